@@ -77,6 +77,16 @@ func runGenerate(opts *parser.GenerateOptions) error {
 	// Print summary
 	fmt.Printf("Found %d goals and %d prompts\n", len(result.Goals), len(result.Prompts))
 
+	// Compare goal schemas with a previous version of the definitions
+	if opts.Against != "" {
+		baseline, err := parseBaseline(opts.Against, excludeFiles)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Checking schema compatibility against %s...\n", opts.Against)
+		result.Errors = append(result.Errors, parser.CheckSchemaCompatibility(baseline, result, opts.AllowBreaking)...)
+	}
+
 	// Print errors and warnings
 	errorCount := 0
 	warningCount := 0
@@ -122,6 +132,22 @@ func runGenerate(opts *parser.GenerateOptions) error {
 	return nil
 }
 
+// parseBaseline parses the goals and prompts of a previous version of the definitions
+func parseBaseline(dir string, excludeFiles []string) (*parser.ParseResult, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("baseline directory does not exist: %s", dir)
+	}
+	goResult, err := parser.ParseGoFilesWithExclusions(dir, excludeFiles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse baseline Go files: %w", err)
+	}
+	configResult, err := parser.ParseConfigFiles(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse baseline config files: %w", err)
+	}
+	return parser.MergeResults(goResult, configResult), nil
+}
+
 // setSmartDefaults sets intelligent defaults based on project structure
 func setSmartDefaults(opts *parser.GenerateOptions) error {
 	// Set input directory default
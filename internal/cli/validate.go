@@ -13,7 +13,10 @@ func NewValidateCommand() *cobra.Command {
 		Use:   "validate",
 		Short: "Validate goal and prompt definitions without generating code",
 		Long: `Validate scans the current directory for LLM goal and prompt definitions
-and validates them for correctness without generating any code.`,
+and validates them for correctness without generating any code.
+
+With --against, goal schemas are compared with a previous version of the
+definitions (e.g. a checkout of the main branch) and breaking changes fail.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			opts.Validate = true
 			return runGenerate(&opts)
@@ -22,6 +25,8 @@ and validates them for correctness without generating any code.`,
 
 	cmd.Flags().StringVarP(&opts.InputDir, "input", "i", ".", "Input directory to scan for goals and prompts")
 	cmd.Flags().StringVarP(&opts.ConfigFile, "config", "c", "", "Specific config file to use (optional)")
+	cmd.Flags().StringVar(&opts.Against, "against", "", "Previous version of the definitions to check goal schemas for breaking changes")
+	cmd.Flags().BoolVar(&opts.AllowBreaking, "allow-breaking", false, "Report breaking schema changes as warnings instead of errors")
 
 	return cmd
 }
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/llmang/llmango/internal/parser"
+)
+
+func TestValidateAgainstBaseline(t *testing.T) {
+	writeConfig := func(dir, outputSchema string) {
+		t.Helper()
+		config := `
+goals:
+  - uid: "triage"
+    title: "Triage"
+    input_type: "TriageInput"
+    output_type: "TriageOutput"
+    input_example:
+      text: "example"
+    output_schema: ` + outputSchema + `
+`
+		if err := os.WriteFile(filepath.Join(dir, "llmango.yaml"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	baselineDir, currentDir := t.TempDir(), t.TempDir()
+	writeConfig(baselineDir, `{"type": "object", "properties": {"label": {"type": "string"}}, "required": ["label"]}`)
+
+	run := func(allowBreaking bool) error {
+		return runGenerate(&parser.GenerateOptions{
+			InputDir:      currentDir,
+			GoSourceDir:   currentDir,
+			OutputFile:    filepath.Join(currentDir, "mango.go"),
+			Validate:      true,
+			Against:       baselineDir,
+			AllowBreaking: allowBreaking,
+		})
+	}
+
+	// Adding an optional field is compatible
+	writeConfig(currentDir, `{"type": "object", "properties": {"label": {"type": "string"}, "reason": {"type": "string"}}, "required": ["label"]}`)
+	if err := run(false); err != nil {
+		t.Errorf("Compatible changes should validate: %v", err)
+	}
+
+	// Making the label optional breaks readers
+	writeConfig(currentDir, `{"type": "object", "properties": {"label": {"type": "string"}}}`)
+	if err := run(false); err == nil || !strings.Contains(err.Error(), "found 1 errors") {
+		t.Errorf("Breaking changes should fail validation, got %v", err)
+	}
+	if err := run(true); err != nil {
+		t.Errorf("Breaking changes should only warn with --allow-breaking: %v", err)
+	}
+}
@@ -143,8 +143,8 @@ func TestGenerateUniqueMethodName(t *testing.T) {
 
 func TestValidateGoalPromptRelationships(t *testing.T) {
 	tests := []struct {
-		name          string
-		result        *parser.ParseResult
+		name           string
+		result         *parser.ParseResult
 		expectedErrors int
 	}{
 		{
@@ -315,4 +315,47 @@ func TestGenerateMangoFileWithConfigGoals(t *testing.T) {
 	if !strings.Contains(contentStr, "var configPrompt = llmango.Prompt{") {
 		t.Error("Generated file should contain config prompt variable")
 	}
-}
\ No newline at end of file
+}
+
+func TestGenerateMangoFileWithConfigSchemaGoal(t *testing.T) {
+	result := &parser.ParseResult{
+		Goals: []parser.DiscoveredGoal{
+			{
+				UID:              "schema-goal",
+				Title:            "Schema Goal",
+				InputType:        "SchemaInput",
+				OutputType:       "SchemaOutput",
+				InputExampleJSON: `{"text":"example"}`,
+				OutputSchemaJSON: `{"type":"object","properties":{"label":{"type":"string"}},"required":["label"]}`,
+				VarName:          "schemaGoal",
+				SourceType:       "config",
+			},
+		},
+	}
+
+	tmpDir, err := os.MkdirTemp("", "llmango_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	outputFile := filepath.Join(tmpDir, "mango.go")
+	if err := GenerateMangoFile(result, &parser.GenerateOptions{OutputFile: outputFile, PackageName: "testmango"}); err != nil {
+		t.Fatalf("GenerateMangoFile failed: %v", err)
+	}
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read generated file: %v", err)
+	}
+
+	contentStr := string(content)
+	if !strings.Contains(contentStr, "OutputSchema:  json.RawMessage(`{\"type\":\"object\"") {
+		t.Error("Generated goal should contain the output schema")
+	}
+	if !strings.Contains(contentStr, "IsSchemaValidated: true") {
+		t.Error("Generated goal with a schema should be schema validated")
+	}
+	if strings.Contains(contentStr, "InputSchema:") {
+		t.Error("Generated goal should not contain an empty input schema")
+	}
+}
@@ -81,6 +81,15 @@ var {{.VarName}} = llmango.Goal{
 	Description: "{{.Description}}",
 	InputExample:  json.RawMessage(` + "`" + `{{.InputExampleJSON}}` + "`" + `),
 	OutputExample: json.RawMessage(` + "`" + `{{.OutputExampleJSON}}` + "`" + `),
+{{- if .InputSchemaJSON}}
+	InputSchema:   json.RawMessage(` + "`" + `{{.InputSchemaJSON}}` + "`" + `),
+{{- end}}
+{{- if .OutputSchemaJSON}}
+	OutputSchema:  json.RawMessage(` + "`" + `{{.OutputSchemaJSON}}` + "`" + `),
+{{- end}}
+{{- if or .InputSchemaJSON .OutputSchemaJSON}}
+	IsSchemaValidated: true,
+{{- end}}
 }
 `
 
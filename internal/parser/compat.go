@@ -0,0 +1,92 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/llmang/llmango/llmango"
+	"github.com/llmang/llmango/openrouter"
+)
+
+// CheckSchemaCompatibility compares the goal schemas of a previous version of the definitions with
+// the current ones. Breaking changes and prompt variables missing from a changed input schema are
+// returned as errors, or warnings when allowBreaking is set, compatible changes are not reported.
+// Goals are matched by UID, goals without a schema or examples (e.g. Go goals) are skipped.
+func CheckSchemaCompatibility(baseline, current *ParseResult, allowBreaking bool) []ParseError {
+	severity := "error"
+	if allowBreaking {
+		severity = "warning"
+	}
+
+	previous := make(map[string]DiscoveredGoal, len(baseline.Goals))
+	for _, goal := range baseline.Goals {
+		previous[goal.UID] = goal
+	}
+
+	var issues []ParseError
+	for _, goal := range current.Goals {
+		old, ok := previous[goal.UID]
+		if !ok {
+			continue
+		}
+		report := func(format string, args ...interface{}) {
+			issues = append(issues, ParseError{
+				File:    goal.SourceFile,
+				Message: fmt.Sprintf("Goal '%s' ", goal.UID) + fmt.Sprintf(format, args...),
+				Type:    severity,
+			})
+		}
+
+		oldInput, err := goalSchema(old.InputSchemaJSON, old.InputExampleJSON)
+		if err != nil {
+			report("has an invalid previous input schema: %v", err)
+			continue
+		}
+		newInput, err := goalSchema(goal.InputSchemaJSON, goal.InputExampleJSON)
+		if err != nil {
+			report("has an invalid input schema: %v", err)
+			continue
+		}
+		oldOutput, err := goalSchema(old.OutputSchemaJSON, old.OutputExampleJSON)
+		if err != nil {
+			report("has an invalid previous output schema: %v", err)
+			continue
+		}
+		newOutput, err := goalSchema(goal.OutputSchemaJSON, goal.OutputExampleJSON)
+		if err != nil {
+			report("has an invalid output schema: %v", err)
+			continue
+		}
+
+		if oldInput != nil && newInput != nil {
+			for _, change := range openrouter.BreakingChanges(openrouter.DiffSchemas(oldInput, newInput, openrouter.SchemaRoleInput)) {
+				report("input schema change breaks callers: %s", change)
+			}
+			for _, prompt := range current.Prompts {
+				if prompt.GoalUID != goal.UID {
+					continue
+				}
+				for _, variable := range llmango.MissingPromptVariables(prompt.Messages, oldInput, newInput) {
+					report("input schema no longer has %s used by prompt '%s'", variable, prompt.UID)
+				}
+			}
+		}
+		if oldOutput != nil && newOutput != nil {
+			for _, change := range openrouter.BreakingChanges(openrouter.DiffSchemas(oldOutput, newOutput, openrouter.SchemaRoleOutput)) {
+				report("output schema change breaks consumers: %s", change)
+			}
+		}
+	}
+	return issues
+}
+
+// goalSchema returns the explicit schema of a goal or one inferred from its example, nil when it has neither
+func goalSchema(schemaJSON, exampleJSON string) (*openrouter.Definition, error) {
+	if schemaJSON != "" {
+		return openrouter.ParseSchema(json.RawMessage(schemaJSON))
+	}
+	if exampleJSON != "" {
+		return openrouter.GenerateSchemaFromJSONExample(json.RawMessage(exampleJSON))
+	}
+	return nil, nil
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+func TestCheckSchemaCompatibility(t *testing.T) {
+	baseline := &ParseResult{Goals: []DiscoveredGoal{
+		{UID: "classify", InputExampleJSON: `{"text": "hi", "lang": "en"}`, OutputSchemaJSON: `{"type":"object","properties":{"label":{"type":"string","enum":["spam","ham"]}},"required":["label"]}`},
+		{UID: "typed", InputType: "TypedInput", OutputType: "TypedOutput"},
+	}}
+	current := &ParseResult{
+		Goals: []DiscoveredGoal{
+			{UID: "classify", SourceFile: "llmango.yaml", InputExampleJSON: `{"text": "hi"}`, OutputSchemaJSON: `{"type":"object","properties":{"label":{"type":"string","enum":["spam","ham","unsure"]},"reason":{"type":"string"}},"required":["label"]}`},
+			{UID: "typed", InputType: "TypedInput", OutputType: "TypedOutput"},
+			{UID: "new-goal", OutputExampleJSON: `{"a": 1}`},
+		},
+		Prompts: []DiscoveredPrompt{
+			{UID: "classify-prompt", GoalUID: "classify", Messages: []openrouter.Message{{Role: "user", Content: "Classify {{text}} ({{lang}})"}}},
+		},
+	}
+
+	issues := CheckSchemaCompatibility(baseline, current, false)
+	if len(issues) != 3 {
+		t.Fatalf("Expected the removed input field, the missing prompt variable and the widened enum, got %v", issues)
+	}
+	for _, issue := range issues {
+		if issue.Type != "error" || issue.File != "llmango.yaml" {
+			t.Errorf("Expected errors in llmango.yaml, got %+v", issue)
+		}
+	}
+	// Schemas inferred from examples don't allow additional properties, callers still sending lang fail
+	if !strings.Contains(issues[0].Message, "input schema change breaks callers: lang: field removed (breaking)") {
+		t.Errorf("Unexpected input issue: %s", issues[0].Message)
+	}
+	if !strings.Contains(issues[1].Message, "no longer has lang used by prompt 'classify-prompt'") {
+		t.Errorf("Unexpected prompt issue: %s", issues[1].Message)
+	}
+	if !strings.Contains(issues[2].Message, "label: enum values added: unsure (breaking)") {
+		t.Errorf("Unexpected output issue: %s", issues[2].Message)
+	}
+
+	for _, issue := range CheckSchemaCompatibility(baseline, current, true) {
+		if issue.Type != "warning" {
+			t.Errorf("Expected warnings with allowBreaking, got %+v", issue)
+		}
+	}
+	if issues := CheckSchemaCompatibility(current, current, false); len(issues) != 0 {
+		t.Errorf("Expected no issues without changes, got %v", issues)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/llmang/llmango/openrouter"
 	"gopkg.in/yaml.v3"
 )
 
@@ -85,6 +86,15 @@ func parseConfigFile(filename string, result *ParseResult) error {
 			IsPointer:   false, // Config goals are generated as values, we'll take their address
 		}
 
+		// Explicit schemas are used for validation and structured output, examples become optional
+		var ok bool
+		if goal.InputSchemaJSON, ok = configSchemaJSON(configGoal.InputSchema, "input_schema", goal.UID, filename, result); !ok {
+			continue
+		}
+		if goal.OutputSchemaJSON, ok = configSchemaJSON(configGoal.OutputSchema, "output_schema", goal.UID, filename, result); !ok {
+			continue
+		}
+
 		// Convert input example to JSON string and validate
 		if configGoal.InputExample != nil {
 			inputJSON, err := json.Marshal(configGoal.InputExample)
@@ -108,7 +118,7 @@ func parseConfigFile(filename string, result *ParseResult) error {
 			}
 			
 			goal.InputExampleJSON = string(inputJSON)
-		} else {
+		} else if goal.InputSchemaJSON == "" {
 			result.Errors = append(result.Errors, ParseError{
 				File:    filename,
 				Message: fmt.Sprintf("Goal '%s' missing required input_example field - add 'input_example: {\"field\": \"value\"}' to your goal definition", goal.UID),
@@ -140,7 +150,7 @@ func parseConfigFile(filename string, result *ParseResult) error {
 			}
 			
 			goal.OutputExampleJSON = string(outputJSON)
-		} else {
+		} else if goal.OutputSchemaJSON == "" {
 			result.Errors = append(result.Errors, ParseError{
 				File:    filename,
 				Message: fmt.Sprintf("Goal '%s' missing required output_example field - add 'output_example: {\"field\": \"value\"}' to your goal definition", goal.UID),
@@ -337,6 +347,27 @@ func MergeResults(goResult, configResult *ParseResult) *ParseResult {
 	return merged
 }
 
+// configSchemaJSON marshals a schema of a config goal and checks that it parses,
+// ok is false when an error has been recorded
+func configSchemaJSON(schema interface{}, field, goalUID, filename string, result *ParseResult) (string, bool) {
+	if schema == nil {
+		return "", true
+	}
+	schemaJSON, err := json.Marshal(schema)
+	if err == nil {
+		_, err = openrouter.ParseSchema(schemaJSON)
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, ParseError{
+			File:    filename,
+			Message: fmt.Sprintf("Goal '%s' has invalid %s: %v", goalUID, field, err),
+			Type:    "error",
+		})
+		return "", false
+	}
+	return string(schemaJSON), true
+}
+
 // hasAtLeastOneField checks if a JSON object has at least one field
 func hasAtLeastOneField(jsonData []byte) bool {
 	var obj map[string]interface{}
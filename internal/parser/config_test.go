@@ -275,4 +275,60 @@ goals:
 	if !errorFound {
 		t.Error("expected error type in parse errors")
 	}
-}
\ No newline at end of file
+}
+
+func TestParseConfigGoalSchemas(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "llmango_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	configYAML := `
+goals:
+  - uid: "schema-goal"
+    title: "Schema Goal"
+    input_type: "SchemaInput"
+    output_type: "SchemaOutput"
+    input_example:
+      text: "example"
+    output_schema:
+      type: object
+      properties:
+        label:
+          type: string
+          enum: [spam, ham]
+      required: [label]
+      additionalProperties: false
+  - uid: "broken-schema-goal"
+    title: "Broken Schema Goal"
+    input_type: "SchemaInput"
+    output_type: "SchemaOutput"
+    input_example:
+      text: "example"
+    output_schema:
+      type: 42
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "llmango.yaml"), []byte(configYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ParseConfigFiles(tmpDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(result.Goals) != 1 {
+		t.Fatalf("expected 1 goal, got %d (errors: %v)", len(result.Goals), result.Errors)
+	}
+
+	goal := result.Goals[0]
+	if goal.OutputSchemaJSON == "" || goal.OutputExampleJSON != "" {
+		t.Errorf("expected the output schema to replace the output example, got schema %q and example %q", goal.OutputSchemaJSON, goal.OutputExampleJSON)
+	}
+	if goal.InputSchemaJSON != "" || goal.InputExampleJSON == "" {
+		t.Errorf("expected the input to keep its example, got schema %q and example %q", goal.InputSchemaJSON, goal.InputExampleJSON)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Type != "error" {
+		t.Errorf("expected one error for the invalid output_schema, got %v", result.Errors)
+	}
+}
@@ -11,6 +11,8 @@ type DiscoveredGoal struct {
 	OutputType       string `json:"output_type" yaml:"output_type"`
 	InputExampleJSON string `json:"input_example_json,omitempty" yaml:"input_example_json,omitempty"`
 	OutputExampleJSON string `json:"output_example_json,omitempty" yaml:"output_example_json,omitempty"`
+	InputSchemaJSON  string `json:"input_schema_json,omitempty" yaml:"input_schema_json,omitempty"`
+	OutputSchemaJSON string `json:"output_schema_json,omitempty" yaml:"output_schema_json,omitempty"`
 	SourceFile       string `json:"source_file" yaml:"source_file"`
 	SourceType       string `json:"source_type" yaml:"source_type"` // "go" or "config"
 	VarName          string `json:"var_name" yaml:"var_name"`       // Variable name in Go code
@@ -73,6 +75,8 @@ type ConfigGoal struct {
 	OutputType   string      `json:"output_type" yaml:"output_type"`
 	InputExample interface{} `json:"input_example,omitempty" yaml:"input_example,omitempty"`
 	OutputExample interface{} `json:"output_example,omitempty" yaml:"output_example,omitempty"`
+	InputSchema  interface{} `json:"input_schema,omitempty" yaml:"input_schema,omitempty"`
+	OutputSchema interface{} `json:"output_schema,omitempty" yaml:"output_schema,omitempty"`
 }
 
 // ConfigPrompt represents a prompt defined in configuration
@@ -95,4 +99,8 @@ type GenerateOptions struct {
 	PackageName  string
 	GoSourceDir  string
 	Validate     bool
+	// Against is a directory with a previous version of the definitions, breaking
+	// schema changes between it and the current goals are reported as errors
+	Against       string
+	AllowBreaking bool // report breaking schema changes as warnings
 }
\ No newline at end of file
@@ -0,0 +1,257 @@
+package llmango
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+)
+
+// DEFAULT_BANDIT_TOTAL_WEIGHT is the weight spread across a goal's prompts when AdaptiveConfig.TotalWeight is unset
+var DEFAULT_BANDIT_TOTAL_WEIGHT = 100
+
+// DEFAULT_BANDIT_SAVE_EVERY is the number of rewards between state saves when AdaptiveConfig.SaveEvery is unset
+var DEFAULT_BANDIT_SAVE_EVERY = 25
+
+// banditSamples is the number of Monte Carlo draws used to estimate each prompt's chance of being best
+const banditSamples = 500
+
+// AdaptiveConfig enables Thompson sampling for a goal. The goal's served prompts are treated
+// as arms of a multi-armed bandit and their weights are recomputed after every reward.
+// Canary and shadow prompts are left alone.
+type AdaptiveConfig struct {
+	FloorWeight  int  `json:"floorWeight"`  // minimum weight so no prompt starves
+	TotalWeight  int  `json:"totalWeight"`  // weight spread across the prompts, defaults to DEFAULT_BANDIT_TOTAL_WEIGHT
+	FeedbackOnly bool `json:"feedbackOnly"` // only learn from Feedback, not from call success
+	SaveEvery    int  `json:"saveEvery"`    // rewards between state saves, defaults to DEFAULT_BANDIT_SAVE_EVERY
+}
+
+// BanditArm is the Beta posterior of a prompt's reward
+type BanditArm struct {
+	Alpha float64 `json:"alpha"`
+	Beta  float64 `json:"beta"`
+	Pulls int     `json:"pulls"`
+}
+
+// recordCallOutcome rewards the prompt with 1 for a valid result and 0 for a failed one.
+// Rate limiting and cancellations say nothing about the prompt and are ignored.
+func (m *LLMangoManager) recordCallOutcome(goal *Goal, promptUID string, err error) {
+	if goal.Adaptive == nil || goal.Adaptive.FeedbackOnly {
+		return
+	}
+	if errors.Is(err, ErrMaxRateLimitRetries) || errors.Is(err, context.Canceled) {
+		return
+	}
+	reward := 1.0
+	if err != nil {
+		reward = 0
+	}
+	m.rewardPrompt(goal, promptUID, reward)
+}
+
+// Feedback records a user reported score in [0,1] for the call that produced the log.
+// The log ID is the OpenRouter generation ID, available as the ID of the response returned by RunRaw.
+// The log must already be written, see Logging.UpdateLog for loggers that write it before the call returns.
+func (m *LLMangoManager) Feedback(logID string, score float64) error {
+	if score < 0 || score > 1 {
+		return fmt.Errorf("feedback score must be between 0 and 1, got %v", score)
+	}
+	if m.Logging == nil || m.Logging.GetLogs == nil {
+		return ErrLoggerNotInitialized
+	}
+
+	limit := 1
+	logs, _, err := m.Logging.GetLogs(&LLmangoLogFilter{LogID: &logID, Limit: &limit})
+	if err != nil {
+		return fmt.Errorf("failed to look up log %s: %w", logID, err)
+	}
+	// Loggers that ignore the LogID filter return other logs, rewarding their prompt would be wrong
+	var entry *LLMangoLog
+	for i := range logs {
+		if logs[i].LogID == logID {
+			entry = &logs[i]
+			break
+		}
+	}
+	if entry == nil {
+		return fmt.Errorf("log %s not found", logID)
+	}
+
+	goal, ok := m.Goals.Get(entry.GoalUID)
+	if !ok {
+		return fmt.Errorf("goal with UID '%s' not found", entry.GoalUID)
+	}
+	if goal.Adaptive == nil {
+		return fmt.Errorf("goal %s does not use adaptive weights", goal.UID)
+	}
+
+	m.rewardPrompt(goal, entry.PromptUID, score)
+	return nil
+}
+
+// rewardPrompt updates the prompt's arm and recomputes the weights of the goal's prompts
+func (m *LLMangoManager) rewardPrompt(goal *Goal, promptUID string, reward float64) {
+	cfg := goal.Adaptive
+
+	m.banditMu.Lock()
+	if m.banditArms == nil {
+		m.banditArms = make(map[string]map[string]*BanditArm)
+	}
+	arms := m.banditArms[goal.UID]
+	if arms == nil {
+		arms = make(map[string]*BanditArm)
+		m.banditArms[goal.UID] = arms
+	}
+	arm := arms[promptUID]
+	if arm == nil {
+		arm = &BanditArm{Alpha: 1, Beta: 1}
+		arms[promptUID] = arm
+	}
+	arm.Alpha += reward
+	arm.Beta += 1 - reward
+	arm.Pulls++
+
+	m.banditRewards++
+	saveEvery := cfg.SaveEvery
+	if saveEvery <= 0 {
+		saveEvery = DEFAULT_BANDIT_SAVE_EVERY
+	}
+	shouldSave := m.banditRewards%saveEvery == 0
+
+	m.applyBanditWeights(goal, arms)
+	m.banditMu.Unlock()
+
+	if shouldSave && m.SaveState != nil {
+		if err := m.SaveState(); err != nil {
+			log.Printf("WARN: SaveState failed after bandit update for goal %s: %v", goal.UID, err)
+		}
+	}
+}
+
+// applyBanditWeights sets each arm's weight to the floor plus its share of the remaining
+// weight, proportional to the estimated probability that it is the best prompt.
+// Prompts with weight 0, disabled by an operator or retired by a canary promotion, are not
+// arms, and the weight held by canaries is left to the canary controller.
+// Must be called with banditMu held.
+func (m *LLMangoManager) applyBanditWeights(goal *Goal, arms map[string]*BanditArm) {
+	m.weightMu.Lock()
+	defer m.weightMu.Unlock()
+
+	var prompts []*Prompt
+	var posteriors []BanditArm
+	canaryWeight := 0
+	for _, promptUID := range goal.PromptUIDs {
+		prompt, ok := m.Prompts.Get(promptUID)
+		if !ok || prompt == nil || prompt.IsShadow || prompt.Weight <= 0 {
+			continue
+		}
+		if prompt.IsCanary {
+			canaryWeight += prompt.Weight
+			continue
+		}
+		prompts = append(prompts, prompt)
+		if arm := arms[promptUID]; arm != nil {
+			posteriors = append(posteriors, *arm)
+		} else {
+			posteriors = append(posteriors, BanditArm{Alpha: 1, Beta: 1})
+		}
+	}
+	if len(prompts) == 0 {
+		return
+	}
+
+	total := goal.Adaptive.TotalWeight
+	if total <= 0 {
+		total = DEFAULT_BANDIT_TOTAL_WEIGHT
+	}
+	floor := max(goal.Adaptive.FloorWeight, 1)
+	spread := max(total-canaryWeight-floor*len(prompts), 0)
+
+	for i, share := range probabilityOfBest(posteriors, banditSamples) {
+		prompts[i].Weight = floor + int(math.Round(share*float64(spread)))
+	}
+}
+
+// probabilityOfBest estimates for every arm the probability that its reward rate is the highest
+func probabilityOfBest(arms []BanditArm, samples int) []float64 {
+	wins := make([]float64, len(arms))
+	for range samples {
+		best := 0
+		bestDraw := -1.0
+		for i, arm := range arms {
+			draw := sampleBeta(arm.Alpha, arm.Beta)
+			if draw > bestDraw {
+				best = i
+				bestDraw = draw
+			}
+		}
+		wins[best]++
+	}
+	for i := range wins {
+		wins[i] /= float64(samples)
+	}
+	return wins
+}
+
+// sampleBeta draws from Beta(a, b) using two Gamma draws
+func sampleBeta(a, b float64) float64 {
+	x := sampleGamma(a)
+	y := sampleGamma(b)
+	if x+y == 0 {
+		return 0.5
+	}
+	return x / (x + y)
+}
+
+// sampleGamma draws from Gamma(shape, 1) using the Marsaglia and Tsang method
+func sampleGamma(shape float64) float64 {
+	if shape < 1 {
+		// Boost small shapes, Gamma(a) = Gamma(a+1) * U^(1/a)
+		return sampleGamma(shape+1) * math.Pow(rand.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := rand.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := rand.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
+
+// BanditArms returns a copy of the learned arms keyed by goal UID and prompt UID
+func (m *LLMangoManager) BanditArms() map[string]map[string]BanditArm {
+	m.banditMu.Lock()
+	defer m.banditMu.Unlock()
+
+	result := make(map[string]map[string]BanditArm, len(m.banditArms))
+	for goalUID, arms := range m.banditArms {
+		result[goalUID] = make(map[string]BanditArm, len(arms))
+		for promptUID, arm := range arms {
+			result[goalUID][promptUID] = *arm
+		}
+	}
+	return result
+}
+
+// SetBanditArms replaces the learned arms, used when loading saved state
+func (m *LLMangoManager) SetBanditArms(arms map[string]map[string]BanditArm) {
+	m.banditMu.Lock()
+	defer m.banditMu.Unlock()
+
+	m.banditArms = make(map[string]map[string]*BanditArm, len(arms))
+	for goalUID, goalArms := range arms {
+		m.banditArms[goalUID] = make(map[string]*BanditArm, len(goalArms))
+		for promptUID, arm := range goalArms {
+			m.banditArms[goalUID][promptUID] = &arm
+		}
+	}
+}
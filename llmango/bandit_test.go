@@ -0,0 +1,198 @@
+package llmango
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/openrouter/openroutertest"
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func TestProbabilityOfBest(t *testing.T) {
+	shares := probabilityOfBest([]BanditArm{
+		{Alpha: 90, Beta: 10},
+		{Alpha: 10, Beta: 90},
+	}, 1000)
+	testhelpers.AssertTrue(t, shares[0] > 0.95, "Clearly better arm should almost always win, got %v", shares[0])
+	testhelpers.AssertTrue(t, shares[0]+shares[1] > 0.999 && shares[0]+shares[1] < 1.001, "Shares should sum to 1")
+}
+
+func TestSampleBetaRange(t *testing.T) {
+	for _, params := range [][2]float64{{1, 1}, {0.5, 0.5}, {20, 3}} {
+		for range 100 {
+			v := sampleBeta(params[0], params[1])
+			testhelpers.AssertTrue(t, v >= 0 && v <= 1, "Beta sample out of range: %v", v)
+		}
+	}
+}
+
+func TestAdaptiveWeightsFollowRewards(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	goal.Adaptive = &AdaptiveConfig{FloorWeight: 5}
+	good := createTestPrompt("openai/gpt-4o", "good")
+	bad := createTestPrompt("openai/gpt-4o-mini", "bad")
+
+	manager.AddGoals(goal)
+	manager.AddPrompts(good, bad)
+	goal.PromptUIDs = []string{good.UID, bad.UID}
+
+	for range 30 {
+		manager.recordCallOutcome(goal, good.UID, nil)
+		manager.recordCallOutcome(goal, bad.UID, errors.New("output validation failed"))
+	}
+
+	testhelpers.AssertTrue(t, good.Weight > 80, "Rewarded prompt should get most traffic, got %d", good.Weight)
+	testhelpers.AssertEqual(t, 5, bad.Weight, "Failing prompt should keep the floor weight")
+
+	arms := manager.BanditArms()
+	testhelpers.AssertEqual(t, 30, arms[goal.UID][good.UID].Pulls, "Every outcome should be counted")
+
+	// Rate limiting is not the prompt's fault
+	manager.recordCallOutcome(goal, bad.UID, ErrMaxRateLimitRetries)
+	testhelpers.AssertEqual(t, 30, manager.BanditArms()[goal.UID][bad.UID].Pulls, "Rate limit errors should not be rewarded")
+}
+
+func TestAdaptiveWeightsKeepDisabledAndCanaryWeights(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	goal.Adaptive = &AdaptiveConfig{FloorWeight: 5}
+	first := createTestPrompt("openai/gpt-4o", "first")
+	second := createTestPrompt("openai/gpt-4o-mini", "second")
+	retired := createTestPrompt("openai/gpt-4o", "retired")
+	retired.Weight = 0
+	canary := createTestPrompt("anthropic/claude-3-sonnet", "canary")
+	canary.IsCanary = true
+	canary.Weight = 30
+
+	manager.AddGoals(goal)
+	manager.AddPrompts(first, second, retired, canary)
+	goal.PromptUIDs = []string{first.UID, second.UID, retired.UID, canary.UID}
+
+	for range 10 {
+		manager.recordCallOutcome(goal, first.UID, nil)
+		manager.recordCallOutcome(goal, retired.UID, nil)
+	}
+
+	testhelpers.AssertEqual(t, 0, retired.Weight, "Prompts with weight 0 should stay disabled")
+	testhelpers.AssertEqual(t, 30, canary.Weight, "The canary's weight should be left to the canary controller")
+	testhelpers.AssertTrue(t, first.Weight > second.Weight, "Rewarded prompt should get more traffic")
+	sum := first.Weight + second.Weight
+	testhelpers.AssertTrue(t, sum >= 69 && sum <= 71, "Only the weight the canary doesn't hold should be spread, got %d", sum)
+}
+
+func TestAdaptiveWeightsWhileSelecting(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	goal.Adaptive = &AdaptiveConfig{}
+	first := createTestPrompt("openai/gpt-4o", "first")
+	second := createTestPrompt("openai/gpt-4o-mini", "second")
+	manager.AddGoals(goal)
+	manager.AddPrompts(first, second)
+	goal.PromptUIDs = []string{first.UID, second.UID}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range 200 {
+			manager.recordCallOutcome(goal, goal.PromptUIDs[i%2], nil)
+		}
+	}()
+	for range 200 {
+		_, err := manager.selectPromptForGoal(goal)
+		testhelpers.RequireNoError(t, err, "Selection should succeed while weights change")
+	}
+	wg.Wait()
+}
+
+func TestFeedbackUsesLogPrompt(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	goal.Adaptive = &AdaptiveConfig{FeedbackOnly: true}
+	prompt := createTestPrompt("openai/gpt-4o", "prompt")
+	manager.AddGoals(goal)
+	manager.AddPrompts(prompt)
+	goal.PromptUIDs = []string{prompt.UID}
+
+	manager.Logging = &Logging{
+		GetLogs: func(filter *LLmangoLogFilter) ([]LLMangoLog, int, error) {
+			if filter.LogID == nil || *filter.LogID != "gen-123" {
+				return nil, 0, nil
+			}
+			return []LLMangoLog{{LogID: "gen-123", GoalUID: goal.UID, PromptUID: prompt.UID}}, 1, nil
+		},
+	}
+
+	manager.recordCallOutcome(goal, prompt.UID, nil)
+	testhelpers.AssertEqual(t, 0, len(manager.BanditArms()), "Feedback only goals should ignore call outcomes")
+
+	testhelpers.RequireNoError(t, manager.Feedback("gen-123", 0.8), "Feedback should be recorded")
+	arm := manager.BanditArms()[goal.UID][prompt.UID]
+	testhelpers.AssertEqual(t, 1.8, arm.Alpha, "Score should be added to alpha")
+
+	testhelpers.AssertError(t, manager.Feedback("gen-404", 1), "Unknown log should fail")
+	testhelpers.AssertError(t, manager.Feedback("gen-123", 2), "Out of range score should fail")
+
+	// A logger ignoring the LogID filter returns the latest log instead
+	manager.Logging.GetLogs = func(filter *LLmangoLogFilter) ([]LLMangoLog, int, error) {
+		return []LLMangoLog{{LogID: "gen-123", GoalUID: goal.UID, PromptUID: prompt.UID}}, 1, nil
+	}
+	testhelpers.AssertError(t, manager.Feedback("gen-456", 1), "A log with another ID should not be rewarded")
+	testhelpers.AssertEqual(t, 1.8, manager.BanditArms()[goal.UID][prompt.UID].Alpha, "The prompt of another log should not be rewarded")
+}
+
+func TestFeedbackRightAfterRun(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	goal.Adaptive = &AdaptiveConfig{FeedbackOnly: true}
+	server.Script("openai/gpt-4o", openroutertest.Reply{MatchSchema: true})
+
+	var mu sync.Mutex
+	var logs []LLMangoLog
+	updated := make(chan LLMangoLog, 1)
+	manager.WithLogging(&Logging{
+		LogResponse: func(entry *LLMangoLog) error {
+			mu.Lock()
+			defer mu.Unlock()
+			logs = append(logs, *entry)
+			return nil
+		},
+		GetLogs: func(filter *LLmangoLogFilter) ([]LLMangoLog, int, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var matching []LLMangoLog
+			for _, entry := range logs {
+				if filter.LogID == nil || entry.LogID == *filter.LogID {
+					matching = append(matching, entry)
+				}
+			}
+			return matching, len(matching), nil
+		},
+		UpdateLog: func(entry *LLMangoLog) error {
+			updated <- *entry
+			return nil
+		},
+	})
+
+	_, response, err := RunRaw[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed")
+	testhelpers.RequireNoError(t, manager.Feedback(response.ID, 1), "Feedback right after the call should find its log")
+
+	select {
+	case entry := <-updated:
+		testhelpers.AssertEqual(t, response.ID, entry.LogID, "The logged entry should be updated")
+		testhelpers.AssertFalse(t, entry.CostEstimated, "The update should carry the reconciled cost")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the reconciled cost to be stored with UpdateLog")
+	}
+}
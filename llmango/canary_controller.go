@@ -0,0 +1,338 @@
+package llmango
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+)
+
+// CanaryAction is the outcome of evaluating a canary prompt
+type CanaryAction string
+
+const (
+	CanaryPromote  CanaryAction = "promote"
+	CanaryRollback CanaryAction = "rollback"
+	CanaryHold     CanaryAction = "hold"
+)
+
+// CanaryPolicy holds the thresholds used by the canary controller.
+// Thresholds left at zero disable the corresponding check.
+type CanaryPolicy struct {
+	MinRuns int `json:"minRuns"` // canary calls needed in the evaluation window before deciding
+
+	MaxErrorRateIncrease             float64 `json:"maxErrorRateIncrease"`             // absolute increase over the base error rate
+	MaxValidationFailureRateIncrease float64 `json:"maxValidationFailureRateIncrease"` // absolute increase over the base validation failure rate
+	MaxLatencyRatio                  float64 `json:"maxLatencyRatio"`                  // canary average latency divided by base average latency
+	MaxCostRatio                     float64 `json:"maxCostRatio"`                     // canary average cost divided by base average cost
+
+	PromotionStep float64 `json:"promotionStep"` // share of traffic moved to the canary per promotion, in (0,1]
+	LogLimit      int     `json:"logLimit"`      // max logs read per prompt during an evaluation
+}
+
+// DefaultCanaryPolicy returns a conservative policy that promotes in quarters
+func DefaultCanaryPolicy() CanaryPolicy {
+	return CanaryPolicy{
+		MinRuns:                          50,
+		MaxErrorRateIncrease:             0.02,
+		MaxValidationFailureRateIncrease: 0.02,
+		MaxLatencyRatio:                  1.5,
+		MaxCostRatio:                     2,
+		PromotionStep:                    0.25,
+		LogLimit:                         1000,
+	}
+}
+
+// PromptMetrics summarizes the logs of one or more prompts
+type PromptMetrics struct {
+	Calls                 int     `json:"calls"`
+	ErrorRate             float64 `json:"errorRate"`
+	ValidationFailureRate float64 `json:"validationFailureRate"`
+	AvgLatency            float64 `json:"avgLatency"`
+	AvgCost               float64 `json:"avgCost"`
+}
+
+// CanaryDecision is a single entry of the canary audit trail
+type CanaryDecision struct {
+	Timestamp       int            `json:"timestamp"`
+	GoalUID         string         `json:"goalUID"`
+	CanaryPromptUID string         `json:"canaryPromptUID"`
+	BasePromptUIDs  []string       `json:"basePromptUIDs"`
+	Action          CanaryAction   `json:"action"`
+	Reason          string         `json:"reason"`
+	Canary          PromptMetrics  `json:"canary"`
+	Base            PromptMetrics  `json:"base"`
+	Weights         map[string]int `json:"weights,omitempty"` // prompt weights after the decision was applied
+}
+
+// validationErrorMarkers identify log errors caused by an invalid model output rather than a failed request
+var validationErrorMarkers = []string{
+	"output validation failed",
+	"failed to decode response content",
+	"failed to extract valid JSON",
+}
+
+// computePromptMetrics aggregates calls, error rates, latency and cost over a set of logs
+func computePromptMetrics(logs []LLMangoLog) PromptMetrics {
+	metrics := PromptMetrics{Calls: len(logs)}
+	if len(logs) == 0 {
+		return metrics
+	}
+
+	var errors, validationFailures int
+	var latency, cost float64
+	for _, entry := range logs {
+		latency += entry.RequestTime
+		cost += entry.Cost
+		if entry.Error == "" {
+			continue
+		}
+		errors++
+		for _, marker := range validationErrorMarkers {
+			if strings.Contains(entry.Error, marker) {
+				validationFailures++
+				break
+			}
+		}
+	}
+
+	calls := float64(len(logs))
+	metrics.ErrorRate = float64(errors) / calls
+	metrics.ValidationFailureRate = float64(validationFailures) / calls
+	metrics.AvgLatency = latency / calls
+	metrics.AvgCost = cost / calls
+	return metrics
+}
+
+// checkCanaryThresholds returns a description of every threshold the canary breaches
+func checkCanaryThresholds(policy CanaryPolicy, canary, base PromptMetrics) []string {
+	var breaches []string
+	if policy.MaxErrorRateIncrease > 0 && canary.ErrorRate > base.ErrorRate+policy.MaxErrorRateIncrease {
+		breaches = append(breaches, fmt.Sprintf("error rate %.3f exceeds base %.3f by more than %.3f", canary.ErrorRate, base.ErrorRate, policy.MaxErrorRateIncrease))
+	}
+	if policy.MaxValidationFailureRateIncrease > 0 && canary.ValidationFailureRate > base.ValidationFailureRate+policy.MaxValidationFailureRateIncrease {
+		breaches = append(breaches, fmt.Sprintf("validation failure rate %.3f exceeds base %.3f by more than %.3f", canary.ValidationFailureRate, base.ValidationFailureRate, policy.MaxValidationFailureRateIncrease))
+	}
+	if policy.MaxLatencyRatio > 0 && base.AvgLatency > 0 && canary.AvgLatency > base.AvgLatency*policy.MaxLatencyRatio {
+		breaches = append(breaches, fmt.Sprintf("average latency %.2fs is more than %.2fx the base %.2fs", canary.AvgLatency, policy.MaxLatencyRatio, base.AvgLatency))
+	}
+	if policy.MaxCostRatio > 0 && base.AvgCost > 0 && canary.AvgCost > base.AvgCost*policy.MaxCostRatio {
+		breaches = append(breaches, fmt.Sprintf("average cost %.6f is more than %.2fx the base %.6f", canary.AvgCost, policy.MaxCostRatio, base.AvgCost))
+	}
+	return breaches
+}
+
+// EvaluateCanaries evaluates every canary prompt of the goal against the goal's base prompts
+// and applies promotions and rollbacks. Only logs since the canary's last decision are
+// considered. Promotions and rollbacks are added to the audit trail, holds are only returned.
+func (m *LLMangoManager) EvaluateCanaries(goalUID string, policy CanaryPolicy) ([]CanaryDecision, error) {
+	if m.Logging == nil || m.Logging.GetLogs == nil {
+		return nil, ErrLoggerNotInitialized
+	}
+	goal, ok := m.Goals.Get(goalUID)
+	if !ok {
+		return nil, fmt.Errorf("goal with UID '%s' not found", goalUID)
+	}
+
+	var canaries, bases []*Prompt
+	m.weightMu.RLock()
+	for _, promptUID := range goal.PromptUIDs {
+		prompt, ok := m.Prompts.Get(promptUID)
+		if !ok || prompt == nil || prompt.IsShadow || prompt.Weight <= 0 {
+			continue
+		}
+		if prompt.IsCanary {
+			canaries = append(canaries, prompt)
+		} else {
+			bases = append(bases, prompt)
+		}
+	}
+	m.weightMu.RUnlock()
+
+	var decisions []CanaryDecision
+	changed := false
+	for _, canary := range canaries {
+		since := canary.CreatedAt
+		if last := m.lastCanaryDecision(canary.UID); last != nil {
+			since = last.Timestamp
+		}
+
+		canaryLogs, err := m.promptLogsSince(canary.UID, since, policy.LogLimit)
+		if err != nil {
+			return decisions, err
+		}
+		var baseLogs []LLMangoLog
+		decision := CanaryDecision{
+			Timestamp:       int(time.Now().Unix()),
+			GoalUID:         goalUID,
+			CanaryPromptUID: canary.UID,
+		}
+		for _, base := range bases {
+			logs, err := m.promptLogsSince(base.UID, since, policy.LogLimit)
+			if err != nil {
+				return decisions, err
+			}
+			baseLogs = append(baseLogs, logs...)
+			decision.BasePromptUIDs = append(decision.BasePromptUIDs, base.UID)
+		}
+		decision.Canary = computePromptMetrics(canaryLogs)
+		decision.Base = computePromptMetrics(baseLogs)
+
+		breaches := checkCanaryThresholds(policy, decision.Canary, decision.Base)
+		m.weightMu.Lock()
+		switch {
+		case decision.Canary.Calls < policy.MinRuns:
+			decision.Action = CanaryHold
+			decision.Reason = fmt.Sprintf("waiting for %d canary calls, have %d", policy.MinRuns, decision.Canary.Calls)
+		case decision.Base.Calls == 0:
+			decision.Action = CanaryHold
+			decision.Reason = "no base prompt traffic to compare against"
+		case len(breaches) > 0:
+			decision.Action = CanaryRollback
+			decision.Reason = strings.Join(breaches, "; ")
+			canary.Weight = 0
+		default:
+			decision.Action = CanaryPromote
+			decision.Reason = shiftCanaryWeights(canary, bases, policy)
+		}
+
+		if decision.Action != CanaryHold {
+			now := int(time.Now().Unix())
+			decision.Weights = map[string]int{canary.UID: canary.Weight}
+			canary.UpdatedAt = now
+			for _, base := range bases {
+				decision.Weights[base.UID] = base.Weight
+				base.UpdatedAt = now
+			}
+		}
+		m.weightMu.Unlock()
+
+		if decision.Action != CanaryHold {
+			m.recordCanaryDecision(decision)
+			changed = true
+			log.Printf("INFO: CANARY: %s canary %s for goal %s: %s", decision.Action, canary.UID, goalUID, decision.Reason)
+		}
+		decisions = append(decisions, decision)
+	}
+
+	if changed && m.SaveState != nil {
+		if err := m.SaveState(); err != nil {
+			log.Printf("WARN: SaveState failed after canary evaluation for goal %s: %v", goalUID, err)
+		}
+	}
+
+	return decisions, nil
+}
+
+// shiftCanaryWeights moves PromotionStep of the traffic from the base prompts to the canary.
+// Once the canary holds all traffic it stops being a canary and the base prompts are disabled.
+// Otherwise the canary gets another MinRuns calls before the next evaluation.
+func shiftCanaryWeights(canary *Prompt, bases []*Prompt, policy CanaryPolicy) string {
+	baseTotal := 0
+	for _, base := range bases {
+		baseTotal += base.Weight
+	}
+	total := canary.Weight + baseTotal
+	step := policy.PromotionStep
+	if step <= 0 || step > 1 {
+		step = 1
+	}
+
+	share := float64(canary.Weight)/float64(total) + step
+	if share >= 1 || baseTotal == 0 {
+		canary.Weight = total
+		canary.IsCanary = false
+		for _, base := range bases {
+			base.Weight = 0
+		}
+		return "all thresholds passed, canary fully promoted"
+	}
+
+	canary.Weight = int(math.Round(share * float64(total)))
+	remaining := total - canary.Weight
+	assigned := 0
+	for i, base := range bases {
+		if i == len(bases)-1 {
+			base.Weight = remaining - assigned
+			break
+		}
+		base.Weight = base.Weight * remaining / baseTotal
+		assigned += base.Weight
+	}
+	canary.MaxRuns = canary.TotalRuns + policy.MinRuns
+	return fmt.Sprintf("all thresholds passed, canary traffic share raised to %.0f%%", share*100)
+}
+
+// promptLogsSince reads up to limit logs of a prompt with a timestamp at or after since
+func (m *LLMangoManager) promptLogsSince(promptUID string, since int, limit int) ([]LLMangoLog, error) {
+	filter := &LLmangoLogFilter{PromptUID: &promptUID, MinTimestamp: &since}
+	if limit > 0 {
+		filter.Limit = &limit
+	}
+	logs, _, err := m.Logging.GetLogs(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs for prompt %s: %w", promptUID, err)
+	}
+	return logs, nil
+}
+
+// StartCanaryController evaluates the canaries of every goal on each tick until ctx is done
+func (m *LLMangoManager) StartCanaryController(ctx context.Context, interval time.Duration, policy CanaryPolicy) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for goalUID := range m.Goals.Snapshot() {
+					if _, err := m.EvaluateCanaries(goalUID, policy); err != nil {
+						log.Printf("WARN: CANARY: evaluation failed for goal %s: %v", goalUID, err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// CanaryAuditTrail returns the recorded canary decisions, optionally filtered by goal
+func (m *LLMangoManager) CanaryAuditTrail(goalUID string) []CanaryDecision {
+	m.canaryMu.Lock()
+	defer m.canaryMu.Unlock()
+
+	var trail []CanaryDecision
+	for _, decision := range m.canaryDecisions {
+		if goalUID == "" || decision.GoalUID == goalUID {
+			trail = append(trail, decision)
+		}
+	}
+	return trail
+}
+
+// SetCanaryAuditTrail replaces the recorded canary decisions, used when loading saved state
+func (m *LLMangoManager) SetCanaryAuditTrail(decisions []CanaryDecision) {
+	m.canaryMu.Lock()
+	defer m.canaryMu.Unlock()
+	m.canaryDecisions = append([]CanaryDecision(nil), decisions...)
+}
+
+func (m *LLMangoManager) recordCanaryDecision(decision CanaryDecision) {
+	m.canaryMu.Lock()
+	defer m.canaryMu.Unlock()
+	m.canaryDecisions = append(m.canaryDecisions, decision)
+}
+
+func (m *LLMangoManager) lastCanaryDecision(promptUID string) *CanaryDecision {
+	m.canaryMu.Lock()
+	defer m.canaryMu.Unlock()
+	for i := len(m.canaryDecisions) - 1; i >= 0; i-- {
+		if m.canaryDecisions[i].CanaryPromptUID == promptUID {
+			decision := m.canaryDecisions[i]
+			return &decision
+		}
+	}
+	return nil
+}
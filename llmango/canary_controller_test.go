@@ -0,0 +1,144 @@
+package llmango
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func fakeCanaryLogging(logsByPrompt map[string][]LLMangoLog) *Logging {
+	return &Logging{
+		GetLogs: func(filter *LLmangoLogFilter) ([]LLMangoLog, int, error) {
+			var logs []LLMangoLog
+			for _, entry := range logsByPrompt[*filter.PromptUID] {
+				if filter.MinTimestamp != nil && entry.Timestamp < *filter.MinTimestamp {
+					continue
+				}
+				if filter.MaxTimestamp != nil && entry.Timestamp > *filter.MaxTimestamp {
+					continue
+				}
+				logs = append(logs, entry)
+			}
+			return logs, len(logs), nil
+		},
+	}
+}
+
+// repeatLogs returns n copies of the entry, entries without a timestamp are written now
+func repeatLogs(n int, entry LLMangoLog) []LLMangoLog {
+	if entry.Timestamp == 0 {
+		entry.Timestamp = int(time.Now().Unix())
+	}
+	logs := make([]LLMangoLog, n)
+	for i := range logs {
+		logs[i] = entry
+	}
+	return logs
+}
+
+func setupCanaryGoal(t *testing.T) (*LLMangoManager, *Goal, *Prompt, *Prompt) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	base := createTestPrompt("openai/gpt-4o", "base")
+	base.Weight = 90
+	canary := createTestPrompt("openai/gpt-4o-mini", "canary")
+	canary.Weight = 10
+	canary.IsCanary = true
+	canary.MaxRuns = 100
+
+	manager.AddGoals(goal)
+	manager.AddPrompts(base, canary)
+	goal.PromptUIDs = []string{base.UID, canary.UID}
+	return manager, goal, base, canary
+}
+
+func TestEvaluateCanariesRollsBackOnErrorRate(t *testing.T) {
+	manager, goal, base, canary := setupCanaryGoal(t)
+
+	canaryLogs := repeatLogs(40, LLMangoLog{RequestTime: 1, Cost: 0.001})
+	canaryLogs = append(canaryLogs, repeatLogs(10, LLMangoLog{RequestTime: 1, Cost: 0.001, Error: "output validation failed for goal 'x'"})...)
+	manager.Logging = fakeCanaryLogging(map[string][]LLMangoLog{
+		base.UID:   repeatLogs(100, LLMangoLog{RequestTime: 1, Cost: 0.001}),
+		canary.UID: canaryLogs,
+	})
+
+	decisions, err := manager.EvaluateCanaries(goal.UID, DefaultCanaryPolicy())
+	testhelpers.RequireNoError(t, err, "Evaluation should succeed")
+	testhelpers.AssertEqual(t, 1, len(decisions), "One canary should be evaluated")
+	testhelpers.AssertEqual(t, CanaryRollback, decisions[0].Action, "Canary breaching the error rate should be rolled back")
+	testhelpers.AssertEqual(t, 0.2, decisions[0].Canary.ValidationFailureRate, "Validation failures should be counted")
+	testhelpers.AssertEqual(t, 0, canary.Weight, "Rolled back canary should stop serving")
+	testhelpers.AssertEqual(t, 90, base.Weight, "Base weight should be unchanged")
+	testhelpers.AssertEqual(t, 1, len(manager.CanaryAuditTrail(goal.UID)), "Rollback should be recorded in the audit trail")
+}
+
+func TestEvaluateCanariesPromotesInSteps(t *testing.T) {
+	manager, goal, base, canary := setupCanaryGoal(t)
+
+	manager.Logging = fakeCanaryLogging(map[string][]LLMangoLog{
+		base.UID:   repeatLogs(100, LLMangoLog{RequestTime: 1, Cost: 0.001}),
+		canary.UID: repeatLogs(50, LLMangoLog{RequestTime: 1.2, Cost: 0.0012}),
+	})
+
+	decisions, err := manager.EvaluateCanaries(goal.UID, DefaultCanaryPolicy())
+	testhelpers.RequireNoError(t, err, "Evaluation should succeed")
+	testhelpers.AssertEqual(t, CanaryPromote, decisions[0].Action, "Healthy canary should be promoted")
+	testhelpers.AssertEqual(t, 35, canary.Weight, "Canary share should grow by one step")
+	testhelpers.AssertEqual(t, 65, base.Weight, "Base should give up the shifted weight")
+	testhelpers.AssertTrue(t, canary.IsCanary, "Partially promoted prompt should remain a canary")
+
+	for range 3 {
+		// Only logs written after the last decision are evaluated
+		manager.Logging = fakeCanaryLogging(map[string][]LLMangoLog{
+			base.UID:   repeatLogs(100, LLMangoLog{RequestTime: 1, Cost: 0.001}),
+			canary.UID: repeatLogs(50, LLMangoLog{RequestTime: 1.2, Cost: 0.0012}),
+		})
+		_, err = manager.EvaluateCanaries(goal.UID, DefaultCanaryPolicy())
+		testhelpers.RequireNoError(t, err, "Evaluation should succeed")
+	}
+	testhelpers.AssertFalse(t, canary.IsCanary, "Fully promoted prompt should no longer be a canary")
+	testhelpers.AssertEqual(t, 100, canary.Weight, "Fully promoted prompt should take all traffic")
+	testhelpers.AssertEqual(t, 0, base.Weight, "Base prompt should be disabled after full promotion")
+}
+
+func TestEvaluateCanariesHoldsWithoutEnoughRuns(t *testing.T) {
+	manager, goal, base, canary := setupCanaryGoal(t)
+
+	manager.Logging = fakeCanaryLogging(map[string][]LLMangoLog{
+		base.UID:   repeatLogs(100, LLMangoLog{RequestTime: 1}),
+		canary.UID: repeatLogs(5, LLMangoLog{RequestTime: 1, Error: "boom"}),
+	})
+
+	decisions, err := manager.EvaluateCanaries(goal.UID, DefaultCanaryPolicy())
+	testhelpers.RequireNoError(t, err, "Evaluation should succeed")
+	testhelpers.AssertEqual(t, CanaryHold, decisions[0].Action, "Canary without enough runs should be held")
+	testhelpers.AssertEqual(t, 10, canary.Weight, "Held canary should keep its weight")
+	testhelpers.AssertEqual(t, 0, len(manager.CanaryAuditTrail(goal.UID)), "Holds should not be recorded")
+}
+
+func TestEvaluateCanariesRollsBackFailingCanary(t *testing.T) {
+	manager, goal, base, canary := setupCanaryGoal(t)
+	canary.CreatedAt = int(time.Now().Unix()) - 60
+
+	// Calls failing before any response are logged without a response timestamp
+	var canaryLogs []LLMangoLog
+	for range 50 {
+		entry, err := manager.createLogObject(goal.UID, canary.UID, nil, nil, nil, nil, 0.1, false, errors.New("connection refused"))
+		testhelpers.RequireNoError(t, err, "Failed to create log object")
+		canaryLogs = append(canaryLogs, *entry)
+	}
+	manager.Logging = fakeCanaryLogging(map[string][]LLMangoLog{
+		base.UID:   repeatLogs(100, LLMangoLog{RequestTime: 1, Cost: 0.001}),
+		canary.UID: canaryLogs,
+	})
+
+	decisions, err := manager.EvaluateCanaries(goal.UID, DefaultCanaryPolicy())
+	testhelpers.RequireNoError(t, err, "Evaluation should succeed")
+	testhelpers.AssertEqual(t, 50, decisions[0].Canary.Calls, "Failed calls should be counted since the canary was created")
+	testhelpers.AssertEqual(t, CanaryRollback, decisions[0].Action, "A canary that always fails should be rolled back")
+	testhelpers.AssertEqual(t, 0, canary.Weight, "Rolled back canary should stop serving")
+}
@@ -0,0 +1,47 @@
+package llmango
+
+import (
+	"log"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// DEFAULT_TOP_LOGPROBS is the number of alternatives requested per token by RunWithConfidence
+// when the prompt does not set Parameters.TopLogprobs
+var DEFAULT_TOP_LOGPROBS = 5
+
+// ConfidentResult is a goal result together with the confidence of its fields
+type ConfidentResult[R any] struct {
+	Result *R
+	// Confidence holds the confidence of every leaf value by path, e.g. "label" or "items[0].name".
+	// It is nil when the provider returned no logprobs.
+	Confidence map[string]openrouter.FieldConfidence
+}
+
+// Field returns the probability of a field's value, ok is false when the field has no confidence
+func (r *ConfidentResult[R]) Field(path string) (probability float64, ok bool) {
+	confidence, ok := r.Confidence[path]
+	return confidence.Probability, ok
+}
+
+// RunWithConfidence runs the goal with token logprobs enabled and scores every field of the
+// output by the probability of its tokens. It is meant for classification style fields, where
+// a low probability (or a close alternative) flags results worth a second look.
+// Providers that do not return logprobs still produce the result, without confidence.
+func RunWithConfidence[I, R any](l *LLMangoManager, g *Goal, input *I) (*ConfidentResult[R], error) {
+	res, resp, err := runGoal[I, R](l, g, input, runOptions{logprobs: true})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ConfidentResult[R]{Result: res}
+	if len(resp.Choices) > 0 && resp.Choices[0].Logprobs != nil {
+		confidence, err := openrouter.JSONFieldConfidence(resp.Choices[0].Logprobs)
+		if err != nil {
+			log.Printf("Failed to compute field confidence for goal %s: %v", g.UID, err)
+		} else {
+			result.Confidence = confidence
+		}
+	}
+	return result, nil
+}
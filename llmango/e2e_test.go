@@ -0,0 +1,374 @@
+package llmango
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/openrouter"
+	"github.com/llmang/llmango/openrouter/openroutertest"
+	"github.com/llmang/llmango/testhelpers"
+)
+
+type e2eInput struct {
+	Text string `json:"text"`
+}
+
+type e2eOutput struct {
+	Result string `json:"result"`
+}
+
+// newE2EManager creates a manager talking to a fake OpenRouter server with one goal and prompt
+func newE2EManager(t *testing.T, model string) (*LLMangoManager, *Goal, *Prompt, *openroutertest.Server) {
+	t.Helper()
+	server := openroutertest.NewServer()
+	t.Cleanup(server.Close)
+
+	manager, err := CreateLLMangoManger(server.Client())
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := NewGoal("e2e-goal", "E2E Goal", "End to end test goal", e2eInput{Text: "in"}, e2eOutput{Result: "out"})
+	prompt := createTestPrompt(model, "e2e-prompt")
+	prompt.GoalUID = goal.UID
+	prompt.Messages[1].Content = "Process this: {{text}}"
+	manager.AddGoals(goal)
+	manager.AddPrompts(prompt)
+	return manager, goal, prompt, server
+}
+
+func TestRunEndToEndStructuredOutput(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	server.Script("openai/gpt-4o", openroutertest.Reply{MatchSchema: true})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed against the fake server")
+	testhelpers.AssertEqual(t, "example", output.Result, "Output should be decoded from the schema matching reply")
+
+	requests := server.ChatRequests()
+	testhelpers.AssertEqual(t, 1, len(requests), "One chat request should be sent")
+	testhelpers.AssertEqual(t, "Process this: hello", requests[0].Messages[1].Content, "Prompt template should be filled with the input")
+	testhelpers.AssertTrue(t, len(requests[0].ResponseFormat) > 0, "Structured output models should get a response format")
+}
+
+func TestRunEndToEndUniversalPath(t *testing.T) {
+	model := "test/no-structured-output"
+	manager, goal, _, server := newE2EManager(t, model)
+	server.Script(model, openroutertest.Reply{Content: "Sure!\n```json\n{\"result\": \"universal\"}\n```"})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed on the universal path")
+	testhelpers.AssertEqual(t, "universal", output.Result, "Output should be extracted from the text response")
+	testhelpers.AssertEqual(t, 0, len(server.ChatRequests()[0].ResponseFormat), "Universal path should not send a response format")
+}
+
+func TestRunEndToEndRateLimitRetry(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	manager.RetryRateLimit = true
+	server.Script("openai/gpt-4o",
+		openroutertest.Reply{Status: 429, RetryAfter: "1"},
+		openroutertest.Reply{JSON: e2eOutput{Result: "after retry"}},
+	)
+
+	start := time.Now()
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed after retrying the rate limit")
+	testhelpers.AssertEqual(t, "after retry", output.Result, "Output should come from the retried request")
+	testhelpers.AssertEqual(t, 2, len(server.ChatRequests()), "The rate limited request should be retried once")
+	testhelpers.AssertTrue(t, time.Since(start) >= time.Second, "The retry should wait for the Retry-After instead of the shorter backoff, waited %v", time.Since(start))
+
+	// Retry-After is capped so a server can't stall the call
+	defer func(previous time.Duration) { MAX_RETRY_AFTER_DELAY = previous }(MAX_RETRY_AFTER_DELAY)
+	MAX_RETRY_AFTER_DELAY = 50 * time.Millisecond
+	manager, goal, _, server = newE2EManager(t, "openai/gpt-4o")
+	manager.RetryRateLimit = true
+	server.Script("openai/gpt-4o",
+		openroutertest.Reply{Status: 429, RetryAfter: "3600"},
+		openroutertest.Reply{JSON: e2eOutput{Result: "after retry"}},
+	)
+	start = time.Now()
+	_, err = Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed after retrying the rate limit")
+	testhelpers.AssertTrue(t, time.Since(start) < time.Second, "The Retry-After should be capped by MAX_RETRY_AFTER_DELAY")
+
+	manager, goal, _, server = newE2EManager(t, "openai/gpt-4o")
+	server.Script("openai/gpt-4o", openroutertest.Reply{Status: 429})
+	_, err = Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.AssertTrue(t, errors.Is(err, openrouter.ErrRateLimited), "Without retries the rate limit error should be returned")
+}
+
+func TestRunEndToEndHedge(t *testing.T) {
+	manager, goal, prompt, server := newE2EManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 20, Model: "openai/gpt-4o-mini"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{JSON: e2eOutput{Result: "primary"}, Latency: 2 * time.Second})
+	server.Script("openai/gpt-4o-mini", openroutertest.Reply{JSON: e2eOutput{Result: "hedge"}})
+
+	start := time.Now()
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Hedged run should succeed")
+	testhelpers.AssertEqual(t, "hedge", output.Result, "The faster hedge attempt should win")
+	testhelpers.AssertTrue(t, time.Since(start) < time.Second, "The slow primary should not be waited for")
+	testhelpers.AssertEqual(t, 2, len(server.ChatRequests()), "Both attempts should be sent")
+}
+
+func TestRunEndToEndPreflight(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	manager.Preflight = &openrouter.PreflightOptions{}
+	previous := openrouter.DefaultModelCatalog.Models()
+	defer openrouter.DefaultModelCatalog.Set(previous)
+	openrouter.DefaultModelCatalog.Set([]openrouter.ModelInfo{{ID: "openai/gpt-4o", ContextLength: 10, SupportedParameters: []string{"structured_outputs"}}})
+
+	_, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.AssertTrue(t, errors.Is(err, openrouter.ErrContextWindowExceeded), "Oversized requests should fail fast")
+	testhelpers.AssertEqual(t, 0, len(server.ChatRequests()), "Nothing should be sent when the preflight fails")
+}
+
+func TestEmbedEndToEnd(t *testing.T) {
+	server := openroutertest.NewServer()
+	t.Cleanup(server.Close)
+	manager, err := CreateLLMangoManger(server.Client())
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	logs := make(chan *LLMangoLog, 1)
+	manager.WithLogging(&Logging{LogResponse: func(entry *LLMangoLog) error {
+		logs <- entry
+		return nil
+	}})
+
+	dimensions := 12
+	goal := &EmbeddingGoal[e2eInput]{
+		UID:        "embed-goal",
+		Model:      "test/embed",
+		Dimensions: &dimensions,
+		BatchSize:  1,
+		Text:       func(input e2eInput) string { return input.Text },
+	}
+	embedded, err := Embed(manager, goal, []e2eInput{{Text: "first"}, {Text: "second"}})
+	testhelpers.RequireNoError(t, err, "Embed should succeed against the fake server")
+	testhelpers.AssertEqual(t, 2, len(embedded), "Every item should be embedded")
+	testhelpers.AssertEqual(t, "second", embedded[1].Item.Text, "Items should keep their order")
+	testhelpers.AssertEqual(t, 12, len(embedded[1].Vector), "Vectors should have the requested dimensions")
+	testhelpers.AssertEqual(t, 2, len(server.Requests()), "Items should be sent in batches")
+
+	select {
+	case entry := <-logs:
+		testhelpers.AssertEqual(t, "embed-goal", entry.GoalUID, "The call should be logged under the goal")
+		testhelpers.AssertEqual(t, "test/embed", entry.PromptUID, "The model should be logged as the prompt")
+		testhelpers.AssertTrue(t, entry.InputTokens > 0 && entry.Cost > 0, "Tokens and cost should be logged")
+		testhelpers.AssertEqual(t, `{"count":2,"dimensions":12}`, entry.OutputObject, "The output should be summarized")
+	case <-time.After(time.Second):
+		t.Fatal("Expected the embedding call to be logged")
+	}
+
+	server.Script("test/embed", openroutertest.Reply{Status: 402})
+	_, err = Embed(manager, goal, []e2eInput{{Text: "third"}})
+	testhelpers.AssertTrue(t, errors.Is(err, openrouter.ErrInsufficientCredits), "API errors should be returned")
+}
+
+func TestRunWithConfidenceEndToEnd(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	server.Script("openai/gpt-4o",
+		openroutertest.Reply{Logprobs: []openrouter.TokenLogprob{
+			{Token: `{"result": "`},
+			{Token: "pos", Logprob: math.Log(0.8), TopLogprobs: []openrouter.TopLogprob{{Token: "neg", Logprob: math.Log(0.2)}}},
+			{Token: "itive", Logprob: math.Log(0.5)},
+			{Token: `"}`},
+		}},
+		openroutertest.Reply{JSON: e2eOutput{Result: "plain"}},
+	)
+
+	result, err := RunWithConfidence[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "RunWithConfidence should succeed")
+	testhelpers.AssertEqual(t, "positive", result.Result.Result, "The output should be decoded")
+	probability, ok := result.Field("result")
+	testhelpers.AssertTrue(t, ok && math.Abs(probability-0.4) < 1e-9, "The field should be scored by its tokens")
+
+	request := server.ChatRequests()[0]
+	testhelpers.AssertTrue(t, request.Logprobs != nil && *request.Logprobs, "Logprobs should be requested")
+	testhelpers.AssertEqual(t, DEFAULT_TOP_LOGPROBS, *request.TopLogprobs, "Top logprobs should default")
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed")
+	testhelpers.AssertEqual(t, "plain", output.Result, "Plain runs should be unaffected")
+	testhelpers.AssertTrue(t, server.ChatRequests()[1].Logprobs == nil, "Plain runs should not request logprobs")
+}
+
+func TestRunEndToEndValidationErrors(t *testing.T) {
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	schema, err := openrouter.GenerateSchemaForType(e2eOutput{})
+	testhelpers.RequireNoError(t, err, "Failed to generate schema")
+	goal.OutputValidator = func(output json.RawMessage) error {
+		return openrouter.ValidateJSONAgainstSchema(output, schema)
+	}
+	logs := make(chan *LLMangoLog, 1)
+	manager.SkipCostReconciliation = true
+	manager.WithLogging(&Logging{LogResponse: func(entry *LLMangoLog) error {
+		logs <- entry
+		return nil
+	}})
+	server.Script("openai/gpt-4o", openroutertest.Reply{Content: `{"result": 5, "extra": true}`})
+
+	_, err = Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	var violations openrouter.ValidationErrors
+	testhelpers.AssertTrue(t, errors.As(err, &violations), "Validation failures should carry the violations")
+	testhelpers.AssertEqual(t, 2, len(violations), "All violations should be collected")
+	testhelpers.AssertEqual(t, "/result", violations[1].Path, "Violations should have JSON pointer paths")
+
+	select {
+	case entry := <-logs:
+		metadata, _ := entry.Metadata.(map[string]any)
+		logged, _ := metadata["validationErrors"].(openrouter.ValidationErrors)
+		testhelpers.AssertEqual(t, 2, len(logged), "The violations should be logged as metadata")
+	case <-time.After(time.Second):
+		t.Fatal("Expected the failed run to be logged")
+	}
+}
+
+func TestRunEndToEndSchemaGoal(t *testing.T) {
+	manager, _, prompt, server := newE2EManager(t, "openai/gpt-4o")
+	outputSchema := json.RawMessage(`{"type":"object","properties":{"result":{"type":"string","enum":["spam","ham"]}},"required":["result"],"additionalProperties":false}`)
+	goal := NewSchemaGoal("e2e-schema-goal", "E2E Schema Goal", "Goal defined by a schema", nil, outputSchema, json.RawMessage(`{"text":"in"}`), nil)
+	prompt.GoalUID = goal.UID
+	manager.AddGoals(goal)
+	manager.AddPrompts(prompt)
+	server.Script("openai/gpt-4o", openroutertest.Reply{MatchSchema: true}, openroutertest.Reply{Content: `{"result": "eggs"}`})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed for a schema goal")
+	testhelpers.AssertEqual(t, "spam", output.Result, "The reply should be generated from the explicit schema")
+
+	var format struct {
+		JSONSchema struct {
+			Schema json.RawMessage `json:"schema"`
+			Strict bool            `json:"strict"`
+		} `json:"json_schema"`
+	}
+	requests := server.ChatRequests()
+	testhelpers.RequireNoError(t, json.Unmarshal(requests[0].ResponseFormat, &format), "Failed to decode the response format")
+	testhelpers.AssertTrue(t, format.JSONSchema.Strict, "A strict compatible schema should be sent in strict mode")
+	schema, err := openrouter.ParseSchema(format.JSONSchema.Schema)
+	testhelpers.RequireNoError(t, err, "Failed to parse the sent schema")
+	testhelpers.AssertEqual(t, 2, len(schema.Properties["result"].Enum), "The explicit schema should be sent as is")
+
+	_, err = Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.AssertTrue(t, err != nil, "Outputs outside the explicit schema should fail validation")
+}
+
+func TestRunEndToEndProviderStructuredOutput(t *testing.T) {
+	model := "anthropic/claude-sonnet-4"
+	previous := openrouter.DefaultModelCatalog.Models()
+	defer openrouter.DefaultModelCatalog.Set(previous)
+	openrouter.DefaultModelCatalog.Set([]openrouter.ModelInfo{
+		{ID: model, SupportedParameters: []string{"structured_outputs", "tools"}},
+		{ID: "test/json-mode", SupportedParameters: []string{"response_format"}},
+	})
+
+	// Anthropic models answer through a forced tool call
+	manager, goal, _, server := newE2EManager(t, model)
+	server.Script(model, openroutertest.Reply{MatchSchema: true})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should read the result from the tool call")
+	testhelpers.AssertEqual(t, "example", output.Result, "Output should be decoded from the tool call arguments")
+	requests := server.ChatRequests()
+	testhelpers.AssertEqual(t, 0, len(requests[0].ResponseFormat), "Tool mode should not send a response format")
+	testhelpers.AssertEqual(t, 1, len(requests[0].Tools), "Tool mode should send a single tool")
+
+	// Models that only support JSON mode get a json_object response format next to the universal prompt
+	manager, goal, _, server = newE2EManager(t, "test/json-mode")
+	server.Script("test/json-mode", openroutertest.Reply{Content: `{"result": "json mode"}`})
+	output, err = Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed in JSON mode")
+	testhelpers.AssertEqual(t, "json mode", output.Result, "Output should be decoded from the content")
+	testhelpers.AssertEqual(t, `{"type":"json_object"}`, string(server.ChatRequests()[0].ResponseFormat), "JSON mode should be requested")
+}
+
+func TestRunEndToEndStrictSchemaOptionalField(t *testing.T) {
+	// OpenAI strict mode makes the optional note required and nullable, the null it sends is dropped
+	// before the reply is validated against the goal's schema where note is a plain string
+	manager, goal, _, server := newE2EManager(t, "openai/gpt-4o")
+	err := goal.SetSchemas(nil, json.RawMessage(`{"type": "object", "properties": {"result": {"type": "string"}, "note": {"type": "string"}}, "required": ["result"]}`))
+	testhelpers.RequireNoError(t, err, "SetSchemas should accept the schema")
+	server.Script("openai/gpt-4o", openroutertest.Reply{Content: `{"result": "strict", "note": null}`})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should accept a null for the optional field")
+	testhelpers.AssertEqual(t, "strict", output.Result, "Output should be decoded from the content")
+
+	raw, err := manager.ExecuteGoalWithDualPath(goal.UID, json.RawMessage(`{"text": "hello"}`))
+	testhelpers.RequireNoError(t, err, "The dual path router should accept a null for the optional field")
+	testhelpers.AssertEqual(t, `{"result":"strict"}`, string(raw), "The null should be removed from the output")
+
+	responseFormat := string(server.ChatRequests()[0].ResponseFormat)
+	testhelpers.AssertTrue(t, strings.Contains(responseFormat, `"type":["string","null"]`), "The optional field should be sent as nullable")
+}
+
+func TestRunEndToEndRecursiveSchemaGoogle(t *testing.T) {
+	// Gemini can't take recursive schemas, they are described in the universal prompt with JSON mode
+	model := "google/gemini-2.0-flash-001"
+	manager, goal, _, server := newE2EManager(t, model)
+	err := goal.SetSchemas(nil, json.RawMessage(`{"type": "object", "properties": {"result": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#"}}}, "required": ["result"]}`))
+	testhelpers.RequireNoError(t, err, "SetSchemas should accept the recursive schema")
+	server.Script(model, openroutertest.Reply{Content: `{"result": "tree", "children": [{"result": "leaf"}]}`})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should succeed with the universal prompt")
+	testhelpers.AssertEqual(t, "tree", output.Result, "Output should be decoded from the content")
+
+	request := server.ChatRequests()[0]
+	testhelpers.AssertEqual(t, `{"type":"json_object"}`, string(request.ResponseFormat), "JSON mode should be requested instead of the schema")
+	testhelpers.AssertTrue(t, strings.Contains(request.Messages[0].Content, "children"), "The schema should be described in the system prompt")
+}
+
+func TestRunEndToEndUniversalPathRepairsJSON(t *testing.T) {
+	model := "test/no-structured-output"
+	manager, goal, _, server := newE2EManager(t, model)
+	logs := make(chan *LLMangoLog, 1)
+	manager.SkipCostReconciliation = true
+	manager.WithLogging(&Logging{LogResponse: func(entry *LLMangoLog) error {
+		logs <- entry
+		return nil
+	}})
+	server.Script(model, openroutertest.Reply{Content: "Fill in {result} like this: {'result': 'repaired', /* done */}"})
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should repair the JSON of the response")
+	testhelpers.AssertEqual(t, "repaired", output.Result, "Output should be extracted past the braces in the prose")
+
+	select {
+	case entry := <-logs:
+		metadata, _ := entry.Metadata.(map[string]any)
+		repairs, _ := metadata["jsonRepairs"].([]openrouter.JSONRepair)
+		testhelpers.AssertEqual(t, 3, len(repairs), "The applied repairs should be logged")
+	case <-time.After(time.Second):
+		t.Fatal("The run should be logged")
+	}
+}
+
+func TestRunEndToEndToolCallPath(t *testing.T) {
+	// Models without structured output that support tool calling answer through a forced tool call
+	model := "x-ai/grok-beta"
+	manager, goal, _, server := newE2EManager(t, model)
+	server.Script(model,
+		openroutertest.Reply{MatchSchema: true},
+		// Providers that ignore tool_choice answer in the content
+		openroutertest.Reply{Content: "```json\n{\"result\": \"from content\"}\n```"},
+	)
+
+	output, err := Run[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Run should read the result from the tool call")
+	testhelpers.AssertEqual(t, "example", output.Result, "Output should be decoded from the tool call arguments")
+
+	requests := server.ChatRequests()
+	testhelpers.AssertEqual(t, 0, len(requests[0].ResponseFormat), "The tool path should not send a response format")
+	testhelpers.AssertEqual(t, 1, len(requests[0].Tools), "The tool path should send a single tool")
+	choice, _ := json.Marshal(requests[0].ToolChoice)
+	testhelpers.AssertEqual(t, `{"function":{"name":"E2E_Goal"},"type":"function"}`, string(choice), "The tool should be forced")
+
+	raw, err := manager.ExecuteGoalWithDualPath(goal.UID, json.RawMessage(`{"text": "hello"}`))
+	testhelpers.RequireNoError(t, err, "The dual path router should fall back to the content")
+	testhelpers.AssertEqual(t, `{"result": "from content"}`, string(raw), "Output should be extracted from the content")
+	testhelpers.AssertEqual(t, 1, len(server.ChatRequests()[1].Tools), "The router should use the tool path")
+}
@@ -0,0 +1,119 @@
+package llmango
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// EmbeddingGoal describes an embedding call the way a Goal describes a chat call: what is
+// embedded, with which model, and under which UID the calls are logged.
+type EmbeddingGoal[T any] struct {
+	UID        string
+	Model      string
+	Dimensions *int // output size for models that support shortening, model default when nil
+	BatchSize  int  // inputs per request, openrouter.DEFAULT_EMBEDDING_BATCH_SIZE when 0
+
+	// Text returns the text embedded for an item
+	Text func(T) string
+}
+
+// Embedded is an item together with its embedding
+type Embedded[T any] struct {
+	Item   T
+	Vector []float64
+}
+
+// Embed embeds the items of an embedding goal and logs the call with its tokens and cost
+func Embed[T any](l *LLMangoManager, g *EmbeddingGoal[T], items []T) ([]Embedded[T], error) {
+	return EmbedWithContext(context.Background(), l, g, items)
+}
+
+// EmbedWithContext is Embed with a context for cancellation
+func EmbedWithContext[T any](ctx context.Context, l *LLMangoManager, g *EmbeddingGoal[T], items []T) ([]Embedded[T], error) {
+	if l == nil || l.OpenRouter == nil {
+		return nil, errors.New("OpenRouter client is not initialized")
+	}
+	if g == nil || g.Text == nil {
+		return nil, errors.New("embedding goal needs a Text function")
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	texts := make([]string, len(items))
+	for i, item := range items {
+		texts[i] = g.Text(item)
+	}
+	request := &openrouter.EmbeddingRequest{
+		Model:      g.Model,
+		Input:      texts,
+		Dimensions: g.Dimensions,
+		BatchSize:  g.BatchSize,
+	}
+
+	start := time.Now()
+	response, err := l.OpenRouter.CreateEmbeddings(ctx, request)
+	l.logEmbedding(g.UID, request, response, time.Since(start).Seconds(), err)
+	if err != nil {
+		return nil, fmt.Errorf("embedding goal %s failed: %w", g.UID, err)
+	}
+
+	embedded := make([]Embedded[T], len(items))
+	for i, item := range items {
+		embedded[i] = Embedded[T]{Item: item, Vector: response.Data[i].Embedding}
+	}
+	return embedded, nil
+}
+
+// logEmbedding logs an embedding call like a prompt run. The prompt UID is the model since
+// embedding goals have no prompts, and the output is summarized instead of storing the vectors.
+func (mang *LLMangoManager) logEmbedding(goalUID string, request *openrouter.EmbeddingRequest, response *openrouter.EmbeddingResponse, requestTime float64, runErr error) {
+	if mang.Logging == nil || mang.Logging.LogResponse == nil {
+		return
+	}
+
+	inputJSON, _ := json.Marshal(request.Input)
+	logEntry := &LLMangoLog{
+		Timestamp:   int(time.Now().Unix()),
+		GoalUID:     goalUID,
+		PromptUID:   request.Model,
+		InputObject: string(inputJSON),
+		RequestTime: requestTime,
+		Metadata:    map[string]any{"type": "embedding"},
+	}
+	if runErr != nil {
+		logEntry.Error = runErr.Error()
+	}
+
+	if response != nil {
+		logEntry.LogID = response.ID
+		dimensions := 0
+		if len(response.Data) > 0 {
+			dimensions = len(response.Data[0].Embedding)
+		}
+		outputJSON, _ := json.Marshal(map[string]int{"count": len(response.Data), "dimensions": dimensions})
+		logEntry.OutputObject = string(outputJSON)
+
+		if response.Usage != nil {
+			logEntry.InputTokens = response.Usage.PromptTokens
+			if response.Usage.Cost != nil {
+				logEntry.Cost = *response.Usage.Cost
+			} else if cost, ok := openrouter.CostFromUsage(request.Model, &openrouter.ResponseUsage{PromptTokens: response.Usage.PromptTokens}); ok {
+				logEntry.Cost = cost
+				logEntry.CostEstimated = true
+			}
+		}
+	}
+
+	go func(mangoLog *LLMangoLog) {
+		if err := mang.Logging.LogResponse(mangoLog); err != nil {
+			log.Printf("Failed to log embedding for goal %s: %v", goalUID, err)
+		}
+	}(logEntry)
+}
@@ -0,0 +1,264 @@
+package llmango
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// DEFAULT_ENSEMBLE_SIZE is used when an EnsembleConfig does not specify a size
+var DEFAULT_ENSEMBLE_SIZE = 3
+
+// EnsembleMode controls how an ensemble fans out its calls
+type EnsembleMode string
+
+const (
+	// EnsembleModePrompts runs the input through N distinct prompts of the goal
+	EnsembleModePrompts EnsembleMode = "prompts"
+	// EnsembleModeSamples runs a single selected prompt N times
+	EnsembleModeSamples EnsembleMode = "samples"
+)
+
+// EnsembleStrategy controls how the constituent outputs are combined
+type EnsembleStrategy string
+
+const (
+	// EnsembleMajorityVote picks the most common value per top level field
+	EnsembleMajorityVote EnsembleStrategy = "majority"
+	// EnsembleFirstValid returns the first constituent that produced a valid output
+	EnsembleFirstValid EnsembleStrategy = "first_valid"
+	// EnsembleCustom hands all valid outputs to EnsembleConfig.Reducer
+	EnsembleCustom EnsembleStrategy = "custom"
+)
+
+// EnsembleConfig turns a goal into a self-consistency goal that runs several calls
+// concurrently for the same input and combines their typed outputs.
+type EnsembleConfig struct {
+	Mode     EnsembleMode     `json:"mode"`
+	Size     int              `json:"size"`
+	Strategy EnsembleStrategy `json:"strategy"`
+
+	// Reducer combines the valid outputs when Strategy is EnsembleCustom
+	Reducer func(outputs []json.RawMessage) (json.RawMessage, error) `json:"-"`
+}
+
+// EnsembleResult is the combined outcome of an ensemble run.
+// AgreementRate is the average share of valid outputs that agreed with the winning value of each field.
+type EnsembleResult[R any] struct {
+	GroupID       string   `json:"groupID"`
+	Result        *R       `json:"result"`
+	Outputs       []R      `json:"outputs"`    // valid outputs in completion order
+	PromptUIDs    []string `json:"promptUIDs"` // prompt used for each entry in Outputs
+	Errors        []error  `json:"-"`
+	AgreementRate float64  `json:"agreementRate"`
+}
+
+type ensembleCall[R any] struct {
+	promptUID string
+	output    *R
+	err       error
+}
+
+// RunEnsemble fans the input out according to the goal's EnsembleConfig and aggregates the results.
+// Every constituent call is logged with the same GroupID.
+func RunEnsemble[I, R any](l *LLMangoManager, g *Goal, input *I) (*EnsembleResult[R], error) {
+	cfg := g.Ensemble
+	if cfg == nil {
+		return nil, fmt.Errorf("goal %s has no ensemble configuration", g.UID)
+	}
+	if cfg.Strategy == EnsembleCustom && cfg.Reducer == nil {
+		return nil, fmt.Errorf("goal %s uses a custom ensemble strategy without a reducer", g.UID)
+	}
+
+	size := cfg.Size
+	if size <= 0 {
+		size = DEFAULT_ENSEMBLE_SIZE
+	}
+
+	if err := validateGoalInput(g, input); err != nil {
+		return nil, err
+	}
+
+	var prompts []*Prompt
+	switch cfg.Mode {
+	case EnsembleModePrompts:
+		selected, err := l.selectPromptsForGoal(g, size)
+		if err != nil {
+			return nil, err
+		}
+		prompts = selected
+	case EnsembleModeSamples, "":
+		selected, err := l.selectPromptForGoal(g)
+		if err != nil {
+			return nil, err
+		}
+		for range size {
+			prompts = append(prompts, selected)
+		}
+		// Every sample is a run, selection only counted the first one
+		recordCanaryRuns(selected, size-1)
+	default:
+		return nil, fmt.Errorf("unknown ensemble mode %q for goal %s", cfg.Mode, g.UID)
+	}
+
+	opts := runOptions{groupID: newGroupID()}
+	calls := make(chan ensembleCall[R], len(prompts))
+	for _, prompt := range prompts {
+		go func(p *Prompt) {
+			output, _, err := executePrompt[I, R](l, g, p, input, opts)
+			calls <- ensembleCall[R]{promptUID: p.UID, output: output, err: err}
+		}(prompt)
+	}
+
+	result := &EnsembleResult[R]{GroupID: opts.groupID}
+	var rawOutputs []json.RawMessage
+	for range prompts {
+		call := <-calls
+		if call.err != nil {
+			result.Errors = append(result.Errors, call.err)
+			continue
+		}
+		raw, err := json.Marshal(call.output)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Errorf("failed to marshal output from prompt %s: %w", call.promptUID, err))
+			continue
+		}
+		result.Outputs = append(result.Outputs, *call.output)
+		result.PromptUIDs = append(result.PromptUIDs, call.promptUID)
+		rawOutputs = append(rawOutputs, raw)
+	}
+
+	if len(rawOutputs) == 0 {
+		return result, fmt.Errorf("all %d ensemble calls failed for goal %s: %w", len(prompts), g.UID, errors.Join(result.Errors...))
+	}
+
+	majority, agreement, err := aggregateMajority(rawOutputs)
+	if err != nil {
+		return result, err
+	}
+	result.AgreementRate = agreement
+
+	var combined json.RawMessage
+	switch cfg.Strategy {
+	case EnsembleFirstValid:
+		combined = rawOutputs[0]
+	case EnsembleCustom:
+		combined, err = cfg.Reducer(rawOutputs)
+		if err != nil {
+			return result, fmt.Errorf("ensemble reducer failed for goal %s: %w", g.UID, err)
+		}
+	default:
+		combined = majority
+	}
+
+	var res R
+	if err := json.Unmarshal(combined, &res); err != nil {
+		return result, fmt.Errorf("failed to decode combined ensemble output for goal %s: %w", g.UID, err)
+	}
+	result.Result = &res
+
+	return result, nil
+}
+
+// aggregateMajority votes on every top level field of the outputs and returns the winning
+// values together with the average agreement. Outputs that are not all JSON objects are
+// voted on as a whole. Ties go to the value that was seen first.
+func aggregateMajority(outputs []json.RawMessage) (json.RawMessage, float64, error) {
+	if len(outputs) == 0 {
+		return nil, 0, errors.New("no outputs to aggregate")
+	}
+
+	objects := make([]map[string]any, 0, len(outputs))
+	values := make([]any, 0, len(outputs))
+	for _, raw := range outputs {
+		var v any
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return nil, 0, fmt.Errorf("invalid output JSON: %w", err)
+		}
+		values = append(values, v)
+		if obj, ok := v.(map[string]any); ok {
+			objects = append(objects, obj)
+		}
+	}
+
+	if len(objects) != len(values) {
+		winner, votes := voteOnValues(values)
+		return winner, float64(votes) / float64(len(values)), nil
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	for _, obj := range objects {
+		for key := range obj {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	combined := make(map[string]json.RawMessage, len(keys))
+	totalAgreement := 0.0
+	for _, key := range keys {
+		var fieldValues []any
+		for _, obj := range objects {
+			if v, ok := obj[key]; ok {
+				fieldValues = append(fieldValues, v)
+			}
+		}
+		winner, votes := voteOnValues(fieldValues)
+		combined[key] = winner
+		// Outputs that omit the field count as disagreeing with the winner
+		totalAgreement += float64(votes) / float64(len(objects))
+	}
+
+	agreement := 1.0
+	if len(keys) > 0 {
+		agreement = totalAgreement / float64(len(keys))
+	}
+
+	result, err := json.Marshal(combined)
+	if err != nil {
+		return nil, 0, err
+	}
+	return result, agreement, nil
+}
+
+// voteOnValues returns the canonical JSON of the most common value and its vote count
+func voteOnValues(values []any) (json.RawMessage, int) {
+	counts := make(map[string]int)
+	var order []string
+	for _, v := range values {
+		// Marshalling decoded values sorts object keys so equal values encode identically
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			continue
+		}
+		key := string(encoded)
+		if counts[key] == 0 {
+			order = append(order, key)
+		}
+		counts[key]++
+	}
+
+	best := ""
+	bestCount := 0
+	for _, key := range order {
+		if counts[key] > bestCount {
+			best = key
+			bestCount = counts[key]
+		}
+	}
+	return json.RawMessage(best), bestCount
+}
+
+// newGroupID returns a random identifier used to link related log entries
+func newGroupID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return "grp_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,112 @@
+package llmango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/llmang/llmango/openrouter/openroutertest"
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func TestAggregateMajorityPerField(t *testing.T) {
+	outputs := []json.RawMessage{
+		json.RawMessage(`{"label": "spam", "priority": 1}`),
+		json.RawMessage(`{"label": "spam", "priority": 2}`),
+		json.RawMessage(`{"label": "ham", "priority": 2}`),
+	}
+
+	combined, agreement, err := aggregateMajority(outputs)
+	testhelpers.RequireNoError(t, err, "Aggregation should succeed")
+
+	var result map[string]any
+	testhelpers.RequireNoError(t, json.Unmarshal(combined, &result), "Combined output should be valid JSON")
+	testhelpers.AssertEqual(t, "spam", result["label"], "Label should be the majority value")
+	testhelpers.AssertEqual(t, float64(2), result["priority"], "Priority should be the majority value")
+
+	// Each field has 2 of 3 votes
+	testhelpers.AssertTrue(t, agreement > 0.66 && agreement < 0.67, "Agreement should be 2/3, got %v", agreement)
+}
+
+func TestAggregateMajorityMissingFieldsAndTies(t *testing.T) {
+	outputs := []json.RawMessage{
+		json.RawMessage(`{"label": "a", "tags": ["x", "y"]}`),
+		json.RawMessage(`{"label": "b", "tags": ["x", "y"]}`),
+		json.RawMessage(`{"tags": ["x", "y"]}`),
+	}
+
+	combined, agreement, err := aggregateMajority(outputs)
+	testhelpers.RequireNoError(t, err, "Aggregation should succeed")
+
+	var result map[string]any
+	testhelpers.RequireNoError(t, json.Unmarshal(combined, &result), "Combined output should be valid JSON")
+	testhelpers.AssertEqual(t, "a", result["label"], "Ties should go to the first value seen")
+
+	// label: 1/3 agreement, tags: 3/3 agreement
+	testhelpers.AssertTrue(t, agreement > 0.66 && agreement < 0.67, "Agreement should be 2/3, got %v", agreement)
+}
+
+func TestAggregateMajorityNonObjects(t *testing.T) {
+	outputs := []json.RawMessage{
+		json.RawMessage(`"yes"`),
+		json.RawMessage(`"no"`),
+		json.RawMessage(`"yes"`),
+		json.RawMessage(`"yes"`),
+	}
+
+	combined, agreement, err := aggregateMajority(outputs)
+	testhelpers.RequireNoError(t, err, "Aggregation should succeed")
+	testhelpers.AssertEqual(t, `"yes"`, string(combined), "Whole value should be voted on")
+	testhelpers.AssertEqual(t, 0.75, agreement, "Agreement should be 3/4")
+}
+
+func TestSelectPromptsForGoalDistinct(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	prompt1 := createTestPrompt("openai/gpt-4o", "prompt-1")
+	prompt2 := createTestPrompt("openai/gpt-4o-mini", "prompt-2")
+	prompt3 := createTestPrompt("anthropic/claude-3-sonnet", "prompt-3")
+	prompt3.Weight = 0 // disabled prompts are never selected
+
+	manager.AddGoals(goal)
+	manager.AddPrompts(prompt1, prompt2, prompt3)
+	goal.PromptUIDs = []string{prompt1.UID, prompt2.UID, prompt3.UID}
+
+	selected, err := manager.selectPromptsForGoal(goal, 3)
+	testhelpers.RequireNoError(t, err, "Should select prompts successfully")
+	testhelpers.AssertEqual(t, 2, len(selected), "Only prompts with weight should be selected")
+	testhelpers.AssertNotEqual(t, selected[0].UID, selected[1].UID, "Selected prompts should be distinct")
+}
+
+func TestRunEnsembleRequiresReducerForCustomStrategy(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	type input struct {
+		Text string `json:"text"`
+	}
+	type output struct {
+		Result string `json:"result"`
+	}
+
+	goal := createTestTypedGoal()
+	goal.Ensemble = &EnsembleConfig{Mode: EnsembleModeSamples, Strategy: EnsembleCustom}
+
+	_, err = RunEnsemble[input, output](manager, goal, &input{Text: "hello"})
+	testhelpers.AssertError(t, err, "Custom strategy without reducer should fail")
+	testhelpers.AssertContains(t, err.Error(), "reducer", "Error should mention the missing reducer")
+}
+
+func TestRunEnsembleSamplesCountCanaryRuns(t *testing.T) {
+	manager, goal, prompt, server := newE2EManager(t, "openai/gpt-4o")
+	prompt.IsCanary = true
+	prompt.MaxRuns = 10
+	goal.Ensemble = &EnsembleConfig{Mode: EnsembleModeSamples, Size: 3}
+	server.Script("openai/gpt-4o", openroutertest.Reply{JSON: e2eOutput{Result: "sample"}})
+
+	_, err := RunEnsemble[e2eInput, e2eOutput](manager, goal, &e2eInput{Text: "hello"})
+	testhelpers.RequireNoError(t, err, "Ensemble should succeed")
+	testhelpers.AssertEqual(t, 3, len(server.ChatRequests()), "Every sample should be sent")
+	testhelpers.AssertEqual(t, 3, prompt.TotalRuns, "Every sample should count as a canary run")
+}
@@ -3,12 +3,13 @@ package llmango
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
 
 	"github.com/llmang/llmango/openrouter"
 )
 
 // ExecuteGoalWithDualPath executes a goal using the appropriate execution path
-// based on the model's capabilities (structured output vs universal compatibility)
+// based on the model's capabilities (structured output, forced tool call or universal compatibility)
 func (m *LLMangoManager) ExecuteGoalWithDualPath(goalUID string, input json.RawMessage) (json.RawMessage, error) {
 	goal, exists := m.Goals.Get(goalUID)
 	if !exists {
@@ -21,13 +22,13 @@ func (m *LLMangoManager) ExecuteGoalWithDualPath(goalUID string, input json.RawM
 		return nil, fmt.Errorf("failed to select prompt for goal '%s': %w", goalUID, err)
 	}
 
-	// Check if model supports structured output to determine execution path
-	supportsStructuredOutput := openrouter.SupportsStructuredOutput(selectedPrompt.Model)
-
-	// Choose execution path based on model capabilities
-	if supportsStructuredOutput {
+	// Choose execution path based on the model's structured output and tool calling support
+	switch openrouter.SelectStructuredOutputMode(selectedPrompt.Model) {
+	case openrouter.StructuredOutputJSONSchema:
 		return m.executeWithStructuredOutput(goal, selectedPrompt, input)
-	} else {
+	case openrouter.StructuredOutputTool:
+		return m.executeWithToolCall(goal, selectedPrompt, input)
+	default:
 		return m.executeWithUniversalCompatibility(goal, selectedPrompt, input)
 	}
 }
@@ -36,10 +37,8 @@ func (m *LLMangoManager) ExecuteGoalWithDualPath(goalUID string, input json.RawM
 // Enhanced with better error handling and fallback to universal path
 func (m *LLMangoManager) executeWithStructuredOutput(goal *Goal, prompt *Prompt, input json.RawMessage) (json.RawMessage, error) {
 	// Validate input using the goal's validator
-	if goal.InputValidator != nil {
-		if err := goal.InputValidator(input); err != nil {
-			return nil, fmt.Errorf("input validation failed for goal '%s': %w", goal.UID, err)
-		}
+	if err := goal.validateInput(input); err != nil {
+		return nil, fmt.Errorf("input validation failed for goal '%s': %w", goal.UID, err)
 	}
 
 	// Parse messages with input variables
@@ -55,13 +54,19 @@ func (m *LLMangoManager) executeWithStructuredOutput(goal *Goal, prompt *Prompt,
 		Parameters: prompt.Parameters,
 	}
 
-	// Generate JSON schema for structured output using our new JSON-optimized function
-	responseFormat, err := openrouter.UseOpenRouterJsonFormatFromJSON(goal.OutputExample, goal.Title)
+	// Generate the JSON schema for structured output, it is normalized for the model's provider
+	outputSchema, err := goal.outputSchemaDefinition(openrouter.SchemaOptions{Strict: true})
 	if err != nil {
 		return m.executeWithUniversalCompatibility(goal, prompt, input)
 	}
-
-	routerRequest.Parameters.ResponseFormat = responseFormat
+	structured, err := openrouter.NewStructuredOutput(outputSchema, prompt.Model, goal.Title)
+	if err != nil || structured.Mode == openrouter.StructuredOutputJSONObject || structured.Mode == openrouter.StructuredOutputPrompt {
+		// Schemas the provider can't take, like recursive ones for Gemini, are described in the universal prompt
+		return m.executeWithUniversalCompatibility(goal, prompt, input)
+	}
+	if err := structured.Apply(&routerRequest.Parameters); err != nil {
+		return m.executeWithUniversalCompatibility(goal, prompt, input)
+	}
 
 	// Execute request
 	response, err := m.OpenRouter.GenerateNonStreamingChatResponse(routerRequest)
@@ -69,34 +74,112 @@ func (m *LLMangoManager) executeWithStructuredOutput(goal *Goal, prompt *Prompt,
 		return nil, fmt.Errorf("structured output execution failed: %w", err)
 	}
 
-	if len(response.Choices) == 0 || response.Choices[0].Message.Content == nil {
+	if len(response.Choices) == 0 {
 		return nil, fmt.Errorf("received empty response from structured output execution")
 	}
 
-	content := *response.Choices[0].Message.Content
+	content, err := structured.Content(response.Choices[0].Message)
+	if err != nil {
+		return nil, fmt.Errorf("received empty response from structured output execution: %w", err)
+	}
 	outputJSON := json.RawMessage(content)
 
 	// Validate output using the goal's validator
-	if goal.OutputValidator != nil {
-		if err := goal.OutputValidator(outputJSON); err != nil {
-			return nil, fmt.Errorf("output validation failed for goal '%s': %w", goal.UID, err)
-		}
+	if err := goal.validateOutput(outputJSON); err != nil {
+		return nil, fmt.Errorf("output validation failed for goal '%s': %w", goal.UID, err)
 	}
 
 	return outputJSON, nil
 }
 
+// executeWithToolCall exposes the goal's output schema as a single function tool the model is forced to call,
+// the call's arguments are the result. It is used for models that support tool calling but not structured output,
+// and for Anthropic models which answer more reliably through tools.
+func (m *LLMangoManager) executeWithToolCall(goal *Goal, prompt *Prompt, input json.RawMessage) (json.RawMessage, error) {
+	// Validate input using the goal's validator
+	if err := goal.validateInput(input); err != nil {
+		return nil, fmt.Errorf("input validation failed for goal '%s': %w", goal.UID, err)
+	}
+
+	// Tool arguments aren't enforced by every provider, so they are validated against the canonical schema
+	schema, err := goal.outputSchemaDefinition(openrouter.SchemaOptions{})
+	if err != nil || schema == nil {
+		return m.executeWithUniversalCompatibility(goal, prompt, input)
+	}
+	structured, err := openrouter.NewStructuredOutput(schema, prompt.Model, goal.Title)
+	if err != nil || structured.Mode != openrouter.StructuredOutputTool {
+		return m.executeWithUniversalCompatibility(goal, prompt, input)
+	}
+
+	// Parse messages with input variables
+	updatedMessages, err := ParseMessages(input, prompt.Messages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update prompt messages: %w", err)
+	}
+
+	routerRequest := &openrouter.OpenRouterRequest{
+		Messages:   updatedMessages,
+		Model:      &prompt.Model,
+		Parameters: prompt.Parameters,
+	}
+	if err := structured.Apply(&routerRequest.Parameters); err != nil {
+		return m.executeWithUniversalCompatibility(goal, prompt, input)
+	}
+
+	response, err := m.OpenRouter.GenerateNonStreamingChatResponse(routerRequest)
+	if err != nil {
+		return nil, fmt.Errorf("tool call execution failed: %w", err)
+	}
+
+	if len(response.Choices) == 0 {
+		return nil, fmt.Errorf("received empty response from tool call execution")
+	}
+
+	outputJSON, err := toolCallOutput(structured, response.Choices[0].Message, schema)
+	if err != nil {
+		return nil, fmt.Errorf("tool call execution failed: %w", err)
+	}
+	if err := openrouter.ValidateJSONAgainstSchema(outputJSON, schema); err != nil {
+		return nil, fmt.Errorf("response validation failed for tool call path: %w", err)
+	}
+
+	// Validate output using the goal's validator
+	if err := goal.validateOutput(outputJSON); err != nil {
+		return nil, fmt.Errorf("output validation failed for goal '%s': %w", goal.UID, err)
+	}
+
+	return outputJSON, nil
+}
+
+// toolCallOutput returns the arguments of the forced tool call. Some providers ignore tool_choice and answer
+// in the content instead, the JSON is then extracted from it.
+func toolCallOutput(structured *openrouter.StructuredOutput, message openrouter.ResponseMessage, schema *openrouter.Definition) (json.RawMessage, error) {
+	content, err := structured.Content(message)
+	if err == nil {
+		return json.RawMessage(content), nil
+	}
+	if message.Content == nil || *message.Content == "" {
+		return nil, err
+	}
+	extraction, extractErr := openrouter.ExtractJSON(*message.Content, schema)
+	if extractErr != nil {
+		return nil, fmt.Errorf("%w and no JSON in the content", err)
+	}
+	return extraction.JSON, nil
+}
+
 // executeWithUniversalCompatibility uses universal prompts for models that don't support structured output
 func (m *LLMangoManager) executeWithUniversalCompatibility(goal *Goal, prompt *Prompt, input json.RawMessage) (json.RawMessage, error) {
 	// Validate input using the goal's validator
-	if goal.InputValidator != nil {
-		if err := goal.InputValidator(input); err != nil {
-			return nil, fmt.Errorf("input validation failed for goal '%s': %w", goal.UID, err)
-		}
+	if err := goal.validateInput(input); err != nil {
+		return nil, fmt.Errorf("input validation failed for goal '%s': %w", goal.UID, err)
 	}
 
 	// Generate schema for validation from output example
-	schema, err := openrouter.GenerateSchemaFromJSONExample(goal.OutputExample)
+	schema, err := goal.outputSchemaDefinition(openrouter.SchemaOptions{})
+	if err == nil && schema == nil {
+		err = fmt.Errorf("goal '%s' has no output schema or example", goal.UID)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate schema for universal path: %w", err)
 	}
@@ -156,24 +239,21 @@ func (m *LLMangoManager) executeWithUniversalCompatibility(goal *Goal, prompt *P
 
 	content := *response.Choices[0].Message.Content
 
-	// Extract and clean JSON from response using existing cleaner
-	cleanedJSON := openrouter.PseudoStructuredResponseCleaner(content)
-
-	if cleanedJSON == "" {
+	// Extract the JSON from the free-form response, preferring candidates that match the schema
+	extraction, err := openrouter.ExtractJSON(content, schema)
+	if err != nil {
 		return nil, fmt.Errorf("failed to extract valid JSON from response: %s", content)
 	}
 
 	// Validate JSON against schema
-	outputJSON := json.RawMessage(cleanedJSON)
+	outputJSON := extraction.JSON
 	if err := openrouter.ValidateJSONAgainstSchema(outputJSON, schema); err != nil {
 		return nil, fmt.Errorf("response validation failed for universal path: %w", err)
 	}
 
 	// Validate output using the goal's validator
-	if goal.OutputValidator != nil {
-		if err := goal.OutputValidator(outputJSON); err != nil {
-			return nil, fmt.Errorf("output validation failed for goal '%s': %w", goal.UID, err)
-		}
+	if err := goal.validateOutput(outputJSON); err != nil {
+		return nil, fmt.Errorf("output validation failed for goal '%s': %w", goal.UID, err)
 	}
 
 	return outputJSON, nil
@@ -216,12 +296,21 @@ func (m *LLMangoManager) injectUniversalPrompt(messages []openrouter.Message, un
 	return result
 }
 
-// selectPromptForGoal selects a prompt for the given goal using existing logic
-// This is extracted from the existing Run function in requests.go
-func (m *LLMangoManager) selectPromptForGoal(goal *Goal) (*Prompt, error) {
-	validPrompts := make(map[string]*Prompt)
+// weightedPrompt is a prompt with the weight it had when the candidates were collected
+type weightedPrompt struct {
+	prompt *Prompt
+	weight int
+}
+
+// validPromptsForGoal returns the prompts of a goal that can currently serve traffic,
+// along with their combined weight. Canary prompts drop out once they reach MaxRuns
+// and shadow prompts are never included. The weights are read once, so a selection
+// is not affected by weights changing while it runs.
+func (m *LLMangoManager) validPromptsForGoal(goal *Goal) ([]weightedPrompt, int, error) {
+	var validPrompts []weightedPrompt
 	totalWeight := 0
 
+	m.weightMu.RLock()
 	for _, promptUID := range goal.PromptUIDs {
 		if !m.Prompts.Exists(promptUID) {
 			continue
@@ -231,45 +320,93 @@ func (m *LLMangoManager) selectPromptForGoal(goal *Goal) (*Prompt, error) {
 			continue
 		}
 
+		// Shadow prompts never serve traffic
+		if prompt.IsShadow {
+			continue
+		}
+
 		if prompt.Weight > 0 {
 			if prompt.IsCanary {
 				if prompt.TotalRuns < prompt.MaxRuns {
-					validPrompts[promptUID] = prompt
+					validPrompts = append(validPrompts, weightedPrompt{prompt, prompt.Weight})
 					totalWeight += prompt.Weight
 				}
 			} else {
-				validPrompts[promptUID] = prompt
+				validPrompts = append(validPrompts, weightedPrompt{prompt, prompt.Weight})
 				totalWeight += prompt.Weight
 			}
 		}
 	}
+	m.weightMu.RUnlock()
 
 	if len(validPrompts) == 0 {
 		hasBasePrompt := false
 		for _, pUID := range goal.PromptUIDs {
 			if m.Prompts.Exists(pUID) {
 				p, ok := m.Prompts.Get(pUID)
-				if ok && p != nil && !p.IsCanary {
+				if ok && p != nil && !p.IsCanary && !p.IsShadow {
 					hasBasePrompt = true
 					break
 				}
 			}
 		}
 		if hasBasePrompt {
-			return nil, fmt.Errorf("no valid prompts available for goal %s", goal.UID)
+			return nil, 0, fmt.Errorf("no valid prompts available for goal %s", goal.UID)
 		} else {
-			return nil, fmt.Errorf("no valid prompts available for goal %s and no base prompt exists or is loaded", goal.UID)
+			return nil, 0, fmt.Errorf("no valid prompts available for goal %s and no base prompt exists or is loaded", goal.UID)
 		}
 	}
 
-	// Weighted random selection (simplified for now)
-	// In a full implementation, this would use the same logic as requests.go
-	for _, prompt := range validPrompts {
-		if prompt.IsCanary {
-			prompt.TotalRuns++
+	return validPrompts, totalWeight, nil
+}
+
+// selectPromptForGoal picks one of the goal's valid prompts using weighted random selection.
+func (m *LLMangoManager) selectPromptForGoal(goal *Goal) (*Prompt, error) {
+	prompts, err := m.selectPromptsForGoal(goal, 1)
+	if err != nil {
+		return nil, err
+	}
+	return prompts[0], nil
+}
+
+// selectPromptsForGoal picks up to n distinct prompts using weighted random selection
+// without replacement. Fewer than n prompts are returned if the goal does not have enough.
+func (m *LLMangoManager) selectPromptsForGoal(goal *Goal, n int) ([]*Prompt, error) {
+	candidates, totalWeight, err := m.validPromptsForGoal(goal)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*Prompt
+	for len(selected) < n && len(candidates) > 0 {
+		randWeight := rand.Intn(totalWeight)
+		currentWeight := 0
+		for i, candidate := range candidates {
+			currentWeight += candidate.weight
+			if randWeight < currentWeight {
+				selected = append(selected, candidate.prompt)
+				totalWeight -= candidate.weight
+				candidates = append(candidates[:i], candidates[i+1:]...)
+				break
+			}
 		}
-		return prompt, nil
 	}
 
-	return nil, fmt.Errorf("failed to select prompt after weighted random selection")
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("failed to select prompt after weighted random selection")
+	}
+
+	for _, prompt := range selected {
+		recordCanaryRuns(prompt, 1)
+	}
+
+	return selected, nil
+}
+
+// recordCanaryRuns counts runs of a canary prompt towards its MaxRuns. Selection counts one run,
+// callers sending a prompt several times record the additional runs.
+func recordCanaryRuns(prompt *Prompt, runs int) {
+	if prompt.IsCanary {
+		prompt.TotalRuns += runs
+	}
 }
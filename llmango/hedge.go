@@ -0,0 +1,101 @@
+package llmango
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+const (
+	hedgeRolePrimary = "primary"
+	hedgeRoleHedge   = "hedge"
+)
+
+// errHedgeLost cancels the attempt that lost a hedged call, it is not logged as a failure
+var errHedgeLost = errors.New("another hedged attempt won")
+
+// HedgeConfig enables hedged requests for a prompt. When the primary request has not
+// produced a valid result after DelayMs a second request is fired and the first valid
+// result wins, the other attempt is cancelled. A primary that fails before DelayMs fires the
+// hedge right away. Finished attempts are logged under one GroupID, the cancelled loser is not.
+type HedgeConfig struct {
+	DelayMs int    `json:"delayMs"`
+	Model   string `json:"model,omitempty"` // model for the hedge attempt, empty reuses the prompt's model
+}
+
+type hedgeAttempt[R any] struct {
+	role     string
+	output   *R
+	response *openrouter.NonStreamingChatResponse
+	err      error
+}
+
+// runHedged runs the prompt with a delayed second attempt and returns the first valid result.
+// If every attempt fails the primary's error is returned.
+func runHedged[I, R any](l *LLMangoManager, g *Goal, selectedPrompt *Prompt, input *I, opts runOptions) (*R, *openrouter.NonStreamingChatResponse, error) {
+	if opts.groupID == "" {
+		opts.groupID = newGroupID()
+	}
+	ctx, cancel := context.WithCancelCause(opts.context())
+	defer cancel(nil)
+
+	attempts := make(chan hedgeAttempt[R], 2)
+	launch := func(role, model string) {
+		attemptOpts := opts
+		attemptOpts.ctx = ctx
+		attemptOpts.model = model
+		attemptOpts.hedgeRole = role
+		go func() {
+			output, response, err := runPromptRaw[I, R](l, g, selectedPrompt, input, attemptOpts)
+			attempts <- hedgeAttempt[R]{role: role, output: output, response: response, err: err}
+		}()
+	}
+
+	launch(hedgeRolePrimary, opts.model)
+	timer := time.NewTimer(time.Duration(selectedPrompt.Hedge.DelayMs) * time.Millisecond)
+	defer timer.Stop()
+
+	pending := 1
+	hedged := false
+	var errs map[string]error
+	for {
+		select {
+		case <-timer.C:
+			if !hedged {
+				hedged = true
+				pending++
+				log.Printf("No response for goal %s after %dms, firing hedge request", g.UID, selectedPrompt.Hedge.DelayMs)
+				launch(hedgeRoleHedge, selectedPrompt.Hedge.Model)
+			}
+		case attempt := <-attempts:
+			pending--
+			if attempt.err == nil {
+				// Cancel the losing attempt, logRun skips it so it doesn't count as an error
+				cancel(errHedgeLost)
+				return attempt.output, attempt.response, nil
+			}
+			if errs == nil {
+				errs = make(map[string]error)
+			}
+			errs[attempt.role] = attempt.err
+			if !hedged && opts.context().Err() == nil {
+				// No reason to wait out the delay once the primary has failed
+				hedged = true
+				pending++
+				timer.Stop()
+				log.Printf("Primary request for goal %s failed, firing hedge request: %v", g.UID, attempt.err)
+				launch(hedgeRoleHedge, selectedPrompt.Hedge.Model)
+				continue
+			}
+			if pending == 0 {
+				if err, ok := errs[hedgeRolePrimary]; ok {
+					return nil, nil, err
+				}
+				return nil, nil, attempt.err
+			}
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package llmango
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/openrouter"
+	"github.com/llmang/llmango/openrouter/openroutertest"
+	"github.com/llmang/llmango/testhelpers"
+)
+
+// newHedgeManager creates an e2e manager whose log entries are sent to the returned channel
+// as soon as the attempt finishes
+func newHedgeManager(t *testing.T, model string) (*LLMangoManager, *Goal, *Prompt, *openroutertest.Server, chan *LLMangoLog) {
+	t.Helper()
+	manager, goal, prompt, server := newE2EManager(t, model)
+	manager.SkipCostReconciliation = true
+	logs := make(chan *LLMangoLog, 4)
+	manager.WithLogging(&Logging{LogResponse: func(entry *LLMangoLog) error {
+		logs <- entry
+		return nil
+	}})
+	return manager, goal, prompt, server, logs
+}
+
+// hedgeLogsByRole waits for n log entries and keys them by their hedge role,
+// any further entry within a short grace period fails the test
+func hedgeLogsByRole(t *testing.T, logs chan *LLMangoLog, n int) map[string]*LLMangoLog {
+	t.Helper()
+	byRole := make(map[string]*LLMangoLog)
+	for range n {
+		select {
+		case entry := <-logs:
+			metadata, _ := entry.Metadata.(map[string]any)
+			role, _ := metadata["hedge"].(string)
+			byRole[role] = entry
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Expected %d log entries, got %d", n, len(byRole))
+		}
+	}
+	select {
+	case entry := <-logs:
+		t.Fatalf("Expected %d log entries, got another one with error %q", n, entry.Error)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return byRole
+}
+
+func TestRunHedgedFirstWinnerCancelsRest(t *testing.T) {
+	manager, goal, prompt, server, logs := newHedgeManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 20, Model: "openai/gpt-4o-mini"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{JSON: e2eOutput{Result: "primary"}, Latency: 5 * time.Second})
+	server.Script("openai/gpt-4o-mini", openroutertest.Reply{JSON: e2eOutput{Result: "hedge"}})
+
+	start := time.Now()
+	output, _, err := runHedged[e2eInput, e2eOutput](manager, goal, prompt, &e2eInput{Text: "hello"}, runOptions{})
+	testhelpers.RequireNoError(t, err, "Hedged run should succeed")
+	testhelpers.AssertEqual(t, "hedge", output.Result, "The faster hedge attempt should win")
+
+	// The cancelled primary is not logged, it would count as a failure of the prompt
+	byRole := hedgeLogsByRole(t, logs, 1)
+	testhelpers.AssertTrue(t, time.Since(start) < time.Second, "The losing primary should be cancelled instead of running to completion")
+	testhelpers.AssertEqual(t, "", byRole[hedgeRoleHedge].Error, "The winning hedge should be logged without an error")
+	testhelpers.AssertTrue(t, byRole[hedgeRoleHedge].GroupID != "", "Hedged attempts should get a group ID")
+}
+
+func TestRunHedgedFailedPrimaryFiresHedge(t *testing.T) {
+	manager, goal, prompt, server, logs := newHedgeManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 5000, Model: "openai/gpt-4o-mini"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{Status: 502})
+	server.Script("openai/gpt-4o-mini", openroutertest.Reply{JSON: e2eOutput{Result: "hedge"}})
+
+	start := time.Now()
+	output, _, err := runHedged[e2eInput, e2eOutput](manager, goal, prompt, &e2eInput{Text: "hello"}, runOptions{})
+	testhelpers.RequireNoError(t, err, "The hedge should answer for the failed primary")
+	testhelpers.AssertEqual(t, "hedge", output.Result, "The hedge should answer")
+	testhelpers.AssertTrue(t, time.Since(start) < time.Second, "The hedge should be fired without waiting out the delay")
+
+	byRole := hedgeLogsByRole(t, logs, 2)
+	testhelpers.AssertTrue(t, byRole[hedgeRolePrimary].Error != "", "The failed primary should be logged with its error")
+	testhelpers.AssertEqual(t, "", byRole[hedgeRoleHedge].Error, "The hedge should be logged without an error")
+	testhelpers.AssertEqual(t, byRole[hedgeRolePrimary].GroupID, byRole[hedgeRoleHedge].GroupID, "Both attempts should share the group ID")
+}
+
+func TestRunHedgedAllAttemptsFail(t *testing.T) {
+	manager, goal, prompt, server, logs := newHedgeManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 10, Model: "openai/gpt-4o-mini"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{Status: 400, Latency: 100 * time.Millisecond})
+	server.Script("openai/gpt-4o-mini", openroutertest.Reply{Status: 402})
+
+	output, _, err := runHedged[e2eInput, e2eOutput](manager, goal, prompt, &e2eInput{Text: "hello"}, runOptions{})
+	testhelpers.AssertTrue(t, output == nil, "No output should be returned when every attempt fails")
+	testhelpers.AssertTrue(t, errors.Is(err, openrouter.ErrBadRequest), "The primary's error should be returned even though the hedge failed first, got %v", err)
+	testhelpers.AssertEqual(t, 2, len(server.ChatRequests()), "Both attempts should be sent")
+
+	byRole := hedgeLogsByRole(t, logs, 2)
+	testhelpers.AssertTrue(t, byRole[hedgeRolePrimary].Error != "", "The failed primary should be logged with its error")
+	testhelpers.AssertTrue(t, byRole[hedgeRoleHedge].Error != "", "The failed hedge should be logged with its error")
+}
+
+func TestRunHedgedDelay(t *testing.T) {
+	// A primary answering within the delay never fires the hedge
+	manager, goal, prompt, server, logs := newHedgeManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 500, Model: "openai/gpt-4o-mini"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{JSON: e2eOutput{Result: "primary"}})
+
+	output, _, err := runHedged[e2eInput, e2eOutput](manager, goal, prompt, &e2eInput{Text: "hello"}, runOptions{groupID: "grp_fixed"})
+	testhelpers.RequireNoError(t, err, "Hedged run should succeed")
+	testhelpers.AssertEqual(t, "primary", output.Result, "The primary should answer")
+	testhelpers.AssertEqual(t, 1, len(server.ChatRequests()), "No hedge should be sent before the delay")
+
+	byRole := hedgeLogsByRole(t, logs, 1)
+	testhelpers.AssertEqual(t, "grp_fixed", byRole[hedgeRolePrimary].GroupID, "An existing group ID should be kept")
+
+	// Without a hedge model the hedge reuses the prompt's model
+	manager, goal, prompt, server, logs = newHedgeManager(t, "openai/gpt-4o")
+	prompt.Hedge = &HedgeConfig{DelayMs: 20}
+	server.Script("openai/gpt-4o",
+		openroutertest.Reply{JSON: e2eOutput{Result: "primary"}, Latency: 5 * time.Second},
+		openroutertest.Reply{JSON: e2eOutput{Result: "hedge"}},
+	)
+
+	output, _, err = runHedged[e2eInput, e2eOutput](manager, goal, prompt, &e2eInput{Text: "hello"}, runOptions{})
+	testhelpers.RequireNoError(t, err, "Hedged run should succeed")
+	testhelpers.AssertEqual(t, "hedge", output.Result, "The hedge should win against the slow primary")
+
+	requests := server.ChatRequests()
+	testhelpers.AssertEqual(t, 2, len(requests), "The hedge should be sent after the delay")
+	testhelpers.AssertEqual(t, "openai/gpt-4o", *requests[1].Model, "The hedge should reuse the prompt's model")
+	byRole = hedgeLogsByRole(t, logs, 1)
+	testhelpers.AssertTrue(t, byRole[hedgeRoleHedge] != nil, "The hedge should be tagged with its role")
+}
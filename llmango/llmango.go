@@ -1,9 +1,12 @@
 package llmango
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
 	"slices"
+	"sync"
 	"time"
 
 	"github.com/carsongh/strongmap/concurrentmap"
@@ -14,6 +17,9 @@ var ErrMaxRateLimitRetries = fmt.Errorf("failed to get a valid response after re
 var MAX_BACKOFF_ATTEMPTS = 10
 var BASE_BACKOFF_DELAY = 100 * time.Millisecond
 
+// MAX_RETRY_AFTER_DELAY caps the delay a Retry-After header can ask for between rate limit retries
+var MAX_RETRY_AFTER_DELAY = time.Minute
+
 type LLMangoManager struct {
 	RetryRateLimit bool
 	OpenRouter     *openrouter.OpenRouter
@@ -21,6 +27,30 @@ type LLMangoManager struct {
 	Prompts        concurrentmap.SyncedMap[string, *Prompt]
 	SaveState      func() error
 	Logging        *Logging
+
+	// Preflight checks requests against the model's context window before sending them when set.
+	// Models missing from openrouter.DefaultModelCatalog are sent unchecked.
+	Preflight *openrouter.PreflightOptions
+
+	// SkipCostReconciliation logs the cost estimated from usage and model pricing without
+	// fetching the exact cost from the OpenRouter generation endpoint.
+	SkipCostReconciliation bool
+
+	// ShadowComparator compares the served output with a shadow prompt's output.
+	// CompareFields is used when it is nil.
+	ShadowComparator func(served, shadow json.RawMessage) ShadowComparison
+	// OnShadowResult is called after every shadow run, e.g. to record comparisons in metrics.
+	OnShadowResult func(ShadowResult)
+
+	canaryMu        sync.Mutex
+	canaryDecisions []CanaryDecision // audit trail of the canary controller
+
+	banditMu      sync.Mutex
+	banditArms    map[string]map[string]*BanditArm // goal UID -> prompt UID -> arm
+	banditRewards int
+
+	// weightMu guards the prompt weights the bandit and the canary controller change while prompts are selected
+	weightMu sync.RWMutex
 }
 
 func CreateLLMangoManger(o *openrouter.OpenRouter) (*LLMangoManager, error) {
@@ -51,6 +81,12 @@ type Prompt struct {
 	IsCanary  bool `json:"isCanary"`
 	MaxRuns   int  `json:"maxRuns"`
 	TotalRuns int  `json:"totalRuns"`
+
+	Hedge *HedgeConfig `json:"hedge,omitempty"` // opt-in hedged requests, nil disables hedging
+
+	// Shadow prompts never serve traffic, they run in the background next to the served prompt.
+	IsShadow         bool    `json:"isShadow"`
+	ShadowSampleRate float64 `json:"shadowSampleRate"` // fraction of calls in [0,1] that run the shadow, 0 never runs it, 1 runs it on every call
 }
 
 type Goal struct {
@@ -68,9 +104,27 @@ type Goal struct {
 	InputExample  json.RawMessage `json:"inputExample"`
 	OutputExample json.RawMessage `json:"outputExample"`
 
+	// Additional examples, merged with the examples above when the schemas of JSON goals are inferred
+	InputExamples  []json.RawMessage `json:"inputExamples,omitempty"`
+	OutputExamples []json.RawMessage `json:"outputExamples,omitempty"`
+
+	// Explicit JSON Schemas, when set they are used for the response format, validation and universal
+	// prompts instead of schemas inferred from the examples, which are then only shown to the model
+	InputSchema  json.RawMessage `json:"inputSchema,omitempty"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+
 	// Runtime validators (reconstructed on startup)
 	InputValidator  func(json.RawMessage) error `json:"-"`
 	OutputValidator func(json.RawMessage) error `json:"-"`
+
+	// Optional fan-out execution, when set Run aggregates several calls into one result
+	Ensemble *EnsembleConfig `json:"ensemble,omitempty"`
+
+	// Optional adaptive traffic allocation, when set prompt weights are learned from rewards
+	Adaptive *AdaptiveConfig `json:"adaptive,omitempty"`
+
+	// schemaMu guards the schemas, examples and validators, which can be replaced while the goal runs
+	schemaMu sync.RWMutex
 }
 
 // GoalValidator interface for typed goals
@@ -95,6 +149,8 @@ func (re *ResultError) Error() string {
 
 // AddOrUpdateGoals adds or updates goals in the LLMangoManager.
 // It updates the Title, Description, CreatedAt, and UpdatedAt fields of existing goals.
+// Schemas only come with new goals: goals already registered from code or config keep their
+// schemas and validation mode, so a stale saved schema can't override an updated definition.
 func (m *LLMangoManager) AddOrUpdateGoals(goals ...*Goal) {
 	now := int(time.Now().Unix())
 	for _, goal := range goals {
@@ -106,12 +162,17 @@ func (m *LLMangoManager) AddOrUpdateGoals(goals ...*Goal) {
 				goal.UpdatedAt = now
 			}
 			if existingGoal, ok := m.Goals.Get(goal.UID); ok {
+				existingInput, existingOutput := existingGoal.Schemas()
+				if !bytes.Equal(existingInput, goal.InputSchema) || !bytes.Equal(existingOutput, goal.OutputSchema) {
+					log.Printf("INFO: keeping the registered schemas of goal %s over the loaded ones", goal.UID)
+				}
 				existingGoal.Title = goal.Title
 				existingGoal.Description = goal.Description
 				existingGoal.CreatedAt = goal.CreatedAt // Keep original CreatedAt? No, instruction implies updating based on input goal.
 				existingGoal.UpdatedAt = goal.UpdatedAt // Update UpdatedAt based on input goal.
 				m.Goals.Set(goal.UID, existingGoal)
 			} else {
+				goal.buildMissingValidators()
 				goal.PromptUIDs = []string{}
 				m.Goals.Set(goal.UID, goal)
 				// Iterate over a snapshot for thread safety
@@ -138,6 +199,7 @@ func (m *LLMangoManager) AddGoals(goals ...*Goal) {
 			if goal.UpdatedAt == 0 {
 				goal.UpdatedAt = now
 			}
+			goal.buildMissingValidators()
 			goal.PromptUIDs = []string{}
 			m.Goals.Set(goal.UID, goal)
 			// Iterate over a snapshot for thread safety
@@ -281,27 +343,224 @@ func NewJSONGoal(uid, title, description string, inputExample, outputExample jso
 	return goal
 }
 
-// generateSchemaValidators creates JSON schema validators from examples
-func (g *Goal) generateSchemaValidators() error {
-	// Generate input schema validator
-	if len(g.InputExample) > 0 {
-		inputSchema, err := openrouter.GenerateSchemaFromJSONExample(g.InputExample)
-		if err != nil {
-			return fmt.Errorf("failed to generate input schema: %w", err)
+// NewJSONGoalWithExamples creates a JSON object goal whose schemas are inferred from several examples,
+// so fields that vary between them (optional keys, mixed types) are modelled correctly.
+// The first examples become InputExample and OutputExample, which prompts show to the model.
+func NewJSONGoalWithExamples(uid, title, description string, inputExamples, outputExamples []json.RawMessage) *Goal {
+	if len(inputExamples) == 0 || len(outputExamples) == 0 {
+		panic("a JSON goal needs at least one input and one output example")
+	}
+	goal := &Goal{
+		UID:               uid,
+		Title:             title,
+		Description:       description,
+		CreatedAt:         int(time.Now().Unix()),
+		UpdatedAt:         int(time.Now().Unix()),
+		PromptUIDs:        []string{},
+		IsSchemaValidated: true, // JSON object goal
+		InputExample:      inputExamples[0],
+		OutputExample:     outputExamples[0],
+		InputExamples:     inputExamples[1:],
+		OutputExamples:    outputExamples[1:],
+	}
+
+	if err := goal.generateSchemaValidators(); err != nil {
+		panic(fmt.Sprintf("failed to generate schema validators: %v", err))
+	}
+
+	return goal
+}
+
+// NewSchemaGoal creates a goal whose input and output are defined by explicit JSON Schemas.
+// The schemas are used for the response format, validation and universal prompts, the optional
+// examples are only shown to the model. An empty input schema is inferred from the input example.
+func NewSchemaGoal(uid, title, description string, inputSchema, outputSchema, inputExample, outputExample json.RawMessage) *Goal {
+	if len(outputSchema) == 0 {
+		panic("a schema goal needs an output schema")
+	}
+	goal := &Goal{
+		UID:               uid,
+		Title:             title,
+		Description:       description,
+		CreatedAt:         int(time.Now().Unix()),
+		UpdatedAt:         int(time.Now().Unix()),
+		PromptUIDs:        []string{},
+		IsSchemaValidated: true, // Schema goal
+		InputExample:      inputExample,
+		OutputExample:     outputExample,
+		InputSchema:       inputSchema,
+		OutputSchema:      outputSchema,
+	}
+
+	if err := goal.generateSchemaValidators(); err != nil {
+		panic(fmt.Sprintf("failed to generate schema validators: %v", err))
+	}
+
+	return goal
+}
+
+// SetSchemas replaces the explicit schemas of the goal, an empty or null schema falls back to the examples.
+// The goal becomes schema validated, so validators are rebuilt from the new schemas. It is safe to call
+// while the goal runs.
+func (g *Goal) SetSchemas(inputSchema, outputSchema json.RawMessage) error {
+	if isEmptySchema(inputSchema) {
+		inputSchema = nil
+	}
+	if isEmptySchema(outputSchema) {
+		outputSchema = nil
+	}
+
+	g.schemaMu.Lock()
+	defer g.schemaMu.Unlock()
+	previousInput, previousOutput := g.InputSchema, g.OutputSchema
+	g.InputSchema, g.OutputSchema = inputSchema, outputSchema
+	if err := g.generateSchemaValidators(); err != nil {
+		g.InputSchema, g.OutputSchema = previousInput, previousOutput
+		return err
+	}
+	g.IsSchemaValidated = true
+	return nil
+}
+
+// Schemas returns the explicit input and output schemas of the goal
+func (g *Goal) Schemas() (inputSchema, outputSchema json.RawMessage) {
+	g.schemaMu.RLock()
+	defer g.schemaMu.RUnlock()
+	return g.InputSchema, g.OutputSchema
+}
+
+// validateInput runs the input validator, if the goal has one
+func (g *Goal) validateInput(input json.RawMessage) error {
+	g.schemaMu.RLock()
+	validator := g.InputValidator
+	g.schemaMu.RUnlock()
+	if validator == nil {
+		return nil
+	}
+	return validator(input)
+}
+
+// validateOutput runs the output validator, if the goal has one
+func (g *Goal) validateOutput(output json.RawMessage) error {
+	g.schemaMu.RLock()
+	validator := g.OutputValidator
+	g.schemaMu.RUnlock()
+	if validator == nil {
+		return nil
+	}
+	return validator(output)
+}
+
+// buildMissingValidators rebuilds the validators of schema validated goals that have none,
+// e.g. goals generated from config or loaded from a save state
+func (g *Goal) buildMissingValidators() {
+	g.schemaMu.Lock()
+	defer g.schemaMu.Unlock()
+	if !g.IsSchemaValidated || g.InputValidator != nil || g.OutputValidator != nil {
+		return
+	}
+	if err := g.generateSchemaValidators(); err != nil {
+		log.Printf("WARN: failed to build schema validators for goal %s: %v", g.UID, err)
+	}
+}
+
+// inputSchemaDefinition returns the explicit input schema or one inferred from the input examples,
+// nil when the goal has neither
+func (g *Goal) inputSchemaDefinition(opts openrouter.SchemaOptions) (*openrouter.Definition, error) {
+	g.schemaMu.RLock()
+	defer g.schemaMu.RUnlock()
+	return schemaDefinition(g.InputSchema, g.allInputExamples(), opts)
+}
+
+// outputSchemaDefinition returns the explicit output schema or one inferred from the output examples,
+// nil when the goal has neither
+func (g *Goal) outputSchemaDefinition(opts openrouter.SchemaOptions) (*openrouter.Definition, error) {
+	g.schemaMu.RLock()
+	defer g.schemaMu.RUnlock()
+	return schemaDefinition(g.OutputSchema, g.allOutputExamples(), opts)
+}
+
+func schemaDefinition(schema json.RawMessage, examples []json.RawMessage, opts openrouter.SchemaOptions) (*openrouter.Definition, error) {
+	if !isEmptySchema(schema) {
+		return openrouter.ParseSchema(schema)
+	}
+	if len(examples) == 0 {
+		return nil, nil
+	}
+	return openrouter.GenerateSchemaFromJSONExamples(examples, opts)
+}
+
+// AddExamples adds an input and/or output example to the goal, for JSON goals the validators are
+// regenerated from all examples. Empty examples are skipped.
+func (g *Goal) AddExamples(inputExample, outputExample json.RawMessage) error {
+	g.schemaMu.Lock()
+	defer g.schemaMu.Unlock()
+	previousInputs, previousOutputs := g.InputExamples, g.OutputExamples
+	if len(inputExample) > 0 {
+		g.InputExamples = append(g.InputExamples, inputExample)
+	}
+	if len(outputExample) > 0 {
+		g.OutputExamples = append(g.OutputExamples, outputExample)
+	}
+	if !g.IsSchemaValidated {
+		return nil
+	}
+	if err := g.generateSchemaValidators(); err != nil {
+		g.InputExamples, g.OutputExamples = previousInputs, previousOutputs
+		return err
+	}
+	return nil
+}
+
+// allInputExamples returns InputExample followed by the additional input examples
+func (g *Goal) allInputExamples() []json.RawMessage {
+	return joinExamples(g.InputExample, g.InputExamples)
+}
+
+// allOutputExamples returns OutputExample followed by the additional output examples
+func (g *Goal) allOutputExamples() []json.RawMessage {
+	return joinExamples(g.OutputExample, g.OutputExamples)
+}
+
+func joinExamples(first json.RawMessage, rest []json.RawMessage) []json.RawMessage {
+	examples := make([]json.RawMessage, 0, len(rest)+1)
+	if len(first) > 0 {
+		examples = append(examples, first)
+	}
+	for _, example := range rest {
+		if len(example) > 0 {
+			examples = append(examples, example)
 		}
+	}
+	return examples
+}
+
+// isEmptySchema reports whether an explicit schema is unset, JSON null clears a schema
+func isEmptySchema(schema json.RawMessage) bool {
+	trimmed := bytes.TrimSpace(schema)
+	return len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null"))
+}
 
+// generateSchemaValidators creates JSON schema validators from the schemas or examples,
+// callers of goals that may be running hold schemaMu
+func (g *Goal) generateSchemaValidators() error {
+	// Resolve both schemas first so a failure leaves the current validators in place
+	inputSchema, err := schemaDefinition(g.InputSchema, g.allInputExamples(), openrouter.SchemaOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to generate input schema: %w", err)
+	}
+	outputSchema, err := schemaDefinition(g.OutputSchema, g.allOutputExamples(), openrouter.SchemaOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to generate output schema: %w", err)
+	}
+
+	g.InputValidator, g.OutputValidator = nil, nil
+	if inputSchema != nil {
 		g.InputValidator = func(jsonInput json.RawMessage) error {
 			return openrouter.ValidateJSONAgainstSchema(jsonInput, inputSchema)
 		}
 	}
-
-	// Generate output schema validator
-	if len(g.OutputExample) > 0 {
-		outputSchema, err := openrouter.GenerateSchemaFromJSONExample(g.OutputExample)
-		if err != nil {
-			return fmt.Errorf("failed to generate output schema: %w", err)
-		}
-
+	if outputSchema != nil {
 		g.OutputValidator = func(jsonOutput json.RawMessage) error {
 			return openrouter.ValidateJSONAgainstSchema(jsonOutput, outputSchema)
 		}
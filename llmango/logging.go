@@ -1,9 +1,11 @@
 package llmango
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/llmang/llmango/openrouter"
@@ -17,27 +19,35 @@ type LLmangoLogFilter struct {
 	MaxTimestamp *int    `json:"maxTimestamp,omitempty"`
 	GoalUID      *string `json:"goalUID,omitempty"`
 	PromptUID    *string `json:"promptUID,omitempty"`
+	GroupID      *string `json:"groupID,omitempty"`
+	LogID        *string `json:"logID,omitempty"`
 	Limit        *int    `json:"limit"`
 	Offset       *int    `json:"offset"`
 	IncludeRaw   bool    `json:"includeRaw"`
 }
 
 // LLMangoLog represents a single log entry.
-// UserID and Metadata must be set by custom loggers, they are not part of the default log message passed into the logger.
+// UserID must be set by custom loggers, it is not part of the default log message passed into the logger.
+// Metadata is only set by llmango for hedged and shadow calls, custom loggers may overwrite it.
 type LLMangoLog struct {
-	Timestamp      int     `json:"timestamp"`
-	GoalUID        string  `json:"goalUID"`
-	PromptUID      string  `json:"promptUID"`
-	RawRequest     string  `json:"rawInput,omitempty"`
-	InputObject    string  `json:"inputObject"`
-	RawResponse    string  `json:"rawOutput,omitempty"`
-	OutputObject   string  `json:"outputObject"`
-	InputTokens    int     `json:"inputTokens"`
-	OutputTokens   int     `json:"outputTokens"`
-	Cost           float64 `json:"cost"`
-	RequestTime    float64 `json:"requestTime"`
-	GenerationTime float64 `json:"generationTime"`
-	Error          string  `json:"error"`
+	Timestamp       int     `json:"timestamp"`
+	LogID           string  `json:"logID,omitempty"` // OpenRouter generation ID, empty when the request failed before a response
+	GoalUID         string  `json:"goalUID"`
+	PromptUID       string  `json:"promptUID"`
+	GroupID         string  `json:"groupID,omitempty"` // Shared by calls that belong together, e.g. an ensemble
+	RawRequest      string  `json:"rawInput,omitempty"`
+	InputObject     string  `json:"inputObject"`
+	RawResponse     string  `json:"rawOutput,omitempty"`
+	OutputObject    string  `json:"outputObject"`
+	InputTokens     int     `json:"inputTokens"`
+	OutputTokens    int     `json:"outputTokens"`
+	ReasoningTokens int     `json:"reasoningTokens"` // part of OutputTokens spent on reasoning
+	Cost            float64 `json:"cost"`
+	CostEstimated   bool    `json:"costEstimated,omitempty"` // cost is estimated from usage and pricing, not yet reconciled with OpenRouter
+	RequestTime     float64 `json:"requestTime"`
+	GenerationTime  float64 `json:"generationTime"`
+	Error           string  `json:"error"`
+	Reasoning       string  `json:"reasoning,omitempty"` // reasoning text returned by reasoning models
 
 	UserID   string `json:"userID"`
 	Metadata any    `json:"metadata,omitempty"`
@@ -46,11 +56,15 @@ type LLMangoLog struct {
 type Logging struct {
 	LogResponse func(*LLMangoLog) error                            //logger
 	GetLogs     func(*LLmangoLogFilter) ([]LLMangoLog, int, error) //log reteriver
+	// UpdateLog stores the reconciled cost, generation time and reasoning tokens of an entry already
+	// passed to LogResponse, matched by LogID. When set, entries are logged before the call returns
+	// and updated once the exact cost is known. Without it entries are only logged after
+	// reconciliation, about a second after the call, so Feedback right after a call can't find them.
+	UpdateLog func(*LLMangoLog) error
 }
 
-// WARNING: IF YOU DO NOT SLEEP YOU MAY HIT THE GENERATION ENDPOINT TOO FAST RESULTING IN A 404 ERROR.
-// This gathers cost and usage from openrouter getGeneration endpoint.
-// createLogObject builds a log entry from request/response data
+// createLogObject builds a log entry from request/response data.
+// The cost is estimated from the reported usage and the model pricing, see reconcileLogCost for the exact cost.
 func (mang *LLMangoManager) createLogObject(
 	goalUID string,
 	promptUID string,
@@ -90,26 +104,36 @@ func (mang *LLMangoManager) createLogObject(
 		}
 
 		logObject.Timestamp = int(response.Created)
+		logObject.LogID = response.ID
 
 		if response.Usage != nil {
 			logObject.InputTokens = response.Usage.PromptTokens
 			logObject.OutputTokens = response.Usage.CompletionTokens
+			logObject.ReasoningTokens = response.Usage.ReasoningTokens()
 		}
-
-		// Get actual cost and generation time from OpenRouter API
-		if response.ID == "" {
-			return nil, errors.New("response ID is empty, cannot retrieve generation stats")
+		if len(response.Choices) > 0 && response.Choices[0].Message.Reasoning != nil {
+			logObject.Reasoning = *response.Choices[0].Message.Reasoning
 		}
 
-		//WARNING: IF YOU DO NOT SLEEP YOU MAY HIT THE GENERATION ENDPOINT TOO FAST RESULTING IN A 404 ERROR
-		time.Sleep(800 * time.Millisecond)
-		stats, apiErr := mang.OpenRouter.GetGenerationStats(response.ID)
-		if apiErr != nil {
-			return nil, fmt.Errorf("failed to get OpenRouter generation stats: %w", apiErr)
+		// OpenRouter often reports a dated slug like "openai/gpt-4o-2024-08-06" that isn't priced,
+		// the requested model is tried first
+		var models []string
+		if request != nil && request.Model != nil {
+			models = append(models, *request.Model)
+		}
+		models = append(models, response.Model)
+		for _, model := range models {
+			if cost, ok := openrouter.CostFromUsage(model, response.Usage); ok {
+				logObject.Cost = cost
+				logObject.CostEstimated = true
+				break
+			}
 		}
+	}
 
-		logObject.Cost = stats.TotalCost
-		logObject.GenerationTime = float64(stats.GenerationTime)
+	if logObject.Timestamp == 0 {
+		// Calls that failed before a response still need a timestamp, time filters would drop them otherwise
+		logObject.Timestamp = int(time.Now().Unix())
 	}
 
 	// Add error if there is one
@@ -119,3 +143,105 @@ func (mang *LLMangoManager) createLogObject(
 
 	return logObject, nil
 }
+
+// WARNING: IF YOU DO NOT SLEEP YOU MAY HIT THE GENERATION ENDPOINT TOO FAST RESULTING IN A 404 ERROR.
+// reconcileLogCost replaces the estimated cost with the actual cost and generation time from the
+// OpenRouter generation endpoint. It sleeps first, so never call it on the request path.
+func (mang *LLMangoManager) reconcileLogCost(logObject *LLMangoLog) error {
+	if logObject.LogID == "" {
+		return errors.New("response ID is empty, cannot retrieve generation stats")
+	}
+
+	//WARNING: IF YOU DO NOT SLEEP YOU MAY HIT THE GENERATION ENDPOINT TOO FAST RESULTING IN A 404 ERROR
+	time.Sleep(800 * time.Millisecond)
+	stats, err := mang.OpenRouter.GetGenerationStats(logObject.LogID)
+	if err != nil {
+		return fmt.Errorf("failed to get OpenRouter generation stats: %w", err)
+	}
+
+	logObject.Cost = stats.TotalCost
+	logObject.CostEstimated = false
+	logObject.GenerationTime = float64(stats.GenerationTime)
+	if logObject.ReasoningTokens == 0 {
+		// Not every provider reports reasoning tokens in the response usage
+		logObject.ReasoningTokens = stats.NativeTokensReasoning
+	}
+	return nil
+}
+
+// logRun creates the log entry for a single prompt execution and hands it to the
+// configured logger in the background. It is a no-op when logging is not set up.
+func (mang *LLMangoManager) logRun(
+	goalUID string,
+	promptUID string,
+	input any,
+	request *openrouter.OpenRouterRequest,
+	response *openrouter.NonStreamingChatResponse,
+	output any,
+	requestTime float64,
+	runErr error,
+	opts runOptions,
+) {
+	if mang.Logging == nil || mang.Logging.LogResponse == nil {
+		return
+	}
+	if runErr != nil && opts.ctx != nil && errors.Is(context.Cause(opts.ctx), errHedgeLost) {
+		// The loser of a hedged call was cancelled by us, logging it would inflate the error rate
+		return
+	}
+
+	logEntry, err := mang.createLogObject(goalUID, promptUID, input, request, response, output, requestTime, true, runErr)
+	if err != nil {
+		log.Printf("Failed to create log object for goal %s: %v (Original Error: %v)", goalUID, err, runErr)
+		return
+	}
+	logEntry.GroupID = opts.groupID
+
+	metadata := make(map[string]any)
+	if opts.hedgeRole != "" {
+		metadata["hedge"] = opts.hedgeRole
+	}
+	if opts.logMetadata != nil {
+		for key, value := range opts.logMetadata(output) {
+			metadata[key] = value
+		}
+	}
+	var violations openrouter.ValidationErrors
+	if errors.As(runErr, &violations) {
+		// Keep the individual violations queryable instead of only the joined error message
+		metadata["validationErrors"] = violations
+	}
+	if len(metadata) > 0 {
+		logEntry.Metadata = metadata
+	}
+
+	reconcile := response != nil && !mang.SkipCostReconciliation
+	if reconcile && mang.Logging.UpdateLog != nil {
+		// Log right away so the entry can be found, e.g. by Feedback, and fill in the exact cost later
+		if err := mang.Logging.LogResponse(logEntry); err != nil {
+			log.Printf("Failed to log response for goal %s: %v", goalUID, err)
+			return
+		}
+		go func(mangoLog LLMangoLog) {
+			if err := mang.reconcileLogCost(&mangoLog); err != nil {
+				log.Printf("Failed to reconcile cost for goal %s, keeping the estimate: %v", goalUID, err)
+				return
+			}
+			if err := mang.Logging.UpdateLog(&mangoLog); err != nil {
+				log.Printf("Failed to update the cost of log %s for goal %s: %v", mangoLog.LogID, goalUID, err)
+			}
+		}(*logEntry)
+		return
+	}
+
+	go func(mangoLog *LLMangoLog) {
+		if reconcile {
+			if err := mang.reconcileLogCost(mangoLog); err != nil {
+				log.Printf("Failed to reconcile cost for goal %s, keeping the estimate: %v", goalUID, err)
+			}
+		}
+		if err := mang.Logging.LogResponse(mangoLog); err != nil {
+			log.Printf("Failed to log response for goal %s: %v", goalUID, err)
+		}
+	}(logEntry)
+}
@@ -0,0 +1,62 @@
+package llmango
+
+import (
+	"testing"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+func TestCreateLogObjectEstimatesCost(t *testing.T) {
+	openrouter.DefaultPricingTable.Set("test/priced", openrouter.ModelPricing{Prompt: 0.001, Completion: 0.002})
+	defer openrouter.DefaultPricingTable.Delete("test/priced")
+
+	manager := &LLMangoManager{OpenRouter: &openrouter.OpenRouter{}}
+	model := "test/priced"
+	request := &openrouter.OpenRouterRequest{Model: &model}
+	response := &openrouter.NonStreamingChatResponse{}
+	response.ID = "gen-1"
+	response.Usage = &openrouter.ResponseUsage{PromptTokens: 10, CompletionTokens: 5}
+
+	logObject, err := manager.createLogObject("goal", "prompt", nil, request, response, nil, 0.5, false, nil)
+	if err != nil {
+		t.Fatalf("createLogObject failed: %v", err)
+	}
+	if !logObject.CostEstimated || logObject.Cost < 0.0199 || logObject.Cost > 0.0201 {
+		t.Errorf("Expected an estimated cost of 0.02, got %v (estimated %v)", logObject.Cost, logObject.CostEstimated)
+	}
+
+	// The requested model is priced even when the response reports a dated slug
+	response.Model = "test/priced-2024-08-06"
+	logObject, err = manager.createLogObject("goal", "prompt", nil, request, response, nil, 0.5, false, nil)
+	if err != nil {
+		t.Fatalf("createLogObject failed: %v", err)
+	}
+	if !logObject.CostEstimated || logObject.Cost < 0.0199 || logObject.Cost > 0.0201 {
+		t.Errorf("Expected the cost to be estimated from the requested model, got %v", logObject.Cost)
+	}
+
+	// The response model is the fallback, e.g. for router models like openrouter/auto whose
+	// catalog price of -1 is unknown
+	previous := openrouter.DefaultModelCatalog.Models()
+	defer openrouter.DefaultModelCatalog.Set(previous)
+	openrouter.DefaultModelCatalog.Set([]openrouter.ModelInfo{{ID: "openrouter/auto", PricingUnknown: true}})
+	model = "openrouter/auto"
+	response.Model = "test/priced"
+	logObject, err = manager.createLogObject("goal", "prompt", nil, request, response, nil, 0.5, false, nil)
+	if err != nil {
+		t.Fatalf("createLogObject failed: %v", err)
+	}
+	if !logObject.CostEstimated || logObject.Cost < 0.0199 || logObject.Cost > 0.0201 {
+		t.Errorf("Expected the cost to be estimated from the response model, got %v", logObject.Cost)
+	}
+
+	model = "test/unknown"
+	response.Model = ""
+	logObject, err = manager.createLogObject("goal", "prompt", nil, request, response, nil, 0.5, false, nil)
+	if err != nil {
+		t.Fatalf("createLogObject failed: %v", err)
+	}
+	if logObject.CostEstimated || logObject.Cost != 0 {
+		t.Errorf("Expected no cost estimate without pricing, got %v", logObject.Cost)
+	}
+}
@@ -468,3 +468,21 @@ func ParseMessages(input any, messages []openrouter.Message) ([]openrouter.Messa
 
 	return finalMessages, nil
 }
+
+// TemplateVariables returns the input variables referenced by the messages, both {{variable}}
+// placeholders and {{#if variable}} conditions, in order of first use
+func TemplateVariables(messages []openrouter.Message) []string {
+	pattern := regexp.MustCompile(`\{\{\s*(#if\s+)?([^{}#/:]+?)\s*\}\}`)
+
+	var variables []string
+	seen := make(map[string]bool)
+	for _, msg := range messages {
+		for _, match := range pattern.FindAllStringSubmatch(msg.Content, -1) {
+			if name := match[2]; !seen[name] {
+				seen[name] = true
+				variables = append(variables, name)
+			}
+		}
+	}
+	return variables
+}
@@ -677,3 +677,14 @@ func TestInsertMessagesFeature(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateVariables(t *testing.T) {
+	messages := []openrouter.Message{
+		{Role: "system", Content: "Greet {{name}}.{{#if previousItems}} Mention {{previousItems}}.{{:else}} Be brief.{{/if}}"},
+		{Role: "user", Content: "{{name}} is {{age}}{{insertMessages}}"},
+	}
+	expected := []string{"name", "previousItems", "age", "insertMessages"}
+	if got := TemplateVariables(messages); !reflect.DeepEqual(got, expected) {
+		t.Errorf("TemplateVariables() = %v, expected %v", got, expected)
+	}
+}
@@ -264,3 +264,138 @@ func TestGoalValidation(t *testing.T) {
 		t.Errorf("JSON goal should have no warnings, got: %v", warnings)
 	}
 }
+
+func TestJSONGoalWithExamples(t *testing.T) {
+	goal := NewJSONGoalWithExamples("test-examples", "Test Examples", "Goal inferred from several examples",
+		[]json.RawMessage{json.RawMessage(`{"text": "a"}`), json.RawMessage(`{"text": "b", "lang": "en"}`)},
+		[]json.RawMessage{json.RawMessage(`{"items": [{"id": 1, "tag": "x"}, {"id": 2.5}]}`), json.RawMessage(`{"items": []}`)},
+	)
+
+	if string(goal.OutputExample) != `{"items": [{"id": 1, "tag": "x"}, {"id": 2.5}]}` || len(goal.OutputExamples) != 1 {
+		t.Errorf("Expected the first example to be the primary one, got %s and %d more", goal.OutputExample, len(goal.OutputExamples))
+	}
+	if err := goal.InputValidator(json.RawMessage(`{"text": "c"}`)); err != nil {
+		t.Errorf("Keys missing from some examples should be optional: %v", err)
+	}
+	if err := goal.OutputValidator(json.RawMessage(`{"items": [{"id": 0.5}]}`)); err != nil {
+		t.Errorf("Integer and number examples should merge into number: %v", err)
+	}
+	if err := goal.OutputValidator(json.RawMessage(`{"items": [{"tag": "y"}]}`)); err == nil {
+		t.Error("Keys present in every element should stay required")
+	}
+
+	if err := goal.AddExamples(nil, json.RawMessage(`{"items": [{"id": "id-3"}]}`)); err != nil {
+		t.Fatalf("AddExamples failed: %v", err)
+	}
+	if err := goal.OutputValidator(json.RawMessage(`{"items": [{"id": "id-4"}]}`)); err != nil {
+		t.Errorf("Added examples should widen the schema: %v", err)
+	}
+	if err := goal.AddExamples(json.RawMessage(`{invalid`), nil); err == nil || len(goal.InputExamples) != 1 {
+		t.Errorf("Expected invalid examples to be rejected and not kept, got %v with %d input examples", err, len(goal.InputExamples))
+	}
+}
+
+func TestSchemaGoal(t *testing.T) {
+	inputSchema := json.RawMessage(`{"type":"object","properties":{"text":{"type":"string","minLength":1}},"required":["text"]}`)
+	outputSchema := json.RawMessage(`{"type":"object","properties":{"score":{"type":"number","minimum":0,"maximum":1}},"required":["score"]}`)
+	goal := NewSchemaGoal("test-schema-goal", "Test Schema Goal", "Goal defined by schemas", inputSchema, outputSchema, json.RawMessage(`{"text": "hi"}`), nil)
+
+	if !goal.IsSchemaValidated {
+		t.Error("Schema goal should be schema validated")
+	}
+	if err := goal.InputValidator(json.RawMessage(`{"text": ""}`)); err == nil {
+		t.Error("The explicit input schema should be used instead of the example")
+	}
+	if err := goal.OutputValidator(json.RawMessage(`{"score": 1.5}`)); err == nil {
+		t.Error("The explicit output schema should enforce its bounds")
+	}
+	if err := goal.OutputValidator(json.RawMessage(`{"score": 0.5}`)); err != nil {
+		t.Errorf("Valid output should pass: %v", err)
+	}
+
+	if err := goal.SetSchemas(nil, json.RawMessage(`{"type": 42}`)); err == nil {
+		t.Error("Invalid schemas should be rejected")
+	}
+	if string(goal.OutputSchema) != string(outputSchema) || goal.OutputValidator(json.RawMessage(`{"score": 1.5}`)) == nil {
+		t.Error("A rejected schema should keep the current schema and validators")
+	}
+
+	// Without an input schema the input falls back to the example
+	if err := goal.SetSchemas(nil, outputSchema); err != nil {
+		t.Fatalf("SetSchemas failed: %v", err)
+	}
+	if err := goal.InputValidator(json.RawMessage(`{"text": ""}`)); err != nil {
+		t.Errorf("The input should be validated against the example after removing its schema: %v", err)
+	}
+
+	// JSON null clears an explicit schema as well
+	if err := goal.SetSchemas(nil, json.RawMessage(`null`)); err != nil {
+		t.Fatalf("SetSchemas failed: %v", err)
+	}
+	if _, output := goal.Schemas(); output != nil {
+		t.Errorf("Expected the output schema to be removed, got %s", output)
+	}
+}
+
+func TestSetSchemasWhileRunning(t *testing.T) {
+	goal := NewJSONGoal("concurrent", "Concurrent", "Schemas replaced while validating", json.RawMessage(`{"text": "hi"}`), json.RawMessage(`{"score": 0.5}`))
+	strict := json.RawMessage(`{"type":"object","properties":{"score":{"type":"number","maximum":1}},"required":["score"]}`)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 200 {
+			schema := strict
+			if i%2 == 0 {
+				schema = nil
+			}
+			if err := goal.SetSchemas(nil, schema); err != nil {
+				t.Errorf("SetSchemas failed: %v", err)
+				return
+			}
+		}
+	}()
+	for range 200 {
+		if err := goal.validateOutput(json.RawMessage(`{"score": 0.5}`)); err != nil {
+			t.Errorf("Valid output should pass with either schema: %v", err)
+		}
+		goal.Schemas()
+	}
+	<-done
+}
+
+func TestAddGoalsRebuildsSchemaValidators(t *testing.T) {
+	manager, _ := CreateLLMangoManger(nil)
+	outputSchema := json.RawMessage(`{"type":"object","properties":{"label":{"type":"string"}},"required":["label"]}`)
+
+	// Goals generated from config or loaded from a save state come without validators
+	manager.AddGoals(&Goal{UID: "loaded", OutputSchema: outputSchema, IsSchemaValidated: true})
+	goal, _ := manager.Goals.Get("loaded")
+	if goal.OutputValidator == nil || goal.OutputValidator(json.RawMessage(`{}`)) == nil {
+		t.Error("AddGoals should build validators from the schema")
+	}
+
+	// Saved schemas don't override goals registered from code or config
+	typed := NewGoal("typed-schema", "Typed", "Typed goal", UserInput{Name: "a", Age: 1}, UserOutput{Message: "m"})
+	manager.AddGoals(typed)
+	manager.AddOrUpdateGoals(&Goal{UID: "typed-schema", Title: "Typed", OutputSchema: outputSchema, IsSchemaValidated: true})
+	if typed.IsSchemaValidated || len(typed.OutputSchema) != 0 {
+		t.Error("AddOrUpdateGoals should not turn a typed goal into a schema validated one")
+	}
+	if err := typed.validateOutput(json.RawMessage(`{"message":"m"}`)); err != nil {
+		t.Errorf("Typed goals should not be checked against saved schemas: %v", err)
+	}
+
+	staleSchema := json.RawMessage(`{"type":"object","properties":{"old":{"type":"string"}},"required":["old"]}`)
+	manager.AddOrUpdateGoals(&Goal{UID: "loaded", OutputSchema: staleSchema, IsSchemaValidated: true})
+	if _, current := goal.Schemas(); string(current) != string(outputSchema) {
+		t.Errorf("A stale saved schema should not replace the registered one, got %s", current)
+	}
+
+	// Goals only known to the save state come with their schemas
+	manager.AddOrUpdateGoals(&Goal{UID: "saved-only", OutputSchema: outputSchema, IsSchemaValidated: true})
+	saved, _ := manager.Goals.Get("saved-only")
+	if saved == nil || saved.OutputValidator == nil || saved.OutputValidator(json.RawMessage(`{}`)) == nil {
+		t.Error("New goals from the save state should get validators from their schema")
+	}
+}
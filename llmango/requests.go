@@ -1,142 +1,193 @@
 package llmango
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
-	"math/rand"
 	"time"
 
 	"github.com/llmang/llmango/openrouter"
 )
 
 func Run[I, R any](l *LLMangoManager, g *Goal, input *I) (*R, error) {
+	if g.Ensemble != nil {
+		ensembleResult, err := RunEnsemble[I, R](l, g, input)
+		if err != nil {
+			return nil, err
+		}
+		return ensembleResult.Result, nil
+	}
 	res, _, err := RunRaw[I, R](l, g, input)
 	return res, err
 }
+
+// RunRaw executes a single call for the goal and also returns the raw OpenRouter response.
+// Ensemble configuration on the goal is ignored here, use RunEnsemble for fan-out execution.
 func RunRaw[I, R any](l *LLMangoManager, g *Goal, input *I) (*R, *openrouter.NonStreamingChatResponse, error) {
-	// Validate input using the goal's validator
-	inputJSON, err := json.Marshal(input)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to marshal input for goal '%s': %w", g.UID, err)
+	return runGoal[I, R](l, g, input, runOptions{})
+}
+
+// runGoal selects a prompt for the goal, executes it and starts the goal's shadow prompts.
+func runGoal[I, R any](l *LLMangoManager, g *Goal, input *I, opts runOptions) (*R, *openrouter.NonStreamingChatResponse, error) {
+	if err := validateGoalInput(g, input); err != nil {
+		return nil, nil, err
 	}
 
-	if g.InputValidator != nil {
-		if err := g.InputValidator(inputJSON); err != nil {
-			return nil, nil, fmt.Errorf("input validation failed for goal '%s': %w", g.UID, err)
-		}
+	selectedPrompt, err := l.selectPromptForGoal(g)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	requestStartTime := float64(time.Now().UnixNano()) / 1e9
-	var res R
-	validPrompts := make(map[string]*Prompt)
-	totalWeight := 0
+	shadows := l.shadowPromptsForGoal(g)
+	if len(shadows) > 0 {
+		opts.groupID = newGroupID()
+	}
 
-	for _, promptUID := range g.PromptUIDs {
-		if !l.Prompts.Exists(promptUID) {
-			continue
-		}
-		prompt, ok := l.Prompts.Get(promptUID)
-		if !ok || prompt == nil {
-			continue
-		}
+	res, resp, err := executePrompt[I, R](l, g, selectedPrompt, input, opts)
+	l.recordCallOutcome(g, selectedPrompt.UID, err)
 
-		if prompt.Weight > 0 {
-			if prompt.IsCanary {
-				if prompt.TotalRuns < prompt.MaxRuns {
-					validPrompts[promptUID] = prompt
-					totalWeight += prompt.Weight
-				}
-			} else {
-				validPrompts[promptUID] = prompt
-				totalWeight += prompt.Weight
-			}
-		}
+	if len(shadows) > 0 {
+		go runShadows[I, R](l, g, shadows, input, selectedPrompt.UID, res, err, opts.groupID)
 	}
 
-	var selectedPrompt *Prompt
-	if len(validPrompts) == 0 {
-		hasBasePrompt := false
-		for _, pUID := range g.PromptUIDs {
-			if l.Prompts.Exists(pUID) {
-				p, ok := l.Prompts.Get(pUID)
-				if ok && p != nil && !p.IsCanary {
-					hasBasePrompt = true
-					break
-				}
-			}
-		}
-		if hasBasePrompt {
-			return nil, nil, fmt.Errorf("no valid prompts available for goal %s", g.UID)
-		} else {
-			return nil, nil, fmt.Errorf("no valid prompts available for goal %s and no base prompt exists or is loaded", g.UID)
-		}
-	}
+	return res, resp, err
+}
 
-	randWeight := rand.Intn(totalWeight)
-	currentWeight := 0
+// runOptions carries per-call settings that are not part of the goal or prompt definition.
+type runOptions struct {
+	// groupID links related calls (e.g. the constituents of an ensemble) together in the logs.
+	groupID string
+	// ctx cancels the in-flight request, nil means context.Background().
+	ctx context.Context
+	// model overrides the prompt's model when set.
+	model string
+	// hedgeRole marks the log entry as the primary or hedge attempt of a hedged call.
+	hedgeRole string
+	// logMetadata adds entries to the log metadata once the call's output is known.
+	logMetadata func(output any) map[string]any
+	// logprobs requests token logprobs, with DEFAULT_TOP_LOGPROBS alternatives unless the prompt sets them.
+	logprobs bool
+}
 
-	promptUIDs := make([]string, 0, len(validPrompts))
-	for uid := range validPrompts {
-		promptUIDs = append(promptUIDs, uid)
+func (o runOptions) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
 	}
+	return o.ctx
+}
 
-	for _, uid := range promptUIDs {
-		prompt := validPrompts[uid]
-		currentWeight += prompt.Weight
-		if randWeight < currentWeight {
-			selectedPrompt = prompt
-			if selectedPrompt.IsCanary {
-				selectedPrompt.TotalRuns++
-			}
-			break
-		}
+// executePrompt runs the selected prompt, hedging the call when the prompt has it enabled.
+func executePrompt[I, R any](l *LLMangoManager, g *Goal, selectedPrompt *Prompt, input *I, opts runOptions) (*R, *openrouter.NonStreamingChatResponse, error) {
+	if selectedPrompt.Hedge != nil && selectedPrompt.Hedge.DelayMs > 0 {
+		return runHedged[I, R](l, g, selectedPrompt, input, opts)
+	}
+	return runPromptRaw[I, R](l, g, selectedPrompt, input, opts)
+}
+
+// validateGoalInput marshals the input and runs it through the goal's input validator.
+func validateGoalInput(g *Goal, input any) error {
+	inputJSON, err := json.Marshal(input)
+	if err != nil {
+		return fmt.Errorf("failed to marshal input for goal '%s': %w", g.UID, err)
 	}
 
-	if selectedPrompt == nil {
-		return nil, nil, errors.New("failed to select prompt after weighted random selection")
+	if err := g.validateInput(inputJSON); err != nil {
+		return fmt.Errorf("input validation failed for goal '%s': %w", g.UID, err)
 	}
+	return nil
+}
+
+// runPromptRaw executes the goal against an already selected prompt. Input validation
+// is expected to have happened before this is called.
+func runPromptRaw[I, R any](l *LLMangoManager, g *Goal, selectedPrompt *Prompt, input *I, opts runOptions) (*R, *openrouter.NonStreamingChatResponse, error) {
+	requestStartTime := float64(time.Now().UnixNano()) / 1e9
+	var res R
 
 	updatedMessages, err := ParseMessages(input, selectedPrompt.Messages)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to update prompt messages with err: %w", err)
 	}
 
+	model := selectedPrompt.Model
+	if opts.model != "" {
+		model = opts.model
+	}
+
 	routerRequest := &openrouter.OpenRouterRequest{
 		Messages:   updatedMessages,
 		Prompt:     nil,
-		Model:      &selectedPrompt.Model,
+		Model:      &model,
 		Parameters: selectedPrompt.Parameters,
 	}
+	if opts.logprobs {
+		enabled := true
+		routerRequest.Parameters.Logprobs = &enabled
+		if routerRequest.Parameters.TopLogprobs == nil {
+			topLogprobs := DEFAULT_TOP_LOGPROBS
+			routerRequest.Parameters.TopLogprobs = &topLogprobs
+		}
+	}
 
-	// Check if model supports structured output to determine execution path
-	supportsStructuredOutput := openrouter.SupportsStructuredOutput(selectedPrompt.Model)
-
-	if supportsStructuredOutput {
-		// Generate response format from output example for structured output
-		var outputExample R
-		if err := json.Unmarshal(g.OutputExample, &outputExample); err != nil {
-			return nil, nil, fmt.Errorf("failed to unmarshal output example for goal '%s': %w", g.UID, err)
+	// Models with structured output or tool calling support get a response format or forced tool,
+	// the others a universal prompt
+	mode := openrouter.SelectStructuredOutputMode(model)
+	usesUniversalPrompt := mode == openrouter.StructuredOutputJSONObject || mode == openrouter.StructuredOutputPrompt
+
+	// The structured output prepares the response format or forced tool for the model's provider
+	// and reads the JSON back from the response
+	structured := &openrouter.StructuredOutput{Mode: openrouter.StructuredOutputPrompt}
+	// universalSchema is the schema described in the universal prompt, free-form replies are checked against it
+	var universalSchema *openrouter.Definition
+	var outputSchema *openrouter.Definition
+	if !usesUniversalPrompt {
+		if _, explicitSchema := g.Schemas(); !isEmptySchema(explicitSchema) {
+			// An explicit schema takes precedence over the one reflected from R
+			outputSchema, err = openrouter.ParseSchema(explicitSchema)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid output schema for goal '%s': %w", g.UID, err)
+			}
+		} else {
+			var outputExample R
+			if err := json.Unmarshal(g.OutputExample, &outputExample); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal output example for goal '%s': %w", g.UID, err)
+			}
+			outputSchema, err = openrouter.GenerateSchemaForTypeWithOptions(outputExample, openrouter.SchemaOptions{Strict: true})
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create JSON schema format: %w", err)
+			}
 		}
 
-		responseFormat, err := openrouter.UseOpenRouterJsonFormat(outputExample, g.Title)
+		structured, err = openrouter.NewStructuredOutput(outputSchema, model, g.Title)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to create JSON schema format: %w", err)
 		}
+		// Schemas the provider can't take, like recursive ones for Gemini, are described in the universal prompt
+		usesUniversalPrompt = structured.Mode == openrouter.StructuredOutputJSONObject || structured.Mode == openrouter.StructuredOutputPrompt
+		if !usesUniversalPrompt {
+			if err := structured.Apply(&routerRequest.Parameters); err != nil {
+				return nil, nil, fmt.Errorf("failed to create JSON schema format: %w", err)
+			}
+		}
+	}
+	if usesUniversalPrompt {
+		jsonMode := mode == openrouter.StructuredOutputJSONObject || structured.Mode == openrouter.StructuredOutputJSONObject
+		structured = &openrouter.StructuredOutput{Mode: openrouter.StructuredOutputPrompt}
 
-		routerRequest.Parameters.ResponseFormat = responseFormat
-	} else {
 		// For models that don't support structured output, use universal prompts
 		// Generate schema for validation from output example
-		schema, err := openrouter.GenerateSchemaFromJSONExample(g.OutputExample)
+		universalSchema, err = g.outputSchemaDefinition(openrouter.SchemaOptions{})
+		if err == nil && universalSchema == nil {
+			err = fmt.Errorf("goal '%s' has no output schema or example", g.UID)
+		}
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to generate schema for universal path: %w", err)
 		}
 
 		// Convert schema to map for universal prompt generation
 		schemaMap := make(map[string]interface{})
-		schemaBytes, err := json.Marshal(schema)
+		schemaBytes, err := json.Marshal(universalSchema)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to marshal schema: %w", err)
 		}
@@ -164,19 +215,45 @@ func RunRaw[I, R any](l *LLMangoManager, g *Goal, input *I) (*R, *openrouter.Non
 		// Update messages with universal system prompt
 		updatedMessages = injectUniversalPromptIntoMessages(updatedMessages, universalPrompt)
 		routerRequest.Messages = updatedMessages
+
+		// Models that only support JSON mode are still asked for a JSON object
+		if jsonMode {
+			structured.Mode = openrouter.StructuredOutputJSONObject
+			structured.Apply(&routerRequest.Parameters)
+		}
+	}
+
+	if l.Preflight != nil {
+		if _, err := routerRequest.Preflight(*l.Preflight); err != nil {
+			l.logRun(g.UID, selectedPrompt.UID, input, routerRequest, nil, nil, 0, err, opts)
+			return nil, nil, fmt.Errorf("preflight check failed for goal %s: %w", g.UID, err)
+		}
 	}
 
-	openrouterResponse, err := l.OpenRouter.GenerateNonStreamingChatResponse(routerRequest)
+	ctx := opts.context()
+	openrouterResponse, err := l.OpenRouter.GenerateNonStreamingChatResponseWithContext(ctx, routerRequest)
 
 	requestTimeElapsed := float64(time.Now().UnixNano())/1e9 - requestStartTime
 
 	if l.RetryRateLimit && errors.Is(err, openrouter.ErrRateLimited) {
 		curDelay := BASE_BACKOFF_DELAY
 		for i := range MAX_BACKOFF_ATTEMPTS {
-			log.Printf("Rate limited. Retrying in %v (Attempt %d/%d)", curDelay, i+1, MAX_BACKOFF_ATTEMPTS)
-			time.Sleep(curDelay)
+			delay := curDelay
+			if retryAfter, ok := openrouter.RetryAfter(err); ok {
+				// The server knows best when the limit resets, its Retry-After replaces the backoff
+				delay = min(retryAfter, MAX_RETRY_AFTER_DELAY)
+			}
+			log.Printf("Rate limited. Retrying in %v (Attempt %d/%d)", delay, i+1, MAX_BACKOFF_ATTEMPTS)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				break
+			}
 			requestTimeStartRetry := float64(time.Now().UnixNano()) / 1e9
-			openrouterResponse, err = l.OpenRouter.GenerateNonStreamingChatResponse(routerRequest)
+			openrouterResponse, err = l.OpenRouter.GenerateNonStreamingChatResponseWithContext(ctx, routerRequest)
 			requestTimeElapsed += float64(time.Now().UnixNano())/1e9 - requestTimeStartRetry
 
 			if err == nil || !errors.Is(err, openrouter.ErrRateLimited) {
@@ -191,82 +268,71 @@ func RunRaw[I, R any](l *LLMangoManager, g *Goal, input *I) (*R, *openrouter.Non
 		}
 	}
 
-	logErr := err
-
-	if logErr != nil {
-		if l.Logging != nil && l.Logging.LogResponse != nil {
-			logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, nil, requestTimeElapsed, true, logErr)
-			if createLogErr != nil {
-				log.Printf("Failed to create log object after API error: %v (Original Error: %v)", createLogErr, logErr)
-			} else {
-				go func(mangoLog *LLMangoLog) {
-					if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-						log.Printf("Failed to log API error response: %v", logErr)
-					}
-				}(logEntry)
-			}
-		}
-		return nil, nil, fmt.Errorf("error generating response from OpenRouter for goal %s: %w", g.UID, logErr)
+	logRun := func(response *openrouter.NonStreamingChatResponse, output any, runErr error) {
+		l.logRun(g.UID, selectedPrompt.UID, input, routerRequest, response, output, requestTimeElapsed, runErr, opts)
+	}
+
+	if err != nil {
+		logRun(openrouterResponse, nil, err)
+		return nil, nil, fmt.Errorf("error generating response from OpenRouter for goal %s: %w", g.UID, err)
 	}
 
 	if openrouterResponse == nil {
-		logErr = errors.New("received nil response from OpenRouter without error")
-		if l.Logging != nil && l.Logging.LogResponse != nil {
-			logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, nil, nil, requestTimeElapsed, true, logErr)
-			if createLogErr == nil {
-				go func(mangoLog *LLMangoLog) {
-					if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-						log.Printf("Failed to log nil response: %v", logErr)
-					}
-				}(logEntry)
-			} else {
-				log.Printf("Failed to create log object for nil response: %v", createLogErr)
-			}
-		}
-		return nil, nil, logErr
+		err = errors.New("received nil response from OpenRouter without error")
+		logRun(nil, nil, err)
+		return nil, nil, err
 	}
 
-	if len(openrouterResponse.Choices) == 0 || openrouterResponse.Choices[0].Message.Content == nil {
-		logErr = errors.New("llm response had 0 choices or nil content")
-		if l.Logging != nil && l.Logging.LogResponse != nil {
-			logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, nil, requestTimeElapsed, true, logErr)
-			if createLogErr == nil {
-				go func(mangoLog *LLMangoLog) {
-					if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-						log.Printf("Failed to log empty choices/content response: %v", logErr)
-					}
-				}(logEntry)
-			} else {
-				log.Printf("Failed to create log object for empty choices/content: %v", createLogErr)
-			}
-		}
-		return nil, nil, logErr
+	if len(openrouterResponse.Choices) == 0 {
+		err = errors.New("llm response had 0 choices or nil content")
+		logRun(openrouterResponse, nil, err)
+		return nil, nil, err
 	}
 
-	content := *openrouterResponse.Choices[0].Message.Content
+	// Forced tool calls answer in the call's arguments, the other modes in the content
+	var content string
+	if structured.Mode == openrouter.StructuredOutputTool {
+		toolOutput, toolErr := toolCallOutput(structured, openrouterResponse.Choices[0].Message, outputSchema)
+		if toolErr != nil {
+			err = fmt.Errorf("llm response had no tool call or nil content: %w", toolErr)
+			logRun(openrouterResponse, nil, err)
+			return nil, nil, err
+		}
+		content = string(toolOutput)
+	} else {
+		var contentErr error
+		content, contentErr = structured.Content(openrouterResponse.Choices[0].Message)
+		if contentErr != nil {
+			err = fmt.Errorf("llm response had 0 choices or nil content: %w", contentErr)
+			logRun(openrouterResponse, nil, err)
+			return nil, nil, err
+		}
+	}
 
 	// Handle response differently based on whether structured output was used
 	var finalContent string
-	if !supportsStructuredOutput {
-		// For universal compatibility path, clean the JSON response
-		cleanedJSON := openrouter.PseudoStructuredResponseCleaner(content)
-		if cleanedJSON == "" {
-			logErr = fmt.Errorf("failed to extract valid JSON from universal compatibility response: %s", content)
-			if l.Logging != nil && l.Logging.LogResponse != nil {
-				logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, nil, requestTimeElapsed, true, logErr)
-				if createLogErr == nil {
-					go func(mangoLog *LLMangoLog) {
-						if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-							log.Printf("Failed to log JSON extraction error response: %v", logErr)
-						}
-					}(logEntry)
-				} else {
-					log.Printf("Failed to create log object for JSON extraction error: %v", createLogErr)
+	if usesUniversalPrompt {
+		// For universal compatibility path, extract the JSON from the free-form response
+		extraction, extractErr := openrouter.ExtractJSON(content, universalSchema)
+		if extractErr != nil {
+			err = fmt.Errorf("failed to extract valid JSON from universal compatibility response: %s", content)
+			logRun(openrouterResponse, nil, err)
+			return nil, nil, err
+		}
+		if len(extraction.Repairs) > 0 {
+			// Keep the repairs visible in the logs, they point at prompts that need work
+			logMetadata := opts.logMetadata
+			opts.logMetadata = func(output any) map[string]any {
+				metadata := map[string]any{"jsonRepairs": extraction.Repairs}
+				if logMetadata != nil {
+					for key, value := range logMetadata(output) {
+						metadata[key] = value
+					}
 				}
+				return metadata
 			}
-			return nil, nil, logErr
 		}
-		finalContent = cleanedJSON
+		finalContent = string(extraction.JSON)
 	} else {
 		// For structured output path, use content directly
 		finalContent = content
@@ -274,54 +340,19 @@ func RunRaw[I, R any](l *LLMangoManager, g *Goal, input *I) (*R, *openrouter.Non
 
 	// Validate output using the goal's validator
 	outputJSON := json.RawMessage(finalContent)
-	if g.OutputValidator != nil {
-		if err := g.OutputValidator(outputJSON); err != nil {
-			logErr = fmt.Errorf("output validation failed for goal '%s': %w", g.UID, err)
-			if l.Logging != nil && l.Logging.LogResponse != nil {
-				logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, nil, requestTimeElapsed, true, logErr)
-				if createLogErr == nil {
-					go func(mangoLog *LLMangoLog) {
-						if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-							log.Printf("Failed to log validation error response: %v", logErr)
-						}
-					}(logEntry)
-				} else {
-					log.Printf("Failed to create log object for validation error: %v", createLogErr)
-				}
-			}
-			return nil, nil, logErr
-		}
+	if validationErr := g.validateOutput(outputJSON); validationErr != nil {
+		err = fmt.Errorf("output validation failed for goal '%s': %w", g.UID, validationErr)
+		logRun(openrouterResponse, nil, err)
+		return nil, nil, err
 	}
 
 	if errUnmarshal := json.Unmarshal([]byte(finalContent), &res); errUnmarshal != nil {
-		logErr = fmt.Errorf("failed to decode response content into target struct: %w, content: %s", errUnmarshal, finalContent)
-		if l.Logging != nil && l.Logging.LogResponse != nil {
-			logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, nil, requestTimeElapsed, true, logErr)
-			if createLogErr == nil {
-				go func(mangoLog *LLMangoLog) {
-					if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-						log.Printf("Failed to log decoding error response: %v", logErr)
-					}
-				}(logEntry)
-			} else {
-				log.Printf("Failed to create log object for decoding error: %v", createLogErr)
-			}
-		}
-		return nil, nil, logErr
+		err = fmt.Errorf("failed to decode response content into target struct: %w, content: %s", errUnmarshal, finalContent)
+		logRun(openrouterResponse, nil, err)
+		return nil, nil, err
 	}
 
-	if l.Logging != nil && l.Logging.LogResponse != nil {
-		logEntry, createLogErr := l.createLogObject(g.UID, selectedPrompt.UID, input, routerRequest, openrouterResponse, &res, requestTimeElapsed, true, nil) // Pass nil for error
-		if createLogErr != nil {
-			log.Printf("Failed to create log object for successful response: %v", createLogErr)
-		} else {
-			go func(mangoLog *LLMangoLog) {
-				if logErr := l.Logging.LogResponse(mangoLog); logErr != nil {
-					log.Printf("Failed to log successful response: %v", logErr)
-				}
-			}(logEntry)
-		}
-	}
+	logRun(openrouterResponse, &res, nil)
 
 	return &res, openrouterResponse, nil
 }
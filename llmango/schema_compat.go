@@ -0,0 +1,102 @@
+package llmango
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// SchemaCompatibility describes how a proposed schema change affects a goal's callers and prompts
+type SchemaCompatibility struct {
+	Input  []openrouter.SchemaChange `json:"input,omitempty"`
+	Output []openrouter.SchemaChange `json:"output,omitempty"`
+	// PromptIssues lists prompt variables that are no longer part of the input schema
+	PromptIssues []string `json:"promptIssues,omitempty"`
+}
+
+// Breaking reports whether applying the change would break existing callers, code or prompts
+func (c *SchemaCompatibility) Breaking() bool {
+	return len(openrouter.BreakingChanges(c.Input)) > 0 || len(openrouter.BreakingChanges(c.Output)) > 0 || len(c.PromptIssues) > 0
+}
+
+// CheckSchemaCompatibility compares a goal's current schemas with proposed ones before they are applied.
+// An empty proposed schema keeps the current one and JSON null removes it, falling back to the examples.
+// Input changes are also checked against the variables used by the goal's prompts.
+func (m *LLMangoManager) CheckSchemaCompatibility(goal *Goal, inputSchema, outputSchema json.RawMessage) (*SchemaCompatibility, error) {
+	opts := openrouter.SchemaOptions{}
+	goal.schemaMu.RLock()
+	currentInput, currentOutput := goal.InputSchema, goal.OutputSchema
+	inputExamples, outputExamples := goal.allInputExamples(), goal.allOutputExamples()
+	goal.schemaMu.RUnlock()
+	if len(inputSchema) == 0 {
+		inputSchema = currentInput
+	}
+	if len(outputSchema) == 0 {
+		outputSchema = currentOutput
+	}
+
+	oldInput, err := goal.inputSchemaDefinition(opts)
+	if err != nil {
+		return nil, fmt.Errorf("current input schema: %w", err)
+	}
+	oldOutput, err := goal.outputSchemaDefinition(opts)
+	if err != nil {
+		return nil, fmt.Errorf("current output schema: %w", err)
+	}
+	newInput, err := schemaDefinition(inputSchema, inputExamples, opts)
+	if err != nil {
+		return nil, fmt.Errorf("input schema: %w", err)
+	}
+	newOutput, err := schemaDefinition(outputSchema, outputExamples, opts)
+	if err != nil {
+		return nil, fmt.Errorf("output schema: %w", err)
+	}
+
+	compatibility := &SchemaCompatibility{}
+	if oldInput != nil && newInput != nil {
+		compatibility.Input = openrouter.DiffSchemas(oldInput, newInput, openrouter.SchemaRoleInput)
+	}
+	if oldOutput != nil && newOutput != nil {
+		compatibility.Output = openrouter.DiffSchemas(oldOutput, newOutput, openrouter.SchemaRoleOutput)
+	}
+	compatibility.PromptIssues = m.missingPromptVariables(goal.UID, oldInput, newInput)
+	return compatibility, nil
+}
+
+// missingPromptVariables describes the variables used by a goal's prompts that the new input schema no longer defines
+func (m *LLMangoManager) missingPromptVariables(goalUID string, oldSchema, newSchema *openrouter.Definition) []string {
+	var issues []string
+	for _, prompt := range m.Prompts.Snapshot() {
+		if prompt == nil || prompt.GoalUID != goalUID {
+			continue
+		}
+		for _, variable := range MissingPromptVariables(prompt.Messages, oldSchema, newSchema) {
+			issues = append(issues, fmt.Sprintf("prompt %s uses {{%s}} which is not in the input schema", prompt.UID, variable))
+		}
+	}
+	sort.Strings(issues)
+	return issues
+}
+
+// MissingPromptVariables returns the template variables of the messages that a changed input schema no
+// longer defines. Variables the previous schema already lacked aren't caused by the change, unless the
+// previous schema had no properties to compare with. Nothing is reported when the new schema has no properties.
+func MissingPromptVariables(messages []openrouter.Message, oldSchema, newSchema *openrouter.Definition) []string {
+	if newSchema == nil || newSchema.Properties == nil {
+		return nil
+	}
+	var missing []string
+	for _, variable := range TemplateVariables(messages) {
+		if !hasProperty(newSchema, variable) && (oldSchema == nil || oldSchema.Properties == nil || hasProperty(oldSchema, variable)) {
+			missing = append(missing, variable)
+		}
+	}
+	return missing
+}
+
+func hasProperty(schema *openrouter.Definition, name string) bool {
+	_, ok := schema.Properties[name]
+	return ok
+}
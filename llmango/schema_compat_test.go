@@ -0,0 +1,62 @@
+package llmango
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+func TestCheckSchemaCompatibility(t *testing.T) {
+	manager, _ := CreateLLMangoManger(nil)
+	goal := NewJSONGoal("compat", "Compat", "Schema compatibility", json.RawMessage(`{"text": "hi", "lang": "en"}`), json.RawMessage(`{"label": "spam", "score": 0.5}`))
+	manager.AddGoals(goal)
+	manager.AddPrompts(&Prompt{UID: "compat-prompt", GoalUID: "compat", Messages: []openrouter.Message{
+		{Role: "user", Content: "Classify {{text}}{{#if lang}} written in {{lang}}{{/if}}"},
+	}})
+
+	// Adding an optional output field is compatible
+	compat, err := manager.CheckSchemaCompatibility(goal, nil, json.RawMessage(`{"type":"object","properties":{"label":{"type":"string"},"score":{"type":"number"},"reason":{"type":"string"}},"required":["label","score"]}`))
+	if err != nil {
+		t.Fatalf("CheckSchemaCompatibility failed: %v", err)
+	}
+	if compat.Breaking() || len(compat.Output) != 1 || compat.Output[0].Kind != openrouter.SchemaFieldAdded {
+		t.Errorf("Expected a compatible field addition, got %+v", compat)
+	}
+
+	// Changing an output type and dropping an input field used by the prompt break
+	compat, err = manager.CheckSchemaCompatibility(goal,
+		json.RawMessage(`{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]}`),
+		json.RawMessage(`{"type":"object","properties":{"label":{"type":"integer"},"score":{"type":"number"}},"required":["label","score"]}`))
+	if err != nil {
+		t.Fatalf("CheckSchemaCompatibility failed: %v", err)
+	}
+	if !compat.Breaking() || len(openrouter.BreakingChanges(compat.Output)) != 1 {
+		t.Errorf("Expected the label type change to break, got %+v", compat)
+	}
+	if len(compat.PromptIssues) != 1 || compat.PromptIssues[0] != "prompt compat-prompt uses {{lang}} which is not in the input schema" {
+		t.Errorf("Expected the prompt variable lang to be reported, got %v", compat.PromptIssues)
+	}
+
+	if _, err := manager.CheckSchemaCompatibility(goal, nil, json.RawMessage(`{"type": 42}`)); err == nil {
+		t.Error("Expected invalid schemas to be rejected")
+	}
+}
+
+func TestMissingPromptVariables(t *testing.T) {
+	messages := []openrouter.Message{{Role: "user", Content: "{{text}} {{lang}} {{extra}}"}}
+	oldSchema := &openrouter.Definition{Type: openrouter.Object, Properties: map[string]openrouter.Definition{"text": {}, "lang": {}}}
+	newSchema := &openrouter.Definition{Type: openrouter.Object, Properties: map[string]openrouter.Definition{"text": {}}}
+
+	// extra was already missing before the change
+	if missing := MissingPromptVariables(messages, oldSchema, newSchema); len(missing) != 1 || missing[0] != "lang" {
+		t.Errorf("Expected only lang to be reported, got %v", missing)
+	}
+	// Without previous properties every variable missing from the new schema is reported
+	if missing := MissingPromptVariables(messages, &openrouter.Definition{Type: openrouter.Object}, newSchema); len(missing) != 2 {
+		t.Errorf("Expected lang and extra to be reported, got %v", missing)
+	}
+	if missing := MissingPromptVariables(messages, oldSchema, &openrouter.Definition{Type: openrouter.Object}); missing != nil {
+		t.Errorf("Expected nothing to be reported for a schema without properties, got %v", missing)
+	}
+}
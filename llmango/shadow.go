@@ -0,0 +1,145 @@
+package llmango
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+)
+
+// ShadowComparison describes how a shadow output differs from the served output.
+type ShadowComparison struct {
+	Match           bool     `json:"match"`
+	MatchedFields   int      `json:"matchedFields"`
+	TotalFields     int      `json:"totalFields"`
+	DifferingFields []string `json:"differingFields,omitempty"`
+}
+
+// ShadowResult is passed to LLMangoManager.OnShadowResult after a shadow prompt ran.
+// Comparison is nil when either the served or the shadow call failed.
+type ShadowResult struct {
+	GroupID         string            `json:"groupID"`
+	GoalUID         string            `json:"goalUID"`
+	ServedPromptUID string            `json:"servedPromptUID"`
+	ShadowPromptUID string            `json:"shadowPromptUID"`
+	ShadowOutput    json.RawMessage   `json:"shadowOutput,omitempty"`
+	Comparison      *ShadowComparison `json:"comparison,omitempty"`
+	Error           error             `json:"-"`
+}
+
+// CompareFields is the default shadow comparator. It compares the top level fields of
+// two JSON objects, values that are not objects are compared as a whole.
+func CompareFields(served, shadow json.RawMessage) ShadowComparison {
+	var servedValue, shadowValue any
+	servedErr := json.Unmarshal(served, &servedValue)
+	shadowErr := json.Unmarshal(shadow, &shadowValue)
+	if servedErr != nil || shadowErr != nil {
+		return ShadowComparison{TotalFields: 1}
+	}
+
+	servedObj, servedIsObj := servedValue.(map[string]any)
+	shadowObj, shadowIsObj := shadowValue.(map[string]any)
+	if !servedIsObj || !shadowIsObj {
+		if reflect.DeepEqual(servedValue, shadowValue) {
+			return ShadowComparison{Match: true, MatchedFields: 1, TotalFields: 1}
+		}
+		return ShadowComparison{TotalFields: 1}
+	}
+
+	keys := make(map[string]bool)
+	for key := range servedObj {
+		keys[key] = true
+	}
+	for key := range shadowObj {
+		keys[key] = true
+	}
+
+	comparison := ShadowComparison{TotalFields: len(keys)}
+	for key := range keys {
+		servedField, inServed := servedObj[key]
+		shadowField, inShadow := shadowObj[key]
+		if inServed && inShadow && reflect.DeepEqual(servedField, shadowField) {
+			comparison.MatchedFields++
+		} else {
+			comparison.DifferingFields = append(comparison.DifferingFields, key)
+		}
+	}
+	sort.Strings(comparison.DifferingFields)
+	comparison.Match = comparison.MatchedFields == comparison.TotalFields
+	return comparison
+}
+
+// shadowPromptsForGoal returns the shadow prompts of the goal that were sampled for this call
+func (m *LLMangoManager) shadowPromptsForGoal(goal *Goal) []*Prompt {
+	var shadows []*Prompt
+	for _, promptUID := range goal.PromptUIDs {
+		prompt, ok := m.Prompts.Get(promptUID)
+		if !ok || prompt == nil || !prompt.IsShadow {
+			continue
+		}
+		if rand.Float64() >= prompt.ShadowSampleRate {
+			continue
+		}
+		shadows = append(shadows, prompt)
+	}
+	return shadows
+}
+
+// runShadows runs the sampled shadow prompts on the same input as the served call and
+// compares their outputs with the served output. Shadow outputs are logged under the
+// served call's GroupID with the comparison in the log metadata, they are never returned.
+func runShadows[I, R any](l *LLMangoManager, g *Goal, shadows []*Prompt, input *I, servedPromptUID string, served *R, servedErr error, groupID string) {
+	var servedJSON json.RawMessage
+	if servedErr == nil && served != nil {
+		servedJSON, _ = json.Marshal(served)
+	}
+
+	comparator := l.ShadowComparator
+	if comparator == nil {
+		comparator = CompareFields
+	}
+
+	for _, shadow := range shadows {
+		result := ShadowResult{
+			GroupID:         groupID,
+			GoalUID:         g.UID,
+			ServedPromptUID: servedPromptUID,
+			ShadowPromptUID: shadow.UID,
+		}
+
+		opts := runOptions{
+			groupID: groupID,
+			logMetadata: func(output any) map[string]any {
+				metadata := map[string]any{"shadowOf": servedPromptUID}
+				if servedJSON == nil || output == nil {
+					return metadata
+				}
+				shadowJSON, err := json.Marshal(output)
+				if err != nil {
+					return metadata
+				}
+				comparison := comparator(servedJSON, shadowJSON)
+				result.ShadowOutput = shadowJSON
+				result.Comparison = &comparison
+				metadata["comparison"] = comparison
+				return metadata
+			},
+		}
+
+		// The comparison is computed while logging, so it is only available when logging is set up
+		output, _, err := runPromptRaw[I, R](l, g, shadow, input, opts)
+		if err != nil {
+			result.Error = fmt.Errorf("shadow prompt %s failed: %w", shadow.UID, err)
+		} else if result.Comparison == nil && servedJSON != nil {
+			shadowJSON, _ := json.Marshal(output)
+			comparison := comparator(servedJSON, shadowJSON)
+			result.ShadowOutput = shadowJSON
+			result.Comparison = &comparison
+		}
+
+		if l.OnShadowResult != nil {
+			l.OnShadowResult(result)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package llmango
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func TestCompareFields(t *testing.T) {
+	comparison := CompareFields(
+		json.RawMessage(`{"label": "spam", "score": 1, "tags": ["a"]}`),
+		json.RawMessage(`{"label": "spam", "score": 2, "extra": true, "tags": ["a"]}`),
+	)
+	testhelpers.AssertFalse(t, comparison.Match, "Outputs with differing fields should not match")
+	testhelpers.AssertEqual(t, 4, comparison.TotalFields, "All fields of both outputs should be compared")
+	testhelpers.AssertEqual(t, 2, comparison.MatchedFields, "label and tags should match")
+	testhelpers.AssertEqual(t, "extra,score", strings.Join(comparison.DifferingFields, ","), "Differing fields should be sorted")
+
+	comparison = CompareFields(json.RawMessage(`"yes"`), json.RawMessage(`"yes"`))
+	testhelpers.AssertTrue(t, comparison.Match, "Equal non-object outputs should match")
+}
+
+func TestShadowPromptsNeverServe(t *testing.T) {
+	manager, err := CreateLLMangoManger(nil)
+	testhelpers.RequireNoError(t, err, "Failed to create manager")
+
+	goal := createTestTypedGoal()
+	served := createTestPrompt("openai/gpt-4o", "served")
+	shadow := createTestPrompt("anthropic/claude-3-sonnet", "shadow")
+	shadow.IsShadow = true
+	shadow.Weight = 1000
+
+	manager.AddGoals(goal)
+	manager.AddPrompts(served, shadow)
+	goal.PromptUIDs = []string{served.UID, shadow.UID}
+
+	for range 20 {
+		selected, err := manager.selectPromptForGoal(goal)
+		testhelpers.RequireNoError(t, err, "Should select a prompt")
+		testhelpers.AssertEqual(t, served.UID, selected.UID, "Shadow prompts should never be selected")
+	}
+
+	shadows := manager.shadowPromptsForGoal(goal)
+	testhelpers.AssertEqual(t, 0, len(shadows), "Shadow prompt without sample rate should never run")
+
+	shadow.ShadowSampleRate = 1
+	for range 20 {
+		testhelpers.AssertEqual(t, 1, len(manager.shadowPromptsForGoal(goal)), "Shadow prompt with sample rate 1 should run on every call")
+	}
+
+	shadow.ShadowSampleRate = 0.000001
+	sampled := 0
+	for range 100 {
+		sampled += len(manager.shadowPromptsForGoal(goal))
+	}
+	testhelpers.AssertTrue(t, sampled < 5, "Tiny sample rate should rarely run the shadow, ran %d times", sampled)
+}
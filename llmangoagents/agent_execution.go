@@ -2,6 +2,7 @@ package llmangoagents
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -157,7 +158,7 @@ func (agentCtx *AgentExecutionContext) Execute(input string, agent *Agent) (stri
 	}
 
 	fmt.Printf("🌐 Making LLM request for agent '%s'...\n", agent.UID)
-	response, err := agentCtx.ParentStepContext.ParentWorkflowContext.SystemManager.Openrouter.GenerateNonStreamingChatResponse(req)
+	response, err := agentCtx.generateResponse(req, agent)
 	if err != nil {
 		fmt.Printf("❌ LLM request failed for agent '%s': %v\n", agent.UID, err)
 		return "", err
@@ -172,7 +173,7 @@ func (agentCtx *AgentExecutionContext) Execute(input string, agent *Agent) (stri
 	// Update step-level conversation history with agent name for clarity
 	responseMsg := openrouter.Message{
 		Role:    response.Choices[0].Message.Role,
-		Content: fmt.Sprintf("[%s]: %s", agent.Name, *response.Choices[0].Message.Content),
+		Content: fmt.Sprintf("[%s]: %s", agent.Name, messageContent(response.Choices[0].Message)),
 	}
 	newMessages := []openrouter.Message{
 		{Role: "user", Content: currentInput},
@@ -204,14 +205,51 @@ func (agentCtx *AgentExecutionContext) Execute(input string, agent *Agent) (stri
 		return agentCtx.processToolCalls(response.Choices[0].Message.ToolCalls, agent)
 	}
 
-	finalResponse := *response.Choices[0].Message.Content
+	finalResponse := messageContent(response.Choices[0].Message)
 	fmt.Printf("💬 Agent '%s' final response: %s\n", agent.UID, finalResponse)
 	return finalResponse, nil
 }
 
 // Helper functions
+
+// generateResponse makes the LLM call for an agent, streaming it when the system has a stream hook.
+// The request is preflighted against the model's context window when the system has preflight options.
+// Streamed responses are assembled into the same shape as non streaming ones.
+func (agentCtx *AgentExecutionContext) generateResponse(req *openrouter.OpenRouterRequest, agent *Agent) (*openrouter.NonStreamingChatResponse, error) {
+	systemManager := agentCtx.ParentStepContext.ParentWorkflowContext.SystemManager
+	if systemManager.Preflight != nil {
+		result, err := req.Preflight(*systemManager.Preflight)
+		if err != nil {
+			return nil, fmt.Errorf("preflight check failed for agent '%s': %w", agent.UID, err)
+		}
+		if result.DroppedMessages > 0 {
+			fmt.Printf("✂️  Dropped %d history messages for agent '%s' to fit the context window\n", result.DroppedMessages, agent.UID)
+		}
+	}
+
+	if systemManager.OnStreamEvent == nil {
+		return systemManager.Openrouter.GenerateNonStreamingChatResponse(req)
+	}
+
+	return systemManager.Openrouter.GenerateStreamingChatResponseAccumulated(context.Background(), req, func(event openrouter.StreamEvent) {
+		systemManager.OnStreamEvent(agent.UID, event)
+	})
+}
+
+// messageContent returns the text content of a response message, tool call responses may have none
+func messageContent(message openrouter.ResponseMessage) string {
+	if message.Content == nil {
+		return ""
+	}
+	return *message.Content
+}
+
 func runPreprocessor(preprocessorName string, agent *Agent, input string, agentCtx *AgentExecutionContext) string {
-	// TODO: Implement actual preprocessor lookup and execution
+	switch preprocessorName {
+	case "preRag":
+		return preRag(agent, input, agentCtx)
+	}
+	// TODO: Implement the remaining preprocessors
 	return ""
 }
 
@@ -589,7 +627,7 @@ func (agentCtx *AgentExecutionContext) makeRawOpenRouterRequest(requestJSON []by
 	}
 
 	// Create the HTTP request
-	req, err := http.NewRequest("POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(requestJSON))
+	req, err := http.NewRequest("POST", openRouter.URL("/chat/completions"), bytes.NewBuffer(requestJSON))
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -599,7 +637,7 @@ func (agentCtx *AgentExecutionContext) makeRawOpenRouterRequest(requestJSON []by
 	req.Header.Set("Authorization", "Bearer "+openRouter.ApiKey)
 
 	// Send the request
-	client := &http.Client{Timeout: 5 * time.Minute}
+	client := openRouter.HTTPClient(5 * time.Minute)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
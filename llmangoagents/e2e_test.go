@@ -0,0 +1,129 @@
+package llmangoagents
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/llmang/llmango/openrouter"
+	"github.com/llmang/llmango/openrouter/openroutertest"
+)
+
+// newToolLoopSystem creates a single agent system with a weather tool talking to a fake OpenRouter server
+func newToolLoopSystem(t *testing.T, calls *[]string) (*AgentSystemManager, *openroutertest.Server) {
+	t.Helper()
+	server := openroutertest.NewServer()
+	t.Cleanup(server.Close)
+
+	weatherTool := Tool{
+		Uid:         "get_weather",
+		Name:        "get_weather",
+		Description: "Returns the weather for a city",
+		InputSchema: `{"type": "object", "properties": {"city": {"type": "string"}}, "required": ["city"]}`,
+		Function: func(secrets map[string]string, input json.RawMessage) (json.RawMessage, error) {
+			*calls = append(*calls, string(input))
+			return json.RawMessage(`{"temperature": 21}`), nil
+		},
+	}
+	config := GetTestConfig()
+	config.Tools = []Tool{weatherTool}
+	config.Agents[0].Model = "openai/gpt-4o"
+	config.Agents[0].Tools = []string{"get_weather"}
+
+	asm, err := CreateAgentSystemManager(config)
+	if err != nil {
+		t.Fatalf("Failed to create agent system: %v", err)
+	}
+	asm.Openrouter = server.Client()
+	return asm, server
+}
+
+func TestAgentToolLoopEndToEnd(t *testing.T) {
+	var calls []string
+	asm, server := newToolLoopSystem(t, &calls)
+	server.Script("openai/gpt-4o",
+		openroutertest.Reply{ToolCalls: []openrouter.ToolCall{{ID: "call_weather", Function: openrouter.ToolCallFunction{Name: "get_weather", Arguments: `{"city": "Paris"}`}}}},
+		openroutertest.Reply{Content: "It is 21 degrees in Paris."},
+	)
+
+	instance, err := asm.StartNewWorkflowInstance("test_workflow", 1, "What is the weather in Paris?")
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if !strings.Contains(instance.Context.GlobalKeyBank["final_result"], "21 degrees") {
+		t.Errorf("Expected the final answer after the tool call, got %q", instance.Context.GlobalKeyBank["final_result"])
+	}
+	if len(calls) != 1 || !strings.Contains(calls[0], "Paris") {
+		t.Errorf("Expected the tool to be called once with the arguments, got %v", calls)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 2 {
+		t.Fatalf("Expected two chat requests, got %d", len(requests))
+	}
+	if !strings.Contains(string(requests[0].Body), `"get_weather"`) {
+		t.Error("Expected the tool definition in the first request")
+	}
+	if !strings.Contains(string(requests[1].Body), `"tool_call_id":"call_weather"`) || !strings.Contains(string(requests[1].Body), "temperature") {
+		t.Errorf("Expected the tool result in the follow-up request, got %s", requests[1].Body)
+	}
+}
+
+func TestAgentStreamingHookEndToEnd(t *testing.T) {
+	var calls []string
+	asm, server := newToolLoopSystem(t, &calls)
+	server.Script("openai/gpt-4o", openroutertest.Reply{Content: "Sunny all week."})
+
+	var text strings.Builder
+	asm.OnStreamEvent = func(agentUID string, event openrouter.StreamEvent) {
+		if agentUID == "test_agent" && event.Type == openrouter.StreamEventTextDelta {
+			text.WriteString(event.Text)
+		}
+	}
+
+	instance, err := asm.StartNewWorkflowInstance("test_workflow", 1, "Weather forecast?")
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if text.String() != "Sunny all week." || !strings.Contains(instance.Context.GlobalKeyBank["final_result"], "Sunny all week.") {
+		t.Errorf("Expected streamed text deltas and the assembled result, got %q and %q", text.String(), instance.Context.GlobalKeyBank["final_result"])
+	}
+	if chats := server.ChatRequests(); len(chats) != 1 || chats[0].Stream == nil || !*chats[0].Stream {
+		t.Error("Expected a streaming request when the stream hook is set")
+	}
+}
+
+func TestAgentPreRagEndToEnd(t *testing.T) {
+	var calls []string
+	asm, server := newToolLoopSystem(t, &calls)
+	asm.Agents[0].PreProcessors = []string{"preRag"}
+	server.Script("openai/gpt-4o", openroutertest.Reply{Content: "Bring an umbrella."})
+
+	asm.RagIndex = NewRagIndex(asm.Openrouter, "test/embed")
+	asm.RagIndex.TopK = 1
+	err := asm.RagIndex.AddDocuments(context.Background(),
+		RagDocument{ID: "rain", Text: "It rains a lot in Paris in autumn"},
+		RagDocument{ID: "stocks", Text: "Stock markets closed higher today"},
+	)
+	if err != nil {
+		t.Fatalf("Failed to index documents: %v", err)
+	}
+
+	results, err := asm.RagIndex.Search(context.Background(), "Should I pack for rain in Paris?")
+	if err != nil || len(results) != 1 || results[0].Document.ID != "rain" {
+		t.Fatalf("Expected the rain document to be retrieved, got %+v (%v)", results, err)
+	}
+
+	if _, err := asm.StartNewWorkflowInstance("test_workflow", 1, "Should I pack for rain in Paris?"); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	chats := server.ChatRequests()
+	if len(chats) != 1 {
+		t.Fatalf("Expected one chat request, got %d", len(chats))
+	}
+	body, _ := json.Marshal(chats[0].Messages)
+	if !strings.Contains(string(body), "It rains a lot in Paris") || strings.Contains(string(body), "Stock markets") {
+		t.Errorf("Expected only the retrieved document in the agent's messages, got %s", body)
+	}
+}
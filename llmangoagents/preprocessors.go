@@ -1,6 +1,8 @@
 package llmangoagents
 
 import (
+	"context"
+	"fmt"
 	"strings"
 )
 
@@ -13,11 +15,40 @@ func preThink(ag *Agent, input string) string {
 	return ""
 }
 
-func preRag(ag *Agent, input string) string {
-	// TODO: This function needs to be updated to work with the new execution context system
-	// The original implementation had syntax errors and referenced non-existent fields
-	// For now, return empty string to avoid compilation errors
-	return ""
+// preRag retrieves the documents of the system's RagIndex most similar to the input and
+// prepends them as context. It returns an empty string (input unchanged) when nothing is found.
+func preRag(ag *Agent, input string, agentCtx *AgentExecutionContext) string {
+	if agentCtx == nil || agentCtx.ParentStepContext == nil || agentCtx.ParentStepContext.ParentWorkflowContext == nil {
+		return ""
+	}
+	index := agentCtx.ParentStepContext.ParentWorkflowContext.SystemManager.RagIndex
+	if index == nil {
+		return ""
+	}
+
+	results, err := index.Search(context.Background(), input)
+	if err != nil {
+		fmt.Printf("❌ RAG retrieval failed for agent '%s': %v\n", ag.UID, err)
+		return ""
+	}
+	if len(results) == 0 {
+		return ""
+	}
+	if agentCtx.PreprocessorResults == nil {
+		agentCtx.PreprocessorResults = make(map[string]interface{})
+	}
+	agentCtx.PreprocessorResults["preRag"] = results
+
+	var builder strings.Builder
+	builder.WriteString("Relevant context:\n")
+	for _, result := range results {
+		builder.WriteString("- ")
+		builder.WriteString(result.Document.Text)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n")
+	builder.WriteString(input)
+	return builder.String()
 }
 
 //========================================================
@@ -0,0 +1,122 @@
+package llmangoagents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// DEFAULT_RAG_TOP_K is the number of documents retrieved when RagIndex.TopK is not set
+const DEFAULT_RAG_TOP_K = 3
+
+// RagDocument is a piece of text that can be retrieved for agents using the preRag preprocessor
+type RagDocument struct {
+	ID     string
+	Text   string
+	Vector []float64 // embedded by AddDocuments when empty
+}
+
+// RagResult is a retrieved document with its cosine similarity to the query
+type RagResult struct {
+	Document RagDocument
+	Score    float64
+}
+
+// RagIndex is an in-memory vector index backed by the OpenRouter embeddings endpoint
+type RagIndex struct {
+	Openrouter *openrouter.OpenRouter
+	Model      string // embedding model used for documents and queries
+	Dimensions *int
+	TopK       int     // documents retrieved per query, DEFAULT_RAG_TOP_K when 0
+	MinScore   float64 // documents scoring below are never retrieved
+
+	mu        sync.RWMutex
+	documents []RagDocument
+}
+
+// NewRagIndex creates an empty index embedding with the given model
+func NewRagIndex(o *openrouter.OpenRouter, model string) *RagIndex {
+	return &RagIndex{Openrouter: o, Model: model}
+}
+
+// AddDocuments embeds the documents without a vector and adds them to the index
+func (idx *RagIndex) AddDocuments(ctx context.Context, documents ...RagDocument) error {
+	var texts []string
+	var missing []int
+	for i, document := range documents {
+		if len(document.Vector) == 0 {
+			texts = append(texts, document.Text)
+			missing = append(missing, i)
+		}
+	}
+
+	documents = append([]RagDocument(nil), documents...)
+	if len(texts) > 0 {
+		vectors, err := idx.embed(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed documents: %w", err)
+		}
+		for i, position := range missing {
+			documents[position].Vector = vectors[i]
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.documents = append(idx.documents, documents...)
+	return nil
+}
+
+// Len returns the number of indexed documents
+func (idx *RagIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.documents)
+}
+
+// Search returns the documents most similar to the query, best first
+func (idx *RagIndex) Search(ctx context.Context, query string) ([]RagResult, error) {
+	vectors, err := idx.embed(ctx, []string{query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	idx.mu.RLock()
+	results := make([]RagResult, 0, len(idx.documents))
+	for _, document := range idx.documents {
+		score := openrouter.CosineSimilarity(vectors[0], document.Vector)
+		if score > 0 && score >= idx.MinScore {
+			results = append(results, RagResult{Document: document, Score: score})
+		}
+	}
+	idx.mu.RUnlock()
+
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	topK := idx.TopK
+	if topK <= 0 {
+		topK = DEFAULT_RAG_TOP_K
+	}
+	if len(results) > topK {
+		results = results[:topK]
+	}
+	return results, nil
+}
+
+func (idx *RagIndex) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if idx.Openrouter == nil {
+		return nil, errors.New("rag index has no OpenRouter client")
+	}
+	response, err := idx.Openrouter.CreateEmbeddings(ctx, &openrouter.EmbeddingRequest{
+		Model:      idx.Model,
+		Input:      texts,
+		Dimensions: idx.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return response.Vectors(), nil
+}
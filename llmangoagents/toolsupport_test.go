@@ -1,6 +1,10 @@
 package llmangoagents
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/llmang/llmango/openrouter"
+)
 
 func TestIsToolCallingSupported(t *testing.T) {
 	// Test cases for models that should support tool calling
@@ -36,13 +40,13 @@ func TestIsToolCallingSupported(t *testing.T) {
 
 func TestToolCallingSupportedModelsMapStructure(t *testing.T) {
 	// Verify the map is not nil
-	if toolCallingSupportedModels == nil {
-		t.Error("toolCallingSupportedModels map should not be nil")
+	if openrouter.ToolCallingModels == nil {
+		t.Error("ToolCallingModels map should not be nil")
 	}
 
 	// Verify the map has entries
-	if len(toolCallingSupportedModels) == 0 {
-		t.Error("toolCallingSupportedModels map should have entries")
+	if len(openrouter.ToolCallingModels) == 0 {
+		t.Error("ToolCallingModels map should have entries")
 	}
 
 	// Verify a few known models exist in the map
@@ -53,8 +57,8 @@ func TestToolCallingSupportedModelsMapStructure(t *testing.T) {
 	}
 
 	for _, model := range knownModels {
-		if _, exists := toolCallingSupportedModels[model]; !exists {
-			t.Errorf("Expected model %s to exist in toolCallingSupportedModels map", model)
+		if _, exists := openrouter.ToolCallingModels[model]; !exists {
+			t.Errorf("Expected model %s to exist in ToolCallingModels map", model)
 		}
 	}
 }
@@ -92,6 +92,18 @@ type AgentSystemManager struct {
 	GlobalKeyBank        map[string]string      //stores global kvs for toolcalls if needed?
 	CompatabillityCutoff int                    //unix timestamp for last point of compatability (point where users can/cannot pick back up a conversation)//for vresioning potentially?
 
+	// OnStreamEvent switches agent LLM calls to streaming when set, it receives every
+	// stream event (text deltas, tool calls, finish and usage) of the calling agent.
+	OnStreamEvent func(agentUID string, event openrouter.StreamEvent)
+
+	// Preflight checks agent requests against the model's context window when set,
+	// with TruncateHistory it drops the oldest conversation history instead of failing.
+	Preflight *openrouter.PreflightOptions
+
+	// RagIndex is searched by agents with the "preRag" preprocessor, the retrieved
+	// documents are prepended to the agent's input.
+	RagIndex *RagIndex
+
 	HTTPToolConfigs []*HTTPToolBuilderConfig `json:"customTools"` //For sending the list over the wire the rest can be "reconstructued"
 
 	Tools     []*Tool
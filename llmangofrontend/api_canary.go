@@ -0,0 +1,62 @@
+package llmangofrontend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/llmang/llmango/llmango"
+)
+
+// handleGetCanaryDecisions returns the canary audit trail, optionally filtered by the goalUID query parameter
+func (r *APIRouter) handleGetCanaryDecisions(w http.ResponseWriter, req *http.Request) {
+	if r.LLMangoManager == nil {
+		ServerError(w, fmt.Errorf("LLMangoManager not initialized"))
+		return
+	}
+
+	decisions := r.LLMangoManager.CanaryAuditTrail(req.URL.Query().Get("goalUID"))
+	if decisions == nil {
+		decisions = []llmango.CanaryDecision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decisions)
+}
+
+// handleEvaluateCanaries runs the canary controller for a goal with the default policy
+func (r *APIRouter) handleEvaluateCanaries(w http.ResponseWriter, req *http.Request) {
+	goalUID := req.PathValue("goaluid")
+	if goalUID == "" {
+		BadRequest(w, "Missing goal UID")
+		return
+	}
+
+	if r.LLMangoManager == nil {
+		ServerError(w, fmt.Errorf("LLMangoManager not initialized"))
+		return
+	}
+
+	if !r.LLMangoManager.Goals.Exists(goalUID) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("Goal not found"))
+		return
+	}
+
+	decisions, err := r.LLMangoManager.EvaluateCanaries(goalUID, llmango.DefaultCanaryPolicy())
+	if errors.Is(err, llmango.ErrLoggerNotInitialized) {
+		BadRequest(w, err.Error())
+		return
+	}
+	if err != nil {
+		ServerError(w, err)
+		return
+	}
+	if decisions == nil {
+		decisions = []llmango.CanaryDecision{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(decisions)
+}
@@ -12,7 +12,8 @@ import (
 	"github.com/llmang/llmango/llmango"
 )
 
-// handleUpdateGoal updates a goal's title and description
+// handleUpdateGoal updates a goal's title, description and explicit schemas,
+// schema changes that break compatibility are rejected with 409 unless forced
 func (r *APIRouter) handleUpdateGoal(w http.ResponseWriter, req *http.Request) {
 	goalUID := req.PathValue("goaluid")
 	if goalUID == "" {
@@ -36,6 +37,11 @@ func (r *APIRouter) handleUpdateGoal(w http.ResponseWriter, req *http.Request) {
 	var updateReq struct {
 		Title       *string `json:"title,omitempty"` // Use pointers to check presence
 		Description *string `json:"description,omitempty"`
+		// Explicit JSON Schemas, an omitted schema keeps the current one and null removes it
+		InputSchema  json.RawMessage `json:"inputSchema,omitempty"`
+		OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
+		// Force applies schema changes that break callers, code or prompts
+		Force bool `json:"force,omitempty"`
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
@@ -43,7 +49,36 @@ func (r *APIRouter) handleUpdateGoal(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Schemas are applied first so an invalid one rejects the whole update
 	updated := false
+	if len(updateReq.InputSchema) > 0 || len(updateReq.OutputSchema) > 0 {
+		inputSchema, outputSchema := goal.Schemas()
+		if len(updateReq.InputSchema) > 0 {
+			inputSchema = updateReq.InputSchema
+		}
+		if len(updateReq.OutputSchema) > 0 {
+			outputSchema = updateReq.OutputSchema
+		}
+		compatibility, err := r.LLMangoManager.CheckSchemaCompatibility(goal, inputSchema, outputSchema)
+		if err != nil {
+			BadRequest(w, "Invalid schema: "+err.Error())
+			return
+		}
+		// Breaking changes are returned for confirmation instead of being applied
+		if compatibility.Breaking() && !updateReq.Force {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(compatibility)
+			return
+		}
+		// The schemas and validators are swapped together, runs in flight use either the old or the new ones
+		if err := goal.SetSchemas(inputSchema, outputSchema); err != nil {
+			BadRequest(w, "Invalid schema: "+err.Error())
+			return
+		}
+		updated = true
+	}
+
 	if updateReq.Title != nil && *updateReq.Title != goal.Title {
 		goal.Title = *updateReq.Title
 		updated = true
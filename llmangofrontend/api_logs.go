@@ -32,8 +32,10 @@ type LogResponse struct {
 }
 
 type SpendResponse struct {
-	Spend float64 `json:"spend"`
-	Count int     `json:"count"`
+	Spend           float64 `json:"spend"`
+	Count           int     `json:"count"`
+	OutputTokens    int     `json:"outputTokens"`
+	ReasoningTokens int     `json:"reasoningTokens"`
 }
 
 // handleGetLogs handles general log queries with filters
@@ -127,15 +129,14 @@ func (r *APIRouter) handleGetSpend(w http.ResponseWriter, req *http.Request) {
 		json.NewEncoder(w).Encode("Failed to get logs: " + err.Error())
 		return
 	}
-	var totalSpend float64
-	for _, log := range logs {
-		totalSpend += log.Cost
-	}
-
 	response := SpendResponse{
-		Spend: totalSpend,
 		Count: total,
 	}
+	for _, log := range logs {
+		response.Spend += log.Cost
+		response.OutputTokens += log.OutputTokens
+		response.ReasoningTokens += log.ReasoningTokens
+	}
 
 	json.NewEncoder(w).Encode(response)
 }
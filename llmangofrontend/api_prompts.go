@@ -242,6 +242,9 @@ func (r *APIRouter) handleUpdatePrompt(w http.ResponseWriter, req *http.Request)
 		Weight     *int               `json:"weight,omitempty"`
 		IsCanary   *bool              `json:"isCanary,omitempty"`
 		MaxRuns    *int               `json:"maxRuns,omitempty"`
+		Hedge      json.RawMessage    `json:"hedge,omitempty"` // null disables hedging
+		IsShadow   *bool              `json:"isShadow,omitempty"`
+		ShadowRate *float64           `json:"shadowSampleRate,omitempty"`
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&updateReq); err != nil {
@@ -268,6 +271,31 @@ func (r *APIRouter) handleUpdatePrompt(w http.ResponseWriter, req *http.Request)
 		prompt.MaxRuns = *updateReq.MaxRuns
 		updated = true
 	}
+	if updateReq.Hedge != nil {
+		var hedge *llmango.HedgeConfig
+		if err := json.Unmarshal(updateReq.Hedge, &hedge); err != nil {
+			BadRequest(w, "Invalid hedge configuration: "+err.Error())
+			return
+		}
+		if hedge != nil && hedge.DelayMs <= 0 {
+			BadRequest(w, "Hedge delayMs must be greater than 0")
+			return
+		}
+		prompt.Hedge = hedge
+		updated = true
+	}
+	if updateReq.IsShadow != nil {
+		prompt.IsShadow = *updateReq.IsShadow
+		updated = true
+	}
+	if updateReq.ShadowRate != nil {
+		if *updateReq.ShadowRate < 0 || *updateReq.ShadowRate > 1 {
+			BadRequest(w, "shadowSampleRate must be between 0 and 1")
+			return
+		}
+		prompt.ShadowSampleRate = *updateReq.ShadowRate
+		updated = true
+	}
 
 	// Handle parameters update
 	if updateReq.Parameters != nil {
@@ -290,6 +318,24 @@ func (r *APIRouter) handleUpdatePrompt(w http.ResponseWriter, req *http.Request)
 		if presPen, ok := params["presence_penalty"].(float64); ok {
 			prompt.Parameters.PresencePenalty = &presPen
 		}
+		if providerData, ok := params["provider"]; ok && providerData != nil {
+			providerJSON, _ := json.Marshal(providerData)
+			var provider openrouter.ProviderPreferences
+			if err := json.Unmarshal(providerJSON, &provider); err != nil {
+				BadRequest(w, "Invalid provider preferences: "+err.Error())
+				return
+			}
+			prompt.Parameters.Provider = &provider
+		}
+		if reasoningData, ok := params["reasoning"]; ok && reasoningData != nil {
+			reasoningJSON, _ := json.Marshal(reasoningData)
+			var reasoning openrouter.ReasoningConfig
+			if err := json.Unmarshal(reasoningJSON, &reasoning); err != nil {
+				BadRequest(w, "Invalid reasoning config: "+err.Error())
+				return
+			}
+			prompt.Parameters.Reasoning = &reasoning
+		}
 		updated = true
 	}
 
@@ -30,6 +30,10 @@ func (router *Router) CreateAPIRouter() *http.ServeMux {
 	apiMux.HandleFunc("POST /prompt/create", r.handleCreatePrompt)
 	apiMux.HandleFunc("POST /prompts/{promptuid}/update", r.handleUpdatePrompt)
 
+	// Canary endpoints
+	apiMux.HandleFunc("GET /canary/decisions", r.handleGetCanaryDecisions)
+	apiMux.HandleFunc("POST /goal/{goaluid}/canary/evaluate", r.handleEvaluateCanaries)
+
 	// Logging endpoints
 	apiMux.HandleFunc("POST /logs", r.handleGetLogs)
 	apiMux.HandleFunc("POST /logs/spend", r.handleGetSpend)
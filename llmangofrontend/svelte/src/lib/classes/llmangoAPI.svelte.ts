@@ -11,6 +11,28 @@ export type Prompt = {
     isCanary: boolean;
     maxRuns: number;
     totalRuns: number;
+    isShadow?: boolean;
+    shadowSampleRate?: number;
+}
+
+export type PromptMetrics = {
+    calls: number;
+    errorRate: number;
+    validationFailureRate: number;
+    avgLatency: number;
+    avgCost: number;
+}
+
+export type CanaryDecision = {
+    timestamp: number;
+    goalUID: string;
+    canaryPromptUID: string;
+    basePromptUIDs: string[];
+    action: 'promote' | 'rollback' | 'hold';
+    reason: string;
+    canary: PromptMetrics;
+    base: PromptMetrics;
+    weights?: Record<string, number>;
 }
 
 // Updated to match our types.ts Goal interface
@@ -23,6 +45,44 @@ export type Goal = {
         inputExample: any;
         outputExample: any;
     };
+    inputExamples?: any[]; // Additional examples, paired by index and merged with the example above when schemas are inferred
+    outputExamples?: any[];
+    inputSchema?: any; // Explicit JSON Schemas, used instead of the examples when set
+    outputSchema?: any;
+}
+
+export type SchemaChange = {
+    path: string;
+    kind: string;
+    breaking: boolean;
+    message: string;
+}
+
+// Returned instead of applying schema changes that would break callers, code or prompts
+export type SchemaCompatibility = {
+    input?: SchemaChange[];
+    output?: SchemaChange[];
+    promptIssues?: string[];
+}
+
+export type ProviderMaxPrice = {
+    prompt?: number;
+    completion?: number;
+    request?: number;
+    image?: number;
+}
+
+// Provider routing preferences, sent to OpenRouter under `provider`
+export type ProviderPreferences = {
+    order?: string[];
+    allow_fallbacks?: boolean;
+    require_parameters?: boolean;
+    data_collection?: 'allow' | 'deny';
+    ignore?: string[];
+    only?: string[];
+    quantizations?: string[];
+    sort?: 'price' | 'throughput' | 'latency';
+    max_price?: ProviderMaxPrice;
 }
 
 export class PromptParameters {
@@ -31,6 +91,7 @@ export class PromptParameters {
     top_p?: number;
     frequency_penalty?: number;
     presence_penalty?: number;
+    provider: ProviderPreferences;
     
     constructor(params: Partial<PromptParameters> = {}) {
         this.temperature = params.temperature;
@@ -38,6 +99,7 @@ export class PromptParameters {
         this.top_p = params.top_p;
         this.frequency_penalty = params.frequency_penalty;
         this.presence_penalty = params.presence_penalty;
+        this.provider = { ...(params.provider || {}) };
     }
     
     // Convert to a plain object, removing undefined values
@@ -49,6 +111,14 @@ export class PromptParameters {
         if (this.top_p !== undefined) result.top_p = this.top_p;
         if (this.frequency_penalty !== undefined) result.frequency_penalty = this.frequency_penalty;
         if (this.presence_penalty !== undefined) result.presence_penalty = this.presence_penalty;
+
+        const provider: Record<string, any> = {};
+        for (const [key, value] of Object.entries(this.provider)) {
+            if (value === undefined || value === null || value === '') continue;
+            if (Array.isArray(value) && value.length === 0) continue;
+            provider[key] = value;
+        }
+        if (Object.keys(provider).length > 0) result.provider = provider;
         
         return result;
     }
@@ -61,7 +131,8 @@ export class PromptParameters {
             max_tokens: obj.max_tokens,
             top_p: obj.top_p,
             frequency_penalty: obj.frequency_penalty,
-            presence_penalty: obj.presence_penalty
+            presence_penalty: obj.presence_penalty,
+            provider: obj.provider
         });
     }
 }
@@ -165,6 +236,41 @@ class LLMangoAPI{
         }
     }
 
+    // Resolves to the compatibility report when the change is breaking and not forced, null once saved.
+    // An undefined schema keeps the current one, null removes it so the examples are used again.
+    updateGoalSchemas = async (goalUID: string, inputSchema: any | null | undefined, outputSchema: any | null | undefined, force = false): Promise<SchemaCompatibility | null> => {
+        const url = `${this.baseUrl}/goal/${goalUID}/update`;
+        const updateData: Record<string, any> = {};
+        if (inputSchema !== undefined) updateData.inputSchema = inputSchema;
+        if (outputSchema !== undefined) updateData.outputSchema = outputSchema;
+        if (force) updateData.force = true;
+
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json'
+            },
+            body: JSON.stringify(updateData)
+        });
+
+        if (response.status === 409) {
+            return await response.json();
+        }
+        if (!response.ok) {
+            throw new Error(`Failed to update goal schemas: ${await response.text() || response.statusText}`);
+        }
+
+        const updated = await response.json();
+        if (this.goals[goalUID]) {
+            this.goals[goalUID] = {
+                ...this.goals[goalUID],
+                inputSchema: updated.inputSchema,
+                outputSchema: updated.outputSchema
+            };
+        }
+        return null;
+    }
+
     createPrompt = async (prompt: Prompt): Promise<void> => {
         const url = `${this.baseUrl}/prompt/create`;
         const response = await fetch(url, {
@@ -207,6 +313,31 @@ class LLMangoAPI{
         delete this.prompts[promptUID];
     }
 
+    getCanaryDecisions = async (goalUID: string): Promise<CanaryDecision[]> => {
+        const url = `${this.baseUrl}/canary/decisions?goalUID=${encodeURIComponent(goalUID)}`;
+        const response = await fetch(url);
+
+        if (!response.ok) {
+            throw new Error(`Failed to fetch canary decisions: ${response.statusText}`);
+        }
+
+        return await response.json();
+    }
+
+    evaluateCanaries = async (goalUID: string): Promise<CanaryDecision[]> => {
+        const url = `${this.baseUrl}/goal/${goalUID}/canary/evaluate`;
+        const response = await fetch(url, { method: 'POST' });
+
+        if (!response.ok) {
+            const error = await response.text();
+            throw new Error(`Failed to evaluate canaries: ${error}`);
+        }
+
+        // Promotions and rollbacks change prompt weights
+        await this.reload();
+        return await response.json();
+    }
+
     updateAPIKey = async (apiKey: string): Promise<void> => {
         const url = `${this.baseUrl}/update-key`;
         const response = await fetch(url, {
@@ -15,6 +15,8 @@ export type LogFilter = {
 export type SpendResponse = {
     spend: number;
     count: number;
+    outputTokens: number;
+    reasoningTokens: number;
 }
 
 export type Log = {
@@ -27,10 +29,16 @@ export type Log = {
     outputObject: string;
     inputTokens: number;
     outputTokens: number;
+    reasoningTokens: number;
     cost: number;
+    costEstimated?: boolean;
     requestTime: number;
     generationTime: number;
     error: string;
+    reasoning?: string;
+    logID?: string;
+    groupID?: string;
+    metadata?: any;
 }
 
 // Pagination information for API responses
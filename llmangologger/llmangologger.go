@@ -30,6 +30,7 @@ func UseLogger(m *llmango.LLMangoManager, logger *log.Logger, opts *MangoLogging
 		return nil
 	}
 	m.Logging.GetLogs = nil
+	m.Logging.UpdateLog = nil
 
 	return nil
 }
@@ -44,6 +45,7 @@ func UseConsoleLogging(m *llmango.LLMangoManager, opts *MangoLoggingOptions) err
 		return nil
 	}
 	m.Logging.GetLogs = nil
+	m.Logging.UpdateLog = nil
 
 	return nil
 }
@@ -26,10 +26,69 @@ func setupSQLiteDB(db *sql.DB) error {
 			cost REAL NOT NULL DEFAULT 0.0,
 			request_time REAL NOT NULL DEFAULT 0.0,
 			generation_time REAL NOT NULL DEFAULT 0.0,
-			error TEXT NOT NULL DEFAULT ''
+			error TEXT NOT NULL DEFAULT '',
+			group_id TEXT NOT NULL DEFAULT '',
+			log_id TEXT NOT NULL DEFAULT '',
+			reasoning_tokens INTEGER NOT NULL DEFAULT 0,
+			reasoning TEXT NOT NULL DEFAULT '',
+			cost_estimated INTEGER NOT NULL DEFAULT 0
 		);
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+	return migrateSQLiteDB(db)
+}
+
+// sqliteColumnMigrations lists columns added after the original table layout.
+// They are added to existing databases that were created by older versions.
+var sqliteColumnMigrations = []struct {
+	name       string
+	definition string
+}{
+	{"group_id", "TEXT NOT NULL DEFAULT ''"},
+	{"log_id", "TEXT NOT NULL DEFAULT ''"},
+	{"reasoning_tokens", "INTEGER NOT NULL DEFAULT 0"},
+	{"reasoning", "TEXT NOT NULL DEFAULT ''"},
+	{"cost_estimated", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// migrateSQLiteDB adds any missing columns from sqliteColumnMigrations to the logging table
+func migrateSQLiteDB(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(mango_logs)")
+	if err != nil {
+		return fmt.Errorf("failed to read logging table info: %w", err)
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan logging table info: %w", err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read logging table info: %w", err)
+	}
+
+	for _, column := range sqliteColumnMigrations {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE mango_logs ADD COLUMN %s %s", column.name, column.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s to logging table: %w", column.name, err)
+		}
+	}
+	return nil
 }
 
 // LogObject inserts a LogObject into the database
@@ -38,8 +97,9 @@ func sqlite3LogObject(db *sql.DB, logObj *llmango.LLMangoLog) error {
 		INSERT INTO mango_logs (
 			timestamp, goal_uid, prompt_uid, raw_request, input_object,
 			raw_response, output_object, input_tokens, output_tokens,
-			cost, request_time, generation_time, error
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			cost, request_time, generation_time, error, group_id, log_id,
+			reasoning_tokens, reasoning, cost_estimated
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		logObj.Timestamp,
 		logObj.GoalUID,
 		logObj.PromptUID,
@@ -53,6 +113,25 @@ func sqlite3LogObject(db *sql.DB, logObj *llmango.LLMangoLog) error {
 		logObj.RequestTime,
 		logObj.GenerationTime,
 		logObj.Error,
+		logObj.GroupID,
+		logObj.LogID,
+		logObj.ReasoningTokens,
+		logObj.Reasoning,
+		logObj.CostEstimated,
+	)
+	return err
+}
+
+// sqlite3UpdateLogCost stores the reconciled cost of a logged entry
+func sqlite3UpdateLogCost(db *sql.DB, logObj *llmango.LLMangoLog) error {
+	_, err := db.Exec(`
+		UPDATE mango_logs SET cost = ?, cost_estimated = ?, generation_time = ?, reasoning_tokens = ?
+		WHERE log_id = ?`,
+		logObj.Cost,
+		logObj.CostEstimated,
+		logObj.GenerationTime,
+		logObj.ReasoningTokens,
+		logObj.LogID,
 	)
 	return err
 }
@@ -66,13 +145,13 @@ func sqlite3GetLogs(db *sql.DB, filter *llmango.LLmangoLogFilter) ([]llmango.LLM
 
 	// Only include raw fields if requested, using snake_case columns
 	if filter.IncludeRaw {
-		query += ", raw_request, input_object, raw_response, output_object"
+		query += ", raw_request, input_object, raw_response, output_object, reasoning"
 	} else {
-		query += ", '' as raw_request, input_object, '' as raw_response, output_object"
+		query += ", '' as raw_request, input_object, '' as raw_response, output_object, '' as reasoning"
 	}
 
 	// Add remaining fields using snake_case columns
-	query += ", input_tokens, output_tokens, cost, request_time, generation_time, error FROM mango_logs WHERE 1=1"
+	query += ", input_tokens, output_tokens, cost, request_time, generation_time, error, group_id, log_id, reasoning_tokens, cost_estimated FROM mango_logs WHERE 1=1"
 
 	// Add filter conditions using snake_case columns
 	var args []interface{}
@@ -106,6 +185,20 @@ func sqlite3GetLogs(db *sql.DB, filter *llmango.LLmangoLogFilter) ([]llmango.LLM
 		countArgs = append(countArgs, *filter.PromptUID)
 	}
 
+	if filter.GroupID != nil {
+		query += " AND group_id = ?"
+		countQuery += " AND group_id = ?"
+		args = append(args, *filter.GroupID)
+		countArgs = append(countArgs, *filter.GroupID)
+	}
+
+	if filter.LogID != nil {
+		query += " AND log_id = ?"
+		countQuery += " AND log_id = ?"
+		args = append(args, *filter.LogID)
+		countArgs = append(countArgs, *filter.LogID)
+	}
+
 	// Add order by, limit and offset
 	query += " ORDER BY timestamp DESC"
 
@@ -138,12 +231,17 @@ func sqlite3GetLogs(db *sql.DB, filter *llmango.LLmangoLogFilter) ([]llmango.LLM
 			&log.InputObject,
 			&log.RawResponse,
 			&log.OutputObject,
+			&log.Reasoning,
 			&log.InputTokens,
 			&log.OutputTokens,
 			&log.Cost,
 			&log.RequestTime,
 			&log.GenerationTime,
 			&log.Error,
+			&log.GroupID,
+			&log.LogID,
+			&log.ReasoningTokens,
+			&log.CostEstimated,
 		)
 		if err != nil {
 			return logs, 0, fmt.Errorf("error scanning log row: %w", err)
@@ -194,6 +292,10 @@ func UseSQLiteLogging(m *llmango.LLMangoManager, db *sql.DB, opts *MangoLoggingO
 		return sqlite3GetLogs(db, filter)
 	}
 
+	m.Logging.UpdateLog = func(mangolog *llmango.LLMangoLog) error {
+		return sqlite3UpdateLogCost(db, mangolog)
+	}
+
 	return nil
 }
 
@@ -220,5 +322,8 @@ func CreateSQLiteLogger(db *sql.DB, logFullRequests bool) (*llmango.Logging, err
 		GetLogs: func(filter *llmango.LLmangoLogFilter) ([]llmango.LLMangoLog, int, error) {
 			return sqlite3GetLogs(db, filter)
 		},
+		UpdateLog: func(mangolog *llmango.LLMangoLog) error {
+			return sqlite3UpdateLogCost(db, mangolog)
+		},
 	}, nil
 }
@@ -18,12 +18,17 @@ type goalForJSON struct {
 	CreatedAt   int    `json:"createdAt"`
 	UpdatedAt   int    `json:"updatedAt"`
 	// InputExample and OutputExample removed as they are hardcoded
+	// Explicit schemas are persisted so validators can be rebuilt on load
+	InputSchema  json.RawMessage `json:"inputSchema,omitempty"`
+	OutputSchema json.RawMessage `json:"outputSchema,omitempty"`
 }
 
 // mangoConfigFile defines the structure of the JSON configuration file.
 type mangoConfigFile struct {
-	Goals   map[string]*goalForJSON    `json:"goals"`
-	Prompts map[string]*llmango.Prompt `json:"prompts"`
+	Goals           map[string]*goalForJSON                 `json:"goals"`
+	Prompts         map[string]*llmango.Prompt              `json:"prompts"`
+	CanaryDecisions []llmango.CanaryDecision                `json:"canaryDecisions,omitempty"` // audit trail of the canary controller
+	BanditArms      map[string]map[string]llmango.BanditArm `json:"banditArms,omitempty"`      // learned arms of adaptive goals
 }
 
 // jsonSaveStateFunc saves the current state of the LLMangoManager to a JSON file.
@@ -40,6 +45,8 @@ func jsonSaveStateFunc(mango *llmango.LLMangoManager, fileName string) error {
 		if goal == nil {
 			continue // skip nil entries if any
 		}
+		// Schemas can be swapped while the goal runs, read them under the goal's lock
+		inputSchema, outputSchema := goal.Schemas()
 		configToSave.Goals[uid] = &goalForJSON{
 			UID:         goal.UID,
 			Title:       goal.Title,
@@ -47,6 +54,8 @@ func jsonSaveStateFunc(mango *llmango.LLMangoManager, fileName string) error {
 			CreatedAt:   goal.CreatedAt,
 			UpdatedAt:   goal.UpdatedAt,
 			// InputExample and OutputExample removed
+			InputSchema:  inputSchema,
+			OutputSchema: outputSchema,
 		}
 	}
 
@@ -63,6 +72,9 @@ func jsonSaveStateFunc(mango *llmango.LLMangoManager, fileName string) error {
 		configToSave.Prompts[uid] = prompt
 	}
 
+	configToSave.CanaryDecisions = mango.CanaryAuditTrail("")
+	configToSave.BanditArms = mango.BanditArms()
+
 	// Write updated config to file
 	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
@@ -156,6 +168,10 @@ func WithJSONSaveState(fileName string, llmangoManager *llmango.LLMangoManager)
 				Description: gj.Description,
 				CreatedAt:   gj.CreatedAt,
 				UpdatedAt:   gj.UpdatedAt,
+				// Goals with a schema get their validators rebuilt by AddOrUpdateGoals, goals registered in code keep theirs
+				InputSchema:       gj.InputSchema,
+				OutputSchema:      gj.OutputSchema,
+				IsSchemaValidated: len(gj.InputSchema) > 0 || len(gj.OutputSchema) > 0,
 				// PromptUIDs will be populated by AddPrompts later
 				// InputOutput field is omitted here; AddOrUpdateGoals preserves the existing one
 			}
@@ -192,6 +208,18 @@ func WithJSONSaveState(fileName string, llmangoManager *llmango.LLMangoManager)
 		log.Printf("INFO: MANGO SAVESTATE: No 'prompts' section found or it's empty in %s", fileName)
 	}
 
+	// --- Load Canary Audit Trail ---
+	if len(loadedConfig.CanaryDecisions) > 0 {
+		llmangoManager.SetCanaryAuditTrail(loadedConfig.CanaryDecisions)
+		log.Printf("INFO: MANGO SAVESTATE: Loaded %d canary decisions from %s", len(loadedConfig.CanaryDecisions), fileName)
+	}
+
+	// --- Load Bandit Arms ---
+	if len(loadedConfig.BanditArms) > 0 {
+		llmangoManager.SetBanditArms(loadedConfig.BanditArms)
+		log.Printf("INFO: MANGO SAVESTATE: Loaded bandit arms for %d goals from %s", len(loadedConfig.BanditArms), fileName)
+	}
+
 	// Save state immediately after loading to potentially fix UIDs or add timestamps if logic requires it
 	// (Though AddOrUpdateGoals/AddPrompts should handle timestamps now)
 	if err := llmangoManager.SaveState(); err != nil {
@@ -2,6 +2,7 @@ package openrouter
 
 import (
 	"encoding/json"
+	"strings"
 	"testing"
 )
 
@@ -14,14 +15,14 @@ func TestAutoConfigureProviderRequirements(t *testing.T) {
 		description    string
 	}{
 		{
-			name:           "Auto-set when ResponseFormat present and ProviderRequireParameters nil",
+			name:           "Auto-set when ResponseFormat present and Provider.RequireParameters nil",
 			responseFormat: json.RawMessage(`{"type": "json_schema"}`),
 			existingValue:  nil,
 			expectedValue:  boolPtr(true),
 			description:    "Should automatically set to true when structured output detected",
 		},
 		{
-			name:           "No change when ResponseFormat present but ProviderRequireParameters already set",
+			name:           "No change when ResponseFormat present but Provider.RequireParameters already set",
 			responseFormat: json.RawMessage(`{"type": "json_schema"}`),
 			existingValue:  boolPtr(false),
 			expectedValue:  boolPtr(false),
@@ -47,26 +48,28 @@ func TestAutoConfigureProviderRequirements(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			request := &OpenRouterRequest{
 				Parameters: Parameters{
-					ResponseFormat:            tt.responseFormat,
-					ProviderRequireParameters: tt.existingValue,
+					ResponseFormat: tt.responseFormat,
 				},
 			}
+			if tt.existingValue != nil {
+				request.Parameters.Provider = &ProviderPreferences{RequireParameters: tt.existingValue}
+			}
 
 			// Call the auto-detection function
 			request.autoConfigureProviderRequirements()
 
 			// Check the result
 			if tt.expectedValue == nil {
-				if request.Parameters.ProviderRequireParameters != nil {
-					t.Errorf("Expected ProviderRequireParameters to be nil, got %v", 
-						*request.Parameters.ProviderRequireParameters)
+				if request.Parameters.Provider != nil {
+					t.Errorf("Expected Provider to be nil, got %+v",
+						*request.Parameters.Provider)
 				}
 			} else {
-				if request.Parameters.ProviderRequireParameters == nil {
-					t.Errorf("Expected ProviderRequireParameters to be %v, got nil", *tt.expectedValue)
-				} else if *request.Parameters.ProviderRequireParameters != *tt.expectedValue {
-					t.Errorf("Expected ProviderRequireParameters to be %v, got %v", 
-						*tt.expectedValue, *request.Parameters.ProviderRequireParameters)
+				if request.Parameters.Provider == nil || request.Parameters.Provider.RequireParameters == nil {
+					t.Errorf("Expected Provider.RequireParameters to be %v, got nil", *tt.expectedValue)
+				} else if *request.Parameters.Provider.RequireParameters != *tt.expectedValue {
+					t.Errorf("Expected Provider.RequireParameters to be %v, got %v",
+						*tt.expectedValue, *request.Parameters.Provider.RequireParameters)
 				}
 			}
 		})
@@ -76,7 +79,7 @@ func TestAutoConfigureProviderRequirements(t *testing.T) {
 func TestStructuredOutputAutoRequiresParameters(t *testing.T) {
 	// Test that when we use structured output, require_parameters is automatically set
 	exampleJSON := json.RawMessage(`{"name": "John", "age": 30}`)
-	
+
 	responseFormat, err := UseOpenRouterJsonFormatFromJSON(exampleJSON, "TestSchema")
 	if err != nil {
 		t.Fatalf("Failed to create response format: %v", err)
@@ -92,15 +95,69 @@ func TestStructuredOutputAutoRequiresParameters(t *testing.T) {
 	// Simulate what happens in executeOpenRouterRequest
 	request.autoConfigureProviderRequirements()
 
-	// Verify that ProviderRequireParameters was automatically set to true
-	if request.Parameters.ProviderRequireParameters == nil {
-		t.Error("Expected ProviderRequireParameters to be automatically set, but it was nil")
-	} else if !*request.Parameters.ProviderRequireParameters {
-		t.Error("Expected ProviderRequireParameters to be true, but it was false")
+	// Verify that Provider.RequireParameters was automatically set to true
+	if request.Parameters.Provider == nil || request.Parameters.Provider.RequireParameters == nil {
+		t.Error("Expected Provider.RequireParameters to be automatically set, but it was nil")
+	} else if !*request.Parameters.Provider.RequireParameters {
+		t.Error("Expected Provider.RequireParameters to be true, but it was false")
 	}
 }
 
 // Helper function to create bool pointers
 func boolPtr(b bool) *bool {
 	return &b
-}
\ No newline at end of file
+}
+
+func TestLegacyProviderFieldsMigration(t *testing.T) {
+	saved := []byte(`{"temperature": 0.5, "provider_order": ["openai", "azure"], "provider_sort": "price", "provider_allow_fallbacks": false}`)
+
+	var params Parameters
+	if err := json.Unmarshal(saved, &params); err != nil {
+		t.Fatalf("Failed to decode legacy parameters: %v", err)
+	}
+	if params.Temperature == nil || *params.Temperature != 0.5 {
+		t.Errorf("Expected temperature to be preserved, got %v", params.Temperature)
+	}
+	if params.Provider == nil {
+		t.Fatal("Expected legacy provider fields to be migrated into Provider")
+	}
+	if len(params.Provider.Order) != 2 || params.Provider.Order[0] != "openai" {
+		t.Errorf("Expected provider order to be migrated, got %v", params.Provider.Order)
+	}
+	if params.Provider.Sort == nil || *params.Provider.Sort != "price" {
+		t.Errorf("Expected provider sort to be migrated, got %v", params.Provider.Sort)
+	}
+	if params.Provider.AllowFallbacks == nil || *params.Provider.AllowFallbacks {
+		t.Errorf("Expected allow_fallbacks to be migrated as false, got %v", params.Provider.AllowFallbacks)
+	}
+
+	// Re-encoding uses the nested provider object only
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Failed to encode parameters: %v", err)
+	}
+	if strings.Contains(string(encoded), "provider_order") || !strings.Contains(string(encoded), `"provider":{"order":["openai","azure"]`) {
+		t.Errorf("Expected nested provider object, got %s", encoded)
+	}
+}
+
+func TestOpenRouterRequestUnmarshalKeepsRequestFields(t *testing.T) {
+	body := []byte(`{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}], "max_tokens": 10, "provider": {"only": ["openai"]}}`)
+
+	var request OpenRouterRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Fatalf("Failed to decode request: %v", err)
+	}
+	if request.Model == nil || *request.Model != "openai/gpt-4o" {
+		t.Errorf("Expected model to be decoded, got %v", request.Model)
+	}
+	if len(request.Messages) != 1 {
+		t.Errorf("Expected messages to be decoded, got %v", request.Messages)
+	}
+	if request.MaxTokens == nil || *request.MaxTokens != 10 {
+		t.Errorf("Expected max_tokens to be decoded, got %v", request.MaxTokens)
+	}
+	if request.Provider == nil || len(request.Provider.Only) != 1 {
+		t.Errorf("Expected provider preferences to be decoded, got %+v", request.Provider)
+	}
+}
@@ -0,0 +1,187 @@
+package openrouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"time"
+)
+
+// DEFAULT_EMBEDDING_BATCH_SIZE is the number of inputs sent per request when EmbeddingRequest.BatchSize is not set
+var DEFAULT_EMBEDDING_BATCH_SIZE = 100
+
+// EmbeddingRequest is an OpenAI compatible /embeddings request
+type EmbeddingRequest struct {
+	Model          string               `json:"model"`
+	Input          []string             `json:"input"`
+	Dimensions     *int                 `json:"dimensions,omitempty"`      // Output size for models that support shortening
+	EncodingFormat string               `json:"encoding_format,omitempty"` // Only "float" is decoded
+	User           *string              `json:"user,omitempty"`
+	Provider       *ProviderPreferences `json:"provider,omitempty"`
+
+	BatchSize int `json:"-"` // Inputs per request, larger inputs are split into several requests
+}
+
+// Embedding is a single vector of an embeddings response
+type Embedding struct {
+	Object    string    `json:"object"`
+	Index     int       `json:"index"` // Position of the input the vector belongs to
+	Embedding []float64 `json:"embedding"`
+}
+
+// EmbeddingUsage is the token usage of an embeddings request
+type EmbeddingUsage struct {
+	PromptTokens int      `json:"prompt_tokens"`
+	TotalTokens  int      `json:"total_tokens"`
+	Cost         *float64 `json:"cost,omitempty"` // Cost in USD when reported by OpenRouter
+}
+
+// EmbeddingResponse is the response of the /embeddings endpoint. When a request is sent
+// in batches the data of all batches is merged in input order and the usage is summed.
+type EmbeddingResponse struct {
+	ID     string          `json:"id"`
+	Object string          `json:"object"`
+	Model  string          `json:"model"`
+	Data   []Embedding     `json:"data"`
+	Usage  *EmbeddingUsage `json:"usage,omitempty"`
+}
+
+// Vectors returns the embeddings in input order
+func (r *EmbeddingResponse) Vectors() [][]float64 {
+	vectors := make([][]float64, len(r.Data))
+	for i, embedding := range r.Data {
+		vectors[i] = embedding.Embedding
+	}
+	return vectors
+}
+
+// CreateEmbeddings embeds the request's inputs, splitting them into batches of BatchSize
+func (o *OpenRouter) CreateEmbeddings(ctx context.Context, request *EmbeddingRequest) (*EmbeddingResponse, error) {
+	if request == nil || request.Model == "" {
+		return nil, errors.New("embedding request needs a model")
+	}
+	if len(request.Input) == 0 {
+		return nil, errors.New("embedding request needs at least one input")
+	}
+	batchSize := request.BatchSize
+	if batchSize <= 0 {
+		batchSize = DEFAULT_EMBEDDING_BATCH_SIZE
+	}
+
+	merged := &EmbeddingResponse{Object: "list", Model: request.Model, Data: make([]Embedding, 0, len(request.Input))}
+	for start := 0; start < len(request.Input); start += batchSize {
+		batch := *request
+		batch.Input = request.Input[start:min(start+batchSize, len(request.Input))]
+
+		response, err := o.createEmbeddingsBatch(ctx, &batch)
+		if err != nil {
+			return nil, fmt.Errorf("embedding batch starting at input %d failed: %w", start, err)
+		}
+		if len(response.Data) != len(batch.Input) {
+			return nil, fmt.Errorf("embedding batch starting at input %d returned %d vectors for %d inputs", start, len(response.Data), len(batch.Input))
+		}
+
+		if merged.ID == "" {
+			merged.ID = response.ID
+		}
+		if response.Model != "" {
+			merged.Model = response.Model
+		}
+		for _, embedding := range response.Data {
+			embedding.Index += start
+			merged.Data = append(merged.Data, embedding)
+		}
+		if response.Usage != nil {
+			if merged.Usage == nil {
+				merged.Usage = &EmbeddingUsage{}
+			}
+			merged.Usage.PromptTokens += response.Usage.PromptTokens
+			merged.Usage.TotalTokens += response.Usage.TotalTokens
+			if response.Usage.Cost != nil {
+				cost := *response.Usage.Cost
+				if merged.Usage.Cost != nil {
+					cost += *merged.Usage.Cost
+				}
+				merged.Usage.Cost = &cost
+			}
+		}
+	}
+
+	// Providers may answer out of order, the index says which input a vector belongs to
+	ordered := make([]Embedding, len(merged.Data))
+	for _, embedding := range merged.Data {
+		if embedding.Index < 0 || embedding.Index >= len(ordered) {
+			return nil, fmt.Errorf("embedding index %d is out of range for %d inputs", embedding.Index, len(ordered))
+		}
+		ordered[embedding.Index] = embedding
+	}
+	merged.Data = ordered
+	return merged, nil
+}
+
+func (o *OpenRouter) createEmbeddingsBatch(ctx context.Context, request *EmbeddingRequest) (*EmbeddingResponse, error) {
+	if o.ApiKey == "" {
+		return nil, errors.New("API KEY is empty in openrouter instance")
+	}
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.URL("/embeddings"), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.ApiKey)
+
+	client := o.HTTPClient(2 * time.Minute)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	var errResp ErrorResponse
+	if json.Unmarshal(body, &errResp) == nil && errResp.Details.Message != "" {
+		if stdErr, exists := ErrorCodeToError[errResp.Details.Code]; exists {
+			return nil, fmt.Errorf("%w: %s", stdErr, errResp.Details.Message)
+		}
+		return nil, &errResp
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	}
+
+	var response EmbeddingResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("error parsing embeddings response: %w\nBody: %s", err, string(body))
+	}
+	return &response, nil
+}
+
+// CosineSimilarity returns the cosine similarity of two vectors, 0 when they differ in length or one is zero
+func CosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
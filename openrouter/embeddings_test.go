@@ -0,0 +1,92 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"testing"
+)
+
+// fakeEmbeddingsTransport answers /embeddings with vectors holding the input length,
+// listing them in reverse order like providers are allowed to
+func fakeEmbeddingsTransport(batches *[][]string) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		var request EmbeddingRequest
+		body, _ := io.ReadAll(req.Body)
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, err
+		}
+		*batches = append(*batches, request.Input)
+		if request.Model == "test/broken" {
+			return textResponse(req, "application/json", `{"error":{"code":402,"message":"no credits"}}`), nil
+		}
+
+		response := EmbeddingResponse{ID: "emb-1", Model: request.Model, Usage: &EmbeddingUsage{PromptTokens: len(request.Input), TotalTokens: len(request.Input)}}
+		cost := 0.001
+		response.Usage.Cost = &cost
+		for i := len(request.Input) - 1; i >= 0; i-- {
+			response.Data = append(response.Data, Embedding{Object: "embedding", Index: i, Embedding: []float64{float64(len(request.Input[i]))}})
+		}
+		encoded, _ := json.Marshal(response)
+		return textResponse(req, "application/json", string(encoded)), nil
+	})
+}
+
+func TestCreateEmbeddingsBatching(t *testing.T) {
+	var batches [][]string
+	client := &OpenRouter{ApiKey: "test-key", Transport: fakeEmbeddingsTransport(&batches)}
+
+	inputs := []string{"a", "bb", "ccc", "dddd", "eeeee"}
+	response, err := client.CreateEmbeddings(context.Background(), &EmbeddingRequest{Model: "test/embed", Input: inputs, BatchSize: 2})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings failed: %v", err)
+	}
+	if len(batches) != 3 || len(batches[2]) != 1 {
+		t.Errorf("Expected 3 batches of at most 2 inputs, got %v", batches)
+	}
+	for i, vector := range response.Vectors() {
+		if vector[0] != float64(len(inputs[i])) || response.Data[i].Index != i {
+			t.Errorf("Expected vector %d to belong to %q, got %v (index %d)", i, inputs[i], vector, response.Data[i].Index)
+		}
+	}
+	if response.Usage.TotalTokens != 5 || math.Abs(*response.Usage.Cost-0.003) > 1e-9 {
+		t.Errorf("Expected the usage of all batches to be summed, got %+v (cost %v)", response.Usage, *response.Usage.Cost)
+	}
+}
+
+func TestCreateEmbeddingsErrors(t *testing.T) {
+	var batches [][]string
+	client := &OpenRouter{ApiKey: "test-key", Transport: fakeEmbeddingsTransport(&batches)}
+
+	if _, err := client.CreateEmbeddings(context.Background(), &EmbeddingRequest{Model: "test/embed"}); err == nil {
+		t.Error("Expected requests without inputs to fail")
+	}
+	_, err := client.CreateEmbeddings(context.Background(), &EmbeddingRequest{Model: "test/broken", Input: []string{"a"}})
+	if !errors.Is(err, ErrInsufficientCredits) {
+		t.Errorf("Expected ErrInsufficientCredits, got %v", err)
+	}
+	if len(batches) != 1 {
+		t.Errorf("Expected invalid requests not to be sent, got %d requests", len(batches))
+	}
+}
+
+func TestCosineSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b     []float64
+		expected float64
+	}{
+		{[]float64{1, 0}, []float64{1, 0}, 1},
+		{[]float64{1, 0}, []float64{0, 1}, 0},
+		{[]float64{1, 1}, []float64{-1, -1}, -1},
+		{[]float64{1, 0}, []float64{1, 0, 0}, 0},
+		{[]float64{0, 0}, []float64{1, 0}, 0},
+	}
+	for _, c := range cases {
+		if got := CosineSimilarity(c.a, c.b); math.Abs(got-c.expected) > 1e-9 {
+			t.Errorf("CosineSimilarity(%v, %v) = %v, expected %v", c.a, c.b, got, c.expected)
+		}
+	}
+}
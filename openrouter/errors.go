@@ -4,6 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ErrorResponse matches the OpenRouter API error structure
@@ -81,6 +85,49 @@ var ErrorCodeToError = map[int]error{
 	503: ErrNoProviders,
 }
 
+// RetryAfterError wraps an error whose response asked to retry after a delay via its Retry-After header
+type RetryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+// Error implements the error interface for RetryAfterError
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %v)", e.Err, e.Delay)
+}
+
+// Unwrap returns the wrapped error so errors.Is keeps matching e.g. ErrRateLimited
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns the delay requested by the response that caused the error, if any
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if errors.As(err, &retryErr) {
+		return retryErr.Delay, true
+	}
+	return 0, false
+}
+
+// ParseRetryAfter parses a Retry-After header, given either in seconds or as an HTTP date
+func ParseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
 // IsModerationError checks if an error is a moderation error and returns parsed metadata
 func IsModerationError(err error) (*ModerationErrorMetadata, bool) {
 	var orErr *ErrorResponse
@@ -0,0 +1,44 @@
+package openrouter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{"2", 2 * time.Second, true},
+		{" 0 ", 0, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		delay, ok := ParseRetryAfter(tt.header, now)
+		testhelpers.AssertEqual(t, tt.ok, ok, "Unexpected ok for Retry-After "+tt.header)
+		testhelpers.AssertEqual(t, tt.delay, delay, "Unexpected delay for Retry-After "+tt.header)
+	}
+}
+
+func TestRetryAfterError(t *testing.T) {
+	err := fmt.Errorf("goal failed: %w", &RetryAfterError{Err: fmt.Errorf("%w: slow down", ErrRateLimited), Delay: time.Second})
+	testhelpers.AssertTrue(t, errors.Is(err, ErrRateLimited), "The wrapped error should still match")
+	delay, ok := RetryAfter(err)
+	testhelpers.AssertTrue(t, ok, "The delay should be found through wrapping")
+	testhelpers.AssertEqual(t, time.Second, delay, "The delay should be kept")
+
+	_, ok = RetryAfter(ErrRateLimited)
+	testhelpers.AssertFalse(t, ok, "Errors without a Retry-After have no delay")
+}
@@ -0,0 +1,364 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// JSONRepair names a lenient fix applied to model output to make it valid JSON
+type JSONRepair string
+
+const (
+	JSONRepairComments       JSONRepair = "removed_comments"
+	JSONRepairSingleQuotes   JSONRepair = "converted_single_quotes"
+	JSONRepairTrailingCommas JSONRepair = "removed_trailing_commas"
+	JSONRepairTruncated      JSONRepair = "closed_truncated_json"
+)
+
+// JSON extraction sources
+const (
+	JSONSourceFenced = "fenced" // a ``` code block
+	JSONSourceInline = "inline" // balanced braces or brackets in the text
+)
+
+// JSONExtraction is JSON found in free-form model output
+type JSONExtraction struct {
+	JSON    json.RawMessage
+	Source  string       // JSONSourceFenced or JSONSourceInline
+	Repairs []JSONRepair // repairs applied to the candidate, empty when it was valid JSON
+	Offset  int          // byte offset of the candidate in the text
+	// Valid is set when the JSON satisfies the schema passed to ExtractJSON
+	Valid bool
+}
+
+const (
+	// maxJSONCandidates bounds how many spans of a text are tried, every span is scanned up to
+	// the end of the text when it isn't closed
+	maxJSONCandidates = 32
+	// maxJSONScanBytes bounds how much of a text is searched for JSON
+	maxJSONScanBytes = 256 << 10
+	// truncatedTailBytes is how much of the end of truncated JSON is searched for an incomplete value
+	truncatedTailBytes = 512
+)
+
+var (
+	fencedBlockPattern = regexp.MustCompile("(?s)```([a-zA-Z]*)[ \t]*\n?(.*?)(?:```|\\z)")
+	// incompleteLiteralPattern matches a literal cut off by truncation like tru or 12.
+	incompleteLiteralPattern = regexp.MustCompile(`([,:\[{]\s*)(?:t|tr|tru|f|fa|fal|fals|n|nu|nul|-|[0-9.eE+-]*[.eE+-])$`)
+	// danglingKeyPattern matches an object key cut off before its value
+	danglingKeyPattern = regexp.MustCompile(`([{,])\s*"(?:[^"\\]|\\.)*"\s*:?$`)
+)
+
+// ExtractJSON finds the JSON value in free-form model output. Candidates are ```json blocks first, then
+// other code blocks, then balanced {...} or [...] spans of the text. Candidates that aren't valid JSON are
+// repaired leniently: comments, trailing commas and single quoted strings are fixed and truncated output
+// is closed. The first candidate that validates against the schema is returned, or the first one that
+// parses when none does (or the schema is nil). An error is only returned when no candidate parses.
+func ExtractJSON(text string, schema *Definition) (*JSONExtraction, error) {
+	// Blocks are kept as offsets into the text so candidates can report where they were found
+	var fenced, other [][2]int
+	for _, match := range fencedBlockPattern.FindAllStringSubmatchIndex(text, -1) {
+		if strings.EqualFold(text[match[2]:match[3]], "json") {
+			fenced = append(fenced, [2]int{match[4], match[5]})
+		} else {
+			other = append(other, [2]int{match[4], match[5]})
+		}
+	}
+
+	var first *JSONExtraction
+	seen := make(map[string]bool)
+	for _, block := range []struct {
+		source string
+		spans  [][2]int
+	}{
+		{JSONSourceFenced, fenced},
+		{JSONSourceFenced, other},
+		{JSONSourceInline, [][2]int{{0, len(text)}}},
+	} {
+		for _, span := range block.spans {
+			for _, candidate := range jsonCandidates(text[span[0]:span[1]]) {
+				if seen[string(candidate.json)] {
+					continue
+				}
+				seen[string(candidate.json)] = true
+
+				extraction := &JSONExtraction{JSON: candidate.json, Source: block.source, Repairs: candidate.repairs, Offset: span[0] + candidate.offset}
+				if schema == nil {
+					return extraction, nil
+				}
+				if ValidateJSONAgainstSchema(candidate.json, schema) == nil {
+					extraction.Valid = true
+					return extraction, nil
+				}
+				if first == nil {
+					first = extraction
+				}
+			}
+		}
+	}
+	if first == nil {
+		return nil, errors.New("no JSON found in the response")
+	}
+	return first, nil
+}
+
+type jsonCandidate struct {
+	json    json.RawMessage
+	repairs []JSONRepair
+	offset  int
+}
+
+// jsonCandidates returns the balanced {...} and [...] spans of a text that parse, after repairs when needed.
+// A span that doesn't parse doesn't hide the candidates nested in it. At most maxJSONCandidates spans of the
+// first maxJSONScanBytes are tried, so brace heavy or truncated output can't make the search quadratic.
+func jsonCandidates(text string) []jsonCandidate {
+	if len(text) > maxJSONScanBytes {
+		text = text[:maxJSONScanBytes]
+	}
+	var candidates []jsonCandidate
+	attempts := 0
+	for start := 0; start < len(text) && attempts < maxJSONCandidates; start++ {
+		if text[start] != '{' && text[start] != '[' {
+			continue
+		}
+		attempts++
+		end, closed := matchingClose(text, start)
+		parsed, repairs, ok := repairJSON(text[start:end], !closed)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, jsonCandidate{json: parsed, repairs: repairs, offset: start})
+		start = end - 1
+	}
+	return candidates
+}
+
+// matchingClose returns the end of the value starting at start, skipping quoted strings.
+// closed is false when the text ends first.
+func matchingClose(text string, start int) (end int, closed bool) {
+	var stack []byte
+	var quote byte
+	for i := start; i < len(text); i++ {
+		c := text[i]
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch c {
+		case '"', '\'':
+			quote = c
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) == 0 || stack[len(stack)-1] != c {
+				// Mismatched brackets, e.g. prose like "[see {below]"
+				return i + 1, true
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i + 1, true
+			}
+		}
+	}
+	return len(text), false
+}
+
+// repairJSON returns the candidate as valid JSON, applying the repairs it needs in order
+func repairJSON(candidate string, truncated bool) (json.RawMessage, []JSONRepair, bool) {
+	if json.Valid([]byte(candidate)) {
+		return json.RawMessage(candidate), nil, true
+	}
+
+	var repairs []JSONRepair
+	repaired := candidate
+	steps := []struct {
+		repair JSONRepair
+		apply  func(string) string
+	}{
+		{JSONRepairComments, removeJSONComments},
+		{JSONRepairSingleQuotes, convertSingleQuotes},
+		{JSONRepairTrailingCommas, removeTrailingCommas},
+	}
+	if truncated {
+		steps = append(steps, struct {
+			repair JSONRepair
+			apply  func(string) string
+		}{JSONRepairTruncated, closeTruncatedJSON})
+	}
+	for _, step := range steps {
+		if next := step.apply(repaired); next != repaired {
+			repaired = next
+			repairs = append(repairs, step.repair)
+		}
+		if json.Valid([]byte(repaired)) {
+			return json.RawMessage(repaired), repairs, true
+		}
+	}
+	return nil, nil, false
+}
+
+// scanJSONText calls fn for every byte outside of double quoted strings, fn returns how many bytes it consumed
+// and what to write instead
+func scanJSONText(text string, fn func(rest string) (consumed int, replacement string)) string {
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(text); {
+		c := text[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\\' && i+1 < len(text) {
+				b.WriteByte(text[i+1])
+				i += 2
+				continue
+			}
+			if c == '"' {
+				inString = false
+			}
+			i++
+			continue
+		}
+		if c == '"' {
+			inString = true
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		consumed, replacement := fn(text[i:])
+		if consumed == 0 {
+			b.WriteByte(c)
+			i++
+			continue
+		}
+		b.WriteString(replacement)
+		i += consumed
+	}
+	return b.String()
+}
+
+// removeJSONComments removes // line and /* block */ comments
+func removeJSONComments(text string) string {
+	return scanJSONText(text, func(rest string) (int, string) {
+		switch {
+		case strings.HasPrefix(rest, "//"):
+			if end := strings.IndexByte(rest, '\n'); end >= 0 {
+				return end, ""
+			}
+			return len(rest), ""
+		case strings.HasPrefix(rest, "/*"):
+			if end := strings.Index(rest[2:], "*/"); end >= 0 {
+				return end + 4, ""
+			}
+			return len(rest), ""
+		}
+		return 0, ""
+	})
+}
+
+// convertSingleQuotes turns 'single quoted' strings into double quoted ones
+func convertSingleQuotes(text string) string {
+	return scanJSONText(text, func(rest string) (int, string) {
+		if rest[0] != '\'' {
+			return 0, ""
+		}
+		var b strings.Builder
+		b.WriteByte('"')
+		for i := 1; i < len(rest); i++ {
+			switch c := rest[i]; {
+			case c == '\\' && i+1 < len(rest) && rest[i+1] == '\'':
+				b.WriteByte('\'')
+				i++
+			case c == '\\' && i+1 < len(rest):
+				b.WriteByte(c)
+				b.WriteByte(rest[i+1])
+				i++
+			case c == '"':
+				b.WriteString(`\"`)
+			case c == '\'':
+				b.WriteByte('"')
+				return i + 1, b.String()
+			default:
+				b.WriteByte(c)
+			}
+		}
+		// Unterminated, left for the truncation repair
+		return len(rest), b.String()
+	})
+}
+
+// removeTrailingCommas removes commas directly before a closing brace or bracket
+func removeTrailingCommas(text string) string {
+	return scanJSONText(text, func(rest string) (int, string) {
+		if rest[0] != ',' {
+			return 0, ""
+		}
+		next := strings.TrimLeft(rest[1:], " \t\r\n")
+		if next != "" && (next[0] == '}' || next[0] == ']') {
+			return 1, ""
+		}
+		return 0, ""
+	})
+}
+
+// closeTruncatedJSON closes an unterminated string and all open objects and arrays, dropping a
+// trailing comma, a key without a value or an incomplete literal
+func closeTruncatedJSON(text string) string {
+	var stack []byte
+	inString := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			stack = append(stack, '}')
+		case '[':
+			stack = append(stack, ']')
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	if inString {
+		text = strings.TrimSuffix(text, `\`) + `"`
+	}
+	text = strings.TrimRight(text, " \t\r\n")
+	// Drop an incomplete literal like tru or 12. and the separators left dangling before it
+	text = replaceTail(incompleteLiteralPattern, text, "$1")
+	text = strings.TrimRight(text, " \t\r\n")
+	text = strings.TrimSuffix(text, ",")
+	if len(stack) > 0 && stack[len(stack)-1] == '}' {
+		// A key without a value, with or without its colon
+		text = replaceTail(danglingKeyPattern, text, "$1")
+		text = strings.TrimSuffix(strings.TrimRight(text, " \t\r\n"), ",")
+	}
+	closers := make([]byte, len(stack))
+	for i, closer := range stack {
+		closers[len(stack)-1-i] = closer
+	}
+	return text + string(closers)
+}
+
+// replaceTail applies a pattern anchored at the end of the text to its last truncatedTailBytes only,
+// scanning all of a long text is slow
+func replaceTail(pattern *regexp.Regexp, text, replacement string) string {
+	split := max(0, len(text)-truncatedTailBytes)
+	return text[:split] + pattern.ReplaceAllString(text[split:], replacement)
+}
@@ -0,0 +1,125 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExtractJSON(t *testing.T) {
+	cases := []struct {
+		name     string
+		text     string
+		expected string
+		source   string
+		repairs  []JSONRepair
+	}{
+		{
+			name:     "prose with braces before the JSON",
+			text:     `Use {name} as a placeholder. Result: {"label": "spam", "note": "a } in a string"} Done.`,
+			expected: `{"label": "spam", "note": "a } in a string"}`,
+			source:   JSONSourceInline,
+		},
+		{
+			name:     "fenced json block wins over inline JSON",
+			text:     "Example: {\"label\": \"ham\"}\n```json\n{\"label\": \"spam\"}\n```",
+			expected: `{"label": "spam"}`,
+			source:   JSONSourceFenced,
+		},
+		{
+			name:     "comments and trailing commas",
+			text:     "```\n{\n  \"label\": \"spam\", // the label\n  /* scores */ \"tags\": [\"a\", \"b\",],\n}\n```",
+			expected: "{\n  \"label\": \"spam\", \n   \"tags\": [\"a\", \"b\"]\n}",
+			source:   JSONSourceFenced,
+			repairs:  []JSONRepair{JSONRepairComments, JSONRepairTrailingCommas},
+		},
+		{
+			name:     "single quotes",
+			text:     `{'label': 'it\'s "spam"'}`,
+			expected: `{"label": "it's \"spam\""}`,
+			source:   JSONSourceInline,
+			repairs:  []JSONRepair{JSONRepairSingleQuotes},
+		},
+		{
+			name:     "truncated in a string",
+			text:     `Here it is: {"label": "spam", "tags": ["a", "bu`,
+			expected: `{"label": "spam", "tags": ["a", "bu"]}`,
+			source:   JSONSourceInline,
+			repairs:  []JSONRepair{JSONRepairTruncated},
+		},
+		{
+			name:     "truncated after a key",
+			text:     "```json\n{\"label\": \"spam\", \"score\": 0.5, \"valid\": tr",
+			expected: `{"label": "spam", "score": 0.5}`,
+			source:   JSONSourceFenced,
+			repairs:  []JSONRepair{JSONRepairTruncated},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			extraction, err := ExtractJSON(c.text, nil)
+			if err != nil {
+				t.Fatalf("ExtractJSON failed: %v", err)
+			}
+			if string(extraction.JSON) != c.expected || extraction.Source != c.source || !slices.Equal(extraction.Repairs, c.repairs) {
+				t.Errorf("ExtractJSON() = %s from %s with %v, expected %s from %s with %v",
+					extraction.JSON, extraction.Source, extraction.Repairs, c.expected, c.source, c.repairs)
+			}
+			if len(c.repairs) == 0 && !strings.HasPrefix(c.text[extraction.Offset:], c.expected) {
+				t.Errorf("Offset %d doesn't point at the extracted JSON", extraction.Offset)
+			}
+		})
+	}
+
+	// An identical value in the prose doesn't move the offset of the fenced candidate
+	text := "Example: {\"label\": \"spam\"}\n```json\n{\"label\": \"spam\"}\n```"
+	extraction, err := ExtractJSON(text, nil)
+	if err != nil {
+		t.Fatalf("ExtractJSON failed: %v", err)
+	}
+	if extraction.Source != JSONSourceFenced || extraction.Offset != strings.LastIndex(text, `{"label"`) {
+		t.Errorf("Expected the offset of the fenced candidate, got %d from %s", extraction.Offset, extraction.Source)
+	}
+
+	if _, err := ExtractJSON("no json {here", nil); err == nil {
+		t.Error("Expected an error without JSON")
+	}
+}
+
+func TestExtractJSONPrefersSchemaMatch(t *testing.T) {
+	schema := &Definition{Type: Object, Properties: map[string]Definition{"label": {Type: String, Enum: []string{"spam", "ham"}}}, Required: []string{"label"}}
+	text := "Input was:\n```json\n{\"text\": \"buy now\"}\n```\nAnswer: [1, 2] {\"label\": \"spam\"}"
+
+	extraction, err := ExtractJSON(text, schema)
+	if err != nil {
+		t.Fatalf("ExtractJSON failed: %v", err)
+	}
+	if string(extraction.JSON) != `{"label": "spam"}` || !extraction.Valid {
+		t.Errorf("Expected the candidate matching the schema, got %+v", extraction)
+	}
+
+	extraction, err = ExtractJSON(`{"label": "eggs"}`, schema)
+	if err != nil || extraction.Valid || !json.Valid(extraction.JSON) {
+		t.Errorf("Expected the first parsed candidate when none matches, got %+v, %v", extraction, err)
+	}
+}
+
+func TestExtractJSONBoundsCandidates(t *testing.T) {
+	// Every unclosed brace starts a span reaching the end of the text
+	text := strings.Repeat("{[ ", 100000)
+	start := time.Now()
+	if _, err := ExtractJSON(text, nil); err == nil {
+		t.Error("Expected an error without JSON")
+	}
+	// Generous bound, the unbounded search takes minutes while race builds are several times slower
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the search to be bounded, took %v", elapsed)
+	}
+
+	extraction, err := ExtractJSON(`{see {the} [answer] below} {"label": "spam"}`, nil)
+	if err != nil || string(extraction.JSON) != `{"label": "spam"}` {
+		t.Errorf("Expected the JSON after unparsable spans, got %+v, %v", extraction, err)
+	}
+}
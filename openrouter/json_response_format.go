@@ -10,16 +10,33 @@ import (
 // specifically designed for JSON examples (not Go structs). This is optimized for the dual-path
 // execution system where we work with JSON data throughout the pipeline.
 func UseOpenRouterJsonFormatFromJSON(jsonExample json.RawMessage, schemaName string) (json.RawMessage, error) {
-	if len(jsonExample) == 0 {
-		return nil, fmt.Errorf("empty JSON example provided")
+	return UseOpenRouterJsonFormatFromJSONExamples([]json.RawMessage{jsonExample}, schemaName)
+}
+
+// UseOpenRouterJsonFormatFromJSONExamples creates a JSON schema response format accepting all of the examples,
+// see GenerateSchemaFromJSONExamples for how they are merged
+func UseOpenRouterJsonFormatFromJSONExamples(jsonExamples []json.RawMessage, schemaName string) (json.RawMessage, error) {
+	for _, jsonExample := range jsonExamples {
+		if len(jsonExample) == 0 {
+			return nil, fmt.Errorf("empty JSON example provided")
+		}
 	}
 
-	// Generate schema definition directly from JSON example
-	// This uses the existing GenerateSchemaFromJSONExample which is designed for this purpose
-	schemaDef, err := GenerateSchemaFromJSONExample(jsonExample)
+	// Generate schema definition directly from the JSON examples
+	// Strict mode keeps every property required, optional properties become nullable
+	schemaDef, err := GenerateSchemaFromJSONExamples(jsonExamples, SchemaOptions{Strict: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate schema from JSON example: %w", err)
 	}
+	return UseOpenRouterJsonFormatFromSchema(schemaDef, schemaName)
+}
+
+// UseOpenRouterJsonFormatFromSchema creates a JSON schema response format from a schema definition,
+// strict mode is only enabled when the schema satisfies it (see IsStrictSchema) since providers reject it otherwise
+func UseOpenRouterJsonFormatFromSchema(schemaDef *Definition, schemaName string) (json.RawMessage, error) {
+	if schemaDef == nil {
+		return nil, fmt.Errorf("no schema definition provided")
+	}
 
 	// Convert the Definition to JSON for the schema
 	schemaBytes, err := json.Marshal(schemaDef)
@@ -39,7 +56,7 @@ func UseOpenRouterJsonFormatFromJSON(jsonExample json.RawMessage, schemaName str
 		"json_schema": map[string]interface{}{
 			"name":   safeName,
 			"schema": json.RawMessage(schemaBytes),
-			"strict": true, // Enable strict mode for better compliance
+			"strict": IsStrictSchema(schemaDef), // Enable strict mode for better compliance
 		},
 	}
 
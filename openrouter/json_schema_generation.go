@@ -3,82 +3,197 @@ package openrouter
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 )
 
-// GenerateSchemaFromJSONExample creates a schema definition from a JSON example
+// GenerateSchemaFromJSONExample creates a schema definition from a JSON example.
+// Properties with a null example are optional and nullable.
 func GenerateSchemaFromJSONExample(example json.RawMessage) (*Definition, error) {
-	if len(example) == 0 {
-		return nil, fmt.Errorf("empty JSON example")
-	}
-	
-	// Parse the JSON to determine its structure
-	var parsed interface{}
-	if err := json.Unmarshal(example, &parsed); err != nil {
-		return nil, fmt.Errorf("invalid JSON example: %w", err)
-	}
-	
-	// Generate schema from the parsed structure
-	return generateSchemaFromInterface(parsed)
+	return GenerateSchemaFromJSONExampleWithOptions(example, SchemaOptions{})
+}
+
+// GenerateSchemaFromJSONExampleWithOptions creates a schema definition from a JSON example,
+// in strict mode properties with a null example stay required
+func GenerateSchemaFromJSONExampleWithOptions(example json.RawMessage, opts SchemaOptions) (*Definition, error) {
+	return GenerateSchemaFromJSONExamples([]json.RawMessage{example}, opts)
+}
+
+// GenerateSchemaFromJSONExamples creates a schema definition that accepts every example.
+// Examples are merged like the elements of an array: objects get the union of their keys, keys missing
+// from some examples are optional, integers widen to numbers and other mixed types become an anyOf.
+func GenerateSchemaFromJSONExamples(examples []json.RawMessage, opts SchemaOptions) (*Definition, error) {
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("no JSON examples")
+	}
+
+	values := make([]interface{}, 0, len(examples))
+	for i, example := range examples {
+		if len(example) == 0 {
+			return nil, fmt.Errorf("empty JSON example")
+		}
+		var parsed interface{}
+		if err := json.Unmarshal(example, &parsed); err != nil {
+			if len(examples) > 1 {
+				return nil, fmt.Errorf("invalid JSON example %d: %w", i, err)
+			}
+			return nil, fmt.Errorf("invalid JSON example: %w", err)
+		}
+		values = append(values, parsed)
+	}
+	if len(values) == 1 {
+		return generateSchemaWithOptions(values[0], opts)
+	}
+	return inferSchema(values, opts)
 }
 
 // generateSchemaFromInterface recursively builds schema from parsed JSON
 func generateSchemaFromInterface(v interface{}) (*Definition, error) {
-	switch val := v.(type) {
-	case map[string]interface{}:
-		return generateObjectSchema(val)
-	case []interface{}:
-		return generateArraySchema(val)
-	case string:
-		return &Definition{Type: String}, nil
-	case float64:
-		// JSON numbers are always float64
-		if val == float64(int64(val)) {
-			return &Definition{Type: Integer}, nil
-		}
-		return &Definition{Type: Number}, nil
-	case bool:
-		return &Definition{Type: Boolean}, nil
-	case nil:
+	return generateSchemaWithOptions(v, SchemaOptions{})
+}
+
+func generateSchemaWithOptions(v interface{}, opts SchemaOptions) (*Definition, error) {
+	if v == nil {
 		return &Definition{Type: Null}, nil
+	}
+	return inferSchema([]interface{}{v}, opts)
+}
+
+// nullExampleSchema is the schema of a property whose example is null: a nullable value of any scalar type
+func nullExampleSchema() *Definition {
+	return &Definition{AnyOf: []Definition{{Type: String}, {Type: Number}, {Type: Boolean}}, Nullable: true}
+}
+
+// exampleSamples are the parsed example values seen at one position of the document, grouped by JSON type
+type exampleSamples struct {
+	objects                                     []map[string]interface{}
+	arrays                                      [][]interface{}
+	strings, integers, numbers, booleans, nulls int
+}
+
+// inferSchema builds the schema accepting all values seen at one position of the examples
+func inferSchema(values []interface{}, opts SchemaOptions) (*Definition, error) {
+	var samples exampleSamples
+	for _, v := range values {
+		switch val := v.(type) {
+		case map[string]interface{}:
+			samples.objects = append(samples.objects, val)
+		case []interface{}:
+			samples.arrays = append(samples.arrays, val)
+		case string:
+			samples.strings++
+		case float64:
+			// JSON numbers are always float64
+			if val == float64(int64(val)) {
+				samples.integers++
+			} else {
+				samples.numbers++
+			}
+		case bool:
+			samples.booleans++
+		case nil:
+			samples.nulls++
+		default:
+			return nil, fmt.Errorf("unsupported type: %T", v)
+		}
+	}
+
+	var options []Definition
+	if len(samples.objects) > 0 {
+		def, err := generateObjectSchema(samples.objects, opts)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, *def)
+	}
+	if len(samples.arrays) > 0 {
+		def, err := generateArraySchema(samples.arrays, opts)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, *def)
+	}
+	if samples.strings > 0 {
+		options = append(options, Definition{Type: String})
+	}
+	if samples.numbers > 0 {
+		options = append(options, Definition{Type: Number})
+	} else if samples.integers > 0 {
+		options = append(options, Definition{Type: Integer})
+	}
+	if samples.booleans > 0 {
+		options = append(options, Definition{Type: Boolean})
+	}
+
+	var def *Definition
+	switch len(options) {
+	case 0:
+		// Only nulls, nothing is known about the value
+		return nullExampleSchema(), nil
+	case 1:
+		def = &options[0]
 	default:
-		return nil, fmt.Errorf("unsupported type: %T", v)
+		def = &Definition{AnyOf: options}
 	}
+	def.Nullable = samples.nulls > 0
+	return def, nil
 }
 
-func generateObjectSchema(obj map[string]interface{}) (*Definition, error) {
+// generateObjectSchema merges example objects: a key is required when every object has a non-null value for it.
+// In strict mode all keys are required and the optional ones are nullable instead.
+func generateObjectSchema(objects []map[string]interface{}, opts SchemaOptions) (*Definition, error) {
 	def := &Definition{
 		Type:                 Object,
 		Properties:           make(map[string]Definition),
 		AdditionalProperties: false,
 	}
-	
+
+	values := make(map[string][]interface{})
+	var keys []string
+	for _, obj := range objects {
+		for key, value := range obj {
+			if _, seen := values[key]; !seen {
+				keys = append(keys, key)
+			}
+			values[key] = append(values[key], value)
+		}
+	}
+	sort.Strings(keys)
+
 	var required []string
-	
-	for key, value := range obj {
-		propSchema, err := generateSchemaFromInterface(value)
+	for _, key := range keys {
+		propSchema, err := inferSchema(values[key], opts)
 		if err != nil {
 			return nil, fmt.Errorf("error generating schema for property %s: %w", key, err)
 		}
-		
+
+		optional := propSchema.Nullable || len(values[key]) < len(objects)
+		if opts.Strict {
+			propSchema.Nullable = optional
+			required = append(required, key)
+		} else if !optional {
+			required = append(required, key)
+		}
 		def.Properties[key] = *propSchema
-		required = append(required, key)
 	}
-	
+
 	def.Required = required
 	return def, nil
 }
 
-func generateArraySchema(arr []interface{}) (*Definition, error) {
-	def := &Definition{Type: Array}
-	
-	if len(arr) > 0 {
-		// Use first element to determine item schema
-		itemSchema, err := generateSchemaFromInterface(arr[0])
-		if err != nil {
-			return nil, fmt.Errorf("error generating array item schema: %w", err)
-		}
-		def.Items = itemSchema
+// generateArraySchema merges the elements of all example arrays into one item schema,
+// items are unconstrained when every example array is empty
+func generateArraySchema(arrays [][]interface{}, opts SchemaOptions) (*Definition, error) {
+	var elements []interface{}
+	for _, arr := range arrays {
+		elements = append(elements, arr...)
 	}
-	
-	return def, nil
-}
\ No newline at end of file
+	if len(elements) == 0 {
+		return &Definition{Type: Array, Items: &Definition{}}, nil
+	}
+
+	itemSchema, err := inferSchema(elements, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error generating array item schema: %w", err)
+	}
+	return &Definition{Type: Array, Items: itemSchema}, nil
+}
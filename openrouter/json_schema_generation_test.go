@@ -55,7 +55,7 @@ func TestGenerateSchemaFromJSONExample(t *testing.T) {
 				AdditionalProperties: false,
 				Properties: map[string]Definition{
 					"tags": {
-						Type: Array,
+						Type:  Array,
 						Items: &Definition{Type: String},
 					},
 					"active": {Type: Boolean},
@@ -95,19 +95,19 @@ func TestGenerateSchemaFromJSONExample(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result, err := GenerateSchemaFromJSONExample(tt.example)
-			
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
 				}
 				return
 			}
-			
+
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
 				return
 			}
-			
+
 			if !compareDefinitions(result, tt.expected) {
 				t.Errorf("Schema mismatch.\nExpected: %+v\nGot: %+v", tt.expected, result)
 			}
@@ -155,7 +155,7 @@ func TestGenerateSchemaFromInterface(t *testing.T) {
 		{
 			name:     "empty array",
 			input:    []interface{}{},
-			expected: &Definition{Type: Array},
+			expected: &Definition{Type: Array, Items: &Definition{}},
 			hasError: false,
 		},
 		{
@@ -172,19 +172,19 @@ func TestGenerateSchemaFromInterface(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			result, err := generateSchemaFromInterface(tt.input)
-			
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
 				}
 				return
 			}
-			
+
 			if err != nil {
 				t.Errorf("Unexpected error: %v", err)
 				return
 			}
-			
+
 			if !compareDefinitions(result, tt.expected) {
 				t.Errorf("Schema mismatch.\nExpected: %+v\nGot: %+v", tt.expected, result)
 			}
@@ -200,37 +200,37 @@ func compareDefinitions(a, b *Definition) bool {
 	if a == nil || b == nil {
 		return false
 	}
-	
+
 	if a.Type != b.Type {
 		return false
 	}
-	
+
 	if a.Description != b.Description {
 		return false
 	}
-	
+
 	if !compareStringSlices(a.Required, b.Required) {
 		return false
 	}
-	
+
 	if !compareStringSlices(a.Enum, b.Enum) {
 		return false
 	}
-	
+
 	if a.AdditionalProperties != b.AdditionalProperties {
 		return false
 	}
-	
+
 	// Compare Items
 	if !compareDefinitions(a.Items, b.Items) {
 		return false
 	}
-	
+
 	// Compare Properties
 	if len(a.Properties) != len(b.Properties) {
 		return false
 	}
-	
+
 	for key, propA := range a.Properties {
 		propB, exists := b.Properties[key]
 		if !exists {
@@ -240,7 +240,7 @@ func compareDefinitions(a, b *Definition) bool {
 			return false
 		}
 	}
-	
+
 	return true
 }
 
@@ -249,23 +249,76 @@ func compareStringSlices(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
 	}
-	
+
 	// Create maps to check existence
 	mapA := make(map[string]bool)
 	mapB := make(map[string]bool)
-	
+
 	for _, s := range a {
 		mapA[s] = true
 	}
 	for _, s := range b {
 		mapB[s] = true
 	}
-	
+
 	for key := range mapA {
 		if !mapB[key] {
 			return false
 		}
 	}
-	
+
 	return true
-}
\ No newline at end of file
+}
+
+func TestGenerateSchemaFromJSONExamplesMerging(t *testing.T) {
+	examples := []json.RawMessage{
+		json.RawMessage(`{"id": 1, "tags": ["a", 2], "items": [{"name": "x", "qty": 1}, {"name": "y", "note": null}]}`),
+		json.RawMessage(`{"id": 1.5, "tags": [], "extra": true, "items": []}`),
+	}
+
+	schema, err := GenerateSchemaFromJSONExamples(examples, SchemaOptions{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaFromJSONExamples failed: %v", err)
+	}
+	if !compareStringSlices(schema.Required, []string{"id", "tags", "items"}) {
+		t.Errorf("Expected keys present in every example to be required, got %v", schema.Required)
+	}
+	if schema.Properties["id"].Type != Number {
+		t.Errorf("Expected integers and numbers to merge into number, got %s", schema.Properties["id"].Type)
+	}
+	if tags := schema.Properties["tags"].Items; tags == nil || len(tags.AnyOf) != 2 || tags.AnyOf[0].Type != String || tags.AnyOf[1].Type != Integer {
+		t.Errorf("Expected mixed primitives to become anyOf, got %+v", tags)
+	}
+	items := schema.Properties["items"].Items
+	if items == nil || !compareStringSlices(items.Required, []string{"name"}) || len(items.Properties) != 3 {
+		t.Fatalf("Expected the union of element keys with the shared ones required, got %+v", items)
+	}
+	if !items.Properties["note"].Nullable || items.Properties["qty"].Type != Integer {
+		t.Errorf("Expected element properties to be merged, got %+v", items.Properties)
+	}
+
+	if err := ValidateJSONAgainstSchema(json.RawMessage(`{"id": 3, "tags": ["b", 4], "items": [{"name": "z"}]}`), schema); err != nil {
+		t.Errorf("Expected optional keys to be omittable, got %v", err)
+	}
+	if err := ValidateJSONAgainstSchema(json.RawMessage(`{"id": 3, "tags": [true], "items": []}`), schema); err == nil {
+		t.Error("Expected item types outside the anyOf to be invalid")
+	}
+	if err := ValidateJSONAgainstSchema(json.RawMessage(`{"id": 3, "tags": [], "items": [{"qty": 2}]}`), schema); err == nil {
+		t.Error("Expected an element without the shared key to be invalid")
+	}
+
+	strict, err := GenerateSchemaFromJSONExamples(examples, SchemaOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("GenerateSchemaFromJSONExamples failed: %v", err)
+	}
+	if len(strict.Required) != 4 || !strict.Properties["extra"].Nullable || strict.Properties["id"].Nullable {
+		t.Errorf("Expected strict mode to require every key and make optional ones nullable, got %v", strict.Required)
+	}
+
+	if _, err := GenerateSchemaFromJSONExamples(nil, SchemaOptions{}); err == nil {
+		t.Error("Expected an error without examples")
+	}
+	if _, err := GenerateSchemaFromJSONExamples([]json.RawMessage{examples[0], json.RawMessage(`{`)}, SchemaOptions{}); err == nil {
+		t.Error("Expected an error for an invalid example")
+	}
+}
@@ -3,89 +3,376 @@ package openrouter
 import (
 	"encoding/json"
 	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
-// ValidateJSONAgainstSchema validates JSON data against a schema definition
+// maxRefDepth stops references that resolve to themselves without descending into the value
+const maxRefDepth = 64
+
+// ValidationError is a single schema violation
+type ValidationError struct {
+	Path    string `json:"path"`    // JSON pointer of the value, "" for the root
+	Keyword string `json:"keyword"` // Schema keyword that failed, e.g. "type", "required" or "enum"
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "root"
+	}
+	return fmt.Sprintf("%s at %s", e.Message, path)
+}
+
+// ValidationErrors are all violations found in a value, use errors.As to get them from
+// the error returned by ValidateJSONAgainstSchema
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	messages := make([]string, len(e))
+	for i, violation := range e {
+		messages[i] = violation.Error()
+	}
+	return fmt.Sprintf("%d schema violations: %s", len(e), strings.Join(messages, "; "))
+}
+
+// ValidateJSONAgainstSchema validates JSON data against a schema definition. All violations
+// are returned as ValidationErrors, invalid JSON as a plain error.
 func ValidateJSONAgainstSchema(data json.RawMessage, schema *Definition) error {
 	var parsed interface{}
 	if err := json.Unmarshal(data, &parsed); err != nil {
 		return fmt.Errorf("invalid JSON: %w", err)
 	}
-	
-	return validateValueAgainstSchema(parsed, schema, "root")
+	if violations := ValidateValue(parsed, schema); len(violations) > 0 {
+		return violations
+	}
+	return nil
 }
 
-func validateValueAgainstSchema(value interface{}, schema *Definition, path string) error {
-	switch schema.Type {
-	case Object:
-		return validateObjectAgainstSchema(value, schema, path)
-	case Array:
-		return validateArrayAgainstSchema(value, schema, path)
-	case String:
-		if _, ok := value.(string); !ok {
-			return fmt.Errorf("expected string at %s, got %T", path, value)
+// ValidateValue validates a decoded JSON value (as produced by json.Unmarshal into any) against a schema
+func ValidateValue(value any, schema *Definition) ValidationErrors {
+	v := &schemaValidator{root: schema}
+	v.validate(value, schema, "", 0)
+	return v.errors
+}
+
+// schemaValidator collects the violations of a value, root resolves references
+type schemaValidator struct {
+	root   *Definition
+	errors ValidationErrors
+}
+
+func (v *schemaValidator) fail(path, keyword, format string, args ...any) {
+	v.errors = append(v.errors, ValidationError{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+}
+
+// matches reports whether the value is valid against a schema without recording violations
+func (v *schemaValidator) matches(value any, schema *Definition, path string, refDepth int) (bool, ValidationErrors) {
+	sub := &schemaValidator{root: v.root}
+	sub.validate(value, schema, path, refDepth)
+	return len(sub.errors) == 0, sub.errors
+}
+
+func (v *schemaValidator) validate(value any, schema *Definition, path string, refDepth int) {
+	if schema == nil {
+		return
+	}
+	if value == nil && schema.Nullable {
+		return
+	}
+
+	if schema.Ref != "" {
+		if refDepth >= maxRefDepth {
+			v.fail(path, "$ref", "reference %s nests too deeply", schema.Ref)
+			return
 		}
-	case Number:
-		if _, ok := value.(float64); !ok {
-			return fmt.Errorf("expected number at %s, got %T", path, value)
+		target, ok := v.resolve(schema.Ref)
+		if !ok {
+			v.fail(path, "$ref", "unresolvable reference %s", schema.Ref)
+			return
 		}
-	case Integer:
-		if num, ok := value.(float64); !ok || num != float64(int64(num)) {
-			return fmt.Errorf("expected integer at %s, got %T", path, value)
+		v.validate(value, target, path, refDepth+1)
+	}
+
+	if schema.Type != "" && !matchesType(value, schema.Type) {
+		v.fail(path, "type", "expected %s, got %s", schema.Type, jsonTypeName(value))
+		return
+	}
+
+	if len(schema.Enum) > 0 {
+		if str, ok := value.(string); !ok || !slices.Contains(schema.Enum, str) {
+			v.fail(path, "enum", "value %s is not one of %v", encodeValue(value), schema.Enum)
 		}
-	case Boolean:
-		if _, ok := value.(bool); !ok {
-			return fmt.Errorf("expected boolean at %s, got %T", path, value)
+	}
+	if schema.Const != nil && !equalJSON(value, schema.Const) {
+		v.fail(path, "const", "value %s is not the constant %s", encodeValue(value), encodeValue(schema.Const))
+	}
+
+	switch typed := value.(type) {
+	case string:
+		v.validateString(typed, schema, path)
+	case float64:
+		v.validateNumber(typed, schema, path)
+	case []any:
+		v.validateArray(typed, schema, path, refDepth)
+	case map[string]any:
+		v.validateObject(typed, schema, path, refDepth)
+	}
+
+	v.validateCombinations(value, schema, path, refDepth)
+}
+
+func (v *schemaValidator) validateCombinations(value any, schema *Definition, path string, refDepth int) {
+	for i := range schema.AllOf {
+		v.validate(value, &schema.AllOf[i], path, refDepth)
+	}
+
+	if len(schema.AnyOf) > 0 {
+		var closest ValidationErrors
+		matched := false
+		for i := range schema.AnyOf {
+			ok, violations := v.matches(value, &schema.AnyOf[i], path, refDepth)
+			if ok {
+				matched = true
+				break
+			}
+			if closest == nil || len(violations) < len(closest) {
+				closest = violations
+			}
 		}
-	case Null:
-		if value != nil {
-			return fmt.Errorf("expected null at %s, got %T", path, value)
+		if !matched {
+			v.fail(path, "anyOf", "value matches none of the %d anyOf schemas (closest: %s)", len(schema.AnyOf), closest.Error())
+		}
+	}
+
+	if len(schema.OneOf) > 0 {
+		count := 0
+		for i := range schema.OneOf {
+			if ok, _ := v.matches(value, &schema.OneOf[i], path, refDepth); ok {
+				count++
+			}
+		}
+		if count != 1 {
+			v.fail(path, "oneOf", "value matches %d of the oneOf schemas, expected exactly one", count)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(value string, schema *Definition, path string) {
+	length := utf8.RuneCountInString(value)
+	if schema.MinLength != nil && length < *schema.MinLength {
+		v.fail(path, "minLength", "string has length %d, expected at least %d", length, *schema.MinLength)
+	}
+	if schema.MaxLength != nil && length > *schema.MaxLength {
+		v.fail(path, "maxLength", "string has length %d, expected at most %d", length, *schema.MaxLength)
+	}
+	if schema.Pattern != "" {
+		re, err := regexp.Compile(schema.Pattern)
+		if err != nil {
+			v.fail(path, "pattern", "invalid pattern %q: %v", schema.Pattern, err)
+		} else if !re.MatchString(value) {
+			v.fail(path, "pattern", "value %q does not match pattern %s", value, schema.Pattern)
+		}
+	}
+	if schema.Format != "" && !matchesFormat(value, schema.Format) {
+		v.fail(path, "format", "value %q is not a valid %s", value, schema.Format)
+	}
+}
+
+func (v *schemaValidator) validateNumber(value float64, schema *Definition, path string) {
+	if schema.Minimum != nil && value < *schema.Minimum {
+		v.fail(path, "minimum", "value %v is less than the minimum %v", value, *schema.Minimum)
+	}
+	if schema.Maximum != nil && value > *schema.Maximum {
+		v.fail(path, "maximum", "value %v is greater than the maximum %v", value, *schema.Maximum)
+	}
+	if schema.ExclusiveMinimum != nil && value <= *schema.ExclusiveMinimum {
+		v.fail(path, "exclusiveMinimum", "value %v is not greater than the exclusive minimum %v", value, *schema.ExclusiveMinimum)
+	}
+	if schema.ExclusiveMaximum != nil && value >= *schema.ExclusiveMaximum {
+		v.fail(path, "exclusiveMaximum", "value %v is not less than the exclusive maximum %v", value, *schema.ExclusiveMaximum)
+	}
+	if schema.MultipleOf != nil && *schema.MultipleOf > 0 {
+		quotient := value / *schema.MultipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			v.fail(path, "multipleOf", "value %v is not a multiple of %v", value, *schema.MultipleOf)
 		}
 	}
-	
-	return nil
 }
 
-func validateObjectAgainstSchema(value interface{}, schema *Definition, path string) error {
-	obj, ok := value.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("expected object at %s, got %T", path, value)
+func (v *schemaValidator) validateArray(value []any, schema *Definition, path string, refDepth int) {
+	if schema.MinItems != nil && len(value) < *schema.MinItems {
+		v.fail(path, "minItems", "array has %d items, expected at least %d", len(value), *schema.MinItems)
+	}
+	if schema.MaxItems != nil && len(value) > *schema.MaxItems {
+		v.fail(path, "maxItems", "array has %d items, expected at most %d", len(value), *schema.MaxItems)
+	}
+	if schema.Items != nil {
+		for i, item := range value {
+			v.validate(item, schema.Items, fmt.Sprintf("%s/%d", path, i), refDepth)
+		}
 	}
-	
-	// Check required fields
+}
+
+func (v *schemaValidator) validateObject(value map[string]any, schema *Definition, path string, refDepth int) {
 	for _, required := range schema.Required {
-		if _, exists := obj[required]; !exists {
-			return fmt.Errorf("missing required field %s at %s", required, path)
+		if _, exists := value[required]; !exists {
+			v.fail(path, "required", "missing required field %s", required)
 		}
 	}
-	
-	// Validate each property
-	for key, val := range obj {
+
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		propertyPath := path + "/" + escapePointer(key)
 		if propSchema, exists := schema.Properties[key]; exists {
-			if err := validateValueAgainstSchema(val, &propSchema, fmt.Sprintf("%s.%s", path, key)); err != nil {
-				return err
+			v.validate(value[key], &propSchema, propertyPath, refDepth)
+			continue
+		}
+		switch additional := schema.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "additionalProperties", "unexpected property %s", key)
 			}
-		} else if schema.AdditionalProperties == false {
-			return fmt.Errorf("unexpected property %s at %s", key, path)
+		case Definition:
+			v.validate(value[key], &additional, propertyPath, refDepth)
+		case *Definition:
+			v.validate(value[key], additional, propertyPath, refDepth)
 		}
 	}
-	
-	return nil
 }
 
-func validateArrayAgainstSchema(value interface{}, schema *Definition, path string) error {
-	arr, ok := value.([]interface{})
-	if !ok {
-		return fmt.Errorf("expected array at %s, got %T", path, value)
+// resolve looks up a local reference in the root schema
+func (v *schemaValidator) resolve(ref string) (*Definition, bool) {
+	if ref == "#" {
+		return v.root, v.root != nil
 	}
-	
-	if schema.Items != nil {
-		for i, item := range arr {
-			if err := validateValueAgainstSchema(item, schema.Items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
-				return err
-			}
+	name, ok := strings.CutPrefix(ref, "#/$defs/")
+	if !ok || v.root == nil {
+		return nil, false
+	}
+	definition, ok := v.root.Defs[unescapePointer(name)]
+	return &definition, ok
+}
+
+func matchesType(value any, dataType DataType) bool {
+	switch dataType {
+	case Object:
+		_, ok := value.(map[string]any)
+		return ok
+	case Array:
+		_, ok := value.([]any)
+		return ok
+	case String:
+		_, ok := value.(string)
+		return ok
+	case Number:
+		_, ok := value.(float64)
+		return ok
+	case Integer:
+		num, ok := value.(float64)
+		return ok && num == math.Trunc(num) && !math.IsInf(num, 0)
+	case Boolean:
+		_, ok := value.(bool)
+		return ok
+	case Null:
+		return value == nil
+	}
+	return true
+}
+
+// jsonTypeName names the JSON type of a decoded value
+func jsonTypeName(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return "null"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if typed == math.Trunc(typed) {
+			return "integer"
 		}
+		return "number"
 	}
-	
-	return nil
-}
\ No newline at end of file
+	return fmt.Sprintf("%T", value)
+}
+
+func encodeValue(value any) string {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
+
+// equalJSON compares values after a JSON round trip, so Go constants compare equal to decoded JSON
+func equalJSON(a, b any) bool {
+	var normalizedA, normalizedB any
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	json.Unmarshal(encodedA, &normalizedA)
+	json.Unmarshal(encodedB, &normalizedB)
+	return reflect.DeepEqual(normalizedA, normalizedB)
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func unescapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// matchesFormat checks the string formats structured outputs support, unknown formats always match
+func matchesFormat(value, format string) bool {
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse(time.DateOnly, value)
+		return err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", value)
+		if err != nil {
+			_, err = time.Parse(time.TimeOnly, value)
+		}
+		return err == nil
+	case "email":
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	case "uri":
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.Scheme != ""
+	case "uuid":
+		return uuidPattern.MatchString(value)
+	}
+	return true
+}
@@ -2,6 +2,8 @@ package openrouter
 
 import (
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -10,8 +12,8 @@ func TestValidateJSONAgainstSchema(t *testing.T) {
 	schema := &Definition{
 		Type: Object,
 		Properties: map[string]Definition{
-			"name": {Type: String},
-			"age":  {Type: Integer},
+			"name":   {Type: String},
+			"age":    {Type: Integer},
 			"active": {Type: Boolean},
 			"tags": {
 				Type:  Array,
@@ -23,11 +25,11 @@ func TestValidateJSONAgainstSchema(t *testing.T) {
 					"created": {Type: String},
 					"version": {Type: Integer},
 				},
-				Required: []string{"created", "version"},
+				Required:             []string{"created", "version"},
 				AdditionalProperties: false,
 			},
 		},
-		Required: []string{"name", "age"},
+		Required:             []string{"name", "age"},
 		AdditionalProperties: false,
 	}
 
@@ -94,7 +96,7 @@ func TestValidateJSONAgainstSchema(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			err := ValidateJSONAgainstSchema(tt.data, schema)
-			
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
@@ -110,70 +112,70 @@ func TestValidateJSONAgainstSchema(t *testing.T) {
 	}
 }
 
-func TestValidateValueAgainstSchema(t *testing.T) {
+func TestValidateJSONAgainstSchemaTypes(t *testing.T) {
 	tests := []struct {
 		name     string
-		value    interface{}
+		value    string
 		schema   *Definition
 		hasError bool
 	}{
 		{
 			name:     "valid string",
-			value:    "test",
+			value:    `"test"`,
 			schema:   &Definition{Type: String},
 			hasError: false,
 		},
 		{
 			name:     "invalid string",
-			value:    123,
+			value:    `123`,
 			schema:   &Definition{Type: String},
 			hasError: true,
 		},
 		{
 			name:     "valid integer",
-			value:    float64(42),
+			value:    `42`,
 			schema:   &Definition{Type: Integer},
 			hasError: false,
 		},
 		{
 			name:     "invalid integer (float)",
-			value:    float64(42.5),
+			value:    `42.5`,
 			schema:   &Definition{Type: Integer},
 			hasError: true,
 		},
 		{
 			name:     "valid number",
-			value:    float64(42.5),
+			value:    `42.5`,
 			schema:   &Definition{Type: Number},
 			hasError: false,
 		},
 		{
 			name:     "invalid number",
-			value:    "not a number",
+			value:    `"not a number"`,
 			schema:   &Definition{Type: Number},
 			hasError: true,
 		},
 		{
 			name:     "valid boolean",
-			value:    true,
+			value:    `true`,
 			schema:   &Definition{Type: Boolean},
 			hasError: false,
 		},
 		{
 			name:     "invalid boolean",
-			value:    "true",
+			value:    `"true"`,
 			schema:   &Definition{Type: Boolean},
 			hasError: true,
 		},
 		{
 			name:     "valid null",
-			value:    nil,
+			value:    `null`,
 			schema:   &Definition{Type: Null},
 			hasError: false,
 		},
 		{
 			name:     "invalid null",
-			value:    "not null",
+			value:    `"not null"`,
 			schema:   &Definition{Type: Null},
 			hasError: true,
 		},
@@ -181,8 +183,8 @@ func TestValidateValueAgainstSchema(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateValueAgainstSchema(tt.value, tt.schema, "test")
-			
+			err := ValidateJSONAgainstSchema(json.RawMessage(tt.value), tt.schema)
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
@@ -196,16 +198,16 @@ func TestValidateValueAgainstSchema(t *testing.T) {
 	}
 }
 
-func TestValidateArrayAgainstSchema(t *testing.T) {
+func TestValidateJSONAgainstSchemaArrays(t *testing.T) {
 	tests := []struct {
 		name     string
-		value    interface{}
+		value    string
 		schema   *Definition
 		hasError bool
 	}{
 		{
 			name:  "valid string array",
-			value: []interface{}{"a", "b", "c"},
+			value: `["a", "b", "c"]`,
 			schema: &Definition{
 				Type:  Array,
 				Items: &Definition{Type: String},
@@ -214,7 +216,7 @@ func TestValidateArrayAgainstSchema(t *testing.T) {
 		},
 		{
 			name:  "invalid array item type",
-			value: []interface{}{"a", 123, "c"},
+			value: `["a", 123, "c"]`,
 			schema: &Definition{
 				Type:  Array,
 				Items: &Definition{Type: String},
@@ -223,7 +225,7 @@ func TestValidateArrayAgainstSchema(t *testing.T) {
 		},
 		{
 			name:  "empty array",
-			value: []interface{}{},
+			value: `[]`,
 			schema: &Definition{
 				Type:  Array,
 				Items: &Definition{Type: String},
@@ -232,13 +234,13 @@ func TestValidateArrayAgainstSchema(t *testing.T) {
 		},
 		{
 			name:     "not an array",
-			value:    "not an array",
+			value:    `"not an array"`,
 			schema:   &Definition{Type: Array},
 			hasError: true,
 		},
 		{
 			name:     "array without items schema",
-			value:    []interface{}{"a", "b"},
+			value:    `["a", "b"]`,
 			schema:   &Definition{Type: Array},
 			hasError: false,
 		},
@@ -246,8 +248,8 @@ func TestValidateArrayAgainstSchema(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validateArrayAgainstSchema(tt.value, tt.schema, "test")
-			
+			err := ValidateJSONAgainstSchema(json.RawMessage(tt.value), tt.schema)
+
 			if tt.hasError {
 				if err == nil {
 					t.Errorf("Expected error but got none")
@@ -263,14 +265,136 @@ func TestValidateArrayAgainstSchema(t *testing.T) {
 
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(substr) == 0 || 
-		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr || 
-		func() bool {
-			for i := 0; i <= len(s)-len(substr); i++ {
-				if s[i:i+len(substr)] == substr {
-					return true
+	return len(s) >= len(substr) && (s == substr || len(substr) == 0 ||
+		(len(s) > len(substr) && (s[:len(substr)] == substr || s[len(s)-len(substr):] == substr ||
+			func() bool {
+				for i := 0; i <= len(s)-len(substr); i++ {
+					if s[i:i+len(substr)] == substr {
+						return true
+					}
 				}
-			}
-			return false
-		}())))
-}
\ No newline at end of file
+				return false
+			}())))
+}
+
+func TestValidationErrorsCollectsAll(t *testing.T) {
+	minimum := 0.0
+	schema := &Definition{
+		Type: Object,
+		Properties: map[string]Definition{
+			"label": {Type: String, Enum: []string{"spam", "ham"}},
+			"score": {Type: Number, Minimum: &minimum},
+			"tags":  {Type: Array, Items: &Definition{Type: String}},
+			"a/b":   {Type: Integer},
+		},
+		Required:             []string{"label", "id"},
+		AdditionalProperties: false,
+	}
+
+	err := ValidateJSONAgainstSchema(json.RawMessage(`{"label": "eggs", "score": -1, "tags": ["ok", 1], "a/b": 1.5, "extra": 1}`), schema)
+	var violations ValidationErrors
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected ValidationErrors, got %v", err)
+	}
+
+	expected := []ValidationError{
+		{Path: "", Keyword: "required"},
+		{Path: "/a~1b", Keyword: "type"},
+		{Path: "", Keyword: "additionalProperties"},
+		{Path: "/label", Keyword: "enum"},
+		{Path: "/score", Keyword: "minimum"},
+		{Path: "/tags/1", Keyword: "type"},
+	}
+	if len(violations) != len(expected) {
+		t.Fatalf("Expected %d violations, got %d: %v", len(expected), len(violations), violations)
+	}
+	for i, e := range expected {
+		if violations[i].Path != e.Path || violations[i].Keyword != e.Keyword {
+			t.Errorf("Violation %d: expected %s at %q, got %+v", i, e.Keyword, e.Path, violations[i])
+		}
+	}
+	if !strings.Contains(err.Error(), "6 schema violations") || !strings.Contains(err.Error(), "missing required field id at root") {
+		t.Errorf("Unexpected error message: %v", err)
+	}
+}
+
+func TestValidateCombinationsAndRefs(t *testing.T) {
+	exclusive, multiple := 0.0, 0.5
+	schema := &Definition{
+		Type: Object,
+		Defs: map[string]Definition{
+			"node": {
+				Type: Object,
+				Properties: map[string]Definition{
+					"name":     {Type: String},
+					"children": {Type: Array, Items: &Definition{Ref: "#/$defs/node"}},
+				},
+				Required: []string{"name"},
+			},
+		},
+		Properties: map[string]Definition{
+			"tree":    {Ref: "#/$defs/node"},
+			"id":      {AnyOf: []Definition{{Type: String}, {Type: Integer}}},
+			"shape":   {OneOf: []Definition{{Type: Object, Required: []string{"radius"}}, {Type: Object, Required: []string{"width"}}}},
+			"ratio":   {Type: Number, AllOf: []Definition{{ExclusiveMinimum: &exclusive}, {MultipleOf: &multiple}}},
+			"kind":    {Const: "circle"},
+			"comment": {Type: String, Nullable: true},
+			"missing": {Ref: "#/$defs/unknown"},
+		},
+	}
+
+	valid := `{"tree": {"name": "a", "children": [{"name": "b", "children": []}]}, "id": 3, "shape": {"radius": 1}, "ratio": 1.5, "kind": "circle", "comment": null}`
+	if err := ValidateJSONAgainstSchema(json.RawMessage(valid), schema); err != nil {
+		t.Errorf("Expected the valid document to pass: %v", err)
+	}
+
+	cases := map[string]string{
+		`{"tree": {"name": "a", "children": [{"children": []}]}}`: "/tree/children/0",
+		`{"id": true}`:                         "anyOf",
+		`{"shape": {"radius": 1, "width": 2}}`: "matches 2 of the oneOf schemas",
+		`{"ratio": 0}`:                         "exclusive minimum",
+		`{"ratio": 0.7}`:                       "not a multiple of 0.5",
+		`{"kind": "square"}`:                   `"square" is not the constant "circle"`,
+		`{"comment": 5}`:                       "expected string",
+		`{"missing": 1}`:                       "unresolvable reference",
+	}
+	for document, expected := range cases {
+		err := ValidateJSONAgainstSchema(json.RawMessage(document), schema)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", document, expected, err)
+		}
+	}
+
+	recursive := &Definition{Ref: "#"}
+	if err := ValidateJSONAgainstSchema(json.RawMessage(`1`), recursive); err == nil || !strings.Contains(err.Error(), "nests too deeply") {
+		t.Errorf("Expected self references to be stopped, got %v", err)
+	}
+}
+
+func TestDefinitionTypeUnions(t *testing.T) {
+	var schema Definition
+	if err := json.Unmarshal([]byte(`{"type": "object", "properties": {"a": {"type": ["string", "null"]}, "b": {"type": ["string", "integer"]}}}`), &schema); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if a := schema.Properties["a"]; a.Type != String || !a.Nullable {
+		t.Errorf("Expected a nullable string, got %+v", a)
+	}
+	if b := schema.Properties["b"]; b.Type != "" || len(b.AnyOf) != 2 {
+		t.Errorf("Expected an anyOf of the types, got %+v", b)
+	}
+	if err := ValidateJSONAgainstSchema(json.RawMessage(`{"a": null, "b": 1}`), &schema); err != nil {
+		t.Errorf("Expected null and the union to pass: %v", err)
+	}
+
+	encoded, err := json.Marshal(&schema)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"a":{"type":["string","null"]}`) {
+		t.Errorf("Expected nullable types to marshal as a union, got %s", encoded)
+	}
+	encoded, _ = json.Marshal(Definition{AnyOf: []Definition{{Type: String}}, Nullable: true})
+	if string(encoded) != `{"anyOf":[{"type":"string"},{"type":"null"}]}` {
+		t.Errorf("Expected null to become an anyOf option, got %s", encoded)
+	}
+}
@@ -0,0 +1,244 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ErrNoLogprobs is returned when a response carries no token logprobs, e.g. because the provider does not support them
+var ErrNoLogprobs = errors.New("response has no logprobs")
+
+// TopLogprob is one of the most likely tokens at an output position
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes,omitempty"`
+}
+
+// TokenLogprob is the logprob of an output token together with the most likely alternatives
+type TokenLogprob struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes,omitempty"`
+	TopLogprobs []TopLogprob `json:"top_logprobs,omitempty"` // Up to Parameters.TopLogprobs alternatives
+}
+
+// ChoiceLogprobs are the token logprobs of a choice
+type ChoiceLogprobs struct {
+	Content []TokenLogprob `json:"content"`
+	Refusal []TokenLogprob `json:"refusal,omitempty"`
+}
+
+// Text returns the content tokens joined together
+func (l *ChoiceLogprobs) Text() string {
+	if l == nil {
+		return ""
+	}
+	var builder strings.Builder
+	for _, token := range l.Content {
+		builder.WriteString(token.Token)
+	}
+	return builder.String()
+}
+
+// FieldConfidence is the confidence of a single JSON value, computed from the logprobs of the tokens it spans
+type FieldConfidence struct {
+	Path           string       `json:"path"`           // e.g. "label" or "items[0].name"
+	Value          string       `json:"value"`          // Raw JSON of the value
+	Logprob        float64      `json:"logprob"`        // Sum of the token logprobs
+	Probability    float64      `json:"probability"`    // Probability of the whole value, exp(Logprob)
+	MinProbability float64      `json:"minProbability"` // Probability of the least likely token
+	Tokens         int          `json:"tokens"`
+	Alternatives   []TopLogprob `json:"alternatives,omitempty"` // Top logprobs at the value's first token, e.g. the other classes
+}
+
+// JSONFieldConfidence maps the token logprobs of a JSON response onto its values and returns the
+// confidence of every leaf value (string, number, boolean or null) by path. The JSON is located
+// with ExtractJSON, so text around it, e.g. a markdown code fence or prose with brackets, is skipped.
+func JSONFieldConfidence(logprobs *ChoiceLogprobs) (map[string]FieldConfidence, error) {
+	if logprobs == nil || len(logprobs.Content) == 0 {
+		return nil, ErrNoLogprobs
+	}
+	text := logprobs.Text()
+	extraction, err := ExtractJSON(text, nil)
+	if err != nil {
+		return nil, fmt.Errorf("no JSON found in the logprob tokens: %w", err)
+	}
+	if len(extraction.Repairs) > 0 {
+		// Repaired JSON has no span in the tokens to map the logprobs onto
+		return nil, fmt.Errorf("the JSON in the logprob tokens needed repairs (%v)", extraction.Repairs)
+	}
+	// The offset locates the extracted candidate itself, an identical value earlier in the text
+	// (e.g. an example in the prose) would map the wrong tokens
+	start := extraction.Offset
+	if !strings.HasPrefix(text[start:], string(extraction.JSON)) {
+		return nil, errors.New("the extracted JSON was not found in the logprob tokens")
+	}
+
+	parser := &jsonSpanParser{text: text, pos: start}
+	if err := parser.parseValue(""); err != nil {
+		return nil, fmt.Errorf("failed to map logprobs onto JSON: %w", err)
+	}
+
+	offsets := make([]int, len(logprobs.Content)+1)
+	for i, token := range logprobs.Content {
+		offsets[i+1] = offsets[i] + len(token.Token)
+	}
+
+	confidences := make(map[string]FieldConfidence, len(parser.spans))
+	for _, span := range parser.spans {
+		from, to := span.start, span.end
+		if text[from] == '"' && to-from > 2 {
+			// Score the string contents, the quotes are structure every answer shares
+			from, to = from+1, to-1
+		}
+
+		confidence := FieldConfidence{Path: span.path, Value: text[span.start:span.end], MinProbability: 1}
+		for i, token := range logprobs.Content {
+			if offsets[i] >= to || offsets[i+1] <= from {
+				continue
+			}
+			if confidence.Tokens == 0 {
+				confidence.Alternatives = token.TopLogprobs
+			}
+			confidence.Tokens++
+			confidence.Logprob += token.Logprob
+			confidence.MinProbability = math.Min(confidence.MinProbability, math.Exp(token.Logprob))
+		}
+		confidence.Probability = math.Exp(confidence.Logprob)
+		confidences[span.path] = confidence
+	}
+	return confidences, nil
+}
+
+// jsonSpan is the byte range of a leaf value in the token text
+type jsonSpan struct {
+	path       string
+	start, end int
+}
+
+// jsonSpanParser records the spans of leaf values while walking a JSON document
+type jsonSpanParser struct {
+	text  string
+	pos   int
+	spans []jsonSpan
+}
+
+func (p *jsonSpanParser) skipWhitespace() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+func (p *jsonSpanParser) expect(c byte) error {
+	p.skipWhitespace()
+	if p.pos >= len(p.text) || p.text[p.pos] != c {
+		return fmt.Errorf("expected %q at offset %d", c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *jsonSpanParser) parseValue(path string) error {
+	p.skipWhitespace()
+	if p.pos >= len(p.text) {
+		return errors.New("unexpected end of JSON")
+	}
+	start := p.pos
+	switch p.text[p.pos] {
+	case '{':
+		return p.parseObject(path)
+	case '[':
+		return p.parseArray(path)
+	case '"':
+		if _, err := p.parseString(); err != nil {
+			return err
+		}
+	default:
+		for p.pos < len(p.text) && strings.IndexByte(",}] \t\r\n", p.text[p.pos]) < 0 {
+			p.pos++
+		}
+		if !json.Valid([]byte(p.text[start:p.pos])) {
+			return fmt.Errorf("invalid JSON value %q at %s", p.text[start:p.pos], path)
+		}
+	}
+	p.spans = append(p.spans, jsonSpan{path: path, start: start, end: p.pos})
+	return nil
+}
+
+func (p *jsonSpanParser) parseObject(path string) error {
+	p.pos++
+	p.skipWhitespace()
+	if p.pos < len(p.text) && p.text[p.pos] == '}' {
+		p.pos++
+		return nil
+	}
+	for {
+		p.skipWhitespace()
+		key, err := p.parseString()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		fieldPath := key
+		if path != "" {
+			fieldPath = path + "." + key
+		}
+		if err := p.parseValue(fieldPath); err != nil {
+			return err
+		}
+		p.skipWhitespace()
+		if p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		return p.expect('}')
+	}
+}
+
+func (p *jsonSpanParser) parseArray(path string) error {
+	p.pos++
+	p.skipWhitespace()
+	if p.pos < len(p.text) && p.text[p.pos] == ']' {
+		p.pos++
+		return nil
+	}
+	for i := 0; ; i++ {
+		if err := p.parseValue(fmt.Sprintf("%s[%d]", path, i)); err != nil {
+			return err
+		}
+		p.skipWhitespace()
+		if p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.pos++
+			continue
+		}
+		return p.expect(']')
+	}
+}
+
+// parseString reads a quoted string and returns its decoded value
+func (p *jsonSpanParser) parseString() (string, error) {
+	if p.pos >= len(p.text) || p.text[p.pos] != '"' {
+		return "", fmt.Errorf("expected a string at offset %d", p.pos)
+	}
+	start := p.pos
+	for p.pos++; p.pos < len(p.text); p.pos++ {
+		switch p.text[p.pos] {
+		case '\\':
+			p.pos++
+		case '"':
+			p.pos++
+			var value string
+			if err := json.Unmarshal([]byte(p.text[start:p.pos]), &value); err != nil {
+				return "", fmt.Errorf("invalid string at offset %d: %w", start, err)
+			}
+			return value, nil
+		}
+	}
+	return "", errors.New("unterminated string")
+}
@@ -0,0 +1,107 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func tokens(pairs ...any) []TokenLogprob {
+	var result []TokenLogprob
+	for i := 0; i < len(pairs); i += 2 {
+		result = append(result, TokenLogprob{Token: pairs[i].(string), Logprob: pairs[i+1].(float64)})
+	}
+	return result
+}
+
+func TestJSONFieldConfidence(t *testing.T) {
+	content := tokens(
+		"```json\n", 0.0,
+		`{"label":"`, 0.0, "sp", math.Log(0.6), "am", math.Log(0.9), `",`, 0.0,
+		` "score": `, 0.0, "0.", 0.0, "8", math.Log(0.5), `,`, 0.0,
+		` "tags": ["`, 0.0, "urgent", math.Log(0.7), `"], "note": ""}`, 0.0,
+		"\n```", 0.0,
+	)
+	content[2].TopLogprobs = []TopLogprob{{Token: "sp", Logprob: math.Log(0.6)}, {Token: "ham", Logprob: math.Log(0.4)}}
+
+	confidences, err := JSONFieldConfidence(&ChoiceLogprobs{Content: content})
+	if err != nil {
+		t.Fatalf("JSONFieldConfidence failed: %v", err)
+	}
+
+	label := confidences["label"]
+	if label.Value != `"spam"` || label.Tokens != 2 || math.Abs(label.Probability-0.54) > 1e-9 || math.Abs(label.MinProbability-0.6) > 1e-9 {
+		t.Errorf("Unexpected label confidence: %+v", label)
+	}
+	if len(label.Alternatives) != 2 || label.Alternatives[1].Token != "ham" {
+		t.Errorf("Expected the alternatives of the first label token, got %+v", label.Alternatives)
+	}
+	if score := confidences["score"]; score.Value != "0.8" || math.Abs(score.Probability-0.5) > 1e-9 {
+		t.Errorf("Unexpected score confidence: %+v", score)
+	}
+	if tag := confidences["tags[0]"]; math.Abs(tag.Probability-0.7) > 1e-9 {
+		t.Errorf("Unexpected tag confidence: %+v", tag)
+	}
+	if note, ok := confidences["note"]; !ok || note.Probability != 1 {
+		t.Errorf("Expected empty strings to be scored by their quotes, got %+v", note)
+	}
+	if len(confidences) != 4 {
+		t.Errorf("Expected only leaf values, got %d", len(confidences))
+	}
+}
+
+func TestJSONFieldConfidenceSkipsProse(t *testing.T) {
+	content := tokens(
+		"Between {spam, ham} I pick [one]:\n", 0.0,
+		`{"label": "`, 0.0, "ham", math.Log(0.3), `"}`, 0.0,
+	)
+	confidences, err := JSONFieldConfidence(&ChoiceLogprobs{Content: content})
+	if err != nil {
+		t.Fatalf("JSONFieldConfidence failed: %v", err)
+	}
+	if label := confidences["label"]; label.Value != `"ham"` || math.Abs(label.Probability-0.3) > 1e-9 {
+		t.Errorf("Expected the extracted JSON to be scored, got %+v", confidences)
+	}
+}
+
+func TestJSONFieldConfidenceRepeatedJSON(t *testing.T) {
+	// The same JSON as an example in the prose and as the fenced answer, only the answer is scored
+	content := tokens(
+		"For example ", 0.0, `{"label": "`, 0.0, "spam", math.Log(0.2), `"}`, 0.0, "\n```json\n", 0.0,
+		`{"label": "`, 0.0, "spam", math.Log(0.9), `"}`, 0.0, "\n```", 0.0,
+	)
+	confidences, err := JSONFieldConfidence(&ChoiceLogprobs{Content: content})
+	if err != nil {
+		t.Fatalf("JSONFieldConfidence failed: %v", err)
+	}
+	if label := confidences["label"]; math.Abs(label.Probability-0.9) > 1e-9 {
+		t.Errorf("Expected the fenced answer to be scored, got %+v", label)
+	}
+}
+
+func TestJSONFieldConfidenceErrors(t *testing.T) {
+	if _, err := JSONFieldConfidence(nil); !errors.Is(err, ErrNoLogprobs) {
+		t.Errorf("Expected ErrNoLogprobs, got %v", err)
+	}
+	if _, err := JSONFieldConfidence(&ChoiceLogprobs{Content: tokens("no json here", 0.0)}); err == nil {
+		t.Error("Expected an error without JSON")
+	}
+	if _, err := JSONFieldConfidence(&ChoiceLogprobs{Content: tokens(`{"label": "sp`, 0.0)}); err == nil {
+		t.Error("Expected an error for truncated JSON")
+	}
+}
+
+func TestChoiceLogprobsUnmarshal(t *testing.T) {
+	body := `{"id": "gen-1", "choices": [{"message": {"role": "assistant", "content": "{}"}, "logprobs": {"content": [
+		{"token": "{}", "logprob": -0.01, "bytes": [123, 125], "top_logprobs": [{"token": "{}", "logprob": -0.01}]}
+	]}}]}`
+	var response NonStreamingChatResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	logprobs := response.Choices[0].Logprobs
+	if logprobs == nil || logprobs.Text() != "{}" || len(logprobs.Content[0].TopLogprobs) != 1 {
+		t.Errorf("Expected logprobs to be parsed, got %+v", logprobs)
+	}
+}
@@ -3,6 +3,7 @@ package openrouter
 // StructuredOutputModels is a simple set of models that support structured output
 // If a model is in this set, it supports structured output. If not, it doesn't.
 // This determines which execution path (structured vs universal) to use
+// It is the offline fallback for models that are not in the synced DefaultModelCatalog
 var StructuredOutputModels = map[string]struct{}{
 	"qwen/qwen3-30b-a3b":                        {},
 	"qwen/qwen3-32b":                            {},
@@ -80,12 +81,167 @@ var StructuredOutputModels = map[string]struct{}{
 	"openai/gpt-4-0314":                         {},
 }
 
+// ToolCallingModels is the bundled set of models that support tool calling.
+// It is the offline fallback for models that are not in the synced DefaultModelCatalog
+var ToolCallingModels = map[string]struct{}{
+	"anthropic/claude-opus-4":                        {},
+	"anthropic/claude-sonnet-4":                      {},
+	"mistralai/devstral-small:free":                  {},
+	"mistralai/devstral-small":                       {},
+	"google/gemini-2.5-flash-preview-05-20":          {},
+	"google/gemini-2.5-flash-preview-05-20:thinking": {},
+	"openai/codex-mini":                              {},
+	"meta-llama/llama-3.3-8b-instruct:free":          {},
+	"mistralai/mistral-medium-3":                     {},
+	"google/gemini-2.5-pro-preview":                  {},
+	"arcee-ai/caller-large":                          {},
+	"qwen/qwen3-30b-a3b":                             {},
+	"qwen/qwen3-14b":                                 {},
+	"qwen/qwen3-32b":                                 {},
+	"qwen/qwen3-235b-a22b":                           {},
+	"google/gemini-2.5-flash-preview":                {},
+	"google/gemini-2.5-flash-preview:thinking":       {},
+	"openai/o4-mini-high":                            {},
+	"openai/o3":                                      {},
+	"openai/o4-mini":                                 {},
+	"openai/gpt-4.1":                                 {},
+	"openai/gpt-4.1-mini":                            {},
+	"openai/gpt-4.1-nano":                            {},
+	"x-ai/grok-3-mini-beta":                          {},
+	"x-ai/grok-3-beta":                               {},
+	"meta-llama/llama-4-maverick:free":               {},
+	"meta-llama/llama-4-maverick":                    {},
+	"meta-llama/llama-4-scout:free":                  {},
+	"meta-llama/llama-4-scout":                       {},
+	"all-hands/openhands-lm-32b-v0.1":                {},
+	"google/gemini-2.5-pro-exp-03-25":                {},
+	"deepseek/deepseek-chat-v3-0324:free":            {},
+	"deepseek/deepseek-chat-v3-0324":                 {},
+	"mistralai/mistral-small-3.1-24b-instruct:free":  {},
+	"mistralai/mistral-small-3.1-24b-instruct":       {},
+	"ai21/jamba-1.6-large":                           {},
+	"ai21/jamba-1.6-mini":                            {},
+	"openai/gpt-4.5-preview":                         {},
+	"google/gemini-2.0-flash-lite-001":               {},
+	"anthropic/claude-3.7-sonnet":                    {},
+	"anthropic/claude-3.7-sonnet:beta":               {},
+	"anthropic/claude-3.7-sonnet:thinking":           {},
+	"mistralai/mistral-saba":                         {},
+	"openai/o3-mini-high":                            {},
+	"google/gemini-2.0-flash-001":                    {},
+	"qwen/qwen-turbo":                                {},
+	"qwen/qwen-plus":                                 {},
+	"qwen/qwen-max":                                  {},
+	"openai/o3-mini":                                 {},
+	"mistralai/mistral-small-24b-instruct-2501":      {},
+	"deepseek/deepseek-r1-distill-llama-70b":         {},
+	"deepseek/deepseek-r1":                           {},
+	"mistralai/codestral-2501":                       {},
+	"deepseek/deepseek-chat":                         {},
+	"openai/o1":                                      {},
+	"x-ai/grok-2-1212":                               {},
+	"meta-llama/llama-3.3-70b-instruct":              {},
+	"meta-llama/llama-3.3-70b-instruct:free":         {},
+	"amazon/nova-lite-v1":                            {},
+	"amazon/nova-micro-v1":                           {},
+	"amazon/nova-pro-v1":                             {},
+	"openai/gpt-4o-2024-11-20":                       {},
+	"mistralai/mistral-large-2411":                   {},
+	"mistralai/mistral-large-2407":                   {},
+	"mistralai/pixtral-large-2411":                   {},
+	"anthropic/claude-3.5-haiku:beta":                {},
+	"anthropic/claude-3.5-haiku":                     {},
+	"anthropic/claude-3.5-haiku-20241022:beta":       {},
+	"anthropic/claude-3.5-haiku-20241022":            {},
+	"anthropic/claude-3.5-sonnet:beta":               {},
+	"anthropic/claude-3.5-sonnet":                    {},
+	"x-ai/grok-beta":                                 {},
+	"mistralai/ministral-8b":                         {},
+	"mistralai/ministral-3b":                         {},
+	"nvidia/llama-3.1-nemotron-70b-instruct":         {},
+	"google/gemini-flash-1.5-8b":                     {},
+	"meta-llama/llama-3.2-3b-instruct":               {},
+	"meta-llama/llama-3.2-11b-vision-instruct":       {},
+	"qwen/qwen-2.5-72b-instruct":                     {},
+	"mistralai/pixtral-12b":                          {},
+	"cohere/command-r-plus-08-2024":                  {},
+	"cohere/command-r-08-2024":                       {},
+	"microsoft/phi-3.5-mini-128k-instruct":           {},
+	"nousresearch/hermes-3-llama-3.1-70b":            {},
+	"openai/gpt-4o-2024-08-06":                       {},
+	"meta-llama/llama-3.1-8b-instruct":               {},
+	"meta-llama/llama-3.1-70b-instruct":              {},
+	"meta-llama/llama-3.1-405b-instruct":             {},
+	"mistralai/mistral-nemo":                         {},
+	"openai/gpt-4o-mini":                             {},
+	"openai/gpt-4o-mini-2024-07-18":                  {},
+	"anthropic/claude-3.5-sonnet-20240620:beta":      {},
+	"anthropic/claude-3.5-sonnet-20240620":           {},
+	"mistralai/mistral-7b-instruct:free":             {},
+	"mistralai/mistral-7b-instruct":                  {},
+	"mistralai/mistral-7b-instruct-v0.3":             {},
+	"microsoft/phi-3-mini-128k-instruct":             {},
+	"microsoft/phi-3-medium-128k-instruct":           {},
+	"google/gemini-flash-1.5":                        {},
+	"openai/gpt-4o-2024-05-13":                       {},
+	"openai/gpt-4o":                                  {},
+	"openai/gpt-4o:extended":                         {},
+	"meta-llama/llama-3-8b-instruct":                 {},
+	"meta-llama/llama-3-70b-instruct":                {},
+	"mistralai/mixtral-8x22b-instruct":               {},
+	"openai/gpt-4-turbo":                             {},
+	"google/gemini-pro-1.5":                          {},
+	"cohere/command-r-plus":                          {},
+	"cohere/command-r-plus-04-2024":                  {},
+	"cohere/command-r":                               {},
+	"anthropic/claude-3-haiku:beta":                  {},
+	"anthropic/claude-3-haiku":                       {},
+	"anthropic/claude-3-sonnet:beta":                 {},
+	"anthropic/claude-3-sonnet":                      {},
+	"anthropic/claude-3-opus:beta":                   {},
+	"anthropic/claude-3-opus":                        {},
+	"cohere/command-r-03-2024":                       {},
+	"mistralai/mistral-large":                        {},
+	"openai/gpt-3.5-turbo-0613":                      {},
+	"openai/gpt-4-turbo-preview":                     {},
+	"mistralai/mistral-tiny":                         {},
+	"mistralai/mistral-medium":                       {},
+	"mistralai/mistral-small":                        {},
+	"mistralai/mixtral-8x7b-instruct":                {},
+	"openai/gpt-3.5-turbo-1106":                      {},
+	"openai/gpt-4-1106-preview":                      {},
+	"mistralai/mistral-7b-instruct-v0.1":             {},
+	"openai/gpt-4-32k-0314":                          {},
+	"openai/gpt-3.5-turbo-16k":                       {},
+	"openai/gpt-4-32k":                               {},
+	"openai/gpt-4":                                   {},
+	"openai/gpt-3.5-turbo-0125":                      {},
+	"openai/gpt-4-0314":                              {},
+	"openai/gpt-3.5-turbo":                           {},
+}
+
+// SupportsToolCalling checks if a model supports tool calling
+// The synced model catalog is consulted first, models it does not know fall back to the ToolCallingModels set
+func SupportsToolCalling(modelID string) bool {
+	if modelID == "" {
+		return false
+	}
+	if info, ok := DefaultModelCatalog.Get(modelID); ok {
+		return info.SupportsToolCalling()
+	}
+	_, exists := ToolCallingModels[modelID]
+	return exists
+}
+
 // SupportsStructuredOutput checks if a model supports structured output
-// Simply checks if the model is in the StructuredOutputModels set
+// The synced model catalog is consulted first, models it does not know fall back to the StructuredOutputModels set
 func SupportsStructuredOutput(modelID string) bool {
 	if modelID == "" {
 		return false
 	}
+	if info, ok := DefaultModelCatalog.Get(modelID); ok {
+		return info.SupportsStructuredOutput()
+	}
 	_, exists := StructuredOutputModels[modelID]
 	return exists
 }
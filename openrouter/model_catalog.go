@@ -0,0 +1,283 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DEFAULT_MODEL_CATALOG_TTL is how long a cached model catalog is considered fresh
+var DEFAULT_MODEL_CATALOG_TTL = 24 * time.Hour
+
+// ModelPricing holds the price in USD per token (or per request/image) of a model
+type ModelPricing struct {
+	Prompt     float64 `json:"prompt"`
+	Completion float64 `json:"completion"`
+	Request    float64 `json:"request"`
+	Image      float64 `json:"image"`
+}
+
+// ModelInfo describes a model as reported by the OpenRouter /models endpoint
+type ModelInfo struct {
+	ID                  string       `json:"id"`
+	Name                string       `json:"name"`
+	ContextLength       int          `json:"contextLength"`
+	MaxCompletionTokens int          `json:"maxCompletionTokens,omitempty"`
+	SupportedParameters []string     `json:"supportedParameters"`
+	Pricing             ModelPricing `json:"pricing"`
+	PricingUnknown      bool         `json:"pricingUnknown,omitempty"` // set when OpenRouter sent a negative or unparsable price
+}
+
+// SupportsParameter reports whether the model accepts the given request parameter
+func (m ModelInfo) SupportsParameter(param string) bool {
+	return slices.Contains(m.SupportedParameters, param)
+}
+
+// SupportsStructuredOutput reports whether the model accepts a json_schema response format
+func (m ModelInfo) SupportsStructuredOutput() bool {
+	return m.SupportsParameter("structured_outputs")
+}
+
+// SupportsToolCalling reports whether the model accepts tool definitions
+func (m ModelInfo) SupportsToolCalling() bool {
+	return m.SupportsParameter("tools")
+}
+
+// ModelCatalog is a registry of model capabilities and pricing synced from OpenRouter.
+// Models that are not in the catalog fall back to the bundled capability maps.
+type ModelCatalog struct {
+	CachePath string        // file used to cache the catalog between runs, empty disables caching
+	TTL       time.Duration // age after which the catalog is refetched, defaults to DEFAULT_MODEL_CATALOG_TTL
+
+	mu        sync.RWMutex
+	models    map[string]ModelInfo
+	fetchedAt time.Time
+}
+
+// DefaultModelCatalog is consulted by SupportsStructuredOutput. It is empty until synced.
+var DefaultModelCatalog = &ModelCatalog{
+	CachePath: filepath.Join(os.TempDir(), "llmango-model-catalog.json"),
+}
+
+// modelCatalogCache is the on disk format of a cached catalog
+type modelCatalogCache struct {
+	FetchedAt time.Time   `json:"fetchedAt"`
+	Models    []ModelInfo `json:"models"`
+}
+
+// Get returns the catalog entry for a model
+func (c *ModelCatalog) Get(modelID string) (ModelInfo, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	info, ok := c.models[modelID]
+	return info, ok
+}
+
+// Models returns all models in the catalog
+func (c *ModelCatalog) Models() []ModelInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	models := make([]ModelInfo, 0, len(c.models))
+	for _, info := range c.models {
+		models = append(models, info)
+	}
+	return models
+}
+
+// Set replaces the catalog contents, passing nil empties the catalog
+func (c *ModelCatalog) Set(models []ModelInfo) {
+	c.setAt(models, time.Now())
+}
+
+func (c *ModelCatalog) setAt(models []ModelInfo, fetchedAt time.Time) {
+	registry := make(map[string]ModelInfo, len(models))
+	for _, info := range models {
+		registry[info.ID] = info
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models = registry
+	c.fetchedAt = fetchedAt
+}
+
+func (c *ModelCatalog) ttl() time.Duration {
+	if c.TTL > 0 {
+		return c.TTL
+	}
+	return DEFAULT_MODEL_CATALOG_TTL
+}
+
+// Sync makes sure the catalog is fresh. A cache file younger than the TTL is used as is,
+// otherwise the catalog is fetched from OpenRouter and written back to the cache.
+// If the fetch fails, or there is no client to fetch with, a stale cache is still loaded and
+// the error is returned.
+func (c *ModelCatalog) Sync(ctx context.Context, o *OpenRouter) error {
+	c.mu.RLock()
+	fresh := len(c.models) > 0 && time.Since(c.fetchedAt) < c.ttl()
+	c.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+
+	cached, cacheErr := c.readCache()
+	if cacheErr == nil && time.Since(cached.FetchedAt) < c.ttl() {
+		c.setAt(cached.Models, cached.FetchedAt)
+		return nil
+	}
+
+	var models []ModelInfo
+	var err error
+	if o == nil {
+		err = errors.New("no OpenRouter client to fetch the models with")
+	} else {
+		models, err = o.ListModels(ctx)
+	}
+	if err != nil {
+		if cacheErr == nil {
+			c.setAt(cached.Models, cached.FetchedAt)
+		}
+		return fmt.Errorf("failed to sync model catalog: %w", err)
+	}
+
+	c.Set(models)
+	if c.CachePath != "" {
+		if err := c.writeCache(); err != nil {
+			return fmt.Errorf("failed to write model catalog cache: %w", err)
+		}
+	}
+	return nil
+}
+
+func (c *ModelCatalog) readCache() (*modelCatalogCache, error) {
+	if c.CachePath == "" {
+		return nil, errors.New("model catalog cache is disabled")
+	}
+	data, err := os.ReadFile(c.CachePath)
+	if err != nil {
+		return nil, err
+	}
+	var cached modelCatalogCache
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("invalid model catalog cache %s: %w", c.CachePath, err)
+	}
+	return &cached, nil
+}
+
+func (c *ModelCatalog) writeCache() error {
+	c.mu.RLock()
+	cached := modelCatalogCache{FetchedAt: c.fetchedAt}
+	for _, info := range c.models {
+		cached.Models = append(cached.Models, info)
+	}
+	c.mu.RUnlock()
+
+	data, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.CachePath, data, 0644)
+}
+
+// openRouterModelsResponse matches the body of GET /api/v1/models
+type openRouterModelsResponse struct {
+	Data []struct {
+		ID            string `json:"id"`
+		Name          string `json:"name"`
+		ContextLength int    `json:"context_length"`
+		Pricing       struct {
+			Prompt     string `json:"prompt"`
+			Completion string `json:"completion"`
+			Request    string `json:"request"`
+			Image      string `json:"image"`
+		} `json:"pricing"`
+		TopProvider struct {
+			MaxCompletionTokens *int `json:"max_completion_tokens"`
+		} `json:"top_provider"`
+		SupportedParameters []string `json:"supported_parameters"`
+	} `json:"data"`
+}
+
+// ListModels fetches all models available on OpenRouter
+func (o *OpenRouter) ListModels(ctx context.Context) ([]ModelInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", o.URL("/models"), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	if o.ApiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.ApiKey)
+	}
+
+	client := o.HTTPClient(30 * time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API returned non-success status: %d, body: %s", resp.StatusCode, string(body))
+	}
+
+	return parseModelsResponse(body)
+}
+
+// parseModelsResponse converts the /models body into ModelInfo entries.
+// Prices are sent as decimal strings, missing prices are treated as 0. Negative or unparsable
+// prices, like the "-1" of routers such as openrouter/auto, mark the pricing as unknown.
+func parseModelsResponse(body []byte) ([]ModelInfo, error) {
+	var parsed openRouterModelsResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("error parsing models response: %w", err)
+	}
+
+	models := make([]ModelInfo, 0, len(parsed.Data))
+	for _, m := range parsed.Data {
+		prompt, promptOK := parsePrice(m.Pricing.Prompt)
+		completion, completionOK := parsePrice(m.Pricing.Completion)
+		request, requestOK := parsePrice(m.Pricing.Request)
+		image, imageOK := parsePrice(m.Pricing.Image)
+		info := ModelInfo{
+			ID:                  m.ID,
+			Name:                m.Name,
+			ContextLength:       m.ContextLength,
+			SupportedParameters: m.SupportedParameters,
+			Pricing: ModelPricing{
+				Prompt:     prompt,
+				Completion: completion,
+				Request:    request,
+				Image:      image,
+			},
+			PricingUnknown: !promptOK || !completionOK || !requestOK || !imageOK,
+		}
+		if m.TopProvider.MaxCompletionTokens != nil {
+			info.MaxCompletionTokens = *m.TopProvider.MaxCompletionTokens
+		}
+		models = append(models, info)
+	}
+	return models, nil
+}
+
+// parsePrice parses a price string, ok is false for negative or unparsable prices
+func parsePrice(price string) (value float64, ok bool) {
+	if price == "" {
+		return 0, true
+	}
+	value, err := strconv.ParseFloat(price, 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,117 @@
+package openrouter
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/testhelpers"
+)
+
+const testModelsResponse = `{"data": [
+	{
+		"id": "acme/fast-1",
+		"name": "Acme Fast",
+		"context_length": 128000,
+		"pricing": {"prompt": "0.0000005", "completion": "0.0000015", "request": "0", "image": "bad"},
+		"top_provider": {"max_completion_tokens": 4096},
+		"supported_parameters": ["tools", "tool_choice", "structured_outputs", "response_format"]
+	},
+	{
+		"id": "acme/plain-1",
+		"name": "Acme Plain",
+		"context_length": 8192,
+		"pricing": {"prompt": "0.000001", "completion": "0.000002"},
+		"top_provider": {},
+		"supported_parameters": ["temperature"]
+	},
+	{
+		"id": "openrouter/auto",
+		"name": "Auto Router",
+		"context_length": 2000000,
+		"pricing": {"prompt": "-1", "completion": "-1"},
+		"top_provider": {},
+		"supported_parameters": []
+	}
+]}`
+
+func TestParseModelsResponse(t *testing.T) {
+	models, err := parseModelsResponse([]byte(testModelsResponse))
+	testhelpers.RequireNoError(t, err, "Models response should parse")
+	testhelpers.AssertEqual(t, 3, len(models), "Every model should be parsed")
+
+	fast := models[0]
+	testhelpers.AssertEqual(t, 128000, fast.ContextLength, "Context length should be parsed")
+	testhelpers.AssertEqual(t, 4096, fast.MaxCompletionTokens, "Max completion tokens should be parsed")
+	testhelpers.AssertEqual(t, 0.0000005, fast.Pricing.Prompt, "Prompt price should be parsed from its string")
+	testhelpers.AssertTrue(t, fast.PricingUnknown, "Unparsable prices should make the pricing unknown")
+	testhelpers.AssertTrue(t, fast.SupportsStructuredOutput(), "structured_outputs should enable structured output")
+	testhelpers.AssertTrue(t, fast.SupportsToolCalling(), "tools should enable tool calling")
+
+	plain := models[1]
+	testhelpers.AssertFalse(t, plain.SupportsStructuredOutput(), "Model without structured_outputs should not support it")
+	testhelpers.AssertFalse(t, plain.SupportsToolCalling(), "Model without tools should not support them")
+	testhelpers.AssertFalse(t, plain.PricingUnknown, "Missing prices should be treated as 0")
+
+	auto := models[2]
+	testhelpers.AssertTrue(t, auto.PricingUnknown, "Negative prices should make the pricing unknown")
+
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set(models)
+	_, ok := LookupPricing("openrouter/auto")
+	testhelpers.AssertFalse(t, ok, "Models with unknown pricing should not be found")
+	_, ok = CostFromUsage("openrouter/auto", &ResponseUsage{PromptTokens: 10, CompletionTokens: 5})
+	testhelpers.AssertFalse(t, ok, "No cost should be calculated from unknown pricing")
+	_, ok = LookupPricing("acme/plain-1")
+	testhelpers.AssertTrue(t, ok, "Models with valid prices should be found")
+}
+
+func TestModelCatalogOverridesBundledMaps(t *testing.T) {
+	models, err := parseModelsResponse([]byte(testModelsResponse))
+	testhelpers.RequireNoError(t, err, "Models response should parse")
+
+	// The catalog knows openai/gpt-4o without structured output support
+	models = append(models, ModelInfo{ID: "openai/gpt-4o", SupportedParameters: []string{"tools"}})
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set(models)
+
+	testhelpers.AssertTrue(t, SupportsStructuredOutput("acme/fast-1"), "Catalog model should support structured output")
+	testhelpers.AssertFalse(t, SupportsStructuredOutput("openai/gpt-4o"), "Catalog should take precedence over the bundled map")
+	testhelpers.AssertTrue(t, SupportsStructuredOutput("openai/gpt-4o-mini"), "Unknown models should fall back to the bundled map")
+	testhelpers.AssertTrue(t, SupportsToolCalling("acme/fast-1"), "Catalog model should support tool calling")
+	testhelpers.AssertFalse(t, SupportsToolCalling("acme/plain-1"), "Catalog model without tools should not support tool calling")
+}
+
+func TestModelCatalogSyncUsesFreshCache(t *testing.T) {
+	cachePath := filepath.Join(t.TempDir(), "catalog.json")
+	writer := &ModelCatalog{CachePath: cachePath}
+	writer.Set([]ModelInfo{{ID: "acme/cached-1", SupportedParameters: []string{"structured_outputs"}}})
+	testhelpers.RequireNoError(t, writer.writeCache(), "Cache should be written")
+
+	// A fresh cache is used without contacting OpenRouter
+	catalog := &ModelCatalog{CachePath: cachePath, TTL: time.Hour}
+	testhelpers.RequireNoError(t, catalog.Sync(context.Background(), nil), "Sync should use the fresh cache")
+	info, ok := catalog.Get("acme/cached-1")
+	testhelpers.AssertTrue(t, ok, "Cached model should be loaded")
+	testhelpers.AssertTrue(t, info.SupportsStructuredOutput(), "Cached capabilities should be preserved")
+
+	// A stale cache is still loaded when the fetch fails
+	stale := &ModelCatalog{CachePath: cachePath, TTL: time.Nanosecond}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := stale.Sync(ctx, &OpenRouter{})
+	testhelpers.AssertError(t, err, "Sync should report the failed fetch")
+	_, ok = stale.Get("acme/cached-1")
+	testhelpers.AssertTrue(t, ok, "Stale cache should be used as a fallback")
+
+	// Without a client a stale or missing cache is an error instead of a panic
+	stale = &ModelCatalog{CachePath: cachePath, TTL: time.Nanosecond}
+	testhelpers.AssertError(t, stale.Sync(context.Background(), nil), "Sync without a client should fail on a stale cache")
+	_, ok = stale.Get("acme/cached-1")
+	testhelpers.AssertTrue(t, ok, "Stale cache should be loaded without a client")
+	empty := &ModelCatalog{}
+	testhelpers.AssertError(t, empty.Sync(context.Background(), nil), "Sync without a client or cache should fail")
+}
@@ -18,8 +18,30 @@ import (
 	"time"
 )
 
+// DEFAULT_BASE_URL is the OpenRouter API root used when OpenRouter.BaseURL is empty
+var DEFAULT_BASE_URL = "https://openrouter.ai/api/v1"
+
 type OpenRouter struct {
 	ApiKey string
+
+	// BaseURL overrides the API root, e.g. for an OpenRouter compatible proxy or a fake server in tests
+	BaseURL string
+	// Transport is used for all HTTP calls to OpenRouter when set, e.g. a Recorder for offline tests
+	Transport http.RoundTripper
+}
+
+// URL returns the full URL of an API path such as "/chat/completions"
+func (o *OpenRouter) URL(path string) string {
+	base := o.BaseURL
+	if base == "" {
+		base = DEFAULT_BASE_URL
+	}
+	return strings.TrimSuffix(base, "/") + path
+}
+
+// HTTPClient returns a client for calls to OpenRouter that goes through Transport when it is set
+func (o *OpenRouter) HTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: o.Transport}
 }
 
 func CreateOpenRouter(apiKey string) (*OpenRouter, error) {
@@ -101,22 +123,129 @@ type Parameters struct {
 	RepetitionPenalty *float64        `json:"repetition_penalty,omitempty"` // Range: (0, 2]
 	Seed              *int            `json:"seed,omitempty"`               // Integer only
 	LogitBias         map[int]float64 `json:"logit_bias,omitempty"`         // { token_id: bias }
-	TopLogprobs       *int            `json:"top_logprobs,omitempty"`       // Integer only
+	Logprobs          *bool           `json:"logprobs,omitempty"`           // Return the logprobs of the output tokens
+	TopLogprobs       *int            `json:"top_logprobs,omitempty"`       // Integer only, requires Logprobs
 	MinP              *float64        `json:"min_p,omitempty"`              // Range: [0, 1]
 	TopA              *float64        `json:"top_a,omitempty"`              // Range: [0, 1]
 
 	// OpenRouter-only parameters (Optional)
-	Transforms []string `json:"transforms,omitempty"` // Prompt transforms
-	Models     []string `json:"models,omitempty"`     // Model routing list
-	Route      *string  `json:"route,omitempty"`      // Model routing strategy ("fallback")
-	// Provider   *ProviderPreferences `json:"provider,omitempty"` // Inlined below
-	ProviderOrder             []string `json:"provider_order,omitempty"`              // List of provider names to try in order
-	ProviderAllowFallbacks    *bool    `json:"provider_allow_fallbacks,omitempty"`    // Default: true. Allow backup providers
-	ProviderRequireParameters *bool    `json:"provider_require_parameters,omitempty"` // Default: false. Only use providers supporting all request parameters
-	ProviderDataCollection    *string  `json:"provider_data_collection,omitempty"`    // Default: "allow". Control data storage ("allow" | "deny")
-	ProviderIgnore            []string `json:"provider_ignore,omitempty"`             // List of provider names to skip
-	ProviderQuantizations     []string `json:"provider_quantizations,omitempty"`      // List of quantization levels to filter by (e.g., ["int4", "int8"])
-	ProviderSort              *string  `json:"provider_sort,omitempty"`               // Sort providers by "price" or "throughput"
+	Transforms []string             `json:"transforms,omitempty"` // Prompt transforms
+	Models     []string             `json:"models,omitempty"`     // Model routing list
+	Route      *string              `json:"route,omitempty"`      // Model routing strategy ("fallback")
+	Provider   *ProviderPreferences `json:"provider,omitempty"`   // Provider routing preferences
+
+	Reasoning *ReasoningConfig `json:"reasoning,omitempty"` // Reasoning (thinking) token controls for reasoning models
+}
+
+// ReasoningConfig controls reasoning tokens for models that support them.
+// Set either Effort or MaxTokens, not both. See https://openrouter.ai/docs/use-cases/reasoning-tokens
+type ReasoningConfig struct {
+	Effort    *string `json:"effort,omitempty"`     // "high", "medium" or "low"
+	MaxTokens *int    `json:"max_tokens,omitempty"` // Token budget for reasoning
+	Exclude   *bool   `json:"exclude,omitempty"`    // Reason internally but leave the reasoning out of the response
+	Enabled   *bool   `json:"enabled,omitempty"`    // Enable reasoning with default settings
+}
+
+// ProviderPreferences controls how OpenRouter routes a request between providers.
+// See https://openrouter.ai/docs/features/provider-routing
+type ProviderPreferences struct {
+	Order             []string          `json:"order,omitempty"`              // List of provider names to try in order
+	AllowFallbacks    *bool             `json:"allow_fallbacks,omitempty"`    // Default: true. Allow backup providers
+	RequireParameters *bool             `json:"require_parameters,omitempty"` // Default: false. Only use providers supporting all request parameters
+	DataCollection    *string           `json:"data_collection,omitempty"`    // Default: "allow". Control data storage ("allow" | "deny")
+	Ignore            []string          `json:"ignore,omitempty"`             // List of provider names to skip
+	Only              []string          `json:"only,omitempty"`               // List of provider names to allow exclusively
+	Quantizations     []string          `json:"quantizations,omitempty"`      // List of quantization levels to filter by (e.g., ["int4", "int8"])
+	Sort              *string           `json:"sort,omitempty"`               // Sort providers by "price", "throughput" or "latency"
+	MaxPrice          *ProviderMaxPrice `json:"max_price,omitempty"`          // Skip providers above these prices
+}
+
+// ProviderMaxPrice caps the price a provider may charge, in USD per million tokens (per request/image for those fields)
+type ProviderMaxPrice struct {
+	Prompt     *float64 `json:"prompt,omitempty"`
+	Completion *float64 `json:"completion,omitempty"`
+	Request    *float64 `json:"request,omitempty"`
+	Image      *float64 `json:"image,omitempty"`
+}
+
+// legacyProviderFields are the flat provider_* fields older versions stored in Parameters.
+// They are only read to migrate saved prompts into ProviderPreferences.
+type legacyProviderFields struct {
+	ProviderOrder             []string `json:"provider_order,omitempty"`
+	ProviderAllowFallbacks    *bool    `json:"provider_allow_fallbacks,omitempty"`
+	ProviderRequireParameters *bool    `json:"provider_require_parameters,omitempty"`
+	ProviderDataCollection    *string  `json:"provider_data_collection,omitempty"`
+	ProviderIgnore            []string `json:"provider_ignore,omitempty"`
+	ProviderQuantizations     []string `json:"provider_quantizations,omitempty"`
+	ProviderSort              *string  `json:"provider_sort,omitempty"`
+}
+
+// UnmarshalJSON decodes Parameters and migrates legacy flat provider_* fields into Provider.
+// Values in a nested provider object win over legacy fields.
+func (p *Parameters) UnmarshalJSON(data []byte) error {
+	type parametersAlias Parameters
+	var decoded struct {
+		parametersAlias
+		legacyProviderFields
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*p = Parameters(decoded.parametersAlias)
+
+	legacy := decoded.legacyProviderFields
+	if legacy.ProviderOrder == nil && legacy.ProviderAllowFallbacks == nil && legacy.ProviderRequireParameters == nil &&
+		legacy.ProviderDataCollection == nil && legacy.ProviderIgnore == nil && legacy.ProviderQuantizations == nil && legacy.ProviderSort == nil {
+		return nil
+	}
+
+	if p.Provider == nil {
+		p.Provider = &ProviderPreferences{}
+	}
+	if p.Provider.Order == nil {
+		p.Provider.Order = legacy.ProviderOrder
+	}
+	if p.Provider.AllowFallbacks == nil {
+		p.Provider.AllowFallbacks = legacy.ProviderAllowFallbacks
+	}
+	if p.Provider.RequireParameters == nil {
+		p.Provider.RequireParameters = legacy.ProviderRequireParameters
+	}
+	if p.Provider.DataCollection == nil {
+		p.Provider.DataCollection = legacy.ProviderDataCollection
+	}
+	if p.Provider.Ignore == nil {
+		p.Provider.Ignore = legacy.ProviderIgnore
+	}
+	if p.Provider.Quantizations == nil {
+		p.Provider.Quantizations = legacy.ProviderQuantizations
+	}
+	if p.Provider.Sort == nil {
+		p.Provider.Sort = legacy.ProviderSort
+	}
+	return nil
+}
+
+// UnmarshalJSON is needed because the embedded Parameters has its own UnmarshalJSON,
+// which would otherwise be promoted and skip the request's own fields.
+func (r *OpenRouterRequest) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Messages []Message `json:"messages,omitempty"`
+		Prompt   *string   `json:"prompt,omitempty"`
+		Model    *string   `json:"model,omitempty"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	var params Parameters
+	if err := params.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	r.Messages = head.Messages
+	r.Prompt = head.Prompt
+	r.Model = head.Model
+	r.Parameters = params
+	return nil
 }
 
 // --- OpenRouter Response Structs ---
@@ -126,6 +255,21 @@ type ResponseUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// CompletionTokensDetails breaks down the completion tokens of a response.
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"` // Included in CompletionTokens
+}
+
+// ReasoningTokens returns the number of completion tokens spent on reasoning.
+func (u *ResponseUsage) ReasoningTokens() int {
+	if u == nil || u.CompletionTokensDetails == nil {
+		return 0
+	}
+	return u.CompletionTokensDetails.ReasoningTokens
 }
 
 // OpenRouterBaseResponse holds fields common to all top-level response objects.
@@ -202,12 +346,16 @@ type ResponseMessage struct {
 	Content   *string    `json:"content"` // Message content or null
 	Role      string     `json:"role"`    // Usually "assistant"
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+
+	Reasoning        *string         `json:"reasoning,omitempty"`         // Reasoning text of reasoning models
+	ReasoningDetails json.RawMessage `json:"reasoning_details,omitempty"` // Structured reasoning blocks, kept raw
 }
 
 // NonStreamingChatChoice represents a choice in a standard chat completion response
 type NonStreamingChatChoice struct {
 	BaseChoice
-	Message ResponseMessage `json:"message"`
+	Message  ResponseMessage `json:"message"`
+	Logprobs *ChoiceLogprobs `json:"logprobs,omitempty"` // Token logprobs when requested with Parameters.Logprobs
 }
 
 // StreamingChatChoice represents a choice chunk in a streaming chat response.
@@ -221,6 +369,7 @@ type StreamingChatDelta struct {
 	Content   *string         `json:"content"`              // Content delta (token chunk) or null
 	Role      *string         `json:"role,omitempty"`       // Usually present only in the first chunk
 	ToolCalls []ToolCallDelta `json:"tool_calls,omitempty"` // Tool calls delta
+	Reasoning *string         `json:"reasoning,omitempty"`  // Reasoning delta of reasoning models
 }
 
 // ToolCallDelta represents a single tool call delta in a streaming response.
@@ -265,16 +414,22 @@ type PromptCompletionResponse struct {
 
 // --- Helper Function for NON-Streaming HTTP Request ---
 
-// autoConfigureProviderRequirements automatically sets ProviderRequireParameters
+// autoConfigureProviderRequirements automatically sets Provider.RequireParameters
 // to true when ResponseFormat is detected (structured output)
 func (r *OpenRouterRequest) autoConfigureProviderRequirements() {
 	if len(r.Parameters.ResponseFormat) > 2 {
 		// Check if it's more than just "{}" - meaningful structured output
 		responseStr := string(r.Parameters.ResponseFormat)
 		if responseStr != "{}" && responseStr != "" {
-			if r.Parameters.ProviderRequireParameters == nil {
+			if r.Parameters.Provider == nil || r.Parameters.Provider.RequireParameters == nil {
+				// Copy the preferences, they may be shared with the prompt the request was built from
+				provider := ProviderPreferences{}
+				if r.Parameters.Provider != nil {
+					provider = *r.Parameters.Provider
+				}
 				requireParams := true
-				r.Parameters.ProviderRequireParameters = &requireParams
+				provider.RequireParameters = &requireParams
+				r.Parameters.Provider = &provider
 			}
 		}
 	}
@@ -283,8 +438,15 @@ func (r *OpenRouterRequest) autoConfigureProviderRequirements() {
 // executeOpenRouterRequest handles sending the request and basic response/error handling
 // for non-streaming requests. It returns the response body bytes on success.
 func (o *OpenRouter) executeOpenRouterRequest(request *OpenRouterRequest) ([]byte, error) {
+	body, _, err := o.executeOpenRouterRequestWithContext(context.Background(), request)
+	return body, err
+}
+
+// executeOpenRouterRequestWithContext is executeOpenRouterRequest with a context that can
+// cancel the in-flight HTTP request. The response headers are returned with the body.
+func (o *OpenRouter) executeOpenRouterRequestWithContext(ctx context.Context, request *OpenRouterRequest) ([]byte, http.Header, error) {
 	if o.ApiKey == "" {
-		return nil, errors.New("API KEY is empty in openrouter instance")
+		return nil, nil, errors.New("API KEY is empty in openrouter instance")
 	}
 
 	// Auto-configure provider requirements based on request content
@@ -292,44 +454,50 @@ func (o *OpenRouter) executeOpenRouterRequest(request *OpenRouterRequest) ([]byt
 
 	// Ensure stream is not accidentally set for this helper
 	if request.Stream != nil && *request.Stream {
-		return nil, errors.New("executeOpenRouterRequest is for non-streaming requests; use GenerateStreamingChatResponse for streaming")
+		return nil, nil, errors.New("executeOpenRouterRequest is for non-streaming requests; use GenerateStreamingChatResponse for streaming")
 	}
 
 	// Marshal the request body to JSON
 	jsonData, err := json.Marshal(request)
 	if err != nil {
-		return nil, fmt.Errorf("error marshaling request: %w", err)
+		return nil, nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 	// Create the new HTTP request
-	req, err := http.NewRequest("POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", o.URL("/chat/completions"), bytes.NewBuffer(jsonData))
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return nil, nil, fmt.Errorf("error creating request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+o.ApiKey)
 	// Send the request with a timeout
-	client := &http.Client{Timeout: 5 * time.Minute} // Consider making timeout configurable
+	client := o.HTTPClient(5 * time.Minute) // Consider making timeout configurable
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		return nil, nil, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("error reading response body: %w", err)
+		return nil, nil, fmt.Errorf("error reading response body: %w", err)
 	}
 
-	return body, nil
+	return body, resp.Header, nil
 }
 
 // --- Specific Response Generation Functions ---
 // GenerateNonStreamingChatResponse sends a request expected to yield a standard chat response.
 // Assumes request.Stream is false or nil, and request.Messages is used.
 func (o *OpenRouter) GenerateNonStreamingChatResponse(request *OpenRouterRequest) (*NonStreamingChatResponse, error) {
+	return o.GenerateNonStreamingChatResponseWithContext(context.Background(), request)
+}
+
+// GenerateNonStreamingChatResponseWithContext is GenerateNonStreamingChatResponse with a context.
+// Canceling the context aborts the in-flight request.
+func (o *OpenRouter) GenerateNonStreamingChatResponseWithContext(ctx context.Context, request *OpenRouterRequest) (*NonStreamingChatResponse, error) {
 	// Explicitly set stream to false if nil
 	if request.Stream == nil {
 		stream := false
@@ -338,7 +506,7 @@ func (o *OpenRouter) GenerateNonStreamingChatResponse(request *OpenRouterRequest
 		return nil, errors.New("GenerateNonStreamingChatResponse called with Stream=true; use GenerateStreamingChatResponse instead")
 	}
 
-	resp, err := o.executeOpenRouterRequest(request)
+	resp, header, err := o.executeOpenRouterRequestWithContext(ctx, request)
 	if err != nil {
 		return nil, err // Error already formatted by executeOpenRouterRequest
 	}
@@ -347,6 +515,10 @@ func (o *OpenRouter) GenerateNonStreamingChatResponse(request *OpenRouterRequest
 	// and parse the response in one step
 	response, err := ValidateNonStreamingResponse(resp, http.StatusOK)
 	if err != nil {
+		// Keep the delay a rate limited response asked for so retries can honour it
+		if delay, ok := ParseRetryAfter(header.Get("Retry-After"), time.Now()); ok {
+			return nil, &RetryAfterError{Err: err, Delay: delay}
+		}
 		return nil, err
 	}
 
@@ -405,7 +577,7 @@ func (o *OpenRouter) GenerateStreamingChatResponse(ctx context.Context, request
 	}
 
 	// Create the new HTTP request with context
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://openrouter.ai/api/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", o.URL("/chat/completions"), bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("error creating streaming request: %w", err)
 	}
@@ -425,6 +597,9 @@ func (o *OpenRouter) GenerateStreamingChatResponse(ctx context.Context, request
 			IdleConnTimeout: 90 * time.Second,
 		},
 	}
+	if o.Transport != nil {
+		client.Transport = o.Transport
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -553,7 +728,7 @@ func (o *OpenRouter) GetGenerationStats(generationID string) (*GenerationStats,
 	}
 
 	// Create the HTTP request with the generation ID as a query parameter
-	req, err := http.NewRequest("GET", "https://openrouter.ai/api/v1/generation", nil)
+	req, err := http.NewRequest("GET", o.URL("/generation"), nil)
 	if err != nil {
 		return nil, fmt.Errorf("error creating request: %w", err)
 	}
@@ -566,7 +741,7 @@ func (o *OpenRouter) GetGenerationStats(generationID string) (*GenerationStats,
 	// Set headers
 	req.Header.Set("Authorization", "Bearer "+o.ApiKey)
 	// Send the request
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := o.HTTPClient(30 * time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error sending request: %w", err)
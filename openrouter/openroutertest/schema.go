@@ -0,0 +1,183 @@
+package openroutertest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// ValueFromResponseFormat generates a value that satisfies the schema of a json_schema response format
+func ValueFromResponseFormat(responseFormat json.RawMessage) (any, error) {
+	if len(responseFormat) == 0 {
+		return nil, errors.New("request has no response format to match")
+	}
+	var format struct {
+		Type       string `json:"type"`
+		JSONSchema struct {
+			Schema map[string]any `json:"schema"`
+		} `json:"json_schema"`
+	}
+	if err := json.Unmarshal(responseFormat, &format); err != nil {
+		return nil, fmt.Errorf("failed to parse response format: %w", err)
+	}
+	if format.Type != "json_schema" || format.JSONSchema.Schema == nil {
+		return nil, fmt.Errorf("response format of type %q has no json schema", format.Type)
+	}
+	return ValueFromSchema(format.JSONSchema.Schema), nil
+}
+
+// ToolCallFromForcedTool generates a call of the tool a request forces with tool_choice, with
+// arguments that satisfy the tool's parameters
+func ToolCallFromForcedTool(request *openrouter.OpenRouterRequest) (openrouter.ToolCall, error) {
+	encoded, _ := json.Marshal(request.ToolChoice)
+	var choice struct {
+		Function struct {
+			Name string `json:"name"`
+		} `json:"function"`
+	}
+	if err := json.Unmarshal(encoded, &choice); err != nil || choice.Function.Name == "" {
+		return openrouter.ToolCall{}, errors.New("request has no response format or forced tool to match")
+	}
+	for _, tool := range request.Tools {
+		if tool.Function.Name != choice.Function.Name {
+			continue
+		}
+		arguments, _ := json.Marshal(ValueFromSchema(tool.Function.Parameters))
+		return openrouter.ToolCall{Function: openrouter.ToolCallFunction{Name: tool.Function.Name, Arguments: string(arguments)}}, nil
+	}
+	return openrouter.ToolCall{}, fmt.Errorf("forced tool %q is not defined", choice.Function.Name)
+}
+
+// ValueFromSchema generates a value that satisfies a JSON schema: enums use their first value and
+// defaults are used when set, objects get all properties, arrays minItems items (at least one) and
+// scalars a fixed example value within the schema's bounds and format. References are resolved
+// against the schema's $defs, recursive arrays are left empty once nested a few levels deep.
+func ValueFromSchema(schema map[string]any) any {
+	return valueFromSchema(schema, schema, 0)
+}
+
+// maxSchemaDepth is the reference depth after which recursive arrays get no items
+const maxSchemaDepth = 3
+
+func valueFromSchema(schema, root map[string]any, depth int) any {
+	if ref, ok := schema["$ref"].(string); ok {
+		target := root
+		if name, found := strings.CutPrefix(ref, "#/$defs/"); found {
+			defs, _ := root["$defs"].(map[string]any)
+			target, _ = defs[name].(map[string]any)
+		}
+		if target == nil {
+			return nil
+		}
+		return valueFromSchema(target, root, depth+1)
+	}
+	for _, combination := range []string{"anyOf", "oneOf"} {
+		if options, ok := schema[combination].([]any); ok && len(options) > 0 {
+			if option, ok := options[0].(map[string]any); ok {
+				return valueFromSchema(option, root, depth)
+			}
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && len(enum) > 0 {
+		return enum[0]
+	}
+	if value, ok := schema["const"]; ok {
+		return value
+	}
+	if value, ok := schema["default"]; ok {
+		return value
+	}
+
+	schemaType, _ := schema["type"].(string)
+	if types, ok := schema["type"].([]any); ok {
+		// Nullable types look like ["string", "null"], use the first non null type
+		for _, t := range types {
+			if name, _ := t.(string); name != "null" {
+				schemaType = name
+				break
+			}
+		}
+	}
+
+	switch schemaType {
+	case "object":
+		object := map[string]any{}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, property := range properties {
+			if propertySchema, ok := property.(map[string]any); ok {
+				object[name] = valueFromSchema(propertySchema, root, depth)
+			}
+		}
+		return object
+	case "array":
+		items, _ := schema["items"].(map[string]any)
+		if items == nil {
+			return []any{}
+		}
+		count := 1
+		if depth >= maxSchemaDepth {
+			count = 0
+		}
+		if minItems, ok := schema["minItems"].(float64); ok && int(minItems) > count {
+			count = int(minItems)
+		}
+		if maxItems, ok := schema["maxItems"].(float64); ok && int(maxItems) < count {
+			count = int(maxItems)
+		}
+		array := make([]any, count)
+		for i := range array {
+			array[i] = valueFromSchema(items, root, depth)
+		}
+		return array
+	case "string":
+		return stringFromSchema(schema)
+	case "integer":
+		if minimum, ok := schema["minimum"].(float64); ok {
+			return int(minimum)
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && maximum < 1 {
+			return int(maximum)
+		}
+		return 1
+	case "number":
+		if minimum, ok := schema["minimum"].(float64); ok {
+			return minimum
+		}
+		if maximum, ok := schema["maximum"].(float64); ok && maximum < 1.5 {
+			return maximum
+		}
+		return 1.5
+	case "boolean":
+		return true
+	default:
+		return nil
+	}
+}
+
+// stringFromSchema returns "example", or a value of the schema's format, padded to its minLength
+func stringFromSchema(schema map[string]any) string {
+	value := "example"
+	switch schema["format"] {
+	case "date-time":
+		value = "2024-01-01T00:00:00Z"
+	case "date":
+		value = "2024-01-01"
+	case "email":
+		value = "user@example.com"
+	case "uri":
+		value = "https://example.com"
+	case "uuid":
+		value = "00000000-0000-4000-8000-000000000000"
+	}
+	if minLength, ok := schema["minLength"].(float64); ok && len(value) < int(minLength) {
+		value += strings.Repeat("x", int(minLength)-len(value))
+	}
+	if maxLength, ok := schema["maxLength"].(float64); ok && len(value) > int(maxLength) {
+		value = value[:int(maxLength)]
+	}
+	return value
+}
@@ -0,0 +1,562 @@
+// Package openroutertest provides a local OpenRouter compatible server for end-to-end tests.
+//
+//	server := openroutertest.NewServer()
+//	defer server.Close()
+//	server.Script("openai/gpt-4o", openroutertest.Reply{Content: "hello"})
+//	client := server.Client() // *openrouter.OpenRouter pointed at the fake
+package openroutertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+// Reply scripts a single response of the fake server. The zero value answers with empty content.
+type Reply struct {
+	Content   string                // assistant message content
+	Reasoning string                // reasoning text of reasoning models
+	ToolCalls []openrouter.ToolCall // tool calls, IDs are generated when empty
+
+	// JSON is marshaled and used as the content when set
+	JSON any
+	// MatchSchema answers with a value generated from the request's json_schema response format,
+	// or with a call of the tool forced by tool_choice when there is no response format
+	MatchSchema bool
+
+	// Logprobs are the content tokens returned when the request asks for logprobs, the content defaults
+	// to the joined tokens. Without them the content is split into tokens with a logprob of 0.
+	Logprobs []openrouter.TokenLogprob
+
+	FinishReason string                    // defaults to "stop", or "tool_calls" when ToolCalls are set
+	Usage        *openrouter.ResponseUsage // defaults to token estimates of the request and content
+
+	// Status and ErrorCode make the reply an OpenRouter error, e.g. Status 429 with ErrorCode 429
+	Status       int
+	ErrorCode    int
+	ErrorMessage string
+	RetryAfter   string // Retry-After header value sent with errors
+
+	Latency         time.Duration // delay before the response is sent
+	MalformedStream bool          // streams the content and then a chunk that is not valid JSON
+}
+
+// ReceivedRequest is a request received by the fake server
+type ReceivedRequest struct {
+	Method  string
+	Path    string
+	Query   string
+	Header  http.Header
+	Body    []byte
+	Request *openrouter.OpenRouterRequest // decoded chat request, nil for other endpoints
+}
+
+// Server is an httptest based fake of the OpenRouter API implementing
+// /chat/completions (including SSE streaming), /embeddings, /generation and /models.
+type Server struct {
+	*httptest.Server
+
+	// PricePerToken is used to calculate the cost reported by /generation
+	PricePerToken float64
+
+	mu          sync.Mutex
+	scripts     map[string][]Reply // model -> pending replies, the last one repeats
+	fallback    Reply
+	models      []openrouter.ModelInfo
+	requests    []ReceivedRequest
+	generations map[string]openrouter.GenerationStats
+	nextID      int
+}
+
+// NewServer starts a fake server, close it with Close
+func NewServer() *Server {
+	s := &Server{
+		PricePerToken: 0.000001,
+		scripts:       make(map[string][]Reply),
+		generations:   make(map[string]openrouter.GenerationStats),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("POST /embeddings", s.handleEmbeddings)
+	mux.HandleFunc("GET /generation", s.handleGeneration)
+	mux.HandleFunc("GET /models", s.handleModels)
+	s.Server = httptest.NewServer(s.recordRequests(mux))
+	return s
+}
+
+// Client returns an OpenRouter client that talks to the fake server
+func (s *Server) Client() *openrouter.OpenRouter {
+	return &openrouter.OpenRouter{ApiKey: "test-key", BaseURL: s.URL}
+}
+
+// Script queues replies for a model. Replies are used in order and the last one keeps being
+// used once the queue is exhausted. Models without a script get the fallback reply.
+func (s *Server) Script(model string, replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[model] = append(s.scripts[model], replies...)
+}
+
+// SetFallback sets the reply used for models without a script
+func (s *Server) SetFallback(reply Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = reply
+}
+
+// SetModels sets the models listed by /models
+func (s *Server) SetModels(models ...openrouter.ModelInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.models = models
+}
+
+// Requests returns all requests received so far
+func (s *Server) Requests() []ReceivedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ReceivedRequest(nil), s.requests...)
+}
+
+// ChatRequests returns the decoded /chat/completions requests received so far
+func (s *Server) ChatRequests() []*openrouter.OpenRouterRequest {
+	var chats []*openrouter.OpenRouterRequest
+	for _, request := range s.Requests() {
+		if request.Request != nil {
+			chats = append(chats, request.Request)
+		}
+	}
+	return chats
+}
+
+func (s *Server) recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = io.NopCloser(strings.NewReader(string(body)))
+
+		received := ReceivedRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Header: r.Header.Clone(),
+			Body:   body,
+		}
+		if r.URL.Path == "/chat/completions" {
+			var request openrouter.OpenRouterRequest
+			if json.Unmarshal(body, &request) == nil {
+				received.Request = &request
+			}
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, received)
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// nextReply pops the scripted reply for a model
+func (s *Server) nextReply(model string) Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.scripts[model]
+	if len(queue) == 0 {
+		return s.fallback
+	}
+	reply := queue[0]
+	if len(queue) > 1 {
+		s.scripts[model] = queue[1:]
+	}
+	return reply
+}
+
+func (s *Server) newGenerationID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return fmt.Sprintf("gen-fake-%d", s.nextID)
+}
+
+func writeError(w http.ResponseWriter, status, code int, message, retryAfter string) {
+	if retryAfter != "" {
+		w.Header().Set("Retry-After", retryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	var body openrouter.ErrorResponse
+	body.Details.Code = code
+	body.Details.Message = message
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeReplyError answers with the reply's scripted error, it reports false when the reply is not an error
+func writeReplyError(w http.ResponseWriter, reply Reply) bool {
+	if (reply.Status == 0 || reply.Status == http.StatusOK) && reply.ErrorCode == 0 {
+		return false
+	}
+	status, code := reply.Status, reply.ErrorCode
+	if status == 0 {
+		status = code
+	}
+	if code == 0 {
+		code = status
+	}
+	message := reply.ErrorMessage
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	writeError(w, status, code, message, reply.RetryAfter)
+	return true
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, 401, "missing API key", "")
+		return
+	}
+	var request openrouter.OpenRouterRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, 400, fmt.Sprintf("invalid request body: %v", err), "")
+		return
+	}
+	model := ""
+	if request.Model != nil {
+		model = *request.Model
+	}
+
+	reply := s.nextReply(model)
+	if reply.Latency > 0 {
+		select {
+		case <-time.After(reply.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if writeReplyError(w, reply) {
+		return
+	}
+
+	message, err := s.buildMessage(reply, &request)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, 400, err.Error(), "")
+		return
+	}
+	finishReason := reply.FinishReason
+	if finishReason == "" {
+		finishReason = "stop"
+		if len(message.ToolCalls) > 0 {
+			finishReason = "tool_calls"
+		}
+	}
+	usage := reply.Usage
+	if usage == nil {
+		usage = &openrouter.ResponseUsage{
+			PromptTokens:     request.EstimatePromptTokens(),
+			CompletionTokens: openrouter.EstimateTokens(model, contentOf(message)),
+		}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+
+	id := s.newGenerationID()
+	s.mu.Lock()
+	s.generations[id] = openrouter.GenerationStats{
+		ID:               id,
+		Model:            model,
+		TotalCost:        float64(usage.TotalTokens) * s.PricePerToken,
+		GenerationTime:   int(reply.Latency.Milliseconds()),
+		Streamed:         request.Stream != nil && *request.Stream,
+		FinishReason:     finishReason,
+		TokensPrompt:     usage.PromptTokens,
+		TokensCompletion: usage.CompletionTokens,
+	}
+	s.mu.Unlock()
+
+	base := openrouter.OpenRouterBaseResponse{
+		ID:      id,
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+
+	if request.Stream != nil && *request.Stream {
+		s.writeStream(w, base, message, finishReason, usage, reply.MalformedStream)
+		return
+	}
+
+	base.Object = "chat.completion"
+	base.Usage = usage
+	response := openrouter.NonStreamingChatResponse{
+		OpenRouterBaseResponse: base,
+		Choices: []openrouter.NonStreamingChatChoice{{
+			BaseChoice: openrouter.BaseChoice{FinishReason: &finishReason},
+			Message:    message,
+		}},
+	}
+	if request.Logprobs != nil && *request.Logprobs {
+		response.Choices[0].Logprobs = replyLogprobs(reply, contentOf(message))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (s *Server) buildMessage(reply Reply, request *openrouter.OpenRouterRequest) (openrouter.ResponseMessage, error) {
+	message := openrouter.ResponseMessage{Role: "assistant"}
+
+	content := reply.Content
+	switch {
+	case content == "" && len(reply.Logprobs) > 0:
+		content = (&openrouter.ChoiceLogprobs{Content: reply.Logprobs}).Text()
+	case reply.MatchSchema && len(request.ResponseFormat) == 0 && len(reply.ToolCalls) == 0:
+		// Requests without a response format are answered with a call of the forced tool
+		call, err := ToolCallFromForcedTool(request)
+		if err != nil {
+			return message, err
+		}
+		reply.ToolCalls = []openrouter.ToolCall{call}
+	case reply.MatchSchema:
+		value, err := ValueFromResponseFormat(request.ResponseFormat)
+		if err != nil {
+			return message, err
+		}
+		encoded, _ := json.Marshal(value)
+		content = string(encoded)
+	case reply.JSON != nil:
+		encoded, err := json.Marshal(reply.JSON)
+		if err != nil {
+			return message, fmt.Errorf("failed to encode scripted JSON: %w", err)
+		}
+		content = string(encoded)
+	}
+	if content != "" || len(reply.ToolCalls) == 0 {
+		message.Content = &content
+	}
+	if reply.Reasoning != "" {
+		reasoning := reply.Reasoning
+		message.Reasoning = &reasoning
+	}
+
+	for i, call := range reply.ToolCalls {
+		if call.ID == "" {
+			call.ID = fmt.Sprintf("call_%d", i)
+		}
+		if call.Type == "" {
+			call.Type = "function"
+		}
+		message.ToolCalls = append(message.ToolCalls, call)
+	}
+	return message, nil
+}
+
+// replyLogprobs returns the scripted logprobs, or the content split into certain tokens
+func replyLogprobs(reply Reply, content string) *openrouter.ChoiceLogprobs {
+	if len(reply.Logprobs) > 0 {
+		return &openrouter.ChoiceLogprobs{Content: reply.Logprobs}
+	}
+	logprobs := &openrouter.ChoiceLogprobs{Content: []openrouter.TokenLogprob{}}
+	for _, piece := range splitContent(content, 4) {
+		logprobs.Content = append(logprobs.Content, openrouter.TokenLogprob{Token: piece})
+	}
+	return logprobs
+}
+
+func contentOf(message openrouter.ResponseMessage) string {
+	if message.Content == nil {
+		return ""
+	}
+	return *message.Content
+}
+
+// writeStream sends the message as SSE chunks the way OpenRouter does: content in small
+// pieces, tool call arguments split across chunks, then the finish reason and usage.
+func (s *Server) writeStream(w http.ResponseWriter, base openrouter.OpenRouterBaseResponse, message openrouter.ResponseMessage, finishReason string, usage *openrouter.ResponseUsage, malformed bool) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	base.Object = "chat.completion.chunk"
+
+	send := func(choice openrouter.StreamingChatChoice, usage *openrouter.ResponseUsage) {
+		chunk := openrouter.StreamingChatResponse{OpenRouterBaseResponse: base}
+		chunk.Usage = usage
+		chunk.Choices = []openrouter.StreamingChatChoice{choice}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	role := "assistant"
+	send(openrouter.StreamingChatChoice{Delta: openrouter.StreamingChatDelta{Role: &role}}, nil)
+
+	if message.Reasoning != nil {
+		send(openrouter.StreamingChatChoice{Delta: openrouter.StreamingChatDelta{Reasoning: message.Reasoning}}, nil)
+	}
+	for _, piece := range splitContent(contentOf(message), 8) {
+		send(openrouter.StreamingChatChoice{Delta: openrouter.StreamingChatDelta{Content: &piece}}, nil)
+	}
+
+	if malformed {
+		fmt.Fprint(w, "data: {\"id\": \"broken\", \"choices\": [\n\n")
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return
+	}
+
+	for i, call := range message.ToolCalls {
+		index := i
+		name := call.Function.Name
+		arguments := call.Function.Arguments
+		half := len(arguments) / 2
+		send(openrouter.StreamingChatChoice{Delta: openrouter.StreamingChatDelta{ToolCalls: []openrouter.ToolCallDelta{{
+			Index: &index, ID: call.ID, Type: call.Type,
+			Function: openrouter.FunctionDelta{Name: &name, Arguments: arguments[:half]},
+		}}}}, nil)
+		send(openrouter.StreamingChatChoice{Delta: openrouter.StreamingChatDelta{ToolCalls: []openrouter.ToolCallDelta{{
+			Index:    &index,
+			Function: openrouter.FunctionDelta{Arguments: arguments[half:]},
+		}}}}, nil)
+	}
+
+	send(openrouter.StreamingChatChoice{BaseChoice: openrouter.BaseChoice{FinishReason: &finishReason}}, usage)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+func splitContent(content string, size int) []string {
+	var pieces []string
+	runes := []rune(content)
+	for start := 0; start < len(runes); start += size {
+		pieces = append(pieces, string(runes[start:min(start+size, len(runes))]))
+	}
+	return pieces
+}
+
+// EmbeddingDimensions is the vector size of /embeddings when the request sets no dimensions
+const EmbeddingDimensions = 16
+
+// handleEmbeddings answers with bag of words vectors: every lower cased word is hashed into
+// one dimension, so texts sharing words are similar. Scripts of the model apply for errors and latency.
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, 401, "missing API key", "")
+		return
+	}
+	var request openrouter.EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, 400, fmt.Sprintf("invalid request body: %v", err), "")
+		return
+	}
+
+	reply := s.nextReply(request.Model)
+	if reply.Latency > 0 {
+		select {
+		case <-time.After(reply.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if writeReplyError(w, reply) {
+		return
+	}
+
+	dimensions := EmbeddingDimensions
+	if request.Dimensions != nil && *request.Dimensions > 0 {
+		dimensions = *request.Dimensions
+	}
+	response := openrouter.EmbeddingResponse{
+		ID:     s.newGenerationID(),
+		Object: "list",
+		Model:  request.Model,
+		Data:   make([]openrouter.Embedding, len(request.Input)),
+		Usage:  &openrouter.EmbeddingUsage{},
+	}
+	for i, text := range request.Input {
+		response.Data[i] = openrouter.Embedding{Object: "embedding", Index: i, Embedding: WordVector(text, dimensions)}
+		response.Usage.PromptTokens += openrouter.EstimateTokens(request.Model, text)
+	}
+	response.Usage.TotalTokens = response.Usage.PromptTokens
+	cost := float64(response.Usage.TotalTokens) * s.PricePerToken
+	response.Usage.Cost = &cost
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// WordVector returns the vector /embeddings answers for a text
+func WordVector(text string, dimensions int) []float64 {
+	vector := make([]float64, dimensions)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		hash := fnv.New32a()
+		hash.Write([]byte(word))
+		vector[hash.Sum32()%uint32(dimensions)]++
+	}
+	return vector
+}
+
+func (s *Server) handleGeneration(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	s.mu.Lock()
+	stats, ok := s.generations[id]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, 404, fmt.Sprintf("generation %s not found", id), "")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(openrouter.GenerationStatsResponse{Data: stats})
+}
+
+// modelEntry is the /models wire format of a model
+type modelEntry struct {
+	ID                  string            `json:"id"`
+	Name                string            `json:"name"`
+	ContextLength       int               `json:"context_length"`
+	Pricing             map[string]string `json:"pricing"`
+	TopProvider         map[string]int    `json:"top_provider"`
+	SupportedParameters []string          `json:"supported_parameters"`
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	models := append([]openrouter.ModelInfo(nil), s.models...)
+	s.mu.Unlock()
+
+	entries := make([]modelEntry, 0, len(models))
+	for _, model := range models {
+		entry := modelEntry{
+			ID:            model.ID,
+			Name:          model.Name,
+			ContextLength: model.ContextLength,
+			Pricing: map[string]string{
+				"prompt":     strconv.FormatFloat(model.Pricing.Prompt, 'f', -1, 64),
+				"completion": strconv.FormatFloat(model.Pricing.Completion, 'f', -1, 64),
+				"request":    strconv.FormatFloat(model.Pricing.Request, 'f', -1, 64),
+				"image":      strconv.FormatFloat(model.Pricing.Image, 'f', -1, 64),
+			},
+			TopProvider:         map[string]int{},
+			SupportedParameters: model.SupportedParameters,
+		}
+		if model.MaxCompletionTokens > 0 {
+			entry.TopProvider["max_completion_tokens"] = model.MaxCompletionTokens
+		}
+		entries = append(entries, entry)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"data": entries})
+}
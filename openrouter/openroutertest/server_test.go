@@ -0,0 +1,288 @@
+package openroutertest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/llmang/llmango/openrouter"
+)
+
+func chatRequest(model string, stream bool) *openrouter.OpenRouterRequest {
+	request := &openrouter.OpenRouterRequest{
+		Model:    &model,
+		Messages: []openrouter.Message{{Role: "user", Content: "hello"}},
+	}
+	if stream {
+		request.Stream = &stream
+	}
+	return request
+}
+
+func TestServerScriptedReplies(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	server.Script("test/model", Reply{Content: "first"}, Reply{Content: "second"})
+	server.SetFallback(Reply{Content: "fallback"})
+
+	for _, expected := range []string{"first", "second", "second"} {
+		response, err := client.GenerateNonStreamingChatResponse(chatRequest("test/model", false))
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		if got := *response.Choices[0].Message.Content; got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+		if response.Usage == nil || response.Usage.PromptTokens == 0 {
+			t.Errorf("Expected estimated usage, got %+v", response.Usage)
+		}
+	}
+
+	response, err := client.GenerateNonStreamingChatResponse(chatRequest("test/other", false))
+	if err != nil || *response.Choices[0].Message.Content != "fallback" {
+		t.Errorf("Expected the fallback reply for unscripted models, got %v", err)
+	}
+
+	requests := server.ChatRequests()
+	if len(requests) != 4 || *requests[3].Model != "test/other" || requests[0].Messages[0].Content != "hello" {
+		t.Errorf("Expected the received requests to be recorded, got %d", len(requests))
+	}
+	if server.Requests()[0].Header.Get("Authorization") != "Bearer test-key" {
+		t.Error("Expected the API key to be sent")
+	}
+}
+
+func TestServerToolCallsAndStreaming(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	reply := Reply{ToolCalls: []openrouter.ToolCall{{Function: openrouter.ToolCallFunction{Name: "lookup", Arguments: `{"query":"weather in paris"}`}}}}
+	server.Script("test/tools", reply)
+
+	response, err := client.GenerateNonStreamingChatResponse(chatRequest("test/tools", false))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if len(response.Choices[0].Message.ToolCalls) != 1 || *response.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Expected a tool call response, got %+v", response.Choices[0])
+	}
+
+	var completed []openrouter.StreamEvent
+	streamed, err := client.GenerateStreamingChatResponseAccumulated(context.Background(), chatRequest("test/tools", true), func(event openrouter.StreamEvent) {
+		if event.Type == openrouter.StreamEventToolCallCompleted {
+			completed = append(completed, event)
+		}
+	})
+	if err != nil {
+		t.Fatalf("Streaming request failed: %v", err)
+	}
+	if len(completed) != 1 || string(completed[0].Arguments) != `{"query":"weather in paris"}` {
+		t.Errorf("Expected the split arguments to be assembled, got %+v", completed)
+	}
+	if streamed.Usage == nil || streamed.Choices[0].Message.ToolCalls[0].ID != "call_0" {
+		t.Errorf("Unexpected streamed response: %+v", streamed)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	server.Script("test/broke", Reply{Status: 402, ErrorMessage: "no credits"})
+	if _, err := client.GenerateNonStreamingChatResponse(chatRequest("test/broke", false)); !errors.Is(err, openrouter.ErrInsufficientCredits) {
+		t.Errorf("Expected ErrInsufficientCredits, got %v", err)
+	}
+
+	server.Script("test/limited", Reply{Status: 429, RetryAfter: "2"})
+	if _, err := client.GenerateNonStreamingChatResponse(chatRequest("test/limited", false)); !errors.Is(err, openrouter.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+	if _, err := client.GenerateStreamingChatResponse(context.Background(), chatRequest("test/limited", true)); !errors.Is(err, openrouter.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited for streaming, got %v", err)
+	}
+
+	resp, err := http.Post(server.URL+"/chat/completions", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Raw request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected requests without a key to be rejected, got %d", resp.StatusCode)
+	}
+
+	request := chatRequest("test/limited", false)
+	body, _ := json.Marshal(request)
+	req, _ := http.NewRequest("POST", server.URL+"/chat/completions", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer test-key")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Raw request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") != "2" {
+		t.Errorf("Expected a 429 with Retry-After, got %d %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestServerMalformedStreamAndLatency(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	server.Script("test/broken-stream", Reply{Content: "partial answer", MalformedStream: true})
+	response, err := client.GenerateStreamingChatResponseAccumulated(context.Background(), chatRequest("test/broken-stream", true), nil)
+	if err != nil {
+		t.Fatalf("Streaming request failed: %v", err)
+	}
+	if response.Choices[0].FinishReason != nil || *response.Choices[0].Message.Content != "partial answer" {
+		t.Errorf("Expected the content before the malformed chunk without a finish reason, got %+v", response.Choices[0])
+	}
+
+	server.Script("test/slow", Reply{Content: "late", Latency: 200 * time.Millisecond})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GenerateNonStreamingChatResponseWithContext(ctx, chatRequest("test/slow", false)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to be exceeded, got %v", err)
+	}
+}
+
+func TestServerSchemaGenerationAndModels(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	format, err := openrouter.UseOpenRouterJsonFormatFromJSON(json.RawMessage(`{"label": "spam", "score": 0.5, "tags": ["a"], "ok": true}`), "Classification")
+	if err != nil {
+		t.Fatalf("Failed to create response format: %v", err)
+	}
+	request := chatRequest("test/schema", false)
+	request.ResponseFormat = format
+	server.Script("test/schema", Reply{MatchSchema: true})
+
+	response, err := client.GenerateNonStreamingChatResponse(request)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	schema, err := openrouter.GenerateSchemaFromJSONExample(json.RawMessage(`{"label": "spam", "score": 0.5, "tags": ["a"], "ok": true}`))
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	if err := openrouter.ValidateJSONAgainstSchema(json.RawMessage(*response.Choices[0].Message.Content), schema); err != nil {
+		t.Errorf("Expected the generated content to match the schema: %v (%s)", err, *response.Choices[0].Message.Content)
+	}
+
+	stats, err := client.GetGenerationStats(response.ID)
+	if err != nil {
+		t.Fatalf("Generation stats failed: %v", err)
+	}
+	if stats.TokensPrompt != response.Usage.PromptTokens || stats.TotalCost <= 0 {
+		t.Errorf("Unexpected generation stats: %+v", stats)
+	}
+	if _, err := client.GetGenerationStats("gen-unknown"); err == nil {
+		t.Error("Expected unknown generations to fail")
+	}
+
+	server.SetModels(openrouter.ModelInfo{
+		ID: "test/schema", ContextLength: 8000, MaxCompletionTokens: 1000,
+		SupportedParameters: []string{"structured_outputs"},
+		Pricing:             openrouter.ModelPricing{Prompt: 0.000002},
+	})
+	models, err := client.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels failed: %v", err)
+	}
+	if len(models) != 1 || models[0].MaxCompletionTokens != 1000 || !models[0].SupportsStructuredOutput() || models[0].Pricing.Prompt != 0.000002 {
+		t.Errorf("Unexpected models: %+v", models)
+	}
+}
+
+func TestServerEmbeddings(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	dimensions := 32
+	response, err := client.CreateEmbeddings(context.Background(), &openrouter.EmbeddingRequest{
+		Model:      "test/embed",
+		Input:      []string{"weather in Paris", "Paris weather today", "stock prices"},
+		Dimensions: &dimensions,
+	})
+	if err != nil {
+		t.Fatalf("CreateEmbeddings failed: %v", err)
+	}
+	vectors := response.Vectors()
+	if len(vectors) != 3 || len(vectors[0]) != 32 {
+		t.Fatalf("Expected 3 vectors of 32 dimensions, got %d", len(vectors))
+	}
+	if openrouter.CosineSimilarity(vectors[0], vectors[1]) <= openrouter.CosineSimilarity(vectors[0], vectors[2]) {
+		t.Error("Expected texts sharing words to be more similar")
+	}
+	if response.Usage == nil || response.Usage.PromptTokens == 0 || response.Usage.Cost == nil {
+		t.Errorf("Expected usage with cost, got %+v", response.Usage)
+	}
+
+	server.Script("test/embed-limited", Reply{Status: 429})
+	if _, err := client.CreateEmbeddings(context.Background(), &openrouter.EmbeddingRequest{Model: "test/embed-limited", Input: []string{"a"}}); !errors.Is(err, openrouter.ErrRateLimited) {
+		t.Errorf("Expected ErrRateLimited, got %v", err)
+	}
+}
+
+func TestValueFromSchemaConstraints(t *testing.T) {
+	type constrained struct {
+		Code   string   `json:"code" minLength:"10"`
+		Due    string   `json:"due" format:"date-time"`
+		Labels []string `json:"labels" minItems:"3"`
+		Ratio  float64  `json:"ratio" maximum:"0.5"`
+		Mode   string   `json:"mode" default:"auto"`
+	}
+	schema, err := openrouter.GenerateSchemaForType(constrained{})
+	if err != nil {
+		t.Fatalf("Failed to generate schema: %v", err)
+	}
+	encoded, _ := json.Marshal(schema)
+	var schemaMap map[string]any
+	json.Unmarshal(encoded, &schemaMap)
+
+	value, _ := json.Marshal(ValueFromSchema(schemaMap))
+	if err := openrouter.ValidateJSONAgainstSchema(value, schema); err != nil {
+		t.Errorf("Expected the generated value to satisfy the constraints: %v (%s)", err, value)
+	}
+	if !strings.Contains(string(value), `"mode":"auto"`) {
+		t.Errorf("Expected the default to be used, got %s", value)
+	}
+}
+
+func TestValueFromSchemaRecursive(t *testing.T) {
+	type node struct {
+		Name     string `json:"name"`
+		Children []node `json:"children"`
+	}
+	type wrapper struct {
+		Root   node              `json:"root"`
+		Labels map[string]string `json:"labels"`
+	}
+	for _, value := range []any{node{}, wrapper{}} {
+		format, err := openrouter.UseOpenRouterJsonFormat(value, "Recursive")
+		if err != nil {
+			t.Fatalf("Failed to create response format: %v", err)
+		}
+		generated, err := ValueFromResponseFormat(format)
+		if err != nil {
+			t.Fatalf("ValueFromResponseFormat failed: %v", err)
+		}
+		encoded, _ := json.Marshal(generated)
+		schema, _ := openrouter.GenerateSchemaForType(value)
+		if err := openrouter.ValidateJSONAgainstSchema(encoded, schema); err != nil {
+			t.Errorf("Expected the generated value to match the recursive schema: %v (%s)", err, encoded)
+		}
+	}
+}
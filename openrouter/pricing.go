@@ -0,0 +1,142 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var ErrPricingUnknown = errors.New("no pricing is known for this model")
+
+// PricingTable holds model prices that take precedence over the model catalog,
+// e.g. negotiated prices or models that are not listed by OpenRouter.
+type PricingTable struct {
+	mu     sync.RWMutex
+	prices map[string]ModelPricing
+}
+
+// DefaultPricingTable is consulted by LookupPricing before the DefaultModelCatalog
+var DefaultPricingTable = &PricingTable{}
+
+// Set stores the pricing of a model
+func (p *PricingTable) Set(modelID string, pricing ModelPricing) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prices == nil {
+		p.prices = make(map[string]ModelPricing)
+	}
+	p.prices[modelID] = pricing
+}
+
+// Delete removes the pricing of a model
+func (p *PricingTable) Delete(modelID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.prices, modelID)
+}
+
+// Get returns the pricing of a model
+func (p *PricingTable) Get(modelID string) (ModelPricing, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	pricing, ok := p.prices[modelID]
+	return pricing, ok
+}
+
+// LoadFile adds the prices from a JSON file mapping model IDs to prices in USD per token, e.g.
+// {"openai/gpt-4o": {"prompt": 0.0000025, "completion": 0.00001, "request": 0, "image": 0}}
+func (p *PricingTable) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read pricing file: %w", err)
+	}
+	var prices map[string]ModelPricing
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return fmt.Errorf("failed to parse pricing file %s: %w", path, err)
+	}
+	for modelID, pricing := range prices {
+		p.Set(modelID, pricing)
+	}
+	return nil
+}
+
+// LookupPricing returns the pricing of a model from the DefaultPricingTable,
+// falling back to the DefaultModelCatalog. Catalog models with unknown pricing are not found.
+func LookupPricing(modelID string) (ModelPricing, bool) {
+	if pricing, ok := DefaultPricingTable.Get(modelID); ok {
+		return pricing, true
+	}
+	if info, ok := DefaultModelCatalog.Get(modelID); ok && !info.PricingUnknown {
+		return info.Pricing, true
+	}
+	return ModelPricing{}, false
+}
+
+// Cost returns the price in USD of a single request with the given token counts
+func (p ModelPricing) Cost(promptTokens, completionTokens int) float64 {
+	return p.Prompt*float64(promptTokens) + p.Completion*float64(completionTokens) + p.Request
+}
+
+// CostFromUsage calculates the cost in USD of a completed request from its reported usage.
+// ok is false when the usage is missing or no pricing is known for the model. The per image
+// price is not included, the usage doesn't report how many images were sent.
+func CostFromUsage(modelID string, usage *ResponseUsage) (cost float64, ok bool) {
+	if usage == nil {
+		return 0, false
+	}
+	pricing, found := LookupPricing(modelID)
+	if !found {
+		return 0, false
+	}
+	return pricing.Cost(usage.PromptTokens, usage.CompletionTokens), true
+}
+
+// CostEstimate is the expected spend of a request before it is sent
+type CostEstimate struct {
+	PromptTokens        int     `json:"promptTokens"`        // estimated prompt tokens
+	MaxCompletionTokens int     `json:"maxCompletionTokens"` // completion budget used for MaxCost, 0 when unbounded
+	PromptCost          float64 `json:"promptCost"`          // cost of the prompt including the per request price
+	MaxCost             float64 `json:"maxCost"`             // cost when the whole completion budget is used
+}
+
+// EstimateCost estimates the spend of a request before sending it. The completion budget is
+// MaxTokens, or the model's maximum completion tokens from the catalog when MaxTokens is not set.
+// An error wrapping ErrPricingUnknown is returned when no pricing is known for the model.
+func (r *OpenRouterRequest) EstimateCost() (*CostEstimate, error) {
+	if r.Model == nil || *r.Model == "" {
+		return nil, errors.New("cannot estimate the cost of a request without a model")
+	}
+	pricing, ok := LookupPricing(*r.Model)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrPricingUnknown, *r.Model)
+	}
+
+	estimate := &CostEstimate{PromptTokens: r.EstimatePromptTokens()}
+	if r.MaxTokens != nil && *r.MaxTokens > 0 {
+		estimate.MaxCompletionTokens = *r.MaxTokens
+	} else if _, maxCompletionTokens, ok := ContextLimits(*r.Model); ok {
+		estimate.MaxCompletionTokens = maxCompletionTokens
+	}
+
+	estimate.PromptCost = pricing.Cost(estimate.PromptTokens, 0)
+	estimate.MaxCost = pricing.Cost(estimate.PromptTokens, estimate.MaxCompletionTokens)
+	return estimate, nil
+}
+
+// EstimateBatchCost sums the cost estimates of several requests, e.g. before running a batch
+func EstimateBatchCost(requests []*OpenRouterRequest) (*CostEstimate, error) {
+	total := &CostEstimate{}
+	for i, request := range requests {
+		estimate, err := request.EstimateCost()
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", i, err)
+		}
+		total.PromptTokens += estimate.PromptTokens
+		total.MaxCompletionTokens += estimate.MaxCompletionTokens
+		total.PromptCost += estimate.PromptCost
+		total.MaxCost += estimate.MaxCost
+	}
+	return total, nil
+}
@@ -0,0 +1,106 @@
+package openrouter
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func floatEquals(a, b float64) bool {
+	return math.Abs(a-b) < 1e-12
+}
+
+func TestLookupPricing(t *testing.T) {
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set([]ModelInfo{{ID: "test/catalog", Pricing: ModelPricing{Prompt: 0.000001, Completion: 0.000002}}})
+
+	if _, ok := LookupPricing("test/unknown"); ok {
+		t.Error("Expected no pricing for an unknown model")
+	}
+	if pricing, ok := LookupPricing("test/catalog"); !ok || pricing.Prompt != 0.000001 {
+		t.Errorf("Expected catalog pricing, got %+v", pricing)
+	}
+
+	DefaultPricingTable.Set("test/catalog", ModelPricing{Prompt: 0.5})
+	defer DefaultPricingTable.Delete("test/catalog")
+	if pricing, _ := LookupPricing("test/catalog"); pricing.Prompt != 0.5 {
+		t.Errorf("Expected the pricing table to take precedence over the catalog, got %+v", pricing)
+	}
+}
+
+func TestPricingTableLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pricing.json")
+	content := `{"test/file": {"prompt": 0.001, "completion": 0.002, "request": 0.01, "image": 0}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write pricing file: %v", err)
+	}
+
+	table := &PricingTable{}
+	if err := table.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	pricing, ok := table.Get("test/file")
+	if !ok || pricing.Request != 0.01 {
+		t.Errorf("Expected pricing from file, got %+v", pricing)
+	}
+	if err := table.LoadFile(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestCostFromUsage(t *testing.T) {
+	DefaultPricingTable.Set("test/priced", ModelPricing{Prompt: 0.001, Completion: 0.002, Request: 0.01})
+	defer DefaultPricingTable.Delete("test/priced")
+
+	cost, ok := CostFromUsage("test/priced", &ResponseUsage{PromptTokens: 100, CompletionTokens: 50})
+	if !ok || !floatEquals(cost, 0.1+0.1+0.01) {
+		t.Errorf("Expected cost 0.21, got %v (%v)", cost, ok)
+	}
+	if _, ok := CostFromUsage("test/priced", nil); ok {
+		t.Error("Expected no cost without usage")
+	}
+	if _, ok := CostFromUsage("test/unknown", &ResponseUsage{PromptTokens: 1}); ok {
+		t.Error("Expected no cost without pricing")
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	DefaultPricingTable.Set("test/priced", ModelPricing{Prompt: 0.001, Completion: 0.002})
+	defer DefaultPricingTable.Delete("test/priced")
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set([]ModelInfo{{ID: "test/priced", ContextLength: 1000, MaxCompletionTokens: 200}})
+
+	model := "test/priced"
+	request := &OpenRouterRequest{Model: &model, Messages: []Message{{Role: "user", Content: strings.Repeat("a", 40)}}}
+
+	estimate, err := request.EstimateCost()
+	if err != nil {
+		t.Fatalf("EstimateCost failed: %v", err)
+	}
+	if estimate.PromptTokens != request.EstimatePromptTokens() || estimate.MaxCompletionTokens != 200 {
+		t.Errorf("Unexpected estimate: %+v", estimate)
+	}
+	if !floatEquals(estimate.MaxCost, estimate.PromptCost+0.4) {
+		t.Errorf("Expected max cost to include the completion budget, got %+v", estimate)
+	}
+
+	maxTokens := 10
+	request.MaxTokens = &maxTokens
+	batch, err := EstimateBatchCost([]*OpenRouterRequest{request, request})
+	if err != nil {
+		t.Fatalf("EstimateBatchCost failed: %v", err)
+	}
+	if batch.MaxCompletionTokens != 20 || !floatEquals(batch.MaxCost, 2*(estimate.PromptCost+0.02)) {
+		t.Errorf("Unexpected batch estimate: %+v", batch)
+	}
+
+	unknown := "test/unknown"
+	if _, err := (&OpenRouterRequest{Model: &unknown}).EstimateCost(); !errors.Is(err, ErrPricingUnknown) {
+		t.Errorf("Expected ErrPricingUnknown, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/llmang/llmango/testhelpers"
+)
+
+func TestReasoningConfigSerialization(t *testing.T) {
+	effort := "high"
+	exclude := true
+	request := OpenRouterRequest{
+		Parameters: Parameters{
+			Reasoning: &ReasoningConfig{Effort: &effort, Exclude: &exclude},
+		},
+	}
+
+	encoded, err := json.Marshal(request)
+	testhelpers.RequireNoError(t, err, "Request should encode")
+	testhelpers.AssertTrue(t, strings.Contains(string(encoded), `"reasoning":{"effort":"high","exclude":true}`),
+		"Reasoning config should be nested under reasoning, got %s", encoded)
+}
+
+func TestReasoningResponseDecoding(t *testing.T) {
+	body := `{
+		"id": "gen-1",
+		"choices": [{"message": {"role": "assistant", "content": "{}", "reasoning": "Let me think..."}}],
+		"usage": {"prompt_tokens": 10, "completion_tokens": 120, "total_tokens": 130, "completion_tokens_details": {"reasoning_tokens": 100}}
+	}`
+
+	var response NonStreamingChatResponse
+	testhelpers.RequireNoError(t, json.Unmarshal([]byte(body), &response), "Response should decode")
+	testhelpers.AssertEqual(t, "Let me think...", *response.Choices[0].Message.Reasoning, "Reasoning text should be captured")
+	testhelpers.AssertEqual(t, 100, response.Usage.ReasoningTokens(), "Reasoning tokens should be captured")
+
+	var noDetails *ResponseUsage
+	testhelpers.AssertEqual(t, 0, noDetails.ReasoningTokens(), "Missing usage should report 0 reasoning tokens")
+}
@@ -0,0 +1,242 @@
+package openrouter
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var ErrCassetteMiss = errors.New("no recorded interaction matches the request")
+
+// RecorderMode selects whether a Recorder talks to the network
+type RecorderMode int
+
+const (
+	// RecorderReplay serves recorded responses and never touches the network
+	RecorderReplay RecorderMode = iota
+	// RecorderRecord sends every request and records the response, replacing the cassette
+	RecorderRecord
+	// RecorderReplayOrRecord serves recorded responses and records the requests that are missing
+	RecorderReplayOrRecord
+)
+
+// RecorderModeFromEnv reads the mode from an environment variable. "record" and "replay_or_record"
+// select those modes, anything else (including unset) replays, so tests stay offline by default.
+func RecorderModeFromEnv(name string) RecorderMode {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "record":
+		return RecorderRecord
+	case "replay_or_record":
+		return RecorderReplayOrRecord
+	default:
+		return RecorderReplay
+	}
+}
+
+// Interaction is a single recorded request and its response
+type Interaction struct {
+	Key          string            `json:"key"` // hash of the method, URL and normalized request body
+	Method       string            `json:"method"`
+	URL          string            `json:"url"`
+	RequestBody  string            `json:"requestBody,omitempty"`
+	StatusCode   int               `json:"statusCode"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	ResponseBody string            `json:"responseBody"` // full body, SSE streams are stored as the raw event text
+}
+
+// Cassette is the on disk format of a Recorder
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// recordedHeaders are the response headers kept in cassettes, auth related headers are never stored
+var recordedHeaders = []string{"Content-Type"}
+
+// Recorder is an http.RoundTripper that records OpenRouter traffic to a JSON cassette file and
+// replays it without network access. Set it as OpenRouter.Transport to run the llmango and
+// agents stack offline. Requests are matched by method, URL and JSON body with normalized
+// formatting and key order. Identical requests are replayed in recorded order, the last
+// response is repeated once they run out.
+type Recorder struct {
+	Path      string
+	Mode      RecorderMode
+	Transport http.RoundTripper // used to reach the network when recording, defaults to http.DefaultTransport
+
+	mu       sync.Mutex
+	cassette Cassette
+	served   map[string]int // key -> number of times it was replayed
+}
+
+// NewRecorder creates a recorder for the cassette at path. Replay modes load the cassette,
+// RecorderReplay fails if it does not exist.
+func NewRecorder(path string, mode RecorderMode) (*Recorder, error) {
+	r := &Recorder{Path: path, Mode: mode, served: make(map[string]int)}
+	if mode == RecorderRecord {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && mode == RecorderReplayOrRecord {
+			return r, nil
+		}
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.cassette); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Interactions returns the recorded interactions
+func (r *Recorder) Interactions() []*Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Interaction(nil), r.cassette.Interactions...)
+}
+
+// RoundTrip implements http.RoundTripper
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	key := interactionKey(req.Method, req.URL.String(), body)
+
+	if r.Mode != RecorderRecord {
+		if interaction := r.replay(key); interaction != nil {
+			return interaction.response(req), nil
+		}
+		if r.Mode == RecorderReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrCassetteMiss, req.Method, req.URL.String())
+		}
+	}
+
+	return r.record(req, key, body)
+}
+
+func (r *Recorder) replay(key string) *Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matches []*Interaction
+	for _, interaction := range r.cassette.Interactions {
+		if interaction.Key == key {
+			matches = append(matches, interaction)
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+	index := min(r.served[key], len(matches)-1)
+	r.served[key]++
+	return matches[index]
+}
+
+func (r *Recorder) record(req *http.Request, key string, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// Streams are read to the end, so recording waits for the whole response
+	responseBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	interaction := &Interaction{
+		Key:          key,
+		Method:       req.Method,
+		URL:          req.URL.String(),
+		RequestBody:  string(body),
+		StatusCode:   resp.StatusCode,
+		Headers:      make(map[string]string),
+		ResponseBody: string(responseBody),
+	}
+	for _, header := range recordedHeaders {
+		if value := resp.Header.Get(header); value != "" {
+			interaction.Headers[header] = value
+		}
+	}
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, interaction)
+	err = r.saveLocked()
+	r.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(responseBody))
+	return resp, nil
+}
+
+// saveLocked writes the cassette to disk, r.mu must be held
+func (r *Recorder) saveLocked() error {
+	data, err := json.MarshalIndent(r.cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+	if dir := filepath.Dir(r.Path); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	}
+	if err := os.WriteFile(r.Path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette: %w", err)
+	}
+	return nil
+}
+
+func (i *Interaction) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	for name, value := range i.Headers {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.StatusCode, http.StatusText(i.StatusCode)),
+		StatusCode:    i.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(i.ResponseBody)),
+		ContentLength: int64(len(i.ResponseBody)),
+		Request:       req,
+	}
+}
+
+// interactionKey hashes the parts of a request that identify it. JSON bodies are
+// re-encoded so formatting and key order do not matter.
+func interactionKey(method, url string, body []byte) string {
+	normalized := body
+	var decoded any
+	if len(body) > 0 && json.Unmarshal(body, &decoded) == nil {
+		if encoded, err := json.Marshal(decoded); err == nil {
+			normalized = encoded
+		}
+	}
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + url + "\n"))
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,147 @@
+package openrouter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func textResponse(req *http.Request, contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+// fakeOpenRouterTransport answers chat, streaming and generation requests like OpenRouter
+func fakeOpenRouterTransport(calls *int) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		*calls++
+		switch {
+		case req.URL.Path == "/api/v1/generation":
+			return textResponse(req, "application/json", `{"data":{"id":"gen-1","total_cost":0.0042,"generation_time":120}}`), nil
+		case req.Header.Get("Accept") == "text/event-stream":
+			return textResponse(req, "text/event-stream",
+				"data: {\"id\":\"gen-2\",\"choices\":[{\"delta\":{\"content\":\"Hel\"}}]}\n\n"+
+					"data: {\"id\":\"gen-2\",\"choices\":[{\"delta\":{\"content\":\"lo\"},\"finish_reason\":\"stop\"}]}\n\n"+
+					"data: [DONE]\n\n"), nil
+		default:
+			return textResponse(req, "application/json", `{"id":"gen-1","model":"openai/gpt-4o","choices":[{"message":{"role":"assistant","content":"Hello"}}]}`), nil
+		}
+	})
+}
+
+func recorderRequest() *OpenRouterRequest {
+	model := "openai/gpt-4o"
+	return &OpenRouterRequest{Model: &model, Messages: []Message{{Role: "user", Content: "Say hello"}}}
+}
+
+func exerciseRecorder(t *testing.T, o *OpenRouter) {
+	t.Helper()
+	response, err := o.GenerateNonStreamingChatResponse(recorderRequest())
+	if err != nil {
+		t.Fatalf("Chat request failed: %v", err)
+	}
+	if *response.Choices[0].Message.Content != "Hello" {
+		t.Errorf("Unexpected chat response: %q", *response.Choices[0].Message.Content)
+	}
+
+	stats, err := o.GetGenerationStats(response.ID)
+	if err != nil {
+		t.Fatalf("Generation stats request failed: %v", err)
+	}
+	if stats.TotalCost != 0.0042 {
+		t.Errorf("Unexpected generation cost: %v", stats.TotalCost)
+	}
+
+	streamed, err := o.GenerateStreamingChatResponseAccumulated(context.Background(), recorderRequest(), nil)
+	if err != nil {
+		t.Fatalf("Streaming request failed: %v", err)
+	}
+	if *streamed.Choices[0].Message.Content != "Hello" {
+		t.Errorf("Unexpected streamed response: %q", *streamed.Choices[0].Message.Content)
+	}
+}
+
+func TestRecorderRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "hello.json")
+
+	calls := 0
+	recorder, err := NewRecorder(path, RecorderRecord)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	recorder.Transport = fakeOpenRouterTransport(&calls)
+	exerciseRecorder(t, &OpenRouter{ApiKey: "test-key", Transport: recorder})
+	if calls != 3 || len(recorder.Interactions()) != 3 {
+		t.Fatalf("Expected 3 recorded interactions, got %d calls and %d interactions", calls, len(recorder.Interactions()))
+	}
+	for _, interaction := range recorder.Interactions() {
+		if strings.Contains(interaction.RequestBody, "test-key") || interaction.Headers["Authorization"] != "" {
+			t.Error("Expected the API key not to be recorded")
+		}
+	}
+
+	replayer, err := NewRecorder(path, RecorderReplay)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	replayer.Transport = roundTripperFunc(func(*http.Request) (*http.Response, error) {
+		t.Fatal("Expected replay not to use the network")
+		return nil, nil
+	})
+	exerciseRecorder(t, &OpenRouter{ApiKey: "other-key", Transport: replayer})
+
+	other := recorderRequest()
+	other.Messages[0].Content = "Say goodbye"
+	_, err = (&OpenRouter{ApiKey: "other-key", Transport: replayer}).GenerateNonStreamingChatResponse(other)
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Errorf("Expected ErrCassetteMiss for an unrecorded request, got %v", err)
+	}
+}
+
+func TestRecorderReplayOrRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	if _, err := NewRecorder(path, RecorderReplay); err == nil {
+		t.Error("Expected replay of a missing cassette to fail")
+	}
+
+	calls := 0
+	recorder, err := NewRecorder(path, RecorderReplayOrRecord)
+	if err != nil {
+		t.Fatalf("NewRecorder failed: %v", err)
+	}
+	recorder.Transport = fakeOpenRouterTransport(&calls)
+	o := &OpenRouter{ApiKey: "test-key", Transport: recorder}
+	for range 3 {
+		if _, err := o.GenerateNonStreamingChatResponse(recorderRequest()); err != nil {
+			t.Fatalf("Chat request failed: %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected only the first request to reach the network, got %d calls", calls)
+	}
+}
+
+func TestInteractionKeyNormalizesJSON(t *testing.T) {
+	a := interactionKey("POST", "https://openrouter.ai/api/v1/chat/completions", []byte(`{"model":"x","messages":[]}`))
+	b := interactionKey("POST", "https://openrouter.ai/api/v1/chat/completions", []byte("{\n  \"messages\": [],\n  \"model\": \"x\"\n}"))
+	if a != b {
+		t.Error("Expected formatting and key order not to change the key")
+	}
+	if a == interactionKey("POST", "https://openrouter.ai/api/v1/chat/completions", []byte(`{"model":"y","messages":[]}`)) {
+		t.Error("Expected different bodies to produce different keys")
+	}
+}
@@ -0,0 +1,159 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type priority string
+
+func (priority) EnumValues() []string { return []string{"low", "high"} }
+
+type ticket struct {
+	Category string   `json:"category" enum:"bug, feature,question"`
+	Priority priority `json:"priority"`
+	Score    float64  `json:"score" minimum:"0" maximum:"1"`
+	Title    string   `json:"title" minLength:"3" maxLength:"20"`
+	Code     string   `json:"code" pattern:"^[A-Z]{3}-[0-9]+$"`
+	Due      string   `json:"due" format:"date-time"`
+	Contact  string   `json:"contact,omitempty" format:"email"`
+	Labels   []string `json:"labels" enum:"ui,api" minItems:"1" maxItems:"2"`
+	Retries  int      `json:"retries" default:"3" maximum:"5"`
+}
+
+func TestReflectConstraintTags(t *testing.T) {
+	schema, err := GenerateSchemaForType(ticket{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+	props := schema.Properties
+
+	if got := strings.Join(props["category"].Enum, "|"); got != "bug|feature|question" {
+		t.Errorf("Expected the enum tag to be split and trimmed, got %q", got)
+	}
+	if got := strings.Join(props["priority"].Enum, "|"); got != "low|high" {
+		t.Errorf("Expected the enum of the Go type, got %q", got)
+	}
+	if *props["score"].Minimum != 0 || *props["score"].Maximum != 1 {
+		t.Errorf("Unexpected bounds: %+v", props["score"])
+	}
+	if *props["title"].MinLength != 3 || *props["title"].MaxLength != 20 || props["code"].Pattern == "" || props["due"].Format != "date-time" {
+		t.Error("Expected string constraints to be reflected")
+	}
+	labels := props["labels"]
+	if *labels.MinItems != 1 || *labels.MaxItems != 2 || len(labels.Items.Enum) != 2 {
+		t.Errorf("Expected item counts on the array and the enum on its items, got %+v", labels)
+	}
+	if props["retries"].Default != int64(3) {
+		t.Errorf("Expected a typed default, got %#v", props["retries"].Default)
+	}
+
+	format, err := UseOpenRouterJsonFormat(ticket{}, "Ticket")
+	if err != nil {
+		t.Fatalf("UseOpenRouterJsonFormat failed: %v", err)
+	}
+	for _, expected := range []string{`"enum":["bug","feature","question"]`, `"maximum":1`, `"pattern":"^[A-Z]{3}-[0-9]+$"`, `"format":"date-time"`, `"minItems":1`, `"default":3`} {
+		if !strings.Contains(string(format), expected) {
+			t.Errorf("Expected %s in the response format, got %s", expected, format)
+		}
+	}
+}
+
+func TestReflectConstraintTagErrors(t *testing.T) {
+	cases := map[string]any{
+		"enum on number": struct {
+			A int `enum:"1,2"`
+		}{},
+		"invalid pattern": struct {
+			A string `pattern:"("`
+		}{},
+		"invalid minimum": struct {
+			A int `minimum:"low"`
+		}{},
+		"negative length": struct {
+			A string `maxLength:"-1"`
+		}{},
+		"invalid default": struct {
+			A bool `default:"maybe"`
+		}{},
+	}
+	for name, value := range cases {
+		if _, err := GenerateSchemaForType(value); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestValidateConstraints(t *testing.T) {
+	schema, err := GenerateSchemaForType(ticket{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+	valid := map[string]any{
+		"category": "bug", "priority": "high", "score": 0.5, "title": "Broken",
+		"code": "ABC-12", "due": "2024-05-01T10:00:00Z", "contact": "a@b.io",
+		"labels": []string{"ui"}, "retries": 2,
+	}
+	encode := func(changes map[string]any) json.RawMessage {
+		value := make(map[string]any)
+		for k, v := range valid {
+			value[k] = v
+		}
+		for k, v := range changes {
+			value[k] = v
+		}
+		data, _ := json.Marshal(value)
+		return data
+	}
+
+	if err := ValidateJSONAgainstSchema(encode(nil), schema); err != nil {
+		t.Fatalf("Expected the valid ticket to pass: %v", err)
+	}
+
+	invalid := []struct {
+		change   map[string]any
+		expected string
+	}{
+		{map[string]any{"category": "other"}, "is not one of"},
+		{map[string]any{"priority": "urgent"}, "is not one of"},
+		{map[string]any{"score": 1.5}, "greater than the maximum"},
+		{map[string]any{"score": -1}, "less than the minimum"},
+		{map[string]any{"title": "ab"}, "expected at least 3"},
+		{map[string]any{"title": strings.Repeat("é", 21)}, "expected at most 20"},
+		{map[string]any{"code": "abc-1"}, "does not match pattern"},
+		{map[string]any{"due": "tomorrow"}, "not a valid date-time"},
+		{map[string]any{"contact": "Ann <a@b.io>"}, "not a valid email"},
+		{map[string]any{"labels": []string{}}, "expected at least 1"},
+		{map[string]any{"labels": []string{"ui", "api", "ui"}}, "expected at most 2"},
+		{map[string]any{"labels": []string{"db"}}, "at /labels/0"},
+		{map[string]any{"retries": 6}, "greater than the maximum"},
+	}
+	for _, c := range invalid {
+		err := ValidateJSONAgainstSchema(encode(c.change), schema)
+		if err == nil || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%v: expected an error containing %q, got %v", c.change, c.expected, err)
+		}
+	}
+}
+
+func TestMatchesFormat(t *testing.T) {
+	cases := []struct {
+		value, format string
+		expected      bool
+	}{
+		{"2024-05-01", "date", true},
+		{"05/01/2024", "date", false},
+		{"10:30:00", "time", true},
+		{"https://example.com/a", "uri", true},
+		{"example.com", "uri", false},
+		{"123e4567-e89b-12d3-a456-426614174000", "uuid", true},
+		{"not-a-uuid", "uuid", false},
+		{"anything", "hostname", true},
+	}
+	for _, c := range cases {
+		if got := matchesFormat(c.value, c.format); got != c.expected {
+			t.Errorf("matchesFormat(%q, %q) = %v, expected %v", c.value, c.format, got, c.expected)
+		}
+	}
+}
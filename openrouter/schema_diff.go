@@ -0,0 +1,283 @@
+package openrouter
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// SchemaChangeKind classifies a difference between two versions of a schema
+type SchemaChangeKind string
+
+const (
+	SchemaFieldAdded      SchemaChangeKind = "field_added"
+	SchemaFieldRemoved    SchemaChangeKind = "field_removed"
+	SchemaTypeChanged     SchemaChangeKind = "type_changed"
+	SchemaRequiredChanged SchemaChangeKind = "required_changed"
+	SchemaNullableChanged SchemaChangeKind = "nullable_changed"
+	SchemaEnumNarrowed    SchemaChangeKind = "enum_narrowed"
+	SchemaEnumWidened     SchemaChangeKind = "enum_widened"
+)
+
+// SchemaRole is the side of a goal a schema describes, it decides which changes break compatibility
+type SchemaRole string
+
+const (
+	// SchemaRoleOutput schemas describe values produced by the model and read by code and other prompts,
+	// they may become stricter but not looser
+	SchemaRoleOutput SchemaRole = "output"
+	// SchemaRoleInput schemas describe values written by callers and read by prompts,
+	// they may become looser but not stricter
+	SchemaRoleInput SchemaRole = "input"
+)
+
+// SchemaChange is a single difference between two versions of a schema
+type SchemaChange struct {
+	Path     string           `json:"path"` // e.g. "user.name" or "tags[]", empty for the root
+	Kind     SchemaChangeKind `json:"kind"`
+	Breaking bool             `json:"breaking"`
+	Message  string           `json:"message"`
+}
+
+func (c SchemaChange) String() string {
+	path := c.Path
+	if path == "" {
+		path = "root"
+	}
+	compatibility := "compatible"
+	if c.Breaking {
+		compatibility = "breaking"
+	}
+	return fmt.Sprintf("%s: %s (%s)", path, c.Message, compatibility)
+}
+
+// DiffSchemas compares two versions of a schema and labels every change as backward compatible
+// or breaking for the role the schema plays, ordered by path
+func DiffSchemas(oldSchema, newSchema *Definition, role SchemaRole) []SchemaChange {
+	d := &schemaDiffer{
+		role:    role,
+		oldRoot: &schemaValidator{root: oldSchema},
+		newRoot: &schemaValidator{root: newSchema},
+		visited: make(map[string]bool),
+	}
+	d.diff("", oldSchema, newSchema, 0)
+	sort.SliceStable(d.changes, func(i, j int) bool { return d.changes[i].Path < d.changes[j].Path })
+	return d.changes
+}
+
+// BreakingChanges returns the breaking changes
+func BreakingChanges(changes []SchemaChange) []SchemaChange {
+	var breaking []SchemaChange
+	for _, change := range changes {
+		if change.Breaking {
+			breaking = append(breaking, change)
+		}
+	}
+	return breaking
+}
+
+type schemaDiffer struct {
+	role             SchemaRole
+	oldRoot, newRoot *schemaValidator // resolve $refs against each version's root
+	visited          map[string]bool  // reference pairs being compared, recursive schemas end there
+	changes          []SchemaChange
+}
+
+// breaks reports whether a change that loosens (or tightens) the schema is breaking for the role
+func (d *schemaDiffer) breaks(loosened bool) bool {
+	if d.role == SchemaRoleInput {
+		return !loosened
+	}
+	return loosened
+}
+
+func (d *schemaDiffer) add(path string, kind SchemaChangeKind, breaking bool, format string, args ...any) {
+	d.changes = append(d.changes, SchemaChange{Path: path, Kind: kind, Breaking: breaking, Message: fmt.Sprintf(format, args...)})
+}
+
+func (d *schemaDiffer) diff(path string, oldSchema, newSchema *Definition, depth int) {
+	if oldSchema == nil || newSchema == nil || depth >= maxRefDepth {
+		return
+	}
+	if oldSchema.Ref != "" || newSchema.Ref != "" {
+		key := oldSchema.Ref + "|" + newSchema.Ref
+		if d.visited[key] {
+			return
+		}
+		d.visited[key] = true
+		defer delete(d.visited, key)
+	}
+	oldSchema, newSchema = resolveSchemaRef(d.oldRoot, oldSchema), resolveSchemaRef(d.newRoot, newSchema)
+
+	oldTypes, newTypes := schemaTypes(oldSchema), schemaTypes(newSchema)
+	if !slices.Equal(oldTypes, newTypes) {
+		breaking := true
+		if coversTypes(newTypes, oldTypes) {
+			breaking = d.breaks(true)
+		} else if coversTypes(oldTypes, newTypes) {
+			breaking = d.breaks(false)
+		}
+		d.add(path, SchemaTypeChanged, breaking, "type changed from %s to %s", describeTypes(oldTypes), describeTypes(newTypes))
+		return
+	}
+
+	if oldSchema.Nullable != newSchema.Nullable {
+		if newSchema.Nullable {
+			d.add(path, SchemaNullableChanged, d.breaks(true), "null became allowed")
+		} else {
+			d.add(path, SchemaNullableChanged, d.breaks(false), "null is no longer allowed")
+		}
+	}
+	d.diffEnum(path, oldSchema.Enum, newSchema.Enum)
+
+	if oldSchema.Properties != nil || newSchema.Properties != nil {
+		d.diffProperties(path, oldSchema, newSchema, depth)
+	}
+	if oldSchema.Items != nil && newSchema.Items != nil {
+		d.diff(path+"[]", oldSchema.Items, newSchema.Items, depth+1)
+	}
+	// Alternatives of the same type are compared with each other
+	for _, oldOption := range slices.Concat(oldSchema.AnyOf, oldSchema.OneOf) {
+		for _, newOption := range slices.Concat(newSchema.AnyOf, newSchema.OneOf) {
+			if oldOption.Type != "" && oldOption.Type == newOption.Type {
+				d.diff(path, &oldOption, &newOption, depth+1)
+				break
+			}
+		}
+	}
+}
+
+func (d *schemaDiffer) diffEnum(path string, oldEnum, newEnum []string) {
+	switch {
+	case len(oldEnum) == 0 && len(newEnum) == 0:
+		return
+	case len(oldEnum) == 0:
+		d.add(path, SchemaEnumNarrowed, d.breaks(false), "values restricted to %s", strings.Join(newEnum, ", "))
+		return
+	case len(newEnum) == 0:
+		d.add(path, SchemaEnumWidened, d.breaks(true), "values no longer restricted to %s", strings.Join(oldEnum, ", "))
+		return
+	}
+
+	var removed, added []string
+	for _, value := range oldEnum {
+		if !slices.Contains(newEnum, value) {
+			removed = append(removed, value)
+		}
+	}
+	for _, value := range newEnum {
+		if !slices.Contains(oldEnum, value) {
+			added = append(added, value)
+		}
+	}
+	if len(removed) > 0 {
+		d.add(path, SchemaEnumNarrowed, d.breaks(false), "enum values removed: %s", strings.Join(removed, ", "))
+	}
+	if len(added) > 0 {
+		d.add(path, SchemaEnumWidened, d.breaks(true), "enum values added: %s", strings.Join(added, ", "))
+	}
+}
+
+func (d *schemaDiffer) diffProperties(path string, oldSchema, newSchema *Definition, depth int) {
+	names := make([]string, 0, len(oldSchema.Properties)+len(newSchema.Properties))
+	for name := range oldSchema.Properties {
+		names = append(names, name)
+	}
+	for name := range newSchema.Properties {
+		if _, ok := oldSchema.Properties[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fieldPath := name
+		if path != "" {
+			fieldPath = path + "." + name
+		}
+		oldField, inOld := oldSchema.Properties[name]
+		newField, inNew := newSchema.Properties[name]
+		oldRequired, newRequired := slices.Contains(oldSchema.Required, name), slices.Contains(newSchema.Required, name)
+
+		switch {
+		case !inNew:
+			// Readers lose a field they could rely on, writers still sending it are rejected when no other fields are allowed
+			breaking := oldRequired
+			if d.role == SchemaRoleInput {
+				additional, ok := newSchema.AdditionalProperties.(bool)
+				breaking = ok && !additional
+			}
+			d.add(fieldPath, SchemaFieldRemoved, breaking, "field removed")
+		case !inOld:
+			// Readers ignore new fields, writers don't send them yet
+			d.add(fieldPath, SchemaFieldAdded, d.role == SchemaRoleInput && newRequired, "field added")
+		default:
+			if oldRequired != newRequired {
+				if newRequired {
+					d.add(fieldPath, SchemaRequiredChanged, d.breaks(false), "field became required")
+				} else {
+					d.add(fieldPath, SchemaRequiredChanged, d.breaks(true), "field became optional")
+				}
+			}
+			d.diff(fieldPath, &oldField, &newField, depth+1)
+		}
+	}
+}
+
+// resolveSchemaRef follows the references of a schema, unresolvable references are returned as they are
+func resolveSchemaRef(root *schemaValidator, schema *Definition) *Definition {
+	for i := 0; schema.Ref != "" && i < maxRefDepth; i++ {
+		resolved, ok := root.resolve(schema.Ref)
+		if !ok {
+			break
+		}
+		schema = resolved
+	}
+	return schema
+}
+
+// schemaTypes returns the types a schema allows, nil when it allows any value
+func schemaTypes(schema *Definition) []DataType {
+	if schema.Type != "" {
+		return []DataType{schema.Type}
+	}
+	var types []DataType
+	for _, option := range slices.Concat(schema.AnyOf, schema.OneOf) {
+		if option.Type == "" {
+			return nil
+		}
+		if !slices.Contains(types, option.Type) {
+			types = append(types, option.Type)
+		}
+	}
+	slices.Sort(types)
+	return types
+}
+
+// coversTypes reports whether every value of the inner types is also allowed by the outer ones
+func coversTypes(outer, inner []DataType) bool {
+	if outer == nil {
+		return true
+	}
+	if inner == nil {
+		return false
+	}
+	for _, t := range inner {
+		if !slices.Contains(outer, t) && !(t == Integer && slices.Contains(outer, Number)) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeTypes(types []DataType) string {
+	if types == nil {
+		return "any"
+	}
+	names := make([]string, len(types))
+	for i, t := range types {
+		names[i] = string(t)
+	}
+	return strings.Join(names, " | ")
+}
@@ -0,0 +1,106 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func mustParseSchema(t *testing.T, schema string) *Definition {
+	t.Helper()
+	def, err := ParseSchema(json.RawMessage(schema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	return def
+}
+
+func changesByPath(changes []SchemaChange) map[string]SchemaChange {
+	byPath := make(map[string]SchemaChange, len(changes))
+	for _, change := range changes {
+		byPath[change.Path+"/"+string(change.Kind)] = change
+	}
+	return byPath
+}
+
+func TestDiffOutputSchemas(t *testing.T) {
+	oldSchema := mustParseSchema(t, `{"type":"object","properties":{
+		"label":{"type":"string","enum":["spam","ham","unsure"]},
+		"score":{"type":"integer"},
+		"reason":{"type":"string"},
+		"note":{"type":"string"},
+		"tags":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"}},"required":["name"]}}
+	},"required":["label","score","reason","tags"]}`)
+	newSchema := mustParseSchema(t, `{"type":"object","properties":{
+		"label":{"type":"string","enum":["spam","ham"]},
+		"score":{"type":"number"},
+		"reason":{"type":["string","null"]},
+		"tags":{"type":"array","items":{"type":"object","properties":{"name":{"type":"string"},"weight":{"type":"number"}},"required":[]}},
+		"summary":{"type":"string"}
+	},"required":["label","score","tags","summary"]}`)
+
+	changes := DiffSchemas(oldSchema, newSchema, SchemaRoleOutput)
+	expected := map[string]bool{
+		"label/enum_narrowed":          false,
+		"note/field_removed":           false,
+		"reason/nullable_changed":      true,
+		"reason/required_changed":      true,
+		"score/type_changed":           true,
+		"summary/field_added":          false,
+		"tags[].name/required_changed": true,
+		"tags[].weight/field_added":    false,
+	}
+	byPath := changesByPath(changes)
+	if len(changes) != len(expected) {
+		t.Errorf("Expected %d changes, got %v", len(expected), changes)
+	}
+	for key, breaking := range expected {
+		change, ok := byPath[key]
+		if !ok {
+			t.Errorf("Expected a change %s, got %v", key, changes)
+			continue
+		}
+		if change.Breaking != breaking {
+			t.Errorf("Expected %s breaking=%v, got %v", key, breaking, change)
+		}
+	}
+	if len(BreakingChanges(changes)) != 4 {
+		t.Errorf("Expected 4 breaking changes, got %v", BreakingChanges(changes))
+	}
+	if got := byPath["score/type_changed"].String(); got != "score: type changed from integer to number (breaking)" {
+		t.Errorf("Unexpected change description %q", got)
+	}
+}
+
+func TestDiffInputSchemas(t *testing.T) {
+	oldSchema := mustParseSchema(t, `{"type":"object","properties":{"text":{"type":"string"},"lang":{"type":"string","enum":["en","de"]}},"required":["text"],"additionalProperties":false}`)
+	newSchema := mustParseSchema(t, `{"type":"object","properties":{"text":{"type":"string"},"lang":{"type":"string","enum":["en"]},"tone":{"type":"string"}},"required":["text","tone"],"additionalProperties":false}`)
+
+	byPath := changesByPath(DiffSchemas(oldSchema, newSchema, SchemaRoleInput))
+	if !byPath["lang/enum_narrowed"].Breaking {
+		t.Error("Narrowing an input enum should break callers")
+	}
+	if !byPath["tone/field_added"].Breaking {
+		t.Error("Adding a required input field should break callers")
+	}
+
+	byPath = changesByPath(DiffSchemas(newSchema, oldSchema, SchemaRoleInput))
+	if byPath["lang/enum_widened"].Breaking || !byPath["tone/field_removed"].Breaking {
+		t.Errorf("Expected widening to be compatible and removing a field of a closed object to break, got %v", byPath)
+	}
+}
+
+func TestDiffSchemasRefsAndUnions(t *testing.T) {
+	oldSchema := mustParseSchema(t, `{"$ref":"#/$defs/node","$defs":{"node":{"type":"object","properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#/$defs/node"}}},"required":["name"]}}}`)
+	newSchema := mustParseSchema(t, `{"$ref":"#/$defs/node","$defs":{"node":{"type":"object","properties":{"name":{"anyOf":[{"type":"string"},{"type":"integer"}]},"children":{"type":"array","items":{"$ref":"#/$defs/node"}}},"required":["name"]}}}`)
+
+	changes := DiffSchemas(oldSchema, newSchema, SchemaRoleOutput)
+	if len(changes) != 1 || changes[0].Path != "name" || changes[0].Kind != SchemaTypeChanged || !changes[0].Breaking {
+		t.Errorf("Expected widening a recursive field to a union to break outputs once, got %v", changes)
+	}
+	if changes := DiffSchemas(newSchema, oldSchema, SchemaRoleOutput); len(BreakingChanges(changes)) != 0 {
+		t.Errorf("Expected narrowing an output union to be compatible, got %v", changes)
+	}
+	if changes := DiffSchemas(oldSchema, oldSchema, SchemaRoleOutput); len(changes) != 0 {
+		t.Errorf("Expected no changes between identical schemas, got %v", changes)
+	}
+}
@@ -0,0 +1,57 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ParseSchema parses a JSON Schema document, e.g. one written by hand in a config file or the frontend
+func ParseSchema(schema json.RawMessage) (*Definition, error) {
+	if len(schema) == 0 {
+		return nil, errors.New("empty JSON schema")
+	}
+	var def Definition
+	if err := json.Unmarshal(schema, &def); err != nil {
+		return nil, fmt.Errorf("invalid JSON schema: %w", err)
+	}
+	return &def, nil
+}
+
+// IsStrictSchema reports whether a schema can be sent in strict mode: every object has to
+// disallow additional properties and list all of its properties as required
+func IsStrictSchema(d *Definition) bool {
+	if d == nil {
+		return true
+	}
+	if d.Type == Object || len(d.Properties) > 0 {
+		if additional, ok := d.AdditionalProperties.(bool); !ok || additional {
+			return false
+		}
+		for name := range d.Properties {
+			if !slices.Contains(d.Required, name) {
+				return false
+			}
+		}
+	}
+
+	for _, property := range d.Properties {
+		if !IsStrictSchema(&property) {
+			return false
+		}
+	}
+	for _, options := range [][]Definition{d.AnyOf, d.OneOf, d.AllOf} {
+		for i := range options {
+			if !IsStrictSchema(&options[i]) {
+				return false
+			}
+		}
+	}
+	for _, def := range d.Defs {
+		if !IsStrictSchema(&def) {
+			return false
+		}
+	}
+	return IsStrictSchema(d.Items)
+}
@@ -0,0 +1,60 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(json.RawMessage(`{"type":"object","properties":{"tags":{"type":"array","items":{"type":"string"}}},"required":["tags"]}`))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+	if schema.Properties["tags"].Items.Type != String {
+		t.Errorf("Expected nested schemas to be parsed, got %+v", schema.Properties["tags"])
+	}
+
+	for _, invalid := range []string{``, `{"type": 42}`, `[1, 2]`} {
+		if _, err := ParseSchema(json.RawMessage(invalid)); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestIsStrictSchema(t *testing.T) {
+	cases := []struct {
+		schema   string
+		expected bool
+	}{
+		{`{"type":"object","properties":{"a":{"type":"string"}},"required":["a"],"additionalProperties":false}`, true},
+		{`{"type":"object","properties":{"a":{"type":"string"}},"required":[],"additionalProperties":false}`, false},
+		{`{"type":"object","properties":{"a":{"type":"string"}},"required":["a"]}`, false},
+		{`{"type":"array","items":{"type":"object","properties":{"b":{"type":"integer"}},"additionalProperties":false}}`, false},
+		{`{"anyOf":[{"type":"string"},{"type":"object","properties":{},"additionalProperties":false}]}`, true},
+	}
+	for _, c := range cases {
+		schema, err := ParseSchema(json.RawMessage(c.schema))
+		if err != nil {
+			t.Fatalf("ParseSchema failed: %v", err)
+		}
+		if got := IsStrictSchema(schema); got != c.expected {
+			t.Errorf("IsStrictSchema(%s) = %v, expected %v", c.schema, got, c.expected)
+		}
+	}
+
+	format, err := UseOpenRouterJsonFormatFromSchema(&Definition{Type: Object, Properties: map[string]Definition{"a": {Type: String}}}, "optional fields")
+	if err != nil {
+		t.Fatalf("UseOpenRouterJsonFormatFromSchema failed: %v", err)
+	}
+	if !strings.Contains(string(format), `"strict":false`) || !strings.Contains(string(format), `"name":"optional_fields"`) {
+		t.Errorf("Expected schemas with optional fields to be sent without strict mode, got %s", format)
+	}
+}
+
+func TestUniversalPromptWithoutExamples(t *testing.T) {
+	prompt := GenerateUniversalSystemPrompt(map[string]interface{}{"type": "object"}, nil, json.RawMessage(`{"a": 1}`))
+	if strings.Contains(prompt, "INPUT EXAMPLE") || !strings.Contains(prompt, "EXPECTED OUTPUT EXAMPLE:\n{\"a\": 1}") {
+		t.Errorf("Expected only the given examples in the prompt, got %s", prompt)
+	}
+}
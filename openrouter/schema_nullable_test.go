@@ -0,0 +1,110 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type optionalFields struct {
+	Name     string   `json:"name"`
+	Nickname string   `json:"nickname,omitempty"`
+	Age      *int     `json:"age"`
+	Email    *string  `json:"email" required:"true"`
+	Tags     []string `json:"tags" required:"false"`
+}
+
+func requiredSet(d *Definition) map[string]bool {
+	set := make(map[string]bool, len(d.Required))
+	for _, name := range d.Required {
+		set[name] = true
+	}
+	return set
+}
+
+func TestReflectOptionalFields(t *testing.T) {
+	schema, err := GenerateSchemaForType(optionalFields{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+
+	required := requiredSet(schema)
+	for name, expected := range map[string]bool{"name": true, "nickname": false, "age": false, "email": true, "tags": false} {
+		if required[name] != expected {
+			t.Errorf("Expected %s required=%v, got %v", name, expected, required[name])
+		}
+	}
+	for name, expected := range map[string]bool{"name": false, "nickname": false, "age": true, "email": true, "tags": false} {
+		if schema.Properties[name].Nullable != expected {
+			t.Errorf("Expected %s nullable=%v, got %v", name, expected, schema.Properties[name].Nullable)
+		}
+	}
+
+	if err := ValidateValue(map[string]any{"name": "ada", "email": nil}, schema); len(err) != 0 {
+		t.Errorf("Expected optional fields to be omittable and pointers nullable, got %v", err)
+	}
+	if err := ValidateValue(map[string]any{"name": "ada"}, schema); len(err) == 0 {
+		t.Error("Expected a missing required pointer field to fail")
+	}
+}
+
+func TestReflectStrictOptionalFields(t *testing.T) {
+	schema, err := GenerateSchemaForTypeWithOptions(optionalFields{}, SchemaOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForTypeWithOptions failed: %v", err)
+	}
+
+	if len(schema.Required) != len(schema.Properties) {
+		t.Errorf("Expected strict schemas to require every property, got %v", schema.Required)
+	}
+	for name, expected := range map[string]bool{"name": false, "nickname": true, "age": true, "email": true, "tags": true} {
+		if schema.Properties[name].Nullable != expected {
+			t.Errorf("Expected %s nullable=%v, got %v", name, expected, schema.Properties[name].Nullable)
+		}
+	}
+
+	encoded, _ := json.Marshal(schema.Properties["nickname"])
+	if !strings.Contains(string(encoded), `"type":["string","null"]`) {
+		t.Errorf("Expected a nullable field to marshal as a type union, got %s", encoded)
+	}
+	if err := ValidateValue(map[string]any{"name": "ada", "nickname": nil, "age": nil, "email": nil, "tags": nil}, schema); len(err) != 0 {
+		t.Errorf("Expected optional fields to accept null in strict mode, got %v", err)
+	}
+	if err := ValidateValue(map[string]any{"name": "ada"}, schema); len(err) == 0 {
+		t.Error("Expected strict schemas to reject missing fields")
+	}
+}
+
+func TestJSONExampleNullProperties(t *testing.T) {
+	example := json.RawMessage(`{"title": "x", "subtitle": null, "items": [{"note": null}]}`)
+
+	schema, err := GenerateSchemaFromJSONExample(example)
+	if err != nil {
+		t.Fatalf("GenerateSchemaFromJSONExample failed: %v", err)
+	}
+	required := requiredSet(schema)
+	if !required["title"] || required["subtitle"] {
+		t.Errorf("Expected null example properties to be optional, got required %v", schema.Required)
+	}
+	if subtitle := schema.Properties["subtitle"]; !subtitle.Nullable || len(subtitle.AnyOf) != 3 {
+		t.Errorf("Expected a nullable scalar for a null example, got %+v", subtitle)
+	}
+	if err := ValidateValue(map[string]any{"title": "x", "subtitle": 3.0, "items": []any{map[string]any{}}}, schema); len(err) != 0 {
+		t.Errorf("Expected null example properties to accept scalars and be omittable, got %v", err)
+	}
+
+	strict, err := GenerateSchemaFromJSONExampleWithOptions(example, SchemaOptions{Strict: true})
+	if err != nil {
+		t.Fatalf("GenerateSchemaFromJSONExampleWithOptions failed: %v", err)
+	}
+	if !requiredSet(strict)["subtitle"] || !requiredSet(strict.Properties["items"].Items)["note"] {
+		t.Errorf("Expected strict schemas to require null example properties, got %v", strict.Required)
+	}
+	encoded, _ := json.Marshal(strict.Properties["subtitle"])
+	if !strings.Contains(string(encoded), `{"type":"null"}`) {
+		t.Errorf("Expected a nullable anyOf to gain a null option, got %s", encoded)
+	}
+	if err := ValidateValue(map[string]any{"title": "x", "subtitle": nil, "items": []any{map[string]any{"note": "y"}}}, strict); len(err) != 0 {
+		t.Errorf("Expected null to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type auditFields struct {
+	CreatedAt time.Time `json:"createdAt"`
+	Author    string    `json:"author"`
+	Note      string    `json:"note,omitempty"`
+}
+
+type hiddenBase struct {
+	Source string `json:"source"`
+}
+
+type document struct {
+	auditFields
+	*hiddenBase
+	Author   int                `json:"author"` // shadows the embedded field
+	Title    string             `json:"title"`
+	Secret   string             `json:"-"`
+	Dash     string             `json:"-,"`
+	Count    int64              `json:"count,string"`
+	Scores   map[string]float64 `json:"scores"`
+	Extra    map[int]any        `json:"extra,omitempty"`
+	Payload  json.RawMessage    `json:"payload"`
+	Data     []byte             `json:"data"`
+	Anything interface{}        `json:"anything"`
+	Due      *time.Time         `json:"due"`
+}
+
+type treeNode struct {
+	Name     string     `json:"name"`
+	Children []treeNode `json:"children"`
+}
+
+type forest struct {
+	Trees []treeNode `json:"trees"`
+	Best  *treeNode  `json:"best,omitempty"`
+}
+
+type genericNode[T any] struct {
+	Value    T                `json:"value"`
+	Children []genericNode[T] `json:"children"`
+}
+
+type genericForest struct {
+	Counts genericNode[int]    `json:"counts"`
+	Labels genericNode[string] `json:"labels"`
+}
+
+func TestReflectSpecialTypesAndFields(t *testing.T) {
+	schema, err := GenerateSchemaForType(document{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+	props := schema.Properties
+
+	if _, ok := props["Secret"]; ok {
+		t.Error(`Expected json:"-" fields to be skipped`)
+	}
+	if _, ok := props["-"]; !ok {
+		t.Error(`Expected json:"-," to name the field "-"`)
+	}
+	if props["createdAt"].Type != String || props["createdAt"].Format != "date-time" || props["due"].Format != "date-time" {
+		t.Errorf("Expected times to be date-time strings, got %+v", props["createdAt"])
+	}
+	if props["author"].Type != Integer {
+		t.Errorf("Expected the outer field to shadow the promoted one, got %+v", props["author"])
+	}
+	if props["source"].Type != String || props["note"].Type != String {
+		t.Error("Expected fields of embedded structs to be promoted")
+	}
+	for _, name := range []string{"createdAt", "source", "title"} {
+		if !strings.Contains(strings.Join(schema.Required, ","), name) {
+			t.Errorf("Expected %s to be required, got %v", name, schema.Required)
+		}
+	}
+	if strings.Contains(strings.Join(schema.Required, ","), "note") {
+		t.Error("Expected promoted omitempty fields to stay optional")
+	}
+	if props["count"].Type != String {
+		t.Errorf(`Expected ",string" numbers to be strings, got %+v`, props["count"])
+	}
+	if values, ok := props["scores"].AdditionalProperties.(Definition); !ok || props["scores"].Type != Object || values.Type != Number {
+		t.Errorf("Expected maps to use additionalProperties, got %+v", props["scores"])
+	}
+	if props["payload"].Type != "" || props["anything"].Type != "" || props["data"].Type != String {
+		t.Error("Expected raw messages and interfaces to accept any value and bytes to be strings")
+	}
+
+	valid := `{"createdAt": "2024-01-01T00:00:00Z", "author": 7, "source": "web", "title": "t", "-": "d", "count": "12",
+		"scores": {"a": 1.5}, "extra": {"1": [true]}, "payload": {"any": ["thing"]}, "data": "aGk=", "anything": null, "due": "2024-02-01T00:00:00Z"}`
+	if err := ValidateJSONAgainstSchema(json.RawMessage(valid), schema); err != nil {
+		t.Errorf("Expected a value encoded by encoding/json to be valid: %v", err)
+	}
+	if err := ValidateJSONAgainstSchema(json.RawMessage(strings.Replace(valid, `{"a": 1.5}`, `{"a": "high"}`, 1)), schema); err == nil || !strings.Contains(err.Error(), "/scores/a") {
+		t.Errorf("Expected map values to be validated, got %v", err)
+	}
+}
+
+func TestReflectRecursiveTypes(t *testing.T) {
+	schema, err := GenerateSchemaForType(treeNode{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+	if schema.Properties["children"].Items.Ref != "#" || len(schema.Defs) != 0 {
+		t.Errorf("Expected the root type to reference itself, got %+v", schema.Properties["children"])
+	}
+
+	schema, err = GenerateSchemaForType(&forest{})
+	if err != nil {
+		t.Fatalf("GenerateSchemaForType failed: %v", err)
+	}
+	if schema.Properties["trees"].Items.Ref != "#/$defs/treeNode" || schema.Properties["best"].Ref != "#/$defs/treeNode" {
+		t.Errorf("Expected references to the definition, got %+v", schema.Properties)
+	}
+	node, ok := schema.Defs["treeNode"]
+	if !ok || node.Properties["children"].Items.Ref != "#/$defs/treeNode" {
+		t.Fatalf("Expected the recursive type in $defs, got %+v", schema.Defs)
+	}
+
+	encoded, _ := json.Marshal(schema)
+	if !strings.Contains(string(encoded), `"$defs":{"treeNode":`) {
+		t.Errorf("Expected $defs in the schema JSON, got %s", encoded)
+	}
+	valid := `{"trees": [{"name": "a", "children": [{"name": "b", "children": []}]}]}`
+	if err := ValidateJSONAgainstSchema(json.RawMessage(valid), schema); err != nil {
+		t.Errorf("Expected the nested tree to be valid: %v", err)
+	}
+	invalid := `{"trees": [{"name": "a", "children": [{"name": 1, "children": []}]}]}`
+	if err := ValidateJSONAgainstSchema(json.RawMessage(invalid), schema); err == nil || !strings.Contains(err.Error(), "/trees/0/children/0/name") {
+		t.Errorf("Expected nested violations to be found, got %v", err)
+	}
+}
+
+func TestReflectRecursiveTypeNames(t *testing.T) {
+	for range 3 {
+		schema, err := GenerateSchemaForType(genericForest{})
+		if err != nil {
+			t.Fatalf("GenerateSchemaForType failed: %v", err)
+		}
+		// Generic instantiations share the type name without their package qualified arguments
+		if schema.Properties["counts"].Ref != "#/$defs/genericNode" || schema.Properties["labels"].Ref != "#/$defs/genericNode2" {
+			t.Fatalf("Expected stable definition names in field order, got %+v", schema.Properties)
+		}
+		if schema.Defs["genericNode2"].Properties["value"].Type != String {
+			t.Errorf("Expected genericNode2 to be the string instantiation, got %+v", schema.Defs["genericNode2"])
+		}
+	}
+
+	// Types without a name are named after the field they appear in, then numbered
+	r := &schemaReflector{defNames: make(map[reflect.Type]string), owner: reflect.TypeOf(forest{}), fieldName: "Best"}
+	if ref := r.refFor(reflect.TypeOf(struct{ A int }{})); ref != "#/$defs/forestBest" {
+		t.Errorf("Expected the owner and field name, got %s", ref)
+	}
+	if ref := r.refFor(reflect.TypeOf(struct{ B int }{})); ref != "#/$defs/forestBest2" {
+		t.Errorf("Expected a numbered name after a collision, got %s", ref)
+	}
+}
+
+func TestReflectUnsupportedTypes(t *testing.T) {
+	cases := map[string]any{
+		"channel":        struct{ C chan int }{},
+		"function":       struct{ F func() }{},
+		"complex":        complex64(1),
+		"struct map key": map[struct{ A int }]string{},
+	}
+	for name, value := range cases {
+		if _, err := GenerateSchemaForType(value); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package openrouter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// StreamEventType identifies the kind of a StreamEvent.
+type StreamEventType string
+
+const (
+	StreamEventTextDelta         StreamEventType = "text_delta"
+	StreamEventReasoningDelta    StreamEventType = "reasoning_delta"
+	StreamEventToolCallStarted   StreamEventType = "tool_call_started"
+	StreamEventToolCallCompleted StreamEventType = "tool_call_completed"
+	StreamEventFinish            StreamEventType = "finish"
+	StreamEventUsage             StreamEventType = "usage"
+)
+
+// StreamEvent is a higher level event built from streaming chunks.
+// Only the fields relevant to the event type are set.
+type StreamEvent struct {
+	Type        StreamEventType
+	ChoiceIndex int
+
+	Text string // text or reasoning fragment for delta events
+
+	ToolCall  *ToolCall       // tool call for tool call events, arguments are complete on StreamEventToolCallCompleted
+	Arguments json.RawMessage // parsed tool call arguments on StreamEventToolCallCompleted
+	ArgsError error           // set when the assembled arguments are not valid JSON
+
+	FinishReason string         // for StreamEventFinish
+	Usage        *ResponseUsage // for StreamEventUsage
+}
+
+// StreamAccumulator stitches streaming chunks back together.
+// Feed every chunk to Add in order, then call Finish once the stream is closed
+// and read the assembled result from Response.
+type StreamAccumulator struct {
+	base    OpenRouterBaseResponse
+	choices map[int]*accumulatedChoice
+}
+
+type accumulatedChoice struct {
+	role         string
+	content      strings.Builder
+	hasContent   bool
+	reasoning    strings.Builder
+	hasReasoning bool
+	finish       BaseChoice
+	toolCalls    map[int]*accumulatedToolCall
+	toolOrder    []int
+}
+
+type accumulatedToolCall struct {
+	call      ToolCall
+	arguments strings.Builder
+	completed bool
+}
+
+// NewStreamAccumulator creates an empty accumulator.
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{choices: make(map[int]*accumulatedChoice)}
+}
+
+// Add merges a chunk into the accumulated response and returns the events it produced.
+func (a *StreamAccumulator) Add(chunk *StreamingChatResponse) []StreamEvent {
+	if chunk == nil {
+		return nil
+	}
+	var events []StreamEvent
+
+	if chunk.ID != "" {
+		a.base.ID = chunk.ID
+	}
+	if chunk.Created != 0 {
+		a.base.Created = chunk.Created
+	}
+	if chunk.Model != "" {
+		a.base.Model = chunk.Model
+	}
+	if chunk.SystemFingerprint != nil {
+		a.base.SystemFingerprint = chunk.SystemFingerprint
+	}
+
+	for i, streamChoice := range chunk.Choices {
+		choice := a.choice(i)
+		delta := streamChoice.Delta
+
+		if delta.Role != nil && *delta.Role != "" {
+			choice.role = *delta.Role
+		}
+		if delta.Reasoning != nil && *delta.Reasoning != "" {
+			choice.reasoning.WriteString(*delta.Reasoning)
+			choice.hasReasoning = true
+			events = append(events, StreamEvent{Type: StreamEventReasoningDelta, ChoiceIndex: i, Text: *delta.Reasoning})
+		}
+		if delta.Content != nil && *delta.Content != "" {
+			choice.content.WriteString(*delta.Content)
+			choice.hasContent = true
+			events = append(events, StreamEvent{Type: StreamEventTextDelta, ChoiceIndex: i, Text: *delta.Content})
+		}
+
+		for _, toolDelta := range delta.ToolCalls {
+			index := len(choice.toolOrder)
+			if toolDelta.Index != nil {
+				index = *toolDelta.Index
+			} else if toolDelta.ID == "" && len(choice.toolOrder) > 0 {
+				// Continuation fragments without an index belong to the latest call
+				index = choice.toolOrder[len(choice.toolOrder)-1]
+			}
+
+			call, ok := choice.toolCalls[index]
+			if !ok {
+				// A new tool call means all earlier calls of this choice are complete
+				events = append(events, choice.completeToolCalls(i)...)
+				call = &accumulatedToolCall{call: ToolCall{Type: "function"}}
+				choice.toolCalls[index] = call
+				choice.toolOrder = append(choice.toolOrder, index)
+			}
+			if toolDelta.ID != "" {
+				call.call.ID = toolDelta.ID
+			}
+			if toolDelta.Type != "" {
+				call.call.Type = toolDelta.Type
+			}
+			if toolDelta.Function.Name != nil {
+				call.call.Function.Name += *toolDelta.Function.Name
+			}
+			call.arguments.WriteString(toolDelta.Function.Arguments)
+
+			if !ok {
+				started := call.call
+				events = append(events, StreamEvent{Type: StreamEventToolCallStarted, ChoiceIndex: i, ToolCall: &started})
+			}
+		}
+
+		if streamChoice.FinishReason != nil {
+			events = append(events, choice.completeToolCalls(i)...)
+			choice.finish = streamChoice.BaseChoice
+			events = append(events, StreamEvent{Type: StreamEventFinish, ChoiceIndex: i, FinishReason: *streamChoice.FinishReason})
+		} else if streamChoice.Error != nil {
+			choice.finish.Error = streamChoice.Error
+		}
+	}
+
+	if chunk.Usage != nil {
+		a.base.Usage = chunk.Usage
+		events = append(events, StreamEvent{Type: StreamEventUsage, Usage: chunk.Usage})
+	}
+
+	return events
+}
+
+// Finish completes any tool calls that were still open when the stream ended,
+// e.g. because the provider never sent a finish reason.
+func (a *StreamAccumulator) Finish() []StreamEvent {
+	var events []StreamEvent
+	for _, i := range a.choiceIndexes() {
+		events = append(events, a.choices[i].completeToolCalls(i)...)
+	}
+	return events
+}
+
+// Response returns the assembled response in the same shape as a non streaming call.
+func (a *StreamAccumulator) Response() *NonStreamingChatResponse {
+	response := &NonStreamingChatResponse{OpenRouterBaseResponse: a.base}
+	response.Object = "chat.completion"
+
+	for _, i := range a.choiceIndexes() {
+		choice := a.choices[i]
+		message := ResponseMessage{Role: choice.role}
+		if message.Role == "" {
+			message.Role = "assistant"
+		}
+		if choice.hasContent {
+			content := choice.content.String()
+			message.Content = &content
+		}
+		if choice.hasReasoning {
+			reasoning := choice.reasoning.String()
+			message.Reasoning = &reasoning
+		}
+		for _, index := range choice.toolOrder {
+			call := choice.toolCalls[index]
+			toolCall := call.call
+			toolCall.Function.Arguments = call.arguments.String()
+			message.ToolCalls = append(message.ToolCalls, toolCall)
+		}
+		response.Choices = append(response.Choices, NonStreamingChatChoice{
+			BaseChoice: choice.finish,
+			Message:    message,
+		})
+	}
+	return response
+}
+
+func (a *StreamAccumulator) choice(i int) *accumulatedChoice {
+	choice, ok := a.choices[i]
+	if !ok {
+		choice = &accumulatedChoice{toolCalls: make(map[int]*accumulatedToolCall)}
+		a.choices[i] = choice
+	}
+	return choice
+}
+
+func (a *StreamAccumulator) choiceIndexes() []int {
+	indexes := make([]int, 0, len(a.choices))
+	for i := range a.choices {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// completeToolCalls emits a completion event for every tool call that has not been completed yet.
+func (c *accumulatedChoice) completeToolCalls(choiceIndex int) []StreamEvent {
+	var events []StreamEvent
+	for _, index := range c.toolOrder {
+		call := c.toolCalls[index]
+		if call.completed {
+			continue
+		}
+		call.completed = true
+
+		completed := call.call
+		completed.Function.Arguments = call.arguments.String()
+		event := StreamEvent{Type: StreamEventToolCallCompleted, ChoiceIndex: choiceIndex, ToolCall: &completed}
+
+		arguments := strings.TrimSpace(completed.Function.Arguments)
+		if arguments == "" {
+			arguments = "{}"
+		}
+		if json.Valid([]byte(arguments)) {
+			event.Arguments = json.RawMessage(arguments)
+		} else {
+			event.ArgsError = fmt.Errorf("tool call %q has invalid JSON arguments: %s", completed.Function.Name, completed.Function.Arguments)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// AccumulateStream drains a stream from GenerateStreamingChatResponse, calling onEvent
+// for every event if it is not nil, and returns the assembled response.
+func AccumulateStream(stream <-chan *StreamingChatResponse, onEvent func(StreamEvent)) (*NonStreamingChatResponse, error) {
+	if stream == nil {
+		return nil, fmt.Errorf("stream channel is nil")
+	}
+	accumulator := NewStreamAccumulator()
+	received := false
+	for chunk := range stream {
+		received = true
+		for _, event := range accumulator.Add(chunk) {
+			if onEvent != nil {
+				onEvent(event)
+			}
+		}
+	}
+	for _, event := range accumulator.Finish() {
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+	if !received {
+		return nil, fmt.Errorf("stream closed without any chunks")
+	}
+	return accumulator.Response(), nil
+}
+
+// GenerateStreamingChatResponseAccumulated streams a chat completion, reporting events as they
+// arrive, and returns the assembled response once the stream ends.
+func (o *OpenRouter) GenerateStreamingChatResponseAccumulated(ctx context.Context, request *OpenRouterRequest, onEvent func(StreamEvent)) (*NonStreamingChatResponse, error) {
+	stream, err := o.GenerateStreamingChatResponse(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	return AccumulateStream(stream, onEvent)
+}
@@ -0,0 +1,129 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func streamChunks(t *testing.T, lines ...string) <-chan *StreamingChatResponse {
+	t.Helper()
+	ch := make(chan *StreamingChatResponse, len(lines))
+	for _, line := range lines {
+		var chunk StreamingChatResponse
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			t.Fatalf("Failed to decode chunk %s: %v", line, err)
+		}
+		ch <- &chunk
+	}
+	close(ch)
+	return ch
+}
+
+func TestAccumulateStreamToolCalls(t *testing.T) {
+	stream := streamChunks(t,
+		`{"id":"gen-1","created":10,"model":"openai/gpt-4o","choices":[{"delta":{"role":"assistant","content":"Let me "}}]}`,
+		`{"id":"gen-1","choices":[{"delta":{"content":"check."}}]}`,
+		`{"id":"gen-1","choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`{"id":"gen-1","choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"id":"","type":"","function":{"arguments":"{\"city\":"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"id":"","type":"","function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"delta":{"content":null,"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"get_time","arguments":"{}"}}]}}]}`,
+		`{"id":"gen-1","choices":[{"finish_reason":"tool_calls","delta":{"content":null}}]}`,
+		`{"id":"gen-1","choices":[],"usage":{"prompt_tokens":12,"completion_tokens":8,"total_tokens":20}}`,
+	)
+
+	var events []StreamEvent
+	response, err := AccumulateStream(stream, func(event StreamEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("AccumulateStream failed: %v", err)
+	}
+
+	var order []StreamEventType
+	for _, event := range events {
+		order = append(order, event.Type)
+	}
+	expected := []StreamEventType{
+		StreamEventTextDelta, StreamEventTextDelta,
+		StreamEventToolCallStarted,
+		StreamEventToolCallCompleted, StreamEventToolCallStarted,
+		StreamEventToolCallCompleted, StreamEventFinish,
+		StreamEventUsage,
+	}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected events %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Fatalf("Expected events %v, got %v", expected, order)
+		}
+	}
+
+	first := events[3]
+	if first.ToolCall.ID != "call_a" || first.ToolCall.Function.Name != "get_weather" {
+		t.Errorf("Unexpected completed tool call: %+v", first.ToolCall)
+	}
+	var args struct {
+		City string `json:"city"`
+	}
+	if err := json.Unmarshal(first.Arguments, &args); err != nil || args.City != "Paris" {
+		t.Errorf("Expected parsed arguments with city Paris, got %s (%v)", first.Arguments, err)
+	}
+	if events[6].FinishReason != "tool_calls" {
+		t.Errorf("Expected finish reason tool_calls, got %q", events[6].FinishReason)
+	}
+
+	if response.ID != "gen-1" || response.Model != "openai/gpt-4o" || response.Created != 10 {
+		t.Errorf("Unexpected response header: %+v", response.OpenRouterBaseResponse)
+	}
+	if response.Usage == nil || response.Usage.TotalTokens != 20 {
+		t.Errorf("Expected usage to be kept, got %+v", response.Usage)
+	}
+	if len(response.Choices) != 1 {
+		t.Fatalf("Expected one choice, got %d", len(response.Choices))
+	}
+	message := response.Choices[0].Message
+	if message.Content == nil || *message.Content != "Let me check." {
+		t.Errorf("Expected assembled content, got %v", message.Content)
+	}
+	if len(message.ToolCalls) != 2 {
+		t.Fatalf("Expected two tool calls, got %d", len(message.ToolCalls))
+	}
+	if message.ToolCalls[0].Function.Arguments != `{"city":"Paris"}` || message.ToolCalls[1].Function.Name != "get_time" {
+		t.Errorf("Unexpected assembled tool calls: %+v", message.ToolCalls)
+	}
+	if response.Choices[0].FinishReason == nil || *response.Choices[0].FinishReason != "tool_calls" {
+		t.Errorf("Expected finish reason on the assembled choice, got %v", response.Choices[0].FinishReason)
+	}
+}
+
+func TestAccumulateStreamInvalidArgumentsAndMissingFinish(t *testing.T) {
+	stream := streamChunks(t,
+		`{"id":"gen-2","choices":[{"delta":{"content":null,"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"broken","arguments":"{\"a\":"}}]}}]}`,
+	)
+
+	var completed []StreamEvent
+	response, err := AccumulateStream(stream, func(event StreamEvent) {
+		if event.Type == StreamEventToolCallCompleted {
+			completed = append(completed, event)
+		}
+	})
+	if err != nil {
+		t.Fatalf("AccumulateStream failed: %v", err)
+	}
+	if len(completed) != 1 {
+		t.Fatalf("Expected the open tool call to be completed at the end of the stream, got %d", len(completed))
+	}
+	if completed[0].ArgsError == nil || completed[0].Arguments != nil {
+		t.Errorf("Expected an argument error for invalid JSON, got %+v", completed[0])
+	}
+	if response.Choices[0].Message.Content != nil {
+		t.Errorf("Expected no content, got %q", *response.Choices[0].Message.Content)
+	}
+}
+
+func TestAccumulateStreamEmpty(t *testing.T) {
+	if _, err := AccumulateStream(streamChunks(t), nil); err == nil {
+		t.Error("Expected an error for a stream without chunks")
+	}
+}
@@ -0,0 +1,474 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// StructuredOutputMode is the way a model is asked for output matching a schema
+type StructuredOutputMode string
+
+const (
+	// StructuredOutputJSONSchema sends the schema as a json_schema response format
+	StructuredOutputJSONSchema StructuredOutputMode = "json_schema"
+	// StructuredOutputTool exposes the schema as the parameters of a single function tool the model is forced to call
+	StructuredOutputTool StructuredOutputMode = "tool"
+	// StructuredOutputJSONObject only asks for a JSON object, the schema has to be described in the prompt
+	StructuredOutputJSONObject StructuredOutputMode = "json_object"
+	// StructuredOutputPrompt sends no format at all, the schema has to be described in the prompt
+	StructuredOutputPrompt StructuredOutputMode = "prompt"
+)
+
+// ProviderFamily groups models whose APIs accept the same JSON Schema dialect
+type ProviderFamily string
+
+const (
+	ProviderOpenAI    ProviderFamily = "openai"
+	ProviderGoogle    ProviderFamily = "google"
+	ProviderAnthropic ProviderFamily = "anthropic"
+	ProviderGeneric   ProviderFamily = "generic"
+)
+
+// ModelProviderFamily returns the provider family of an OpenRouter model ID like "openai/gpt-4o"
+func ModelProviderFamily(modelID string) ProviderFamily {
+	author, _, _ := strings.Cut(modelID, "/")
+	switch ProviderFamily(author) {
+	case ProviderOpenAI, ProviderGoogle, ProviderAnthropic:
+		return ProviderFamily(author)
+	}
+	return ProviderGeneric
+}
+
+// SupportsJSONObjectOutput checks if a model accepts a json_object response format
+// The synced model catalog is consulted first, models it does not know are assumed to support it when they support structured output
+func SupportsJSONObjectOutput(modelID string) bool {
+	if modelID == "" {
+		return false
+	}
+	if info, ok := DefaultModelCatalog.Get(modelID); ok {
+		return info.SupportsParameter("response_format")
+	}
+	return SupportsStructuredOutput(modelID)
+}
+
+// SelectStructuredOutputMode picks how structured output is requested from a model. Anthropic models
+// answer through a forced tool call, other models use json_schema when they support it, then a forced
+// tool call, then json_object, and prompting only when they support none of them.
+func SelectStructuredOutputMode(modelID string) StructuredOutputMode {
+	switch {
+	case ModelProviderFamily(modelID) == ProviderAnthropic && SupportsToolCalling(modelID):
+		return StructuredOutputTool
+	case SupportsStructuredOutput(modelID):
+		return StructuredOutputJSONSchema
+	case SupportsToolCalling(modelID):
+		return StructuredOutputTool
+	case SupportsJSONObjectOutput(modelID):
+		return StructuredOutputJSONObject
+	}
+	return StructuredOutputPrompt
+}
+
+// StructuredOutput is a schema prepared for a model: the mode it is requested with and the schema
+// normalized for the model's provider. Keywords a provider rejects are dropped from the sent schema,
+// responses should still be validated against the canonical one.
+type StructuredOutput struct {
+	Mode   StructuredOutputMode
+	Name   string      // schema or tool name
+	Schema *Definition // normalized schema, nil for json_object and prompt modes
+	Strict bool        // whether strict mode is requested for the json_schema mode
+	// Wrapped is set when a schema that is not an object was wrapped into the "result" property,
+	// tool parameters have to be objects
+	Wrapped bool
+
+	// canonical is the schema before normalization, nulls the normalized schema allowed for its
+	// optional properties are dropped from responses
+	canonical *Definition
+}
+
+// NewStructuredOutput prepares a canonical schema for a model, see SelectStructuredOutputMode and NormalizeSchema.
+// Recursive schemas fall back to the json_object or prompt mode for Google models, callers have to describe
+// the schema in the prompt for those modes.
+func NewStructuredOutput(schema *Definition, modelID, name string) (*StructuredOutput, error) {
+	if schema == nil {
+		return nil, errors.New("no schema definition provided")
+	}
+	output := &StructuredOutput{
+		Mode: SelectStructuredOutputMode(modelID),
+		Name: safeSchemaName(name),
+	}
+	if (output.Mode == StructuredOutputJSONSchema || output.Mode == StructuredOutputTool) &&
+		ModelProviderFamily(modelID) == ProviderGoogle && hasRecursiveRef(schema) {
+		// Gemini can't express recursion, inlining would nest the schema maxRefDepth levels deep.
+		// The schema has to be described in the prompt instead.
+		output.Mode = StructuredOutputPrompt
+		if SupportsJSONObjectOutput(modelID) {
+			output.Mode = StructuredOutputJSONObject
+		}
+	}
+	if output.Mode == StructuredOutputJSONObject || output.Mode == StructuredOutputPrompt {
+		return output, nil
+	}
+
+	output.canonical = schema
+	output.Schema = NormalizeSchema(schema, ModelProviderFamily(modelID))
+	if output.Mode == StructuredOutputTool && resolveSchemaRef(&schemaValidator{root: output.Schema}, output.Schema).Type != Object {
+		output.Schema = &Definition{
+			Type:                 Object,
+			Properties:           map[string]Definition{"result": withoutDefs(*output.Schema)},
+			Required:             []string{"result"},
+			AdditionalProperties: false,
+			Defs:                 output.Schema.Defs,
+		}
+		output.Wrapped = true
+	}
+	output.Strict = IsStrictSchema(output.Schema)
+	return output, nil
+}
+
+// Apply sets the response format or forced tool of the request parameters
+func (s *StructuredOutput) Apply(params *Parameters) error {
+	switch s.Mode {
+	case StructuredOutputJSONSchema:
+		responseFormat, err := json.Marshal(map[string]any{
+			"type": JSONSchemaStringResponseFormat,
+			"json_schema": map[string]any{
+				"name":   s.Name,
+				"schema": s.Schema,
+				"strict": s.Strict,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal response format: %w", err)
+		}
+		params.ResponseFormat = responseFormat
+	case StructuredOutputTool:
+		schemaBytes, err := json.Marshal(s.Schema)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tool parameters: %w", err)
+		}
+		var parameters map[string]any
+		if err := json.Unmarshal(schemaBytes, &parameters); err != nil {
+			return fmt.Errorf("failed to decode tool parameters: %w", err)
+		}
+		description := "Respond with the result by calling this function"
+		params.Tools = make([]struct {
+			Type     string `json:"type"`
+			Function struct {
+				Description *string        `json:"description,omitempty"`
+				Name        string         `json:"name"`
+				Parameters  map[string]any `json:"parameters"`
+			} `json:"function"`
+		}, 1)
+		params.Tools[0].Type = "function"
+		params.Tools[0].Function.Name = s.Name
+		params.Tools[0].Function.Description = &description
+		params.Tools[0].Function.Parameters = parameters
+		params.ToolChoice = map[string]any{"type": "function", "function": ToolChoiceFunction{Name: s.Name}}
+	case StructuredOutputJSONObject:
+		params.ResponseFormat = json.RawMessage(`{"type":"json_object"}`)
+	}
+	return nil
+}
+
+// Content returns the JSON of a response message: the arguments of the forced tool call, unwrapped
+// when the schema was wrapped, or the message content for the other modes. Strict mode makes optional
+// properties required and nullable, their null values are removed so the JSON matches the canonical schema.
+func (s *StructuredOutput) Content(message ResponseMessage) (string, error) {
+	content, err := s.content(message)
+	if err != nil || s.canonical == nil {
+		return content, err
+	}
+	return removeOptionalNulls(content, s.canonical), nil
+}
+
+func (s *StructuredOutput) content(message ResponseMessage) (string, error) {
+	if s.Mode != StructuredOutputTool {
+		if message.Content == nil {
+			return "", errors.New("response message has no content")
+		}
+		return *message.Content, nil
+	}
+
+	for _, call := range message.ToolCalls {
+		if call.Function.Name != s.Name {
+			continue
+		}
+		if !s.Wrapped {
+			return call.Function.Arguments, nil
+		}
+		var arguments struct {
+			Result json.RawMessage `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &arguments); err != nil {
+			return "", fmt.Errorf("invalid tool call arguments: %w", err)
+		}
+		if arguments.Result == nil {
+			return "", errors.New("tool call arguments have no result")
+		}
+		return string(arguments.Result), nil
+	}
+	return "", fmt.Errorf("response has no call of the %s tool", s.Name)
+}
+
+// removeOptionalNulls drops null values of properties the schema neither requires nor allows to be null.
+// The content is returned unchanged when it isn't JSON or has no such nulls.
+func removeOptionalNulls(content string, schema *Definition) string {
+	decoder := json.NewDecoder(strings.NewReader(content))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return content
+	}
+	if !dropOptionalNulls(value, schema, &schemaValidator{root: schema}, 0) {
+		return content
+	}
+	stripped, err := json.Marshal(value)
+	if err != nil {
+		return content
+	}
+	return string(stripped)
+}
+
+// dropOptionalNulls removes the optional nulls of a decoded value in place and reports whether any was removed
+func dropOptionalNulls(value any, schema *Definition, root *schemaValidator, depth int) bool {
+	if schema == nil || depth >= maxRefDepth {
+		return false
+	}
+	schema = resolveSchemaRef(root, schema)
+	dropped := false
+	switch value := value.(type) {
+	case map[string]any:
+		for name, property := range schema.Properties {
+			propertyValue, ok := value[name]
+			if !ok {
+				continue
+			}
+			if propertyValue == nil && !slices.Contains(schema.Required, name) && !allowsNull(resolveSchemaRef(root, &property)) {
+				delete(value, name)
+				dropped = true
+				continue
+			}
+			if dropOptionalNulls(propertyValue, &property, root, depth+1) {
+				dropped = true
+			}
+		}
+	case []any:
+		for _, item := range value {
+			if dropOptionalNulls(item, schema.Items, root, depth+1) {
+				dropped = true
+			}
+		}
+	}
+	return dropped
+}
+
+// allowsNull reports whether a schema accepts null
+func allowsNull(schema *Definition) bool {
+	types := schemaTypes(schema)
+	return schema.Nullable || types == nil || slices.Contains(types, Null)
+}
+
+// NormalizeSchema returns a copy of a canonical schema in the dialect a provider family accepts:
+//   - OpenAI: strict mode, every property is required, optional ones become nullable, objects disallow
+//     additional properties and minLength, maxLength and default are dropped
+//   - Google: references are inlined and additionalProperties, const, default, pattern, multipleOf and
+//     exclusive bounds are dropped, oneOf becomes anyOf
+//   - Anthropic and other providers get the schema unchanged
+func NormalizeSchema(schema *Definition, family ProviderFamily) *Definition {
+	if schema == nil {
+		return nil
+	}
+	var normalized Definition
+	switch family {
+	case ProviderOpenAI:
+		normalized = transformSchema(*schema, strictenSchema)
+		for name, def := range normalized.Defs {
+			normalized.Defs[name] = transformSchema(def, strictenSchema)
+		}
+	case ProviderGoogle:
+		inlined := inlineRefs(*schema, &schemaValidator{root: schema}, 0)
+		normalized = transformSchema(inlined, geminiSchema)
+	default:
+		normalized = transformSchema(*schema, func(*Definition) {})
+	}
+	return &normalized
+}
+
+// strictenSchema makes an object schema acceptable for OpenAI's strict mode
+func strictenSchema(d *Definition) {
+	d.MinLength, d.MaxLength, d.Default = nil, nil, nil
+	if d.Type != Object && d.Properties == nil {
+		return
+	}
+	if _, isMap := d.AdditionalProperties.(Definition); isMap {
+		// Maps can't be expressed in strict mode, the schema is sent without it
+		return
+	}
+	d.AdditionalProperties = false
+	for name, property := range d.Properties {
+		if !slices.Contains(d.Required, name) {
+			property.Nullable = true
+			d.Properties[name] = property
+			d.Required = append(d.Required, name)
+		}
+	}
+	slices.Sort(d.Required)
+}
+
+// geminiSchema drops the keywords Gemini rejects
+func geminiSchema(d *Definition) {
+	d.AdditionalProperties = nil
+	d.Default, d.Pattern, d.MultipleOf = nil, "", nil
+	d.ExclusiveMinimum, d.ExclusiveMaximum = nil, nil
+	if d.Const != nil {
+		if value, ok := d.Const.(string); ok && len(d.Enum) == 0 {
+			d.Enum = []string{value}
+		}
+		d.Const = nil
+	}
+	if len(d.OneOf) > 0 {
+		d.AnyOf = append(d.AnyOf, d.OneOf...)
+		d.OneOf = nil
+	}
+}
+
+// hasRecursiveRef reports whether a reference of the schema resolves to a schema containing it
+func hasRecursiveRef(schema *Definition) bool {
+	root := &schemaValidator{root: schema}
+	var visit func(d *Definition, refs []string) bool
+	visit = func(d *Definition, refs []string) bool {
+		if d.Ref != "" {
+			if slices.Contains(refs, d.Ref) {
+				return true
+			}
+			resolved, ok := root.resolve(d.Ref)
+			return ok && visit(resolved, append(slices.Clone(refs), d.Ref))
+		}
+		for _, property := range d.Properties {
+			if visit(&property, refs) {
+				return true
+			}
+		}
+		if d.Items != nil && visit(d.Items, refs) {
+			return true
+		}
+		for _, option := range slices.Concat(d.AnyOf, d.OneOf, d.AllOf) {
+			if visit(&option, refs) {
+				return true
+			}
+		}
+		if values, ok := d.AdditionalProperties.(Definition); ok {
+			return visit(&values, refs)
+		}
+		return false
+	}
+	return visit(schema, []string{"#"})
+}
+
+// inlineRefs replaces references with the schemas they point to, recursive references end
+// in an unconstrained schema once maxRefDepth is reached
+func inlineRefs(d Definition, root *schemaValidator, depth int) Definition {
+	if depth >= maxRefDepth {
+		return Definition{Description: d.Description}
+	}
+	if d.Ref != "" {
+		resolved, ok := root.resolve(d.Ref)
+		if !ok {
+			return d
+		}
+		inlined := inlineRefs(*resolved, root, depth+1)
+		inlined.Defs = nil
+		if d.Description != "" {
+			inlined.Description = d.Description
+		}
+		inlined.Nullable = inlined.Nullable || d.Nullable
+		return inlined
+	}
+	d.Defs = nil
+	if d.Properties != nil {
+		properties := make(map[string]Definition, len(d.Properties))
+		for name, property := range d.Properties {
+			properties[name] = inlineRefs(property, root, depth+1)
+		}
+		d.Properties = properties
+	}
+	if d.Items != nil {
+		items := inlineRefs(*d.Items, root, depth+1)
+		d.Items = &items
+	}
+	for _, options := range []*[]Definition{&d.AnyOf, &d.OneOf, &d.AllOf} {
+		if *options == nil {
+			continue
+		}
+		inlined := make([]Definition, len(*options))
+		for i, option := range *options {
+			inlined[i] = inlineRefs(option, root, depth+1)
+		}
+		*options = inlined
+	}
+	if values, ok := d.AdditionalProperties.(Definition); ok {
+		d.AdditionalProperties = inlineRefs(values, root, depth+1)
+	}
+	return d
+}
+
+// transformSchema returns a deep copy of a schema with fn applied to it and every nested schema,
+// definitions in $defs are copied but not transformed
+func transformSchema(d Definition, fn func(*Definition)) Definition {
+	d.Required = slices.Clone(d.Required)
+	d.Enum = slices.Clone(d.Enum)
+	if d.Properties != nil {
+		properties := make(map[string]Definition, len(d.Properties))
+		for name, property := range d.Properties {
+			properties[name] = transformSchema(property, fn)
+		}
+		d.Properties = properties
+	}
+	if d.Items != nil {
+		items := transformSchema(*d.Items, fn)
+		d.Items = &items
+	}
+	for _, options := range []*[]Definition{&d.AnyOf, &d.OneOf, &d.AllOf} {
+		if *options == nil {
+			continue
+		}
+		transformed := make([]Definition, len(*options))
+		for i, option := range *options {
+			transformed[i] = transformSchema(option, fn)
+		}
+		*options = transformed
+	}
+	if values, ok := d.AdditionalProperties.(Definition); ok {
+		d.AdditionalProperties = transformSchema(values, fn)
+	}
+	if d.Defs != nil {
+		defs := make(map[string]Definition, len(d.Defs))
+		for name, def := range d.Defs {
+			defs[name] = transformSchema(def, func(*Definition) {})
+		}
+		d.Defs = defs
+	}
+	fn(&d)
+	return d
+}
+
+func withoutDefs(d Definition) Definition {
+	d.Defs = nil
+	return d
+}
+
+// safeSchemaName turns a goal title into a name accepted for schemas and functions
+func safeSchemaName(name string) string {
+	safeName := regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(name, "_")
+	if safeName == "" || safeName == "_" {
+		return "generated_schema"
+	}
+	if len(safeName) > 64 {
+		safeName = safeName[:64]
+	}
+	return safeName
+}
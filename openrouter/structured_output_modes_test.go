@@ -0,0 +1,152 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSelectStructuredOutputMode(t *testing.T) {
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set([]ModelInfo{
+		{ID: "test/json-mode", SupportedParameters: []string{"response_format"}},
+		{ID: "test/plain"},
+	})
+
+	cases := map[string]StructuredOutputMode{
+		"openai/gpt-4o":               StructuredOutputJSONSchema,
+		"anthropic/claude-3.5-sonnet": StructuredOutputTool,
+		"x-ai/grok-beta":              StructuredOutputTool,
+		"test/json-mode":              StructuredOutputJSONObject,
+		"test/plain":                  StructuredOutputPrompt,
+		"unknown/model":               StructuredOutputPrompt,
+	}
+	for model, expected := range cases {
+		if got := SelectStructuredOutputMode(model); got != expected {
+			t.Errorf("SelectStructuredOutputMode(%s) = %s, expected %s", model, got, expected)
+		}
+	}
+	if ModelProviderFamily("google/gemini-2.0-flash-001") != ProviderGoogle || ModelProviderFamily("meta-llama/llama-4-scout") != ProviderGeneric {
+		t.Error("Unexpected provider families")
+	}
+}
+
+func TestNormalizeSchemaOpenAI(t *testing.T) {
+	schema := mustParseSchema(t, `{"type":"object","properties":{
+		"label":{"type":"string","minLength":1,"default":"ham"},
+		"note":{"type":"string"},
+		"scores":{"type":"object","additionalProperties":{"type":"number"}}
+	},"required":["label"]}`)
+
+	normalized := NormalizeSchema(schema, ProviderOpenAI)
+	if len(normalized.Required) != 3 || normalized.AdditionalProperties != false {
+		t.Errorf("Expected every property required and no additional properties, got %+v", normalized)
+	}
+	if !normalized.Properties["note"].Nullable || normalized.Properties["label"].Nullable {
+		t.Error("Expected only the optional property to become nullable")
+	}
+	if normalized.Properties["label"].MinLength != nil || normalized.Properties["label"].Default != nil {
+		t.Error("Expected minLength and default to be dropped")
+	}
+	if _, ok := normalized.Properties["scores"].AdditionalProperties.(Definition); !ok {
+		t.Error("Expected maps to keep their value schema")
+	}
+	if len(schema.Required) != 1 || schema.Properties["note"].Nullable || schema.Properties["label"].MinLength == nil {
+		t.Error("Normalizing should not modify the canonical schema")
+	}
+}
+
+func TestNormalizeSchemaGoogle(t *testing.T) {
+	schema := mustParseSchema(t, `{"type":"object","properties":{
+		"kind":{"const":"event"},
+		"when":{"$ref":"#/$defs/time"},
+		"value":{"oneOf":[{"type":"string","pattern":"^a"},{"type":"number","exclusiveMinimum":0}]}
+	},"required":["kind"],"additionalProperties":false,"$defs":{"time":{"type":"string","format":"date-time"}}}`)
+
+	encoded, _ := json.Marshal(NormalizeSchema(schema, ProviderGoogle))
+	for _, rejected := range []string{"$ref", "$defs", "const", "oneOf", "pattern", "exclusiveMinimum", "additionalProperties"} {
+		if strings.Contains(string(encoded), rejected) {
+			t.Errorf("Expected %s to be removed for Gemini, got %s", rejected, encoded)
+		}
+	}
+	for _, kept := range []string{`"enum":["event"]`, `"format":"date-time"`, `"anyOf"`} {
+		if !strings.Contains(string(encoded), kept) {
+			t.Errorf("Expected %s in the normalized schema, got %s", kept, encoded)
+		}
+	}
+}
+
+func TestNewStructuredOutputRecursiveSchemaGoogle(t *testing.T) {
+	recursive := mustParseSchema(t, `{"type":"object","properties":{"name":{"type":"string"},"children":{"type":"array","items":{"$ref":"#"}}}}`)
+	output, err := NewStructuredOutput(recursive, "google/gemini-2.0-flash-001", "tree")
+	if err != nil {
+		t.Fatalf("NewStructuredOutput failed: %v", err)
+	}
+	if output.Mode != StructuredOutputJSONObject || output.Schema != nil {
+		t.Errorf("Expected recursive schemas to fall back to JSON mode for Gemini, got %+v", output)
+	}
+
+	viaDefs := mustParseSchema(t, `{"$ref":"#/$defs/node","$defs":{"node":{"type":"object","properties":{"next":{"$ref":"#/$defs/node"}}}}}`)
+	if !hasRecursiveRef(viaDefs) {
+		t.Error("Expected a definition referencing itself to be recursive")
+	}
+	shared := mustParseSchema(t, `{"type":"object","properties":{"from":{"$ref":"#/$defs/time"},"to":{"$ref":"#/$defs/time"}},"$defs":{"time":{"type":"string"}}}`)
+	if hasRecursiveRef(shared) {
+		t.Error("Expected a definition referenced twice not to be recursive")
+	}
+
+	output, err = NewStructuredOutput(recursive, "openai/gpt-4o", "tree")
+	if err != nil || output.Mode != StructuredOutputJSONSchema {
+		t.Errorf("Expected other providers to keep json_schema for recursive schemas, got %+v, %v", output, err)
+	}
+}
+
+func TestStructuredOutputTool(t *testing.T) {
+	schema := mustParseSchema(t, `{"type":"array","items":{"type":"string"}}`)
+	output, err := NewStructuredOutput(schema, "anthropic/claude-3.5-sonnet", "Tag List")
+	if err != nil {
+		t.Fatalf("NewStructuredOutput failed: %v", err)
+	}
+	if output.Mode != StructuredOutputTool || !output.Wrapped || output.Name != "Tag_List" {
+		t.Fatalf("Expected a wrapped forced tool, got %+v", output)
+	}
+
+	var params Parameters
+	if err := output.Apply(&params); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if len(params.Tools) != 1 || params.Tools[0].Function.Parameters["type"] != "object" || len(params.ResponseFormat) != 0 {
+		t.Errorf("Expected a single object tool and no response format, got %+v", params)
+	}
+	choice, _ := json.Marshal(params.ToolChoice)
+	if string(choice) != `{"function":{"name":"Tag_List"},"type":"function"}` {
+		t.Errorf("Expected the tool to be forced, got %s", choice)
+	}
+
+	content, err := output.Content(ResponseMessage{ToolCalls: []ToolCall{{Function: ToolCallFunction{Name: "Tag_List", Arguments: `{"result": ["a", "b"]}`}}}})
+	if err != nil || content != `["a", "b"]` {
+		t.Errorf("Expected the unwrapped result, got %q, %v", content, err)
+	}
+	if _, err := output.Content(ResponseMessage{}); err == nil {
+		t.Error("Expected an error without a tool call")
+	}
+}
+
+func TestStructuredOutputJSONSchema(t *testing.T) {
+	schema := mustParseSchema(t, `{"type":"object","properties":{"label":{"type":"string"}}}`)
+	output, err := NewStructuredOutput(schema, "openai/gpt-4o", "label")
+	if err != nil {
+		t.Fatalf("NewStructuredOutput failed: %v", err)
+	}
+	var params Parameters
+	if err := output.Apply(&params); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := ValidateJSONResponseFormat(params.ResponseFormat); err != nil {
+		t.Errorf("Expected a valid response format: %v", err)
+	}
+	if !strings.Contains(string(params.ResponseFormat), `"strict":true`) || !strings.Contains(string(params.ResponseFormat), `"type":["string","null"]`) {
+		t.Errorf("Expected OpenAI schemas to be made strict, got %s", params.ResponseFormat)
+	}
+}
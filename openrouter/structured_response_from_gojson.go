@@ -10,8 +10,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"regexp"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type DataType string
@@ -36,49 +40,233 @@ type Definition struct {
 	// Enum is used to restrict a value to a fixed set of values. It must be an array with at least
 	// one element, where each element is unique. You will probably only use this with strings.
 	Enum []string `json:"enum,omitempty"`
+	// Const restricts a value to a single value.
+	Const any `json:"const,omitempty"`
+	// Default is the value assumed when the property is missing.
+	Default any `json:"default,omitempty"`
+	// Nullable also allows null, it is marshaled as a type union like ["string", "null"].
+	Nullable bool `json:"-"`
+	// Minimum and Maximum are the inclusive bounds of a number or integer.
+	Minimum *float64 `json:"minimum,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+	// ExclusiveMinimum and ExclusiveMaximum are the exclusive bounds of a number or integer.
+	ExclusiveMinimum *float64 `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum *float64 `json:"exclusiveMaximum,omitempty"`
+	// MultipleOf requires a number to be a multiple of the value.
+	MultipleOf *float64 `json:"multipleOf,omitempty"`
+	// MinLength and MaxLength bound the length of a string in characters.
+	MinLength *int `json:"minLength,omitempty"`
+	MaxLength *int `json:"maxLength,omitempty"`
+	// Pattern is a regular expression a string must match.
+	Pattern string `json:"pattern,omitempty"`
+	// Format is a string format such as "date-time", "date", "email", "uri" or "uuid".
+	Format string `json:"format,omitempty"`
 	// Properties describes the properties of an object, if the schema type is Object.
 	Properties map[string]Definition `json:"properties,omitempty"`
 	// Required specifies which properties are required, if the schema type is Object.
 	Required []string `json:"required,omitempty"`
 	// Items specifies which data type an array contains, if the schema type is Array.
 	Items *Definition `json:"items,omitempty"`
+	// MinItems and MaxItems bound the length of an array.
+	MinItems *int `json:"minItems,omitempty"`
+	MaxItems *int `json:"maxItems,omitempty"`
 	// AdditionalProperties is used to control the handling of properties in an object
 	// that are not explicitly defined in the properties section of the schema. example:
 	// additionalProperties: true
 	// additionalProperties: false
 	// additionalProperties: jsonschema.Definition{Type: jsonschema.String}
 	AdditionalProperties any `json:"additionalProperties,omitempty"`
+	// AnyOf, OneOf and AllOf combine schemas: the value must match at least one,
+	// exactly one or all of them.
+	AnyOf []Definition `json:"anyOf,omitempty"`
+	OneOf []Definition `json:"oneOf,omitempty"`
+	AllOf []Definition `json:"allOf,omitempty"`
+	// Ref references another schema, "#" for the root or "#/$defs/<name>" for a definition.
+	Ref string `json:"$ref,omitempty"`
+	// Defs holds the definitions referenced with Ref, only used on the root schema.
+	Defs map[string]Definition `json:"$defs,omitempty"`
 }
 
-func (d *Definition) MarshalJSON() ([]byte, error) {
-	if d.Properties == nil {
-		d.Properties = make(map[string]Definition)
-	}
+func (d Definition) MarshalJSON() ([]byte, error) {
 	type Alias Definition
+	if !d.Nullable {
+		return json.Marshal(struct {
+			Alias
+		}{
+			Alias: (Alias)(d),
+		})
+	}
+
+	if d.Type == "" {
+		d.Nullable = false
+		switch {
+		case d.Ref != "":
+			// References can't be combined with a type, wrap them in anyOf
+			return json.Marshal(Definition{AnyOf: []Definition{d, {Type: Null}}})
+		case len(d.AnyOf) > 0:
+			// Only a combination like anyOf, null becomes another option
+			d.AnyOf = append(append([]Definition(nil), d.AnyOf...), Definition{Type: Null})
+		}
+		// Without a type any value, including null, is allowed already
+		return json.Marshal(d)
+	}
 	return json.Marshal(struct {
 		Alias
+		Type []DataType `json:"type"`
 	}{
-		Alias: (Alias)(*d),
+		Alias: (Alias)(d),
+		Type:  []DataType{d.Type, Null},
 	})
 }
 
+// UnmarshalJSON accepts type unions: ["string", "null"] becomes a nullable string and
+// unions of several non null types become AnyOf.
+func (d *Definition) UnmarshalJSON(data []byte) error {
+	type Alias Definition
+	aux := struct {
+		*Alias
+		Type any `json:"type,omitempty"`
+	}{
+		Alias: (*Alias)(d),
+	}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	if additional, ok := d.AdditionalProperties.(map[string]any); ok {
+		// A schema for the values of a map
+		encoded, _ := json.Marshal(additional)
+		var values Definition
+		if err := json.Unmarshal(encoded, &values); err != nil {
+			return fmt.Errorf("invalid additionalProperties schema: %w", err)
+		}
+		d.AdditionalProperties = values
+	}
+
+	switch schemaType := aux.Type.(type) {
+	case nil:
+	case string:
+		d.Type = DataType(schemaType)
+	case []any:
+		var types []DataType
+		for _, t := range schemaType {
+			name, ok := t.(string)
+			if !ok {
+				return fmt.Errorf("invalid type %v in schema type union", t)
+			}
+			if DataType(name) == Null && len(schemaType) > 1 {
+				d.Nullable = true
+				continue
+			}
+			types = append(types, DataType(name))
+		}
+		if len(types) == 1 {
+			d.Type = types[0]
+		}
+		if len(types) > 1 {
+			for _, t := range types {
+				d.AnyOf = append(d.AnyOf, Definition{Type: t})
+			}
+		}
+	default:
+		return fmt.Errorf("invalid schema type %v", aux.Type)
+	}
+	return nil
+}
+
+// EnumValuer is implemented by Go types with a fixed set of values, e.g. a string type
+// with constants. Their schema restricts the value to EnumValues.
+type EnumValuer interface {
+	EnumValues() []string
+}
+
+var enumValuerType = reflect.TypeOf((*EnumValuer)(nil)).Elem()
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// SchemaOptions controls how generated schemas model optional and nullable fields
+type SchemaOptions struct {
+	// Strict follows the strict structured output rules of OpenAI and OpenRouter: every property is
+	// required, so optional fields (omitempty, required:"false" or null in examples) are nullable
+	// instead. Without Strict optional fields are left out of required, and pointers are both.
+	Strict bool
+}
+
+// GenerateSchemaForType reflects the type of v into a schema with optional fields left out of required
 func GenerateSchemaForType(v any) (*Definition, error) {
+	return GenerateSchemaForTypeWithOptions(v, SchemaOptions{})
+}
+
+// GenerateSchemaForTypeWithOptions reflects the type of v into a schema
+func GenerateSchemaForTypeWithOptions(v any, opts SchemaOptions) (*Definition, error) {
 	t := reflect.TypeOf(v)
 	if t == nil {
 		return nil, fmt.Errorf("cannot generate schema for nil value")
 	}
-	return reflectSchema(t)
+	return reflectSchema(t, opts)
 }
 
-func reflectSchema(t reflect.Type) (*Definition, error) {
+func reflectSchema(t reflect.Type, opts SchemaOptions) (*Definition, error) {
 	if t == nil {
 		return nil, fmt.Errorf("cannot generate schema for nil type")
 	}
-	
+	r := &schemaReflector{
+		opts:       opts,
+		root:       derefType(t),
+		inProgress: make(map[reflect.Type]bool),
+		recursive:  make(map[reflect.Type]bool),
+		defNames:   make(map[reflect.Type]string),
+	}
+	d, err := r.reflect(t)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.defs) > 0 {
+		d.Defs = r.defs
+	}
+	return d, nil
+}
+
+// schemaReflector reflects a type into a schema. Struct types that contain themselves are
+// moved to $defs and referenced with $ref, the root type is referenced with "#".
+type schemaReflector struct {
+	opts       SchemaOptions
+	root       reflect.Type
+	inProgress map[reflect.Type]bool // structs currently being reflected
+	recursive  map[reflect.Type]bool // structs referenced while in progress
+	defNames   map[reflect.Type]string
+	defs       map[string]Definition
+
+	owner     reflect.Type // struct whose field is being reflected, names types without a name
+	fieldName string
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func (r *schemaReflector) reflect(t reflect.Type) (*Definition, error) {
+	// Types with their own JSON encoding, checked before their kind
+	switch t {
+	case timeType:
+		return &Definition{Type: String, Format: "date-time"}, nil
+	case rawMessageType:
+		return &Definition{}, nil // any JSON value
+	}
+
 	var d Definition
 	switch t.Kind() {
 	case reflect.String:
 		d.Type = String
+		if t.Implements(enumValuerType) {
+			d.Enum = reflect.Zero(t).Interface().(EnumValuer).EnumValues()
+		}
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		d.Type = Integer
@@ -87,74 +275,316 @@ func reflectSchema(t reflect.Type) (*Definition, error) {
 	case reflect.Bool:
 		d.Type = Boolean
 	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json writes []byte as a base64 string
+			d.Type = String
+			break
+		}
 		d.Type = Array
-		items, err := reflectSchema(t.Elem())
+		items, err := r.reflect(t.Elem())
 		if err != nil {
 			return nil, err
 		}
 		d.Items = items
-	case reflect.Struct:
-		d.Type = Object
-		d.AdditionalProperties = false
-		object, err := reflectSchemaObject(t)
-		if err != nil {
-			return nil, err
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return nil, fmt.Errorf("unsupported map key type: %s", t.Key().Kind().String())
 		}
-		d = *object
-	case reflect.Ptr:
-		definition, err := reflectSchema(t.Elem())
+		values, err := r.reflect(t.Elem())
 		if err != nil {
 			return nil, err
 		}
-		d = *definition
+		d.Type = Object
+		d.AdditionalProperties = *values
+	case reflect.Interface:
+		// Any JSON value
+	case reflect.Struct:
+		return r.reflectStruct(t)
+	case reflect.Ptr:
+		return r.reflect(t.Elem())
 	case reflect.Invalid, reflect.Uintptr, reflect.Complex64, reflect.Complex128,
-		reflect.Chan, reflect.Func, reflect.Interface, reflect.Map,
-		reflect.UnsafePointer:
+		reflect.Chan, reflect.Func, reflect.UnsafePointer:
 		return nil, fmt.Errorf("unsupported type: %s", t.Kind().String())
 	default:
 	}
 	return &d, nil
 }
 
-func reflectSchemaObject(t reflect.Type) (*Definition, error) {
+// reflectStruct reflects a struct, or references it when the struct contains itself
+func (r *schemaReflector) reflectStruct(t reflect.Type) (*Definition, error) {
+	if r.inProgress[t] {
+		r.recursive[t] = true
+		return &Definition{Ref: r.refFor(t)}, nil
+	}
+	r.inProgress[t] = true
+	d, err := r.reflectObject(t)
+	delete(r.inProgress, t)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.recursive[t] && t != r.root {
+		if r.defs == nil {
+			r.defs = make(map[string]Definition)
+		}
+		r.defs[r.defNames[t]] = *d
+		return &Definition{Ref: r.refFor(t)}, nil
+	}
+	return d, nil
+}
+
+// refFor returns the reference of a recursive struct, naming its definition after the type
+func (r *schemaReflector) refFor(t reflect.Type) string {
+	if t == r.root {
+		return "#"
+	}
+	if name, ok := r.defNames[t]; ok {
+		return "#/$defs/" + name
+	}
+	base := r.defBaseName(t)
+	name := base
+	taken := func(candidate string) bool {
+		for _, existing := range r.defNames {
+			if existing == candidate {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 2; taken(name); i++ {
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+	r.defNames[t] = name
+	return "#/$defs/" + name
+}
+
+// defBaseName names the definition of a type before collisions are resolved. Type arguments
+// of generic types are dropped as they hold package paths, types without a name are named
+// after the struct and field they appear in.
+func (r *schemaReflector) defBaseName(t reflect.Type) string {
+	name, _, _ := strings.Cut(t.Name(), "[")
+	if name == "" && r.owner != nil {
+		owner, _, _ := strings.Cut(r.owner.Name(), "[")
+		name = owner + r.fieldName
+	}
+	if name == "" {
+		name = "type"
+	}
+	return name
+}
+
+// jsonField is the JSON encoding of a struct field as described by its json tag
+type jsonField struct {
+	name      string
+	omitEmpty bool
+	asString  bool // ",string" option, numbers and booleans are encoded as strings
+	tagged    bool // the tag sets a name
+}
+
+func parseJSONTag(field reflect.StructField) (jsonField, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return jsonField{}, false
+	}
+	name, options, _ := strings.Cut(tag, ",")
+	parsed := jsonField{name: name, tagged: name != ""}
+	if name == "" {
+		parsed.name = field.Name
+	}
+	for _, option := range strings.Split(options, ",") {
+		switch option {
+		case "omitempty", "omitzero":
+			parsed.omitEmpty = true
+		case "string":
+			parsed.asString = true
+		}
+	}
+	return parsed, true
+}
+
+// reflectObject reflects the fields of a struct. Fields of embedded structs without a json
+// name are promoted like encoding/json does, fields of the outer struct take precedence.
+func (r *schemaReflector) reflectObject(t reflect.Type) (*Definition, error) {
 	var d = Definition{
 		Type:                 Object,
 		AdditionalProperties: false,
 	}
 	properties := make(map[string]Definition)
 	var requiredFields []string
+	var embedded []*Definition
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
-		if !field.IsExported() {
+		jsonTag, ok := parseJSONTag(field)
+		if !ok {
 			continue
 		}
-		jsonTag := field.Tag.Get("json")
-		var required = true
-		if jsonTag == "" {
-			jsonTag = field.Name
-		} else if strings.HasSuffix(jsonTag, ",omitempty") {
-			jsonTag = strings.TrimSuffix(jsonTag, ",omitempty")
-			required = false
+
+		if field.Anonymous && !jsonTag.tagged && derefType(field.Type).Kind() == reflect.Struct && derefType(field.Type) != timeType {
+			promoted, err := r.reflectStruct(derefType(field.Type))
+			if err != nil {
+				return nil, err
+			}
+			if promoted.Ref != "" {
+				return nil, fmt.Errorf("embedded struct %s contains itself", field.Type)
+			}
+			embedded = append(embedded, promoted)
+			continue
+		}
+		if !field.IsExported() {
+			continue
 		}
 
-		item, err := reflectSchema(field.Type)
+		owner, fieldName := r.owner, r.fieldName
+		r.owner, r.fieldName = t, field.Name
+		item, err := r.reflect(field.Type)
+		r.owner, r.fieldName = owner, fieldName
 		if err != nil {
 			return nil, err
 		}
+		if jsonTag.asString {
+			switch item.Type {
+			case Integer, Number, Boolean:
+				item = &Definition{Type: String, Description: item.Description}
+			}
+		}
 		description := field.Tag.Get("description")
 		if description != "" {
 			item.Description = description
 		}
-		properties[jsonTag] = *item
-
+		if err := applyConstraintTags(item, field); err != nil {
+			return nil, err
+		}
+		required := !jsonTag.omitEmpty
+		if field.Type.Kind() == reflect.Ptr {
+			// nil pointers are encoded as null, and a missing value decodes to nil
+			item.Nullable = true
+			required = false
+		}
 		if s := field.Tag.Get("required"); s != "" {
 			required, _ = strconv.ParseBool(s)
 		}
+		if r.opts.Strict {
+			if !required {
+				item.Nullable = true
+			}
+			required = true
+		}
 		if required {
-			requiredFields = append(requiredFields, jsonTag)
+			requiredFields = append(requiredFields, jsonTag.name)
 		}
+		properties[jsonTag.name] = *item
 	}
+
+	for _, promoted := range embedded {
+		names := make([]string, 0, len(promoted.Properties))
+		for name := range promoted.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, shadowed := properties[name]; shadowed {
+				continue
+			}
+			properties[name] = promoted.Properties[name]
+			if slices.Contains(promoted.Required, name) {
+				requiredFields = append(requiredFields, name)
+			}
+		}
+	}
+
 	d.Required = requiredFields
 	d.Properties = properties
 	return &d, nil
 }
+
+// applyConstraintTags reflects the constraint tags of a struct field into its definition:
+//
+//	enum:"a,b,c" minimum:"0" maximum:"1" minLength:"1" maxLength:"80"
+//	pattern:"^[a-z]+$" format:"date-time" minItems:"1" maxItems:"5" default:"a"
+//
+// On arrays of scalars all tags but minItems and maxItems apply to the items.
+func applyConstraintTags(d *Definition, field reflect.StructField) error {
+	target := d
+	if d.Type == Array && d.Items != nil && d.Items.Type != Object && d.Items.Type != Array {
+		target = d.Items
+	}
+
+	if enum := field.Tag.Get("enum"); enum != "" {
+		if target.Type != String {
+			return fmt.Errorf("enum tag on field %s needs a string type, got %s", field.Name, target.Type)
+		}
+		target.Enum = nil
+		for _, value := range strings.Split(enum, ",") {
+			target.Enum = append(target.Enum, strings.TrimSpace(value))
+		}
+	}
+	if pattern := field.Tag.Get("pattern"); pattern != "" {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern tag on field %s: %w", field.Name, err)
+		}
+		target.Pattern = pattern
+	}
+	if format := field.Tag.Get("format"); format != "" {
+		target.Format = format
+	}
+
+	floats := []struct {
+		tag   string
+		value **float64
+	}{{"minimum", &target.Minimum}, {"maximum", &target.Maximum}}
+	for _, f := range floats {
+		if s := field.Tag.Get(f.tag); s != "" {
+			value, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s tag on field %s: %w", f.tag, field.Name, err)
+			}
+			*f.value = &value
+		}
+	}
+
+	ints := []struct {
+		tag   string
+		value **int
+	}{{"minLength", &target.MinLength}, {"maxLength", &target.MaxLength}, {"minItems", &d.MinItems}, {"maxItems", &d.MaxItems}}
+	for _, i := range ints {
+		if s := field.Tag.Get(i.tag); s != "" {
+			value, err := strconv.Atoi(s)
+			if err != nil || value < 0 {
+				return fmt.Errorf("invalid %s tag on field %s: %q is not a non-negative integer", i.tag, field.Name, s)
+			}
+			*i.value = &value
+		}
+	}
+
+	if s, ok := field.Tag.Lookup("default"); ok {
+		value, err := parseDefaultTag(s, target.Type)
+		if err != nil {
+			return fmt.Errorf("invalid default tag on field %s: %w", field.Name, err)
+		}
+		target.Default = value
+	}
+	return nil
+}
+
+// parseDefaultTag converts a default tag to a value of the schema type
+func parseDefaultTag(s string, dataType DataType) (any, error) {
+	switch dataType {
+	case String:
+		return s, nil
+	case Integer:
+		return strconv.ParseInt(s, 10, 64)
+	case Number:
+		return strconv.ParseFloat(s, 64)
+	case Boolean:
+		return strconv.ParseBool(s)
+	default:
+		var value any
+		if err := json.Unmarshal([]byte(s), &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+}
@@ -58,7 +58,7 @@ func PseudoStructuredResponseCleaner(response string) string {
 // based on the provided example response object
 func UseOpenRouterJsonFormat(exampleOutput any, schemaName string) (json.RawMessage, error) {
 	// Generate schema definition for the example output type
-	schemaDef, err := GenerateSchemaForType(exampleOutput)
+	schemaDef, err := GenerateSchemaForTypeWithOptions(exampleOutput, SchemaOptions{Strict: true})
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,230 @@
+package openrouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// DEFAULT_CHARS_PER_TOKEN is the character to token ratio used for models without a registered estimator
+var DEFAULT_CHARS_PER_TOKEN = 4.0
+
+// Per message overhead of the chat format (role markers and separators), and the tokens that prime the reply
+const (
+	tokensPerMessage = 4
+	tokensPerReply   = 3
+)
+
+var ErrContextWindowExceeded = errors.New("request does not fit in the model's context window")
+
+// TokenEstimator approximates the number of tokens a text uses for a model family
+type TokenEstimator func(text string) int
+
+// CharRatioEstimator returns an estimator that assumes a fixed number of characters per token
+func CharRatioEstimator(charsPerToken float64) TokenEstimator {
+	return func(text string) int {
+		if text == "" {
+			return 0
+		}
+		ratio := charsPerToken
+		if ratio <= 0 {
+			ratio = DEFAULT_CHARS_PER_TOKEN
+		}
+		return int(math.Ceil(float64(utf8.RuneCountInString(text)) / ratio))
+	}
+}
+
+var (
+	tokenEstimatorsMu sync.RWMutex
+	// tokenEstimators maps a model ID prefix (usually the provider, e.g. "openai/") to its estimator
+	tokenEstimators = map[string]TokenEstimator{
+		"openai/":     CharRatioEstimator(4.0),
+		"anthropic/":  CharRatioEstimator(3.5),
+		"google/":     CharRatioEstimator(4.0),
+		"meta-llama/": CharRatioEstimator(3.8),
+		"mistralai/":  CharRatioEstimator(3.6),
+		"deepseek/":   CharRatioEstimator(3.8),
+		"qwen/":       CharRatioEstimator(3.6),
+	}
+)
+
+// RegisterTokenEstimator sets the estimator for all models whose ID starts with prefix,
+// e.g. "openai/" or "openai/gpt-4o". The longest matching prefix wins. Passing nil removes it.
+func RegisterTokenEstimator(prefix string, estimator TokenEstimator) {
+	tokenEstimatorsMu.Lock()
+	defer tokenEstimatorsMu.Unlock()
+	if estimator == nil {
+		delete(tokenEstimators, prefix)
+		return
+	}
+	tokenEstimators[prefix] = estimator
+}
+
+// TokenEstimatorFor returns the estimator for a model, falling back to DEFAULT_CHARS_PER_TOKEN
+func TokenEstimatorFor(model string) TokenEstimator {
+	tokenEstimatorsMu.RLock()
+	defer tokenEstimatorsMu.RUnlock()
+	var best TokenEstimator
+	bestLen := -1
+	for prefix, estimator := range tokenEstimators {
+		if strings.HasPrefix(model, prefix) && len(prefix) > bestLen {
+			best = estimator
+			bestLen = len(prefix)
+		}
+	}
+	if best == nil {
+		return CharRatioEstimator(DEFAULT_CHARS_PER_TOKEN)
+	}
+	return best
+}
+
+// EstimateTokens approximates the number of tokens of a text for the given model
+func EstimateTokens(model, text string) int {
+	return TokenEstimatorFor(model)(text)
+}
+
+// EstimateMessageTokens approximates the prompt tokens of a conversation including the chat format overhead
+func EstimateMessageTokens(model string, messages []Message) int {
+	estimate := TokenEstimatorFor(model)
+	total := tokensPerReply
+	for _, message := range messages {
+		total += estimateMessage(estimate, message)
+	}
+	return total
+}
+
+func estimateMessage(estimate TokenEstimator, message Message) int {
+	tokens := tokensPerMessage + estimate(message.Role) + estimate(message.Content)
+	if message.Name != nil {
+		tokens += estimate(*message.Name)
+	}
+	return tokens
+}
+
+// EstimatePromptTokens approximates the prompt tokens of a request, including tool definitions and the response format
+func (r *OpenRouterRequest) EstimatePromptTokens() int {
+	model := ""
+	if r.Model != nil {
+		model = *r.Model
+	}
+	estimate := TokenEstimatorFor(model)
+
+	total := EstimateMessageTokens(model, r.Messages)
+	if r.Prompt != nil {
+		total += estimate(*r.Prompt)
+	}
+	if len(r.Tools) > 0 {
+		if tools, err := json.Marshal(r.Tools); err == nil {
+			total += estimate(string(tools))
+		}
+	}
+	if len(r.ResponseFormat) > 0 {
+		total += estimate(string(r.ResponseFormat))
+	}
+	return total
+}
+
+// ContextLimits returns the context length and maximum completion tokens of a model from the
+// DefaultModelCatalog. ok is false when the model is unknown, e.g. because the catalog was never synced.
+func ContextLimits(model string) (contextLength, maxCompletionTokens int, ok bool) {
+	info, found := DefaultModelCatalog.Get(model)
+	if !found || info.ContextLength <= 0 {
+		return 0, 0, false
+	}
+	return info.ContextLength, info.MaxCompletionTokens, true
+}
+
+// PreflightOptions controls what Preflight does when a request does not fit the model's context window
+type PreflightOptions struct {
+	// ClampMaxTokens lowers MaxTokens to the room left in the context window instead of failing
+	ClampMaxTokens bool
+	// TruncateHistory drops the oldest non-system messages until the prompt fits, the last message is always kept
+	TruncateHistory bool
+	// MinCompletionTokens is the room that must be left for the completion, defaults to 1
+	MinCompletionTokens int
+}
+
+// PreflightResult describes the outcome of a preflight check
+type PreflightResult struct {
+	PromptTokens     int  // estimated prompt tokens after truncation
+	ContextLength    int  // context window of the model, 0 when unknown
+	DroppedMessages  int  // number of messages removed by TruncateHistory
+	ClampedMaxTokens bool // MaxTokens was lowered to fit
+	Checked          bool // false when the model's limits are unknown and nothing was checked
+}
+
+// Preflight estimates the request size and checks it against the model's context window before sending.
+// Depending on opts it truncates the conversation history and clamps MaxTokens, the request is modified in place.
+// An error wrapping ErrContextWindowExceeded is returned when the request still does not fit.
+// Models missing from the DefaultModelCatalog are not checked.
+func (r *OpenRouterRequest) Preflight(opts PreflightOptions) (*PreflightResult, error) {
+	result := &PreflightResult{PromptTokens: r.EstimatePromptTokens()}
+	if r.Model == nil {
+		return result, nil
+	}
+	contextLength, maxCompletionTokens, ok := ContextLimits(*r.Model)
+	if !ok {
+		return result, nil
+	}
+	result.Checked = true
+	result.ContextLength = contextLength
+
+	minCompletion := opts.MinCompletionTokens
+	if minCompletion <= 0 {
+		minCompletion = 1
+	}
+	if r.MaxTokens != nil && *r.MaxTokens > 0 && !opts.ClampMaxTokens {
+		minCompletion = max(minCompletion, *r.MaxTokens)
+	}
+
+	if opts.TruncateHistory {
+		for result.PromptTokens+minCompletion > contextLength {
+			index := oldestDroppableMessage(r.Messages)
+			if index < 0 {
+				break
+			}
+			end := index + 1
+			// Tool results are dropped together with the message that preceded them
+			for end < len(r.Messages)-1 && r.Messages[end].Role == "tool" {
+				end++
+			}
+			r.Messages = append(r.Messages[:index:index], r.Messages[end:]...)
+			result.DroppedMessages += end - index
+			result.PromptTokens = r.EstimatePromptTokens()
+		}
+	}
+
+	if result.PromptTokens+minCompletion > contextLength {
+		return result, fmt.Errorf("%w: model %s has %d tokens, estimated prompt is %d tokens with %d reserved for the completion",
+			ErrContextWindowExceeded, *r.Model, contextLength, result.PromptTokens, minCompletion)
+	}
+
+	if opts.ClampMaxTokens {
+		room := contextLength - result.PromptTokens
+		if maxCompletionTokens > 0 {
+			room = min(room, maxCompletionTokens)
+		}
+		if r.MaxTokens != nil && *r.MaxTokens > room {
+			clamped := room
+			r.MaxTokens = &clamped
+			result.ClampedMaxTokens = true
+		}
+	}
+
+	return result, nil
+}
+
+// oldestDroppableMessage returns the index of the oldest message that may be dropped to save room.
+// System messages and the final message are never dropped, -1 means nothing can be dropped.
+func oldestDroppableMessage(messages []Message) int {
+	for i := 0; i < len(messages)-1; i++ {
+		if messages[i].Role != "system" {
+			return i
+		}
+	}
+	return -1
+}
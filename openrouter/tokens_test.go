@@ -0,0 +1,108 @@
+package openrouter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTokenEstimatorFor(t *testing.T) {
+	if got := EstimateTokens("unknown/model", strings.Repeat("a", 40)); got != 10 {
+		t.Errorf("Expected the character ratio fallback to estimate 10 tokens, got %d", got)
+	}
+	if got := EstimateTokens("anthropic/claude-3.5-sonnet", strings.Repeat("a", 35)); got != 10 {
+		t.Errorf("Expected the anthropic estimator to estimate 10 tokens, got %d", got)
+	}
+
+	RegisterTokenEstimator("openai/gpt-4o", func(text string) int { return 42 })
+	defer RegisterTokenEstimator("openai/gpt-4o", nil)
+
+	if got := EstimateTokens("openai/gpt-4o-mini", "hello"); got != 42 {
+		t.Errorf("Expected the longest matching prefix to win, got %d", got)
+	}
+	if got := EstimateTokens("openai/gpt-3.5-turbo", "abcdefgh"); got != 2 {
+		t.Errorf("Expected the openai family estimator, got %d", got)
+	}
+}
+
+func preflightRequest(model string, contents ...string) *OpenRouterRequest {
+	request := &OpenRouterRequest{Model: &model}
+	request.Messages = append(request.Messages, Message{Role: "system", Content: "be brief"})
+	for _, content := range contents {
+		request.Messages = append(request.Messages, Message{Role: "user", Content: content})
+	}
+	return request
+}
+
+func TestPreflight(t *testing.T) {
+	previous := DefaultModelCatalog.Models()
+	defer DefaultModelCatalog.Set(previous)
+	DefaultModelCatalog.Set([]ModelInfo{{ID: "test/small", ContextLength: 100, MaxCompletionTokens: 50}})
+
+	t.Run("Unknown model is not checked", func(t *testing.T) {
+		request := preflightRequest("test/unknown", strings.Repeat("a", 4000))
+		result, err := request.Preflight(PreflightOptions{})
+		if err != nil || result.Checked {
+			t.Errorf("Expected unknown models to pass unchecked, got %+v %v", result, err)
+		}
+	})
+
+	t.Run("Fails fast when the prompt overflows", func(t *testing.T) {
+		request := preflightRequest("test/small", strings.Repeat("a", 400))
+		_, err := request.Preflight(PreflightOptions{})
+		if !errors.Is(err, ErrContextWindowExceeded) {
+			t.Errorf("Expected ErrContextWindowExceeded, got %v", err)
+		}
+	})
+
+	t.Run("Fails when max tokens do not fit without clamping", func(t *testing.T) {
+		request := preflightRequest("test/small", "hi")
+		maxTokens := 95
+		request.MaxTokens = &maxTokens
+		if _, err := request.Preflight(PreflightOptions{}); !errors.Is(err, ErrContextWindowExceeded) {
+			t.Errorf("Expected ErrContextWindowExceeded, got %v", err)
+		}
+	})
+
+	t.Run("Clamps max tokens", func(t *testing.T) {
+		request := preflightRequest("test/small", "hi")
+		maxTokens := 95
+		request.MaxTokens = &maxTokens
+		result, err := request.Preflight(PreflightOptions{ClampMaxTokens: true})
+		if err != nil {
+			t.Fatalf("Preflight failed: %v", err)
+		}
+		if !result.ClampedMaxTokens || *request.MaxTokens != 50 {
+			t.Errorf("Expected max tokens clamped to the model maximum of 50, got %d", *request.MaxTokens)
+		}
+		if maxTokens != 95 {
+			t.Error("Expected the original max tokens value not to be modified")
+		}
+	})
+
+	t.Run("Truncates the oldest history", func(t *testing.T) {
+		request := preflightRequest("test/small", strings.Repeat("a", 200), strings.Repeat("b", 40), "latest question")
+		original := request.Messages
+		result, err := request.Preflight(PreflightOptions{TruncateHistory: true, MinCompletionTokens: 20})
+		if err != nil {
+			t.Fatalf("Preflight failed: %v", err)
+		}
+		if result.DroppedMessages != 1 || len(request.Messages) != 3 {
+			t.Fatalf("Expected the oldest user message to be dropped, got %d dropped and %d left", result.DroppedMessages, len(request.Messages))
+		}
+		if request.Messages[0].Role != "system" || request.Messages[2].Content != "latest question" {
+			t.Errorf("Expected the system and last message to be kept, got %+v", request.Messages)
+		}
+		if len(original) != 4 || original[1].Content != strings.Repeat("a", 200) {
+			t.Error("Expected the caller's message slice not to be modified")
+		}
+	})
+
+	t.Run("Keeps the last message even if it overflows", func(t *testing.T) {
+		request := preflightRequest("test/small", strings.Repeat("a", 800))
+		result, err := request.Preflight(PreflightOptions{TruncateHistory: true})
+		if !errors.Is(err, ErrContextWindowExceeded) || len(request.Messages) != 2 || result.DroppedMessages != 0 {
+			t.Errorf("Expected an error without dropping the last message, got %v with %d messages", err, len(request.Messages))
+		}
+	})
+}
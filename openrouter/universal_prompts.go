@@ -11,19 +11,22 @@ import (
 // valid JSON output matching the provided schema, even without structured output support
 func GenerateUniversalSystemPrompt(schema map[string]interface{}, inputExample, outputExample json.RawMessage) string {
 	schemaStr := FormatSchemaForPrompt(schema)
+
+	// Goals defined by an explicit schema may come without examples
+	var examples strings.Builder
+	if len(inputExample) > 0 {
+		examples.WriteString("INPUT EXAMPLE:\n" + string(inputExample) + "\n\n")
+	}
+	if len(outputExample) > 0 {
+		examples.WriteString("EXPECTED OUTPUT EXAMPLE:\n" + string(outputExample) + "\n\n")
+	}
 	
 	return fmt.Sprintf(`You are a precise JSON response generator. You must respond with valid JSON that exactly matches the provided schema.
 
 SCHEMA REQUIREMENTS:
 %s
 
-INPUT EXAMPLE:
-%s
-
-EXPECTED OUTPUT EXAMPLE:
-%s
-
-CRITICAL INSTRUCTIONS:
+%sCRITICAL INSTRUCTIONS:
 1. Your response must be valid JSON only - no explanations, no markdown, no code blocks
 2. Follow the schema exactly - all required fields must be present
 3. Use the correct data types as specified in the schema
@@ -31,7 +34,7 @@ CRITICAL INSTRUCTIONS:
 5. If uncertain about a value, use reasonable defaults that match the expected type
 6. Do not include any text before or after the JSON response
 
-Respond with JSON only:`, schemaStr, string(inputExample), string(outputExample))
+Respond with JSON only:`, schemaStr, examples.String())
 }
 
 // MergeSystemPrompts implements the collision strategy for combining existing system prompts